@@ -250,14 +250,15 @@ func (eis *EnhancedIntelligenceServer) aiSuggestionsHandler(c *fiber.Ctx) error
 }
 
 func (eis *EnhancedIntelligenceServer) analyzeFileHandler(c *fiber.Ctx) error {
-	filePath := c.Params("path")
-	if filePath == "" {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "File path is required",
+	file, err := eis.pi.resolveWorkspaceFile(c.Params("path"))
+	if err != nil {
+		return c.Status(fileStatus(err)).JSON(fiber.Map{
+			"error":   "File not available",
+			"details": err.Error(),
 		})
 	}
 	
-	result, err := eis.aiAnalysisManager.AnalyzeFile(filePath)
+	result, err := eis.aiAnalysisManager.AnalyzeFile(file.FullPath)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": fmt.Sprintf("Analysis failed: %v", err),
@@ -0,0 +1,674 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// AlertConfig defines when Argus notifies someone and through which sinks
+type AlertConfig struct {
+	Rules       []AlertRule `json:"rules"`
+	Sinks       []AlertSink `json:"sinks"`
+	QuietHours  *QuietHours `json:"quiet_hours,omitempty"`
+	DedupWindow string      `json:"dedup_window,omitempty"` // default cooldown of a rule, 10m when empty
+}
+
+// AlertRule fires an alert for one kind of event
+type AlertRule struct {
+	Name             string   `json:"name"`
+	Kind             string   `json:"kind"`                // error_rate, new_error, process_crash, health_below, build_failure
+	Process          string   `json:"process,omitempty"`   // process name, ID or command; empty for all
+	Threshold        float64  `json:"threshold,omitempty"` // errors per minute for error_rate, score for health_below
+	Window           string   `json:"window,omitempty"`    // error_rate window, 1m when empty
+	Severity         string   `json:"severity,omitempty"`  // least severe error counted, error when empty
+	Types            []string `json:"types,omitempty"`     // error types counted; empty for all
+	Sinks            []string `json:"sinks,omitempty"`     // sink names; empty for all sinks
+	Cooldown         string   `json:"cooldown,omitempty"`  // overrides dedup_window
+	IgnoreQuietHours bool     `json:"ignore_quiet_hours,omitempty"`
+}
+
+// AlertSink delivers alerts to a webhook, a local command or a log file
+type AlertSink struct {
+	Name     string            `json:"name"`
+	Type     string            `json:"type"` // webhook, command, log
+	URL      string            `json:"url,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	Format   string            `json:"format,omitempty"`   // generic, slack, teams
+	Template string            `json:"template,omitempty"` // text/template producing the JSON body
+	Command  string            `json:"command,omitempty"`
+	Args     []string          `json:"args,omitempty"`
+	Timeout  string            `json:"timeout,omitempty"`
+	Path     string            `json:"path,omitempty"` // log file, relative to the workspace
+}
+
+// QuietHours holds back alerts during a daily time range in local time
+type QuietHours struct {
+	Start string `json:"start"` // 22:00
+	End   string `json:"end"`   // 07:00
+}
+
+// Alert is a fired alert rule
+type Alert struct {
+	ID          string    `json:"id"`
+	Rule        string    `json:"rule"`
+	Kind        string    `json:"kind"`
+	Severity    string    `json:"severity"` // critical, error, warning
+	Title       string    `json:"title"`
+	Message     string    `json:"message"`
+	ProcessID   string    `json:"process_id,omitempty"`
+	Process     string    `json:"process,omitempty"`
+	Value       float64   `json:"value,omitempty"`
+	Threshold   float64   `json:"threshold,omitempty"`
+	Fingerprint string    `json:"fingerprint,omitempty"`
+	Suppressed  int       `json:"suppressed,omitempty"` // duplicates held back since the last delivery
+	Quiet       bool      `json:"quiet,omitempty"`      // fired during quiet hours and not delivered
+	Sinks       []string  `json:"sinks,omitempty"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// maxAlertHistory bounds the fired alerts kept for /alerts
+const maxAlertHistory = 200
+
+// maxAlertFingerprints bounds the error fingerprints remembered for new_error rules
+const maxAlertFingerprints = 10000
+
+// alertTemplates are the webhook bodies of the built-in formats
+var alertTemplates = map[string]string{
+	"slack": `{"text": {{json (printf "*%s*\n%s" .Title .Message)}}}`,
+	"teams": `{"@type": "MessageCard", "@context": "http://schema.org/extensions", "themeColor": {{json (color .Severity)}}, ` +
+		`"summary": {{json .Title}}, "title": {{json .Title}}, "text": {{json .Message}}}`,
+}
+
+var alertTemplateFuncs = template.FuncMap{
+	"json": func(value interface{}) (string, error) {
+		data, err := json.Marshal(value)
+		return string(data), err
+	},
+	"color": func(severity string) string {
+		switch severity {
+		case "critical", "error":
+			return "D13438"
+		case "warning":
+			return "FFB900"
+		}
+		return "0078D7"
+	},
+}
+
+// alertRule is a validated rule with its durations parsed
+type alertRule struct {
+	AlertRule
+	window   time.Duration
+	cooldown time.Duration
+}
+
+// alertSink is a validated sink
+type alertSink struct {
+	AlertSink
+	template *template.Template
+	timeout  time.Duration
+}
+
+// AlertManager evaluates alert rules against errors, exits, health and
+// builds, and delivers fired alerts in the background
+type AlertManager struct {
+	workspace  string
+	rules      []*alertRule
+	sinks      map[string]*alertSink
+	quietStart int // minutes after midnight, -1 without quiet hours
+	quietEnd   int
+
+	lastFired    map[string]time.Time // by rule and subject
+	suppressed   map[string]int
+	rates        map[string][]time.Time // error_rate occurrences by rule and process
+	fingerprints map[string]bool
+	history      []Alert
+	deliveries   chan Alert
+	client       *http.Client
+	mutex        sync.Mutex
+}
+
+// NewAlertManager validates the alert configuration; invalid rules and
+// sinks are logged and skipped
+func NewAlertManager(workspace string, config AlertConfig) *AlertManager {
+	am := &AlertManager{
+		workspace:    workspace,
+		sinks:        make(map[string]*alertSink),
+		quietStart:   -1,
+		lastFired:    make(map[string]time.Time),
+		suppressed:   make(map[string]int),
+		rates:        make(map[string][]time.Time),
+		fingerprints: make(map[string]bool),
+		deliveries:   make(chan Alert, 100),
+		client:       &http.Client{Timeout: 10 * time.Second},
+	}
+
+	dedup := 10 * time.Minute
+	if config.DedupWindow != "" {
+		if parsed, err := time.ParseDuration(config.DedupWindow); err == nil {
+			dedup = parsed
+		} else {
+			log.Printf("Invalid alert dedup_window %q, using %v", config.DedupWindow, dedup)
+		}
+	}
+
+	for _, sink := range config.Sinks {
+		compiled, err := compileAlertSink(sink)
+		if err != nil {
+			log.Printf("Skipping alert sink %q: %v", sink.Name, err)
+			continue
+		}
+		am.sinks[sink.Name] = compiled
+	}
+
+	for _, rule := range config.Rules {
+		compiled, err := compileAlertRule(rule, dedup)
+		if err != nil {
+			log.Printf("Skipping alert rule %q: %v", rule.Name, err)
+			continue
+		}
+		am.rules = append(am.rules, compiled)
+	}
+
+	if config.QuietHours != nil {
+		start, startErr := parseClock(config.QuietHours.Start)
+		end, endErr := parseClock(config.QuietHours.End)
+		if startErr != nil || endErr != nil {
+			log.Printf("Ignoring invalid alert quiet hours %s-%s", config.QuietHours.Start, config.QuietHours.End)
+		} else {
+			am.quietStart, am.quietEnd = start, end
+		}
+	}
+
+	return am
+}
+
+func compileAlertRule(rule AlertRule, dedup time.Duration) (*alertRule, error) {
+	if rule.Name == "" {
+		return nil, errors.New("rule needs a name")
+	}
+
+	compiled := &alertRule{AlertRule: rule, window: time.Minute, cooldown: dedup}
+	switch rule.Kind {
+	case "error_rate", "health_below":
+		if rule.Threshold <= 0 {
+			return nil, fmt.Errorf("%s rule needs a positive threshold", rule.Kind)
+		}
+	case "new_error", "process_crash", "build_failure":
+	default:
+		return nil, fmt.Errorf("unknown rule kind %q", rule.Kind)
+	}
+
+	if compiled.Severity == "" {
+		compiled.Severity = "error"
+	}
+	if severityRank(compiled.Severity) == 0 {
+		return nil, fmt.Errorf("unknown severity %q", rule.Severity)
+	}
+
+	var err error
+	if rule.Window != "" {
+		if compiled.window, err = time.ParseDuration(rule.Window); err != nil || compiled.window <= 0 {
+			return nil, fmt.Errorf("invalid window %q", rule.Window)
+		}
+	}
+	if rule.Cooldown != "" {
+		if compiled.cooldown, err = time.ParseDuration(rule.Cooldown); err != nil || compiled.cooldown < 0 {
+			return nil, fmt.Errorf("invalid cooldown %q", rule.Cooldown)
+		}
+	}
+
+	return compiled, nil
+}
+
+func compileAlertSink(sink AlertSink) (*alertSink, error) {
+	if sink.Name == "" {
+		return nil, errors.New("sink needs a name")
+	}
+
+	compiled := &alertSink{AlertSink: sink, timeout: 30 * time.Second}
+	if sink.Timeout != "" {
+		timeout, err := time.ParseDuration(sink.Timeout)
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("invalid timeout %q", sink.Timeout)
+		}
+		compiled.timeout = timeout
+	}
+
+	switch sink.Type {
+	case "webhook":
+		if sink.URL == "" {
+			return nil, errors.New("webhook sink needs a url")
+		}
+		text := sink.Template
+		if text == "" {
+			text = alertTemplates[sink.Format]
+		}
+		if text == "" && sink.Format != "" && sink.Format != "generic" {
+			return nil, fmt.Errorf("unknown webhook format %q", sink.Format)
+		}
+		if text != "" {
+			parsed, err := template.New(sink.Name).Funcs(alertTemplateFuncs).Parse(text)
+			if err != nil {
+				return nil, fmt.Errorf("invalid template: %w", err)
+			}
+			compiled.template = parsed
+		}
+	case "command":
+		if sink.Command == "" {
+			return nil, errors.New("command sink needs a command")
+		}
+	case "log":
+		if sink.Path == "" {
+			compiled.Path = filepath.Join(".argus", "alerts.jsonl")
+		}
+	default:
+		return nil, fmt.Errorf("unknown sink type %q", sink.Type)
+	}
+
+	return compiled, nil
+}
+
+// parseClock parses "HH:MM" into minutes after midnight
+func parseClock(value string) (int, error) {
+	parsed, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, err
+	}
+	return parsed.Hour()*60 + parsed.Minute(), nil
+}
+
+// severityRank orders severities; unknown severities rank zero
+func severityRank(severity string) int {
+	switch severity {
+	case "info":
+		return 1
+	case "warning":
+		return 2
+	case "error":
+		return 3
+	case "critical":
+		return 4
+	}
+	return 0
+}
+
+// inQuietHours reports whether alerts are currently held back
+func (am *AlertManager) inQuietHours(now time.Time) bool {
+	if am.quietStart < 0 {
+		return false
+	}
+	minute := now.Hour()*60 + now.Minute()
+	if am.quietStart <= am.quietEnd {
+		return minute >= am.quietStart && minute < am.quietEnd
+	}
+	return minute >= am.quietStart || minute < am.quietEnd // Spans midnight
+}
+
+// matchesProcess reports whether a rule applies to a process
+func (rule *alertRule) matchesProcess(processID, name, command string) bool {
+	return rule.Process == "" || rule.Process == processID || rule.Process == name || rule.Process == command
+}
+
+// counts reports whether an error is one a rule counts
+func (rule *alertRule) counts(streamError StreamError) bool {
+	if severityRank(streamError.Severity) < severityRank(rule.Severity) {
+		return false
+	}
+	return len(rule.Types) == 0 || containsString(rule.Types, streamError.ErrorType)
+}
+
+// ObserveError evaluates error_rate and new_error rules
+func (am *AlertManager) ObserveError(streamError StreamError, name string) {
+	if am == nil {
+		return
+	}
+
+	am.mutex.Lock()
+	defer am.mutex.Unlock()
+
+	now := time.Now()
+	for _, rule := range am.rules {
+		if !rule.matchesProcess(streamError.ProcessID, name, streamError.Command) || !rule.counts(streamError) {
+			continue
+		}
+
+		switch rule.Kind {
+		case "error_rate":
+			key := rule.Name + "|" + streamError.ProcessID
+			cutoff := now.Add(-rule.window)
+			times := am.rates[key]
+			for len(times) > 0 && times[0].Before(cutoff) {
+				times = times[1:]
+			}
+			// A coalesced error stands for all of its repeats
+			for i := 0; i <= streamError.Repeats; i++ {
+				times = append(times, now)
+			}
+			am.rates[key] = times
+
+			rate := float64(len(times)) / rule.window.Minutes()
+			if rate > rule.Threshold {
+				am.fire(rule, streamError.ProcessID, Alert{
+					Severity:  streamError.Severity,
+					Title:     fmt.Sprintf("High error rate in %s", processLabel(name, streamError.Command)),
+					Message:   fmt.Sprintf("%.1f errors per minute over %v (threshold %.1f). Latest: %s", rate, rule.window, rule.Threshold, streamError.Message),
+					ProcessID: streamError.ProcessID,
+					Process:   processLabel(name, streamError.Command),
+					Value:     rate,
+					Threshold: rule.Threshold,
+				})
+			}
+
+		case "new_error":
+			fingerprint := errorFingerprint(streamError)
+			key := rule.Name + "|" + fingerprint
+			if am.fingerprints[key] {
+				continue
+			}
+			if len(am.fingerprints) >= maxAlertFingerprints {
+				am.fingerprints = make(map[string]bool)
+			}
+			am.fingerprints[key] = true
+
+			location := ""
+			if streamError.File != "" {
+				location = fmt.Sprintf(" at %s:%d", streamError.File, streamError.Line)
+			}
+			am.fire(rule, fingerprint, Alert{
+				Severity:    streamError.Severity,
+				Title:       fmt.Sprintf("New %s error in %s", streamError.ErrorType, processLabel(name, streamError.Command)),
+				Message:     streamError.Message + location,
+				ProcessID:   streamError.ProcessID,
+				Process:     processLabel(name, streamError.Command),
+				Fingerprint: fingerprint,
+			})
+		}
+	}
+}
+
+// ObserveExit evaluates process_crash rules for a run that exited on its own
+func (am *AlertManager) ObserveExit(process *MonitoredProcess, exitCode int, status string) {
+	if am == nil {
+		return
+	}
+
+	am.mutex.Lock()
+	defer am.mutex.Unlock()
+
+	label := processLabel(process.Name, process.Command)
+	for _, rule := range am.rules {
+		if rule.Kind != "process_crash" || !rule.matchesProcess(process.ID, process.Name, process.Command) {
+			continue
+		}
+		am.fire(rule, process.ID, Alert{
+			Severity:  "critical",
+			Title:     fmt.Sprintf("%s crashed", label),
+			Message:   fmt.Sprintf("%s (PID %d) exited with code %d, status %s", label, process.PID, exitCode, status),
+			ProcessID: process.ID,
+			Process:   label,
+			Value:     float64(exitCode),
+		})
+	}
+}
+
+// ObserveHealth evaluates health_below rules
+func (am *AlertManager) ObserveHealth(health ProjectHealth) {
+	if am == nil {
+		return
+	}
+
+	am.mutex.Lock()
+	defer am.mutex.Unlock()
+
+	for _, rule := range am.rules {
+		if rule.Kind != "health_below" || float64(health.Score) >= rule.Threshold {
+			continue
+		}
+		am.fire(rule, "project", Alert{
+			Severity:  "warning",
+			Title:     fmt.Sprintf("Project health is %d", health.Score),
+			Message:   fmt.Sprintf("Health score %d is below %.0f with %d errors and %d warnings", health.Score, rule.Threshold, health.ErrorCount, health.WarningCount),
+			Value:     float64(health.Score),
+			Threshold: rule.Threshold,
+		})
+	}
+}
+
+// ObserveBuild evaluates build_failure rules
+func (am *AlertManager) ObserveBuild(record BuildRecord) {
+	if am == nil || record.Success {
+		return
+	}
+
+	am.mutex.Lock()
+	defer am.mutex.Unlock()
+
+	for _, rule := range am.rules {
+		if rule.Kind != "build_failure" {
+			continue
+		}
+		am.fire(rule, "build", Alert{
+			Severity: "error",
+			Title:    "Build failed",
+			Message:  fmt.Sprintf("%s exited with code %d and %d errors (%s, commit %s)", record.Command, record.ExitCode, record.ErrorCount, record.Trigger, record.Commit),
+			Value:    float64(record.ErrorCount),
+		})
+	}
+}
+
+// fire records an alert and queues it for delivery unless a duplicate was
+// delivered within the rule's cooldown or quiet hours hold it back. The
+// caller holds the lock.
+func (am *AlertManager) fire(rule *alertRule, subject string, alert Alert) {
+	now := time.Now()
+	key := rule.Name + "|" + subject
+	if last, exists := am.lastFired[key]; exists && now.Sub(last) < rule.cooldown {
+		am.suppressed[key]++
+		return
+	}
+
+	alert.ID = fmt.Sprintf("alert_%d", now.UnixNano())
+	alert.Rule = rule.Name
+	alert.Kind = rule.Kind
+	alert.Timestamp = now
+	alert.Sinks = am.ruleSinks(rule)
+	alert.Quiet = am.inQuietHours(now) && !rule.IgnoreQuietHours
+
+	if !alert.Quiet {
+		alert.Suppressed = am.suppressed[key]
+		delete(am.suppressed, key)
+		am.lastFired[key] = now
+
+		select {
+		case am.deliveries <- alert:
+		default:
+			log.Printf("Alert queue full, not delivering %s", alert.ID)
+		}
+	}
+
+	am.history = append(am.history, alert)
+	if len(am.history) > maxAlertHistory {
+		am.history = am.history[len(am.history)-maxAlertHistory:]
+	}
+
+	log.Printf("Alert %s [%s]: %s (quiet=%t)", rule.Name, alert.Severity, alert.Title, alert.Quiet)
+}
+
+func (am *AlertManager) ruleSinks(rule *alertRule) []string {
+	if len(rule.Sinks) > 0 {
+		return rule.Sinks
+	}
+	names := make([]string, 0, len(am.sinks))
+	for name := range am.sinks {
+		names = append(names, name)
+	}
+	return names
+}
+
+func processLabel(name, command string) string {
+	if name != "" {
+		return name
+	}
+	return command
+}
+
+// deliverAlerts sends queued alerts to their sinks until ctx is done
+func (am *AlertManager) deliverAlerts(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case alert := <-am.deliveries:
+			for _, name := range alert.Sinks {
+				sink, exists := am.sinks[name]
+				if !exists {
+					log.Printf("Alert %s names unknown sink %q", alert.ID, name)
+					continue
+				}
+				if err := am.deliver(ctx, sink, alert); err != nil {
+					log.Printf("Failed to deliver alert %s to %s: %v", alert.ID, name, err)
+				}
+			}
+		}
+	}
+}
+
+// deliver sends one alert through one sink
+func (am *AlertManager) deliver(ctx context.Context, sink *alertSink, alert Alert) error {
+	ctx, cancel := context.WithTimeout(ctx, sink.timeout)
+	defer cancel()
+
+	switch sink.Type {
+	case "webhook":
+		body, err := renderAlert(sink, alert)
+		if err != nil {
+			return err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, sink.URL, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		for header, value := range sink.Headers {
+			req.Header.Set(header, value)
+		}
+
+		resp, err := am.client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+		}
+		return nil
+
+	case "command":
+		payload, err := json.Marshal(alert)
+		if err != nil {
+			return err
+		}
+
+		cmd := exec.CommandContext(ctx, sink.Command, sink.Args...)
+		cmd.Dir = am.workspace
+		cmd.Stdin = bytes.NewReader(payload)
+		cmd.Env = append(os.Environ(),
+			"ARGUS_ALERT_RULE="+alert.Rule,
+			"ARGUS_ALERT_KIND="+alert.Kind,
+			"ARGUS_ALERT_SEVERITY="+alert.Severity,
+			"ARGUS_ALERT_TITLE="+alert.Title,
+			"ARGUS_ALERT_MESSAGE="+alert.Message,
+			"ARGUS_ALERT_PROCESS="+alert.Process,
+		)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(output)))
+		}
+		return nil
+
+	case "log":
+		path := sink.Path
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(am.workspace, path)
+		}
+		return appendJSONLine(path, alert)
+	}
+
+	return fmt.Errorf("unknown sink type %q", sink.Type)
+}
+
+// renderAlert builds a webhook body: the alert itself, or its template's output
+func renderAlert(sink *alertSink, alert Alert) ([]byte, error) {
+	if sink.template == nil {
+		return json.Marshal(alert)
+	}
+
+	var body bytes.Buffer
+	if err := sink.template.Execute(&body, alert); err != nil {
+		return nil, fmt.Errorf("template failed: %w", err)
+	}
+	if !json.Valid(body.Bytes()) {
+		return nil, errors.New("template did not produce valid JSON")
+	}
+	return body.Bytes(), nil
+}
+
+// Alerts returns the most recent fired alerts, newest last
+func (am *AlertManager) Alerts(limit int) []Alert {
+	am.mutex.Lock()
+	defer am.mutex.Unlock()
+
+	start := 0
+	if limit > 0 && len(am.history) > limit {
+		start = len(am.history) - limit
+	}
+	return append([]Alert{}, am.history[start:]...)
+}
+
+// Rules returns the active alert rules
+func (am *AlertManager) Rules() []AlertRule {
+	rules := make([]AlertRule, 0, len(am.rules))
+	for _, rule := range am.rules {
+		rules = append(rules, rule.AlertRule)
+	}
+	return rules
+}
+
+// SendTest delivers a test alert to one sink, or to all when name is empty
+func (am *AlertManager) SendTest(ctx context.Context, name string) map[string]string {
+	alert := Alert{
+		ID:        fmt.Sprintf("alert_%d", time.Now().UnixNano()),
+		Rule:      "test",
+		Kind:      "test",
+		Severity:  "warning",
+		Title:     "Argus test alert",
+		Message:   "This is a test alert from Project Argus",
+		Timestamp: time.Now(),
+	}
+
+	results := make(map[string]string)
+	for sinkName, sink := range am.sinks {
+		if name != "" && sinkName != name {
+			continue
+		}
+		if err := am.deliver(ctx, sink, alert); err != nil {
+			results[sinkName] = err.Error()
+		} else {
+			results[sinkName] = "delivered"
+		}
+	}
+	return results
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// deliveredAlerts drains the alerts queued for delivery
+func deliveredAlerts(am *AlertManager) []Alert {
+	var alerts []Alert
+	for {
+		select {
+		case alert := <-am.deliveries:
+			alerts = append(alerts, alert)
+		default:
+			return alerts
+		}
+	}
+}
+
+func TestInQuietHours(t *testing.T) {
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)
+	at := func(hour, minute int) time.Time {
+		return day.Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute)
+	}
+
+	tests := []struct {
+		name     string
+		quiet    *QuietHours
+		now      time.Time
+		quietNow bool
+	}{
+		{"none", nil, at(23, 0), false},
+		{"overnight, evening", &QuietHours{Start: "22:00", End: "07:00"}, at(23, 30), true},
+		{"overnight, at start", &QuietHours{Start: "22:00", End: "07:00"}, at(22, 0), true},
+		{"overnight, after midnight", &QuietHours{Start: "22:00", End: "07:00"}, at(0, 15), true},
+		{"overnight, morning", &QuietHours{Start: "22:00", End: "07:00"}, at(6, 59), true},
+		{"overnight, at end", &QuietHours{Start: "22:00", End: "07:00"}, at(7, 0), false},
+		{"overnight, daytime", &QuietHours{Start: "22:00", End: "07:00"}, at(12, 0), false},
+		{"daytime, inside", &QuietHours{Start: "09:00", End: "17:30"}, at(17, 29), true},
+		{"daytime, outside", &QuietHours{Start: "09:00", End: "17:30"}, at(17, 30), false},
+		{"daytime, before", &QuietHours{Start: "09:00", End: "17:30"}, at(8, 59), false},
+		{"empty range", &QuietHours{Start: "09:00", End: "09:00"}, at(9, 0), false},
+		{"invalid", &QuietHours{Start: "25:00", End: "07:00"}, at(23, 0), false},
+	}
+
+	for _, tt := range tests {
+		am := NewAlertManager(t.TempDir(), AlertConfig{QuietHours: tt.quiet})
+		if got := am.inQuietHours(tt.now); got != tt.quietNow {
+			t.Errorf("%s: inQuietHours(%s) = %t, want %t", tt.name, tt.now.Format("15:04"), got, tt.quietNow)
+		}
+	}
+}
+
+func TestAlertDedup(t *testing.T) {
+	am := NewAlertManager(t.TempDir(), AlertConfig{
+		Rules: []AlertRule{{Name: "crash", Kind: "process_crash", Cooldown: "1h"}},
+	})
+	web := &MonitoredProcess{ID: "p-1", Name: "web", Command: "node"}
+	worker := &MonitoredProcess{ID: "p-2", Name: "worker", Command: "node"}
+
+	am.ObserveExit(web, 1, "error")
+	am.ObserveExit(web, 1, "error")
+	am.ObserveExit(web, 2, "error")
+	am.ObserveExit(worker, 1, "error") // another subject is not a duplicate
+
+	delivered := deliveredAlerts(am)
+	if len(delivered) != 2 || delivered[0].ProcessID != "p-1" || delivered[1].ProcessID != "p-2" {
+		t.Fatalf("delivered %+v, want one alert per process", delivered)
+	}
+	if len(am.Alerts(0)) != 2 {
+		t.Errorf("history holds %d alerts, want duplicates left out", len(am.Alerts(0)))
+	}
+
+	// Once the cooldown has passed the next alert reports the duplicates held back
+	am.lastFired["crash|p-1"] = time.Now().Add(-2 * time.Hour)
+	am.ObserveExit(web, 1, "error")
+	delivered = deliveredAlerts(am)
+	if len(delivered) != 1 || delivered[0].Suppressed != 2 {
+		t.Fatalf("delivered %+v after the cooldown, want one alert with 2 suppressed", delivered)
+	}
+	am.lastFired["crash|p-1"] = time.Now().Add(-2 * time.Hour)
+	am.ObserveExit(web, 1, "error")
+	if delivered = deliveredAlerts(am); len(delivered) != 1 || delivered[0].Suppressed != 0 {
+		t.Errorf("suppressed count not reset after delivery: %+v", delivered)
+	}
+}
+
+func TestAlertNewErrorFingerprints(t *testing.T) {
+	am := NewAlertManager(t.TempDir(), AlertConfig{
+		Rules: []AlertRule{{Name: "new", Kind: "new_error", Cooldown: "0s"}},
+	})
+	streamError := StreamError{ProcessID: "p-1", ErrorType: "runtime", Severity: "error", Message: "timeout after 30s"}
+
+	am.ObserveError(streamError, "web")
+	streamError.Message = "timeout after 45s" // differs only in numbers
+	am.ObserveError(streamError, "web")
+	streamError.Message = "connection reset"
+	am.ObserveError(streamError, "web")
+	streamError.Severity = "warning" // below the rule's severity
+	streamError.Message = "slow query"
+	am.ObserveError(streamError, "web")
+
+	if delivered := deliveredAlerts(am); len(delivered) != 2 {
+		t.Errorf("delivered %d alerts, want one per new fingerprint", len(delivered))
+	}
+}
+
+func TestAlertErrorRate(t *testing.T) {
+	am := NewAlertManager(t.TempDir(), AlertConfig{
+		Rules: []AlertRule{{Name: "rate", Kind: "error_rate", Threshold: 2, Process: "web"}},
+	})
+	streamError := StreamError{ProcessID: "p-1", Severity: "error", Message: "boom"}
+
+	am.ObserveError(streamError, "web")
+	am.ObserveError(streamError, "web")
+	am.ObserveError(streamError, "api") // another process does not count
+	if delivered := deliveredAlerts(am); len(delivered) != 0 {
+		t.Fatalf("fired at the threshold: %+v", delivered)
+	}
+
+	// A coalesced error counts its repeats
+	streamError.Repeats = 1
+	am.ObserveError(streamError, "web")
+	delivered := deliveredAlerts(am)
+	if len(delivered) != 1 || delivered[0].Value != 4 {
+		t.Errorf("delivered %+v, want one alert at 4 errors per minute", delivered)
+	}
+}
+
+func TestAlertQuietHours(t *testing.T) {
+	am := NewAlertManager(t.TempDir(), AlertConfig{
+		Rules: []AlertRule{
+			{Name: "crash", Kind: "process_crash", Process: "web"},
+			{Name: "urgent", Kind: "process_crash", Process: "db", IgnoreQuietHours: true},
+		},
+	})
+	am.quietStart, am.quietEnd = 0, 24*60 // all day
+
+	web := &MonitoredProcess{ID: "p-1", Name: "web"}
+	am.ObserveExit(web, 1, "error")
+	am.ObserveExit(&MonitoredProcess{ID: "p-2", Name: "db"}, 1, "error")
+
+	delivered := deliveredAlerts(am)
+	if len(delivered) != 1 || delivered[0].Rule != "urgent" {
+		t.Fatalf("delivered %+v during quiet hours, want only the rule ignoring them", delivered)
+	}
+	history := am.Alerts(0)
+	if len(history) != 2 || !history[0].Quiet {
+		t.Errorf("history = %+v, want the held back alert recorded as quiet", history)
+	}
+
+	// A held back alert does not start the cooldown, so it is delivered once quiet hours end
+	am.quietStart = -1
+	am.ObserveExit(web, 1, "error")
+	if delivered := deliveredAlerts(am); len(delivered) != 1 || delivered[0].Quiet {
+		t.Errorf("delivered %+v after quiet hours, want the alert", delivered)
+	}
+}
+
+func TestCompileAlertRule(t *testing.T) {
+	tests := []struct {
+		rule  AlertRule
+		valid bool
+	}{
+		{AlertRule{Name: "rate", Kind: "error_rate", Threshold: 5, Window: "5m"}, true},
+		{AlertRule{Name: "rate", Kind: "error_rate"}, false},
+		{AlertRule{Name: "health", Kind: "health_below", Threshold: 60}, true},
+		{AlertRule{Name: "crash", Kind: "process_crash", Cooldown: "0s"}, true},
+		{AlertRule{Kind: "process_crash"}, false},
+		{AlertRule{Name: "x", Kind: "disk_full"}, false},
+		{AlertRule{Name: "x", Kind: "new_error", Severity: "fatal"}, false},
+		{AlertRule{Name: "x", Kind: "error_rate", Threshold: 1, Window: "0s"}, false},
+		{AlertRule{Name: "x", Kind: "build_failure", Cooldown: "-1m"}, false},
+	}
+
+	for _, tt := range tests {
+		_, err := compileAlertRule(tt.rule, time.Minute)
+		if (err == nil) != tt.valid {
+			t.Errorf("compileAlertRule(%+v) = %v, want valid %t", tt.rule, err, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ArtifactInfo describes a single build output file
+type ArtifactInfo struct {
+	Path      string           `json:"path"` // relative to the workspace
+	Key       string           `json:"key"`  // path with content hashes stripped
+	Kind      string           `json:"kind"` // chunk, binary, asset
+	SizeBytes int64            `json:"size_bytes"`
+	Packages  map[string]int64 `json:"packages,omitempty"` // symbol size per package
+}
+
+// ArtifactSnapshot holds the artifacts produced by one build
+type ArtifactSnapshot struct {
+	BuildID    string         `json:"build_id"`
+	Timestamp  time.Time      `json:"timestamp"`
+	OutputDirs []string       `json:"output_dirs"`
+	Artifacts  []ArtifactInfo `json:"artifacts"`
+	TotalBytes int64          `json:"total_bytes"`
+}
+
+// ArtifactDiff compares an artifact between two builds
+type ArtifactDiff struct {
+	Key           string  `json:"key"`
+	Kind          string  `json:"kind"`
+	Status        string  `json:"status"` // added, removed, changed, unchanged
+	PreviousBytes int64   `json:"previous_bytes"`
+	CurrentBytes  int64   `json:"current_bytes"`
+	DeltaBytes    int64   `json:"delta_bytes"`
+	DeltaPercent  float64 `json:"delta_percent"`
+	Regression    bool    `json:"regression"`
+}
+
+// ArtifactTracker records output sizes per build and flags size regressions
+type ArtifactTracker struct {
+	workspace    string
+	snapshots    []ArtifactSnapshot
+	maxSnapshots int
+	threshold    float64 // percent growth that counts as a regression
+	storePath    string
+	mutex        sync.RWMutex
+}
+
+// contentHashPattern matches bundler content hashes such as index-4f3a9c1b.js
+// or main.4f3a9c1b.chunk.js.map: a hex segment of at least eight digits right
+// before the extension, where a source map suffix belongs to the extension
+var contentHashPattern = regexp.MustCompile(`[.-](?:[0-9a-f]{8,}|[0-9A-F]{8,})((?:\.chunk)?\.(?:m?js|cjs|css|wasm)(?:\.map)?)$`)
+
+// goBuildOutputDir is where Go builds write their binaries, so each build's
+// binary sizes can be measured; it is emptied before every build
+const goBuildOutputDir = ".argus/builds/bin"
+
+// artifactKey identifies an artifact across builds by stripping its content hash
+func artifactKey(relPath string) string {
+	return contentHashPattern.ReplaceAllString(relPath, "$1")
+}
+
+// NewArtifactTracker creates an artifact tracker for the workspace
+func NewArtifactTracker(workspace string, threshold float64) *ArtifactTracker {
+	at := &ArtifactTracker{
+		workspace:    workspace,
+		snapshots:    []ArtifactSnapshot{},
+		maxSnapshots: 100,
+		threshold:    threshold,
+		storePath:    filepath.Join(workspace, ".argus", "builds", "artifacts.jsonl"),
+	}
+
+	at.load()
+	return at
+}
+
+// load restores previously recorded artifact snapshots
+func (at *ArtifactTracker) load() {
+	file, err := os.Open(at.storePath)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var snapshot ArtifactSnapshot
+		if err := json.Unmarshal(scanner.Bytes(), &snapshot); err == nil {
+			at.snapshots = append(at.snapshots, snapshot)
+		}
+	}
+
+	if len(at.snapshots) > at.maxSnapshots {
+		at.snapshots = at.snapshots[len(at.snapshots)-at.maxSnapshots:]
+	}
+}
+
+// Record scans the build output directories and stores the result for a build
+func (at *ArtifactTracker) Record(buildID string) *ArtifactSnapshot {
+	snapshot := ArtifactSnapshot{
+		BuildID:    buildID,
+		Timestamp:  time.Now(),
+		OutputDirs: []string{},
+		Artifacts:  []ArtifactInfo{},
+	}
+
+	for _, dir := range at.outputDirs() {
+		artifacts := at.scanOutputDir(dir)
+		if len(artifacts) == 0 {
+			continue
+		}
+
+		snapshot.OutputDirs = append(snapshot.OutputDirs, dir)
+		for _, artifact := range artifacts {
+			snapshot.TotalBytes += artifact.SizeBytes
+		}
+		snapshot.Artifacts = append(snapshot.Artifacts, artifacts...)
+	}
+
+	if len(snapshot.Artifacts) == 0 {
+		return nil
+	}
+	disambiguateKeys(snapshot.Artifacts)
+
+	at.mutex.Lock()
+	at.snapshots = append(at.snapshots, snapshot)
+	if len(at.snapshots) > at.maxSnapshots {
+		at.snapshots = at.snapshots[len(at.snapshots)-at.maxSnapshots:]
+	}
+	at.mutex.Unlock()
+
+	if err := appendJSONLine(at.storePath, snapshot); err != nil {
+		log.Printf("Failed to persist artifact sizes for build %s: %v", buildID, err)
+	}
+
+	return &snapshot
+}
+
+// outputDirs returns the existing output directories of the detected build tools
+func (at *ArtifactTracker) outputDirs() []string {
+	seen := make(map[string]bool)
+	dirs := []string{}
+
+	candidates := []string{}
+	for _, tool := range detectBuildTools(at.workspace) {
+		candidates = append(candidates, tool.OutputDir)
+	}
+	candidates = append(candidates, goBuildOutputDir, "dist", "build", "target", "bin")
+
+	for _, dir := range candidates {
+		if dir == "" || seen[dir] {
+			continue
+		}
+		seen[dir] = true
+
+		if info, err := os.Stat(filepath.Join(at.workspace, dir)); err == nil && info.IsDir() {
+			dirs = append(dirs, dir)
+		}
+	}
+
+	return dirs
+}
+
+// scanOutputDir lists the artifacts in an output directory
+func (at *ArtifactTracker) scanOutputDir(dir string) []ArtifactInfo {
+	root := filepath.Join(at.workspace, dir)
+	artifacts := []ArtifactInfo{}
+
+	// Cargo keeps intermediate files under target; only the final binaries matter
+	if dir == "target" {
+		for _, profile := range []string{"debug", "release"} {
+			entries, err := os.ReadDir(filepath.Join(root, profile))
+			if err != nil {
+				continue
+			}
+			for _, entry := range entries {
+				if artifact, ok := at.describeArtifact(filepath.Join(root, profile, entry.Name()), entry); ok && artifact.Kind == "binary" {
+					artifacts = append(artifacts, artifact)
+				}
+			}
+		}
+		return artifacts
+	}
+
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if len(artifacts) >= 5000 {
+			return filepath.SkipAll
+		}
+		if artifact, ok := at.describeArtifact(path, d); ok {
+			artifacts = append(artifacts, artifact)
+		}
+		return nil
+	})
+
+	return artifacts
+}
+
+func (at *ArtifactTracker) describeArtifact(path string, d fs.DirEntry) (ArtifactInfo, bool) {
+	info, err := d.Info()
+	if err != nil || !info.Mode().IsRegular() {
+		return ArtifactInfo{}, false
+	}
+
+	relPath, _ := filepath.Rel(at.workspace, path)
+	relPath = filepath.ToSlash(relPath)
+
+	kind := "asset"
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".js", ".mjs", ".cjs", ".css", ".wasm":
+		kind = "chunk"
+	case ".d", ".rlib", ".rmeta", ".map":
+		kind = "asset"
+	default:
+		if info.Mode()&0111 != 0 {
+			kind = "binary"
+		}
+	}
+
+	return ArtifactInfo{
+		Path:      relPath,
+		Key:       artifactKey(relPath),
+		Kind:      kind,
+		SizeBytes: info.Size(),
+	}, true
+}
+
+// disambiguateKeys falls back to the full path for artifacts whose keys
+// collide, such as stale copies of a chunk with an older hash, so that no
+// size is lost when snapshots are compared
+func disambiguateKeys(artifacts []ArtifactInfo) {
+	count := make(map[string]int)
+	for _, artifact := range artifacts {
+		count[artifact.Key]++
+	}
+	for i := range artifacts {
+		if count[artifacts[i].Key] > 1 {
+			artifacts[i].Key = artifacts[i].Path
+		}
+	}
+}
+
+// Latest returns the most recent snapshot and the one before it
+func (at *ArtifactTracker) Latest() (*ArtifactSnapshot, *ArtifactSnapshot) {
+	at.mutex.RLock()
+	defer at.mutex.RUnlock()
+
+	var current, previous *ArtifactSnapshot
+	if n := len(at.snapshots); n > 0 {
+		current = &at.snapshots[n-1]
+		if n > 1 {
+			previous = &at.snapshots[n-2]
+		}
+	}
+
+	return current, previous
+}
+
+// ForBuild returns the snapshot recorded for a build and its predecessor
+func (at *ArtifactTracker) ForBuild(buildID string) (*ArtifactSnapshot, *ArtifactSnapshot) {
+	at.mutex.RLock()
+	defer at.mutex.RUnlock()
+
+	for i := range at.snapshots {
+		if at.snapshots[i].BuildID == buildID {
+			if i > 0 {
+				return &at.snapshots[i], &at.snapshots[i-1]
+			}
+			return &at.snapshots[i], nil
+		}
+	}
+
+	return nil, nil
+}
+
+// Diff compares two snapshots; threshold overrides the configured one when positive
+func (at *ArtifactTracker) Diff(current, previous *ArtifactSnapshot, threshold float64) []ArtifactDiff {
+	if threshold <= 0 {
+		threshold = at.threshold
+	}
+
+	previousSizes := make(map[string]ArtifactInfo)
+	if previous != nil {
+		for _, artifact := range previous.Artifacts {
+			previousSizes[artifact.Key] = artifact
+		}
+	}
+
+	diffs := []ArtifactDiff{}
+	seen := make(map[string]bool)
+
+	for _, artifact := range current.Artifacts {
+		seen[artifact.Key] = true
+		diff := ArtifactDiff{
+			Key:          artifact.Key,
+			Kind:         artifact.Kind,
+			CurrentBytes: artifact.SizeBytes,
+			Status:       "added",
+		}
+
+		if old, exists := previousSizes[artifact.Key]; exists {
+			diff.PreviousBytes = old.SizeBytes
+			diff.DeltaBytes = artifact.SizeBytes - old.SizeBytes
+			diff.Status = "unchanged"
+			if diff.DeltaBytes != 0 {
+				diff.Status = "changed"
+			}
+			if old.SizeBytes > 0 {
+				diff.DeltaPercent = float64(diff.DeltaBytes) / float64(old.SizeBytes) * 100
+			}
+			diff.Regression = diff.DeltaBytes > 0 && diff.DeltaPercent >= threshold
+		} else if previous != nil {
+			diff.DeltaBytes = artifact.SizeBytes
+		}
+
+		diffs = append(diffs, diff)
+	}
+
+	for key, old := range previousSizes {
+		if !seen[key] {
+			diffs = append(diffs, ArtifactDiff{
+				Key:           key,
+				Kind:          old.Kind,
+				Status:        "removed",
+				PreviousBytes: old.SizeBytes,
+				DeltaBytes:    -old.SizeBytes,
+				DeltaPercent:  -100,
+			})
+		}
+	}
+
+	// Largest growth first
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].DeltaBytes > diffs[j].DeltaBytes
+	})
+
+	return diffs
+}
+
+// PackageBreakdown attributes binary size to packages using the symbol table
+func (at *ArtifactTracker) PackageBreakdown(relPath string) map[string]int64 {
+	path := filepath.Join(at.workspace, relPath)
+
+	// Go binaries carry their own symbol tooling
+	if err := exec.Command("go", "version", path).Run(); err == nil {
+		if output, err := exec.Command("go", "tool", "nm", "-size", path).Output(); err == nil {
+			return sumSymbolSizes(output, 10, goSymbolPackage)
+		}
+	}
+
+	if checkCommandExists("nm") {
+		if output, err := exec.Command("nm", "--print-size", "--size-sort", "--demangle", path).Output(); err == nil {
+			return sumSymbolSizes(output, 16, nativeSymbolPackage)
+		}
+	}
+
+	return nil
+}
+
+// sumSymbolSizes groups symbol sizes from nm-style "addr size type name" output by package
+func sumSymbolSizes(output []byte, sizeBase int, packageOf func(string) string) map[string]int64 {
+	packages := make(map[string]int64)
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			continue // Undefined symbols carry no address or size
+		}
+
+		size, err := strconv.ParseInt(fields[1], sizeBase, 64)
+		if err != nil {
+			continue
+		}
+
+		packages[packageOf(strings.Join(fields[3:], " "))] += size
+	}
+
+	return packages
+}
+
+// goSymbolPackage extracts the import path from a Go symbol name
+func goSymbolPackage(symbol string) string {
+	lastSlash := strings.LastIndex(symbol, "/")
+	if dot := strings.Index(symbol[lastSlash+1:], "."); dot >= 0 {
+		return symbol[:lastSlash+1+dot]
+	}
+	return symbol
+}
+
+// nativeSymbolPackage extracts the crate or namespace from a demangled symbol
+func nativeSymbolPackage(symbol string) string {
+	symbol = strings.TrimLeft(symbol, "<&")
+	if idx := strings.Index(symbol, "::"); idx > 0 {
+		return symbol[:idx]
+	}
+	return "other"
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestArtifactKey(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		// Content hashes are stripped
+		{"dist/index-4f3a9c1b.js", "dist/index.js"},
+		{"dist/assets/style.4F3A9C1B.css", "dist/assets/style.css"},
+		{"build/static/js/main.4f3a9c1b.chunk.js", "build/static/js/main.chunk.js"},
+		{"dist/vendor.0123456789abcdef0123.mjs", "dist/vendor.mjs"},
+		{"dist/module-deadbeef.wasm", "dist/module.wasm"},
+
+		// A source map suffix belongs to the extension
+		{"dist/index-4f3a9c1b.js.map", "dist/index.js.map"},
+		{"build/static/css/main.4f3a9c1b.chunk.css.map", "build/static/css/main.chunk.css.map"},
+
+		// Names with digits are not hashes
+		{"dist/polyfills-es2015.js", "dist/polyfills-es2015.js"},
+		{"dist/polyfills-es5.js", "dist/polyfills-es5.js"},
+		{"dist/app.chunk1.js", "dist/app.chunk1.js"},
+		{"dist/chunk-1234567.js", "dist/chunk-1234567.js"},
+		{"dist/legacy2020-modules.js", "dist/legacy2020-modules.js"},
+		{"dist/mixed-4f3A9c1b.js", "dist/mixed-4f3A9c1b.js"},
+
+		// Only bundle outputs carry hashes
+		{"bin/server-4f3a9c1b", "bin/server-4f3a9c1b"},
+		{"dist/data-4f3a9c1b.json", "dist/data-4f3a9c1b.json"},
+	}
+
+	for _, tt := range tests {
+		if got := artifactKey(tt.path); got != tt.want {
+			t.Errorf("artifactKey(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestDisambiguateKeys(t *testing.T) {
+	artifacts := []ArtifactInfo{
+		{Path: "dist/index-4f3a9c1b.js", Key: "dist/index.js"},
+		{Path: "dist/index-9e8d7c6b.js", Key: "dist/index.js"},
+		{Path: "dist/style-4f3a9c1b.css", Key: "dist/style.css"},
+	}
+
+	disambiguateKeys(artifacts)
+
+	want := []string{"dist/index-4f3a9c1b.js", "dist/index-9e8d7c6b.js", "dist/style.css"}
+	for i, artifact := range artifacts {
+		if artifact.Key != want[i] {
+			t.Errorf("artifact %d key = %q, want %q", i, artifact.Key, want[i])
+		}
+	}
+}
+
+func TestArtifactDiff(t *testing.T) {
+	at := &ArtifactTracker{threshold: 10}
+
+	previous := &ArtifactSnapshot{Artifacts: []ArtifactInfo{
+		{Key: "dist/polyfills-es2015.js", SizeBytes: 1000},
+		{Key: "dist/polyfills-es5.js", SizeBytes: 3000},
+		{Key: "dist/index.js", SizeBytes: 1000},
+		{Key: "dist/old.js", SizeBytes: 500},
+	}}
+	current := &ArtifactSnapshot{Artifacts: []ArtifactInfo{
+		{Key: "dist/polyfills-es2015.js", SizeBytes: 1000},
+		{Key: "dist/polyfills-es5.js", SizeBytes: 3100},
+		{Key: "dist/index.js", SizeBytes: 1200},
+		{Key: "dist/new.js", SizeBytes: 100},
+	}}
+
+	diffs := make(map[string]ArtifactDiff)
+	for _, diff := range at.Diff(current, previous, 0) {
+		diffs[diff.Key] = diff
+	}
+
+	tests := []struct {
+		key        string
+		status     string
+		delta      int64
+		regression bool
+	}{
+		{"dist/polyfills-es2015.js", "unchanged", 0, false},
+		{"dist/polyfills-es5.js", "changed", 100, false},
+		{"dist/index.js", "changed", 200, true},
+		{"dist/new.js", "added", 100, false},
+		{"dist/old.js", "removed", -500, false},
+	}
+	for _, tt := range tests {
+		diff, ok := diffs[tt.key]
+		if !ok {
+			t.Errorf("no diff for %s", tt.key)
+			continue
+		}
+		if diff.Status != tt.status || diff.DeltaBytes != tt.delta || diff.Regression != tt.regression {
+			t.Errorf("%s: got %s %+d regression=%t, want %s %+d regression=%t",
+				tt.key, diff.Status, diff.DeltaBytes, diff.Regression, tt.status, tt.delta, tt.regression)
+		}
+	}
+}
+
+func TestHasGoMainPackage(t *testing.T) {
+	write := func(root, path, content string) {
+		full := filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	library := t.TempDir()
+	write(library, "lib/lib.go", "package lib\n")
+	write(library, "lib/lib_test.go", "package main\n")
+	write(library, "testdata/tool/main.go", "package main\n")
+	if hasGoMainPackage(library) {
+		t.Error("library reported as having a main package")
+	}
+
+	command := t.TempDir()
+	write(command, "lib/lib.go", "package lib\n")
+	write(command, "cmd/tool/main.go", "// Tool does things\npackage main\n\nfunc main() {}\n")
+	if !hasGoMainPackage(command) {
+		t.Error("main package under cmd/tool not found")
+	}
+}
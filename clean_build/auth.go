@@ -0,0 +1,383 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+)
+
+// API token scopes
+const (
+	scopeRead           = "read"
+	scopeProcessControl = "process:control"
+	scopeServerAdmin    = "server:admin"
+	scopeSnapshotWrite  = "snapshot:write"
+)
+
+var allScopes = []string{scopeRead, scopeProcessControl, scopeServerAdmin, scopeSnapshotWrite}
+
+// AuthConfig controls API authentication, rate limits and CORS
+type AuthConfig struct {
+	Disabled            bool          `json:"disabled"`               // accept requests without a token
+	TokenFile           string        `json:"token_file"`             // the generated token with every scope; ~/.config/argus/token when empty
+	Tokens              []TokenConfig `json:"tokens"`                 // further tokens with limited scopes
+	CORSOrigins         []string      `json:"cors_origins"`           // origins browsers may call the API from; none when empty
+	RequestsPerMinute   int           `json:"requests_per_minute"`    // per token; 0 disables the limit
+	IPRequestsPerMinute int           `json:"ip_requests_per_minute"` // per client IP; 0 disables the limit
+}
+
+// TokenConfig declares a scoped token. Only the SHA-256 of the token is kept
+// in the config: echo -n "$TOKEN" | sha256sum
+type TokenConfig struct {
+	Name   string   `json:"name"`
+	SHA256 string   `json:"sha256"`
+	Scopes []string `json:"scopes"`
+}
+
+// apiToken is an accepted token
+type apiToken struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+func (t *apiToken) hasScope(scope string) bool {
+	return containsString(t.Scopes, scope)
+}
+
+// maxAuthFailuresPerMinute bounds failed authentications per client IP
+const maxAuthFailuresPerMinute = 10
+
+// publicPages are served without a token; they hold no data and call the
+// API with the token the user gives them
+var publicPages = map[string]bool{"/mindmap": true, "/snapshots": true}
+
+// Routes by the scope their non-GET requests need; anything else needs server:admin
+var (
+	processControlRoutes = regexp.MustCompile(`^/(processes(/.*)?|services/.*|dev/.*|build/run|api/languages/[^/]+/(lint|test)|api/analyze/.*)$`)
+	snapshotWriteRoutes  = regexp.MustCompile(`^/(api/(snapshots|investigation|collaboration|ai)(/.*)?|refresh|analyze)$`)
+)
+
+// requiredScope returns the scope a request needs
+func requiredScope(method, path string, upgrade bool) string {
+	path = strings.TrimSuffix(path, "/")
+
+	if upgrade {
+		// The IO socket writes to the process's stdin
+		if strings.HasPrefix(path, "/ws/processes/") && strings.HasSuffix(path, "/io") {
+			return scopeProcessControl
+		}
+		return scopeRead
+	}
+
+	switch {
+	case method == fiber.MethodGet || method == fiber.MethodHead:
+		return scopeRead
+	case processControlRoutes.MatchString(path):
+		return scopeProcessControl
+	case snapshotWriteRoutes.MatchString(path):
+		return scopeSnapshotWrite
+	}
+	return scopeServerAdmin
+}
+
+// tokenBucket refills at a steady rate up to its capacity
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimiter keeps a token bucket per key
+type RateLimiter struct {
+	rate     float64 // tokens per second
+	capacity float64
+	buckets  map[string]*tokenBucket
+	mutex    sync.Mutex
+}
+
+// NewRateLimiter allows perMinute requests per key, in bursts of up to a
+// minute's worth; nil when perMinute is not positive
+func NewRateLimiter(perMinute int) *RateLimiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	return &RateLimiter{
+		rate:     float64(perMinute) / 60,
+		capacity: float64(perMinute),
+		buckets:  make(map[string]*tokenBucket),
+	}
+}
+
+// Allow takes a token for key; when none is left it returns how long until
+// the next one. A nil limiter allows everything.
+func (rl *RateLimiter) Allow(key string) (bool, time.Duration) {
+	if rl == nil {
+		return true, 0
+	}
+
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	now := time.Now()
+	bucket, exists := rl.buckets[key]
+	if !exists {
+		if len(rl.buckets) >= 10000 {
+			rl.prune(now)
+		}
+		bucket = &tokenBucket{tokens: rl.capacity, last: now}
+		rl.buckets[key] = bucket
+	}
+
+	bucket.tokens = math.Min(rl.capacity, bucket.tokens+now.Sub(bucket.last).Seconds()*rl.rate)
+	bucket.last = now
+
+	if bucket.tokens < 1 {
+		wait := time.Duration((1 - bucket.tokens) / rl.rate * float64(time.Second))
+		return false, wait
+	}
+	bucket.tokens--
+	return true, 0
+}
+
+// prune drops buckets that have refilled completely; they hold no state
+func (rl *RateLimiter) prune(now time.Time) {
+	for key, bucket := range rl.buckets {
+		if bucket.tokens+now.Sub(bucket.last).Seconds()*rl.rate >= rl.capacity {
+			delete(rl.buckets, key)
+		}
+	}
+}
+
+// Authenticator checks bearer tokens, scopes and rate limits
+type Authenticator struct {
+	disabled   bool
+	tokenFile  string
+	tokens     map[string]*apiToken // by hex SHA-256 of the token
+	requests   *RateLimiter         // per token
+	ipRequests *RateLimiter         // per client IP
+	failures   *RateLimiter         // failed authentications per client IP
+	starts     *RateLimiter         // process starts per token and per client IP
+}
+
+// defaultTokenFile is where the generated token is kept; outside the
+// workspace so it is never committed
+func defaultTokenFile(workspace string) string {
+	if dir, err := os.UserConfigDir(); err == nil {
+		return filepath.Join(dir, "argus", "token")
+	}
+	return filepath.Join(workspace, ".argus", "token")
+}
+
+// NewAuthenticator loads the generated token, creating it on first start,
+// and the scoped tokens of the config
+func NewAuthenticator(workspace string, config *ProcessMonitorConfig) (*Authenticator, error) {
+	auth := config.Auth
+	a := &Authenticator{
+		disabled:   auth.Disabled,
+		tokenFile:  auth.TokenFile,
+		tokens:     make(map[string]*apiToken),
+		requests:   NewRateLimiter(auth.RequestsPerMinute),
+		ipRequests: NewRateLimiter(auth.IPRequestsPerMinute),
+		failures:   NewRateLimiter(maxAuthFailuresPerMinute),
+		starts:     NewRateLimiter(config.RateLimitPerMinute),
+	}
+	if a.tokenFile == "" {
+		a.tokenFile = defaultTokenFile(workspace)
+	}
+
+	if a.disabled {
+		log.Printf("WARNING: API authentication is disabled; anyone who can reach the port can start processes")
+		return a, nil
+	}
+
+	token, created, err := loadOrCreateToken(a.tokenFile)
+	if err != nil {
+		return nil, err
+	}
+	a.tokens[hashToken(token)] = &apiToken{Name: "default", Scopes: allScopes}
+	if created {
+		log.Printf("Generated API token in %s", a.tokenFile)
+	}
+	log.Printf("API requests need \"Authorization: Bearer <token>\"; the token with every scope is in %s", a.tokenFile)
+
+	for _, tc := range auth.Tokens {
+		if err := validateTokenConfig(tc); err != nil {
+			log.Printf("Skipping API token %q: %v", tc.Name, err)
+			continue
+		}
+		a.tokens[strings.ToLower(tc.SHA256)] = &apiToken{Name: tc.Name, Scopes: tc.Scopes}
+	}
+
+	return a, nil
+}
+
+func validateTokenConfig(tc TokenConfig) error {
+	if tc.Name == "" {
+		return errors.New("name is required")
+	}
+	if digest, err := hex.DecodeString(tc.SHA256); err != nil || len(digest) != sha256.Size {
+		return errors.New("sha256 must be the hex SHA-256 of the token")
+	}
+	if len(tc.Scopes) == 0 {
+		return errors.New("at least one scope is required")
+	}
+	for _, scope := range tc.Scopes {
+		if !containsString(allScopes, scope) {
+			return fmt.Errorf("unknown scope %q: use %s", scope, strings.Join(allScopes, ", "))
+		}
+	}
+	return nil
+}
+
+func hashToken(token string) string {
+	digest := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(digest[:])
+}
+
+// loadOrCreateToken reads the token file, generating a token readable only
+// by the current user when there is none
+func loadOrCreateToken(path string) (string, bool, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		if info, err := os.Stat(path); err == nil && info.Mode().Perm()&0077 != 0 {
+			log.Printf("Token file %s was readable by others, restricting it to 0600", path)
+			if err := os.Chmod(path, 0600); err != nil {
+				return "", false, fmt.Errorf("failed to restrict token file: %w", err)
+			}
+		}
+		if token := strings.TrimSpace(string(data)); token != "" {
+			return token, false, nil
+		}
+		return "", false, fmt.Errorf("token file %s is empty", path)
+	}
+	if !os.IsNotExist(err) {
+		return "", false, fmt.Errorf("failed to read token file: %w", err)
+	}
+
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", false, fmt.Errorf("failed to generate token: %w", err)
+	}
+	token := "argus_" + hex.EncodeToString(random)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", false, fmt.Errorf("failed to create token directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to create token file: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.WriteString(token + "\n"); err != nil {
+		return "", false, fmt.Errorf("failed to write token file: %w", err)
+	}
+	return token, true, nil
+}
+
+// requestToken returns the bearer token of a request. Browsers cannot set
+// headers on WebSocket connections, so upgrades may pass ?token= instead.
+func requestToken(c *fiber.Ctx, upgrade bool) string {
+	if header := c.Get(fiber.HeaderAuthorization); header != "" {
+		if scheme, token, found := strings.Cut(header, " "); found && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+		return ""
+	}
+	if upgrade {
+		return c.Query("token")
+	}
+	return ""
+}
+
+// tooManyRequests answers a request over a rate limit
+func tooManyRequests(c *fiber.Ctx, wait time.Duration, limit string) error {
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	return c.Status(429).JSON(fiber.Map{
+		"error":   "Rate limit exceeded",
+		"details": limit,
+	})
+}
+
+// Middleware authenticates every request except CORS preflights and the
+// public pages, then applies the scope and rate limits
+func (a *Authenticator) Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Method() == fiber.MethodOptions || (c.Method() == fiber.MethodGet && publicPages[c.Path()]) {
+			return c.Next()
+		}
+
+		ip := c.IP()
+		if allowed, wait := a.ipRequests.Allow(ip); !allowed {
+			return tooManyRequests(c, wait, "too many requests from "+ip)
+		}
+		if a.disabled {
+			return c.Next()
+		}
+
+		upgrade := websocket.IsWebSocketUpgrade(c)
+		token := a.tokens[hashToken(requestToken(c, upgrade))]
+		if token == nil {
+			if allowed, wait := a.failures.Allow(ip); !allowed {
+				return tooManyRequests(c, wait, "too many failed authentications from "+ip)
+			}
+			c.Set(fiber.HeaderWWWAuthenticate, `Bearer realm="argus"`)
+			return c.Status(401).JSON(fiber.Map{
+				"error":   "Unauthorized",
+				"details": "send Authorization: Bearer <token>; the generated token is in " + a.tokenFile,
+			})
+		}
+
+		scope := requiredScope(c.Method(), c.Path(), upgrade)
+		if !token.hasScope(scope) {
+			return c.Status(403).JSON(fiber.Map{
+				"error":   "Insufficient scope",
+				"details": fmt.Sprintf("token %q lacks the %s scope", token.Name, scope),
+			})
+		}
+
+		if allowed, wait := a.requests.Allow(token.Name); !allowed {
+			return tooManyRequests(c, wait, "too many requests for token "+token.Name)
+		}
+
+		c.Locals("token", token)
+		return c.Next()
+	}
+}
+
+// requestTokenName names the token of an authenticated request
+func requestTokenName(c *fiber.Ctx) string {
+	if token, ok := c.Locals("token").(*apiToken); ok {
+		return token.Name
+	}
+	return ""
+}
+
+// corsOrigins formats the origin allowlist for the CORS middleware
+func corsOrigins(origins []string) string {
+	allowed := []string{}
+	for _, origin := range origins {
+		origin = strings.TrimSuffix(strings.TrimSpace(origin), "/")
+		if origin == "*" {
+			log.Printf("Ignoring CORS origin \"*\": list the origins allowed to call the API")
+			continue
+		}
+		if origin != "" {
+			allowed = append(allowed, origin)
+		}
+	}
+	return strings.Join(allowed, ",")
+}
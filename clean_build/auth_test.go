@@ -0,0 +1,173 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterBurstAndRefill(t *testing.T) {
+	rl := NewRateLimiter(60) // one per second, bursts of 60
+
+	for i := 0; i < 60; i++ {
+		if ok, _ := rl.Allow("token"); !ok {
+			t.Fatalf("request %d of the burst was limited", i+1)
+		}
+	}
+
+	ok, wait := rl.Allow("token")
+	if ok {
+		t.Fatal("request beyond the burst was allowed")
+	}
+	if wait <= 0 || wait > time.Second {
+		t.Errorf("wait = %v, want up to one second", wait)
+	}
+
+	// Other keys have their own bucket
+	if ok, _ := rl.Allow("other"); !ok {
+		t.Error("a different key was limited")
+	}
+
+	// Two and a half seconds refill two tokens
+	rl.buckets["token"].last = rl.buckets["token"].last.Add(-2500 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		if ok, _ := rl.Allow("token"); !ok {
+			t.Fatalf("refilled request %d was limited", i+1)
+		}
+	}
+	if ok, _ := rl.Allow("token"); ok {
+		t.Error("more requests allowed than were refilled")
+	}
+}
+
+func TestRateLimiterRefillIsCapped(t *testing.T) {
+	rl := NewRateLimiter(6)
+	rl.Allow("token")
+	rl.buckets["token"].last = time.Now().Add(-time.Hour)
+
+	allowed := 0
+	for i := 0; i < 20; i++ {
+		if ok, _ := rl.Allow("token"); ok {
+			allowed++
+		}
+	}
+	if allowed != 6 {
+		t.Errorf("allowed %d requests after an idle hour, want the capacity of 6", allowed)
+	}
+}
+
+func TestRateLimiterPrune(t *testing.T) {
+	rl := NewRateLimiter(60)
+	rl.Allow("idle")
+	rl.Allow("busy")
+	rl.buckets["idle"].last = time.Now().Add(-time.Minute)
+
+	rl.prune(time.Now())
+
+	if _, exists := rl.buckets["idle"]; exists {
+		t.Error("refilled bucket was kept")
+	}
+	if _, exists := rl.buckets["busy"]; !exists {
+		t.Error("bucket with tokens taken was pruned")
+	}
+}
+
+func TestRateLimiterDisabled(t *testing.T) {
+	rl := NewRateLimiter(0)
+	if rl != nil {
+		t.Fatal("limiter created for a limit of 0")
+	}
+	for i := 0; i < 1000; i++ {
+		if ok, _ := rl.Allow("token"); !ok {
+			t.Fatal("nil limiter limited a request")
+		}
+	}
+}
+
+func TestRequiredScope(t *testing.T) {
+	tests := []struct {
+		method  string
+		path    string
+		upgrade bool
+		want    string
+	}{
+		{"GET", "/processes", false, scopeRead},
+		{"HEAD", "/api/files/main.go", false, scopeRead},
+		{"POST", "/processes/start", false, scopeProcessControl},
+		{"POST", "/processes/p-1/input", false, scopeProcessControl},
+		{"DELETE", "/processes/p-1/", false, scopeProcessControl},
+		{"POST", "/services/up", false, scopeProcessControl},
+		{"POST", "/build/run", false, scopeProcessControl},
+		{"POST", "/api/snapshots", false, scopeSnapshotWrite},
+		{"POST", "/refresh", false, scopeSnapshotWrite},
+		{"POST", "/config", false, scopeServerAdmin},
+		{"POST", "/processesx", false, scopeServerAdmin},
+		{"GET", "/ws/processes/p-1/io", true, scopeProcessControl},
+		{"GET", "/ws/processes/p-1/output", true, scopeRead},
+		{"GET", "/ws/errors", true, scopeRead},
+	}
+
+	for _, tt := range tests {
+		if got := requiredScope(tt.method, tt.path, tt.upgrade); got != tt.want {
+			t.Errorf("requiredScope(%s %s, upgrade=%t) = %s, want %s", tt.method, tt.path, tt.upgrade, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTokenConfig(t *testing.T) {
+	digest := hashToken("secret")
+
+	tests := []struct {
+		name    string
+		config  TokenConfig
+		wantErr string
+	}{
+		{"valid", TokenConfig{Name: "ci", SHA256: digest, Scopes: []string{scopeRead}}, ""},
+		{"no name", TokenConfig{SHA256: digest, Scopes: []string{scopeRead}}, "name"},
+		{"plain token", TokenConfig{Name: "ci", SHA256: "secret", Scopes: []string{scopeRead}}, "sha256"},
+		{"no scopes", TokenConfig{Name: "ci", SHA256: digest}, "scope"},
+		{"unknown scope", TokenConfig{Name: "ci", SHA256: digest, Scopes: []string{"admin"}}, `unknown scope "admin"`},
+	}
+
+	for _, tt := range tests {
+		err := validateTokenConfig(tt.config)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLoadOrCreateTokenRestrictsPermissions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "argus", "token")
+
+	token, created, err := loadOrCreateToken(path)
+	if err != nil || !created || token == "" {
+		t.Fatalf("loadOrCreateToken() = %q, %t, %v, want a new token", token, created, err)
+	}
+
+	if err := os.Chmod(path, 0644); err != nil {
+		t.Fatal(err)
+	}
+	again, created, err := loadOrCreateToken(path)
+	if err != nil || created || again != token {
+		t.Fatalf("reloading gave %q, %t, %v, want the same token", again, created, err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("token file mode = %v, want 0600", info.Mode().Perm())
+	}
+}
+
+func TestCORSOrigins(t *testing.T) {
+	got := corsOrigins([]string{" http://localhost:3000/ ", "*", "", "https://app.example.com"})
+	if want := "http://localhost:3000,https://app.example.com"; got != want {
+		t.Errorf("corsOrigins() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/gofiber/websocket/v2"
+)
+
+// subscriberBufferSize is how many frames a subscriber may fall behind before
+// it is disconnected as lagging
+const subscriberBufferSize = 256
+
+// wsPingInterval is how often idle WebSocket connections are pinged
+const wsPingInterval = 30 * time.Second
+
+// Broadcaster fans encoded frames out to subscribers. Publishing never
+// blocks: every subscriber has its own queue, and one that fills it is
+// dropped so a slow client cannot stall the process it watches.
+type Broadcaster struct {
+	subscribers map[*Subscription]struct{}
+	mutex       sync.Mutex
+}
+
+// Subscription receives frames from a broadcaster until it is closed
+type Subscription struct {
+	C      <-chan []byte
+	ch     chan []byte
+	lagged bool
+}
+
+// NewBroadcaster creates a broadcaster with no subscribers
+func NewBroadcaster() *Broadcaster {
+	return &Broadcaster{subscribers: make(map[*Subscription]struct{})}
+}
+
+// Subscribe registers a new subscriber
+func (b *Broadcaster) Subscribe() *Subscription {
+	ch := make(chan []byte, subscriberBufferSize)
+	sub := &Subscription{C: ch, ch: ch}
+
+	b.mutex.Lock()
+	b.subscribers[sub] = struct{}{}
+	b.mutex.Unlock()
+
+	return sub
+}
+
+// Unsubscribe removes a subscriber and closes its channel
+func (b *Broadcaster) Unsubscribe(sub *Subscription) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if _, exists := b.subscribers[sub]; exists {
+		delete(b.subscribers, sub)
+		close(sub.ch)
+	}
+}
+
+// Publish queues a frame for every subscriber
+func (b *Broadcaster) Publish(frame []byte) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for sub := range b.subscribers {
+		select {
+		case sub.ch <- frame:
+		default:
+			sub.lagged = true
+			delete(b.subscribers, sub)
+			close(sub.ch)
+		}
+	}
+}
+
+// PublishJSON encodes a message once and publishes it
+func (b *Broadcaster) PublishJSON(message interface{}) {
+	if frame, err := json.Marshal(message); err == nil {
+		b.Publish(frame)
+	}
+}
+
+// Len returns the number of subscribers
+func (b *Broadcaster) Len() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return len(b.subscribers)
+}
+
+// Lagged reports whether the subscription was dropped for falling behind
+func (b *Broadcaster) Lagged(sub *Subscription) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return sub.lagged
+}
+
+// OutputLine is one line of process output with its position in the stream
+type OutputLine struct {
+	Seq       uint64    `json:"seq"`
+	Stream    string    `json:"stream"` // stdout, stderr, pty
+	Timestamp time.Time `json:"timestamp"`
+	Line      string    `json:"line"`
+}
+
+// recordOutputLine numbers a line, keeps it for resuming clients and
+// publishes it; the caller holds process.mutex so numbering and publishing
+// happen in the same order
+func (p *MonitoredProcess) recordOutputLine(stream, line string, timestamp time.Time, keep int) {
+	p.outputSeq++
+	entry := OutputLine{Seq: p.outputSeq, Stream: stream, Timestamp: timestamp, Line: line}
+
+	p.outputHistory = append(p.outputHistory, entry)
+	if len(p.outputHistory) > keep {
+		p.outputHistory = p.outputHistory[len(p.outputHistory)-keep:]
+	}
+
+	p.output.PublishJSON(outputLineMessage(entry))
+}
+
+func outputLineMessage(entry OutputLine) map[string]interface{} {
+	return map[string]interface{}{
+		"type":      "line",
+		"seq":       entry.Seq,
+		"stream":    entry.Stream,
+		"timestamp": entry.Timestamp,
+		"line":      entry.Line,
+	}
+}
+
+// outputResume is what a client resuming a stream after sinceSeq receives
+// before live lines
+type outputResume struct {
+	Backlog []OutputLine
+	Reset   bool   // sinceSeq is ahead of the stream, so it came from elsewhere and is ignored
+	GapFrom uint64 // first discarded line the client asked for; zero when none
+	GapTo   uint64
+}
+
+// resumeOutput picks the retained lines after sinceSeq and reports the
+// lines between sinceSeq and the oldest retained one as a gap
+func resumeOutput(history []OutputLine, latest, sinceSeq uint64) outputResume {
+	resume := outputResume{Backlog: []OutputLine{}}
+	if sinceSeq > latest {
+		resume.Reset = true
+		sinceSeq = 0
+	}
+
+	oldest := latest + 1
+	if len(history) > 0 {
+		oldest = history[0].Seq
+	}
+	if sinceSeq+1 < oldest {
+		resume.GapFrom, resume.GapTo = sinceSeq+1, oldest-1
+	}
+
+	for _, entry := range history {
+		if entry.Seq > sinceSeq {
+			resume.Backlog = append(resume.Backlog, entry)
+		}
+	}
+	return resume
+}
+
+// SubscribeOutput returns the retained lines after sinceSeq and a
+// subscription for the lines that follow, with nothing missed or repeated
+// in between. Numbering, history and subscribers carry over when the
+// process restarts, so a client can resume across runs.
+func (p *MonitoredProcess) SubscribeOutput(sinceSeq uint64) (outputResume, *Subscription) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return resumeOutput(p.outputHistory, p.outputSeq, sinceSeq), p.output.Subscribe()
+}
+
+// OutputSince returns the retained lines after sinceSeq and the sequence
+// number of the latest line, for callers that poll instead of subscribing
+func (p *MonitoredProcess) OutputSince(sinceSeq uint64) ([]OutputLine, uint64) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	lines := []OutputLine{}
+	for _, entry := range p.outputHistory {
+		if entry.Seq > sinceSeq {
+			lines = append(lines, entry)
+		}
+	}
+	return lines, p.outputSeq
+}
+
+// watchWebSocketClose reads from a connection until the client goes away;
+// a handler writing from its own loop selects on the returned channel
+func watchWebSocketClose(c *websocket.Conn) <-chan struct{} {
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := c.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	return closed
+}
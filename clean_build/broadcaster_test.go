@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResumeOutput(t *testing.T) {
+	history := func(from, to uint64) []OutputLine {
+		lines := []OutputLine{}
+		for seq := from; seq <= to; seq++ {
+			lines = append(lines, OutputLine{Seq: seq})
+		}
+		return lines
+	}
+
+	tests := []struct {
+		name      string
+		history   []OutputLine
+		latest    uint64
+		sinceSeq  uint64
+		wantFirst uint64 // zero when no backlog
+		wantLen   int
+		gapFrom   uint64
+		gapTo     uint64
+		reset     bool
+	}{
+		{"fresh stream", history(1, 5), 5, 0, 1, 5, 0, 0, false},
+		{"resume within history", history(1, 5), 5, 3, 4, 2, 0, 0, false},
+		{"up to date", history(1, 5), 5, 5, 0, 0, 0, 0, false},
+		{"resume before discarded lines", history(11, 20), 20, 4, 11, 10, 5, 10, false},
+		{"resume right before history", history(11, 20), 20, 10, 11, 10, 0, 0, false},
+		{"everything discarded", nil, 20, 4, 0, 0, 5, 20, false},
+		{"ahead of stream", history(1, 5), 5, 9, 1, 5, 0, 0, true},
+		{"ahead with discarded lines", history(11, 20), 20, 25, 11, 10, 1, 10, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resume := resumeOutput(tt.history, tt.latest, tt.sinceSeq)
+
+			if len(resume.Backlog) != tt.wantLen {
+				t.Fatalf("backlog has %d lines, want %d", len(resume.Backlog), tt.wantLen)
+			}
+			if tt.wantLen > 0 && resume.Backlog[0].Seq != tt.wantFirst {
+				t.Errorf("backlog starts at %d, want %d", resume.Backlog[0].Seq, tt.wantFirst)
+			}
+			if resume.GapFrom != tt.gapFrom || resume.GapTo != tt.gapTo {
+				t.Errorf("gap = %d-%d, want %d-%d", resume.GapFrom, resume.GapTo, tt.gapFrom, tt.gapTo)
+			}
+			if resume.Reset != tt.reset {
+				t.Errorf("reset = %t, want %t", resume.Reset, tt.reset)
+			}
+		})
+	}
+}
+
+func TestOutputContinuesAcrossRuns(t *testing.T) {
+	first := &MonitoredProcess{output: NewBroadcaster()}
+	first.mutex.Lock()
+	first.recordOutputLine("stdout", "one", time.Now(), 10)
+	first.recordOutputLine("stdout", "two", time.Now(), 10)
+	first.mutex.Unlock()
+
+	// A client subscribed to the first run keeps receiving the next one
+	resume, sub := first.SubscribeOutput(1)
+	defer first.output.Unsubscribe(sub)
+	if len(resume.Backlog) != 1 || resume.Backlog[0].Line != "two" {
+		t.Fatalf("backlog = %v, want line two", resume.Backlog)
+	}
+
+	second := &MonitoredProcess{output: first.output, outputSeq: first.outputSeq, outputHistory: first.outputHistory}
+	second.mutex.Lock()
+	second.recordOutputLine("stdout", "three", time.Now(), 10)
+	second.mutex.Unlock()
+
+	if second.outputSeq != 3 {
+		t.Errorf("second run numbered its line %d, want 3", second.outputSeq)
+	}
+	select {
+	case frame := <-sub.C:
+		if !strings.Contains(string(frame), `"seq":3`) {
+			t.Errorf("subscriber got %s, want seq 3", frame)
+		}
+	default:
+		t.Error("subscriber of the first run got nothing from the second")
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// BuildRecord captures the outcome of a single build run
+type BuildRecord struct {
+	ID           string    `json:"id"`
+	Trigger      string    `json:"trigger"` // startup, file_change, manual
+	Command      string    `json:"command"`
+	Commit       string    `json:"commit,omitempty"`
+	Branch       string    `json:"branch,omitempty"`
+	StartTime    time.Time `json:"start_time"`
+	DurationMs   int64     `json:"duration_ms"`
+	Success      bool      `json:"success"`
+	ExitCode     int       `json:"exit_code"`
+	ErrorCount   int       `json:"error_count"`
+	WarningCount int       `json:"warning_count"`
+	OutputDigest string    `json:"output_digest"`
+	ChangedFiles []string  `json:"changed_files,omitempty"`
+}
+
+// BuildRegression describes the first failing build after a successful one
+type BuildRegression struct {
+	LastSuccess     BuildRecord `json:"last_success"`
+	FirstFailure    BuildRecord `json:"first_failure"`
+	Ongoing         bool        `json:"ongoing"` // no successful build since the failure
+	ChangedFiles    []string    `json:"changed_files"`
+	GitChangedFiles []string    `json:"git_changed_files,omitempty"`
+}
+
+// BuildTrends summarizes build duration and reliability over a window of builds
+type BuildTrends struct {
+	TotalBuilds       int              `json:"total_builds"`
+	SuccessfulBuilds  int              `json:"successful_builds"`
+	FailedBuilds      int              `json:"failed_builds"`
+	FailureRate       float64          `json:"failure_rate"`
+	P50DurationMs     int64            `json:"p50_duration_ms"`
+	P95DurationMs     int64            `json:"p95_duration_ms"`
+	AverageDurationMs int64            `json:"average_duration_ms"`
+	Regression        *BuildRegression `json:"regression,omitempty"`
+}
+
+// BuildHistory keeps a bounded, persisted record of every build
+type BuildHistory struct {
+	records    []BuildRecord
+	maxRecords int
+	storePath  string
+	storeLines int
+	mutex      sync.RWMutex
+}
+
+// NewBuildHistory creates a build history backed by a JSON lines file
+func NewBuildHistory(storePath string, maxRecords int) *BuildHistory {
+	bh := &BuildHistory{
+		records:    []BuildRecord{},
+		maxRecords: maxRecords,
+		storePath:  storePath,
+	}
+
+	if err := bh.load(); err != nil {
+		log.Printf("Failed to load build history: %v", err)
+	}
+
+	return bh
+}
+
+// load reads previously recorded builds from disk
+func (bh *BuildHistory) load() error {
+	file, err := os.Open(bh.storePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		bh.storeLines++
+		var record BuildRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue // Skip corrupt lines
+		}
+		bh.records = append(bh.records, record)
+	}
+
+	if len(bh.records) > bh.maxRecords {
+		bh.records = bh.records[len(bh.records)-bh.maxRecords:]
+	}
+	if bh.storeLines > len(bh.records) {
+		return bh.rewrite()
+	}
+
+	return scanner.Err()
+}
+
+// rewrite compacts the store file down to the retained records
+func (bh *BuildHistory) rewrite() error {
+	var data []byte
+	for _, record := range bh.records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		data = append(data, line...)
+		data = append(data, '\n')
+	}
+
+	bh.storeLines = len(bh.records)
+	return writeFile(bh.storePath, data)
+}
+
+// Add records a finished build and appends it to the store, compacting the
+// store once it holds twice as many lines as are retained
+func (bh *BuildHistory) Add(record BuildRecord) {
+	bh.mutex.Lock()
+	defer bh.mutex.Unlock()
+
+	bh.records = append(bh.records, record)
+
+	if len(bh.records) > bh.maxRecords {
+		bh.records = bh.records[len(bh.records)-bh.maxRecords:]
+	}
+
+	var err error
+	if bh.storeLines+1 >= 2*bh.maxRecords {
+		err = bh.rewrite()
+	} else if err = appendJSONLine(bh.storePath, record); err == nil {
+		bh.storeLines++
+	}
+	if err != nil {
+		log.Printf("Failed to persist build record %s: %v", record.ID, err)
+	}
+}
+
+// Records returns the most recent builds in chronological order
+func (bh *BuildHistory) Records(limit int) []BuildRecord {
+	bh.mutex.RLock()
+	defer bh.mutex.RUnlock()
+
+	start := 0
+	if limit > 0 && limit < len(bh.records) {
+		start = len(bh.records) - limit
+	}
+
+	return append([]BuildRecord{}, bh.records[start:]...)
+}
+
+// Get returns a single build record by ID
+func (bh *BuildHistory) Get(id string) (*BuildRecord, bool) {
+	bh.mutex.RLock()
+	defer bh.mutex.RUnlock()
+
+	for i := range bh.records {
+		if bh.records[i].ID == id {
+			record := bh.records[i]
+			return &record, true
+		}
+	}
+
+	return nil, false
+}
+
+// Trends computes duration percentiles, failure rate and the latest regression
+// over the last window builds (all builds when window is zero)
+func (bh *BuildHistory) Trends(window int) BuildTrends {
+	records := bh.Records(window)
+	trends := BuildTrends{TotalBuilds: len(records)}
+
+	if len(records) == 0 {
+		return trends
+	}
+
+	durations := make([]int64, 0, len(records))
+	var total int64
+
+	for _, record := range records {
+		if record.Success {
+			trends.SuccessfulBuilds++
+		} else {
+			trends.FailedBuilds++
+		}
+		durations = append(durations, record.DurationMs)
+		total += record.DurationMs
+	}
+
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+
+	trends.FailureRate = float64(trends.FailedBuilds) / float64(len(records))
+	trends.P50DurationMs = percentile(durations, 0.50)
+	trends.P95DurationMs = percentile(durations, 0.95)
+	trends.AverageDurationMs = total / int64(len(records))
+	trends.Regression = findBuildRegression(records)
+
+	return trends
+}
+
+// percentile returns the nearest-rank percentile of sorted values: the
+// smallest value at least p of the values are less than or equal to
+func percentile(sorted []int64, p float64) int64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	// The epsilon keeps float error in p*n from moving an exact rank up
+	rank := int(math.Ceil(p*float64(len(sorted))-1e-9)) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+
+	return sorted[rank]
+}
+
+// findBuildRegression locates the most recent success followed by a failure
+func findBuildRegression(records []BuildRecord) *BuildRegression {
+	for i := len(records) - 1; i > 0; i-- {
+		if records[i].Success || !records[i-1].Success {
+			continue
+		}
+
+		regression := &BuildRegression{
+			LastSuccess:  records[i-1],
+			FirstFailure: records[i],
+			Ongoing:      true,
+			ChangedFiles: append([]string{}, records[i].ChangedFiles...),
+		}
+
+		for _, later := range records[i+1:] {
+			if later.Success {
+				regression.Ongoing = false
+				break
+			}
+		}
+
+		return regression
+	}
+
+	return nil
+}
+
+// appendJSONLine appends a single JSON encoded value to a JSON lines file
+func appendJSONLine(path string, value interface{}) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	line, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
+
+func generateBuildID() string {
+	return fmt.Sprintf("build_%d", time.Now().UnixNano())
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPercentile(t *testing.T) {
+	sorted := []int64{10, 20, 30, 40, 50, 60, 70, 80, 90, 100}
+
+	tests := []struct {
+		p    float64
+		want int64
+	}{
+		{0, 10},
+		{0.5, 50},
+		{0.95, 100},
+		{1, 100},
+	}
+	for _, tt := range tests {
+		if got := percentile(sorted, tt.p); got != tt.want {
+			t.Errorf("percentile(%v) = %d, want %d", tt.p, got, tt.want)
+		}
+	}
+
+	// Nearest rank rounds up, so few samples do not understate the tail
+	few := []int64{10, 20, 30, 40, 50, 60, 70, 80, 90, 100, 110, 120}
+	if got := percentile(few, 0.95); got != 120 {
+		t.Errorf("p95 of 12 values = %d, want 120", got)
+	}
+	if got := percentile(few[:11], 0.95); got != 110 {
+		t.Errorf("p95 of 11 values = %d, want 110", got)
+	}
+	if got := percentile(few[:5], 0.5); got != 30 {
+		t.Errorf("p50 of 5 values = %d, want 30", got)
+	}
+	twenty := make([]int64, 20)
+	for i := range twenty {
+		twenty[i] = int64(i + 1)
+	}
+	if got := percentile(twenty, 0.95); got != 19 {
+		t.Errorf("p95 of 1..20 = %d, want 19", got)
+	}
+
+	if got := percentile(nil, 0.5); got != 0 {
+		t.Errorf("percentile of no values = %d, want 0", got)
+	}
+}
+
+func TestFindBuildRegression(t *testing.T) {
+	build := func(id string, success bool) BuildRecord {
+		return BuildRecord{ID: id, Success: success}
+	}
+
+	tests := []struct {
+		name        string
+		records     []BuildRecord
+		wantFailure string
+		wantOngoing bool
+	}{
+		{"no builds", nil, "", false},
+		{"always green", []BuildRecord{build("a", true), build("b", true)}, "", false},
+		{"never green", []BuildRecord{build("a", false), build("b", false)}, "", false},
+		{"ongoing", []BuildRecord{build("a", true), build("b", false), build("c", false)}, "b", true},
+		{"fixed", []BuildRecord{build("a", true), build("b", false), build("c", true)}, "b", false},
+		{"latest wins", []BuildRecord{build("a", true), build("b", false), build("c", true), build("d", false)}, "d", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			regression := findBuildRegression(tt.records)
+			if tt.wantFailure == "" {
+				if regression != nil {
+					t.Fatalf("got regression at %s, want none", regression.FirstFailure.ID)
+				}
+				return
+			}
+			if regression == nil {
+				t.Fatalf("got no regression, want one at %s", tt.wantFailure)
+			}
+			if regression.FirstFailure.ID != tt.wantFailure || regression.Ongoing != tt.wantOngoing {
+				t.Errorf("got failure %s ongoing=%t, want %s ongoing=%t",
+					regression.FirstFailure.ID, regression.Ongoing, tt.wantFailure, tt.wantOngoing)
+			}
+		})
+	}
+}
+
+func TestBuildHistoryPersistsAndTrims(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+
+	history := NewBuildHistory(path, 3)
+	for _, id := range []string{"a", "b", "c", "d"} {
+		history.Add(BuildRecord{ID: id, Success: true, DurationMs: 100})
+	}
+
+	reloaded := NewBuildHistory(path, 3)
+	records := reloaded.Records(0)
+	if len(records) != 3 || records[0].ID != "b" || records[2].ID != "d" {
+		t.Fatalf("reloaded records = %v, want b, c, d", records)
+	}
+}
+
+func TestBuildHistoryCompactsWhileRunning(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+
+	history := NewBuildHistory(path, 5)
+	for i := 0; i < 23; i++ {
+		history.Add(BuildRecord{ID: fmt.Sprintf("build_%d", i), Success: true})
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lines := bytes.Count(data, []byte("\n")); lines >= 2*5 {
+			t.Fatalf("store holds %d lines after %d builds, want it compacted below %d", lines, i+1, 2*5)
+		}
+	}
+
+	records := NewBuildHistory(path, 5).Records(0)
+	if len(records) != 5 || records[0].ID != "build_18" || records[4].ID != "build_22" {
+		t.Errorf("reloaded records = %v, want build_18 to build_22", records)
+	}
+}
@@ -24,6 +24,26 @@ class ArgusClient:
             'Content-Type': 'application/json',
             'User-Agent': 'Claude-Code-Integration/1.0'
         })
+        token = self._load_token()
+        if token:
+            self.session.headers['Authorization'] = f'Bearer {token}'
+
+    @staticmethod
+    def _load_token() -> Optional[str]:
+        """Read the API token from ARGUS_TOKEN or the file Argus generated it in"""
+        token = os.environ.get('ARGUS_TOKEN')
+        if token:
+            return token.strip()
+
+        token_file = os.environ.get('ARGUS_TOKEN_FILE')
+        if not token_file:
+            config_dir = os.environ.get('XDG_CONFIG_HOME') or os.path.expanduser('~/.config')
+            token_file = os.path.join(config_dir, 'argus', 'token')
+        try:
+            with open(token_file) as f:
+                return f.read().strip() or None
+        except OSError:
+            return None
     
     def is_available(self) -> bool:
         """Check if Argus is running and accessible"""
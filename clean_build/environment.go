@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// EnvProfile is a named environment defined in the config
+type EnvProfile struct {
+	EnvFiles    []string          `json:"env_files"` // .env files, relative to the process working directory
+	Environment map[string]string `json:"environment"`
+	CleanEnv    bool              `json:"clean_env"` // start from a minimal environment instead of Argus's own
+}
+
+// EnvVar is one variable of a process's effective environment
+type EnvVar struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Source string `json:"source"` // argus, clean, profile:<name>, file:<path> or command
+	Masked bool   `json:"masked,omitempty"`
+}
+
+// cleanEnvVars are kept from Argus's environment when a process starts clean
+var cleanEnvVars = []string{"PATH", "HOME", "USER", "LOGNAME", "SHELL", "LANG", "LC_ALL", "TZ", "TMPDIR", "TERM"}
+
+// defaultCleanPath is used when Argus itself has no PATH
+const defaultCleanPath = "/usr/local/bin:/usr/bin:/bin"
+
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// secretEnvName matches variable names whose values are masked when shown
+var secretEnvName = regexp.MustCompile(`(?i)(secret|token(_|$)|passw|_pwd$|api_?key|private|credential|auth|session|cookie|signature|dsn|(^|_)key$)`)
+
+// urlCredentials matches the password of credentials embedded in a URL
+var urlCredentials = regexp.MustCompile(`(://[^:/@\s]+:)[^@\s]+@`)
+
+// envLayers accumulates variables in order; later layers override earlier ones
+type envLayers struct {
+	vars  []EnvVar
+	index map[string]int
+}
+
+func newEnvLayers() *envLayers {
+	return &envLayers{index: make(map[string]int)}
+}
+
+func (l *envLayers) set(name, value, source string) {
+	if i, exists := l.index[name]; exists {
+		l.vars[i] = EnvVar{Name: name, Value: value, Source: source}
+		return
+	}
+	l.index[name] = len(l.vars)
+	l.vars = append(l.vars, EnvVar{Name: name, Value: value, Source: source})
+}
+
+func (l *envLayers) lookup(name string) (string, bool) {
+	if i, exists := l.index[name]; exists {
+		return l.vars[i].Value, true
+	}
+	return "", false
+}
+
+// setMap applies an inline environment map; values are taken literally
+func (l *envLayers) setMap(env map[string]string, source string) {
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		l.set(name, env[name], source)
+	}
+}
+
+// loadFile applies a .env file; its values can refer to any variable set so far
+func (l *envLayers) loadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to read env file: %w", err)
+	}
+	defer file.Close()
+
+	source := "file:" + path
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		name, value, found := strings.Cut(line, "=")
+		name = strings.TrimSpace(name)
+		if !found || !envNamePattern.MatchString(name) {
+			return fmt.Errorf("%s:%d: expected NAME=value", path, lineNumber)
+		}
+		value = strings.TrimSpace(value)
+
+		// Quoted values may continue over several lines
+		if quote := firstByte(value); quote == '"' || quote == '\'' {
+			start := lineNumber
+			for !closedQuote(value, quote) {
+				if !scanner.Scan() {
+					return fmt.Errorf("%s:%d: unterminated quoted value", path, start)
+				}
+				lineNumber++
+				value += "\n" + scanner.Text()
+			}
+		}
+
+		parsed, err := parseEnvValue(value, l.lookup)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", path, lineNumber, err)
+		}
+		l.set(name, parsed, source)
+	}
+
+	return scanner.Err()
+}
+
+func firstByte(value string) byte {
+	if value == "" {
+		return 0
+	}
+	return value[0]
+}
+
+// closedQuote reports whether a value opened with quote has been closed
+func closedQuote(value string, quote byte) bool {
+	for i := 1; i < len(value); i++ {
+		if value[i] == '\\' && quote == '"' {
+			i++
+			continue
+		}
+		if value[i] == quote {
+			return true
+		}
+	}
+	return false
+}
+
+// parseEnvValue unquotes a .env value and expands the variables in it.
+// Single-quoted values are literal; double-quoted values support escapes;
+// unquoted values end at a " #" comment.
+func parseEnvValue(value string, lookup func(string) (string, bool)) (string, error) {
+	switch firstByte(value) {
+	case '\'':
+		end := strings.IndexByte(value[1:], '\'')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated quoted value")
+		}
+		return value[1 : end+1], nil
+	case '"':
+		var unquoted strings.Builder
+		for i := 1; i < len(value); i++ {
+			c := value[i]
+			if c == '"' {
+				return expandEnv(unquoted.String(), lookup)
+			}
+			if c == '\\' && i+1 < len(value) {
+				i++
+				switch value[i] {
+				case 'n':
+					unquoted.WriteByte('\n')
+				case 't':
+					unquoted.WriteByte('\t')
+				case '$':
+					unquoted.WriteString(`\$`) // kept escaped for expandEnv
+				default:
+					unquoted.WriteByte(value[i])
+				}
+				continue
+			}
+			unquoted.WriteByte(c)
+		}
+		return "", fmt.Errorf("unterminated quoted value")
+	}
+
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return expandEnv(value, lookup)
+}
+
+// expandEnv replaces $NAME, ${NAME}, ${NAME:-default} and ${NAME-default};
+// unset variables expand to nothing and \$ is a literal dollar sign
+func expandEnv(value string, lookup func(string) (string, bool)) (string, error) {
+	var expanded strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c == '\\' && i+1 < len(value) && value[i+1] == '$' {
+			expanded.WriteByte('$')
+			i++
+			continue
+		}
+		if c != '$' || i+1 == len(value) {
+			expanded.WriteByte(c)
+			continue
+		}
+
+		if value[i+1] == '{' {
+			end := strings.IndexByte(value[i+2:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated ${ in %q", value)
+			}
+			expr := value[i+2 : i+2+end]
+			i += end + 2
+
+			name, fallback, emptyToo := expr, "", false
+			if n, f, found := strings.Cut(expr, ":-"); found {
+				name, fallback, emptyToo = n, f, true
+			} else if n, f, found := strings.Cut(expr, "-"); found {
+				name, fallback = n, f
+			}
+			if !envNamePattern.MatchString(name) {
+				return "", fmt.Errorf("invalid variable name %q", name)
+			}
+
+			resolved, set := lookup(name)
+			if !set || (emptyToo && resolved == "") {
+				resolved = fallback
+			}
+			expanded.WriteString(resolved)
+			continue
+		}
+
+		end := i + 1
+		for end < len(value) && (value[end] == '_' || isAlnum(value[end])) {
+			end++
+		}
+		if end == i+1 || !envNamePattern.MatchString(value[i+1:end]) {
+			expanded.WriteByte(c)
+			continue
+		}
+		resolved, _ := lookup(value[i+1 : end])
+		expanded.WriteString(resolved)
+		i = end - 1
+	}
+	return expanded.String(), nil
+}
+
+func isAlnum(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// resolveEnvFile makes an env file path relative to the working directory
+func resolveEnvFile(workingDir, file string) string {
+	if filepath.IsAbs(file) {
+		return file
+	}
+	return filepath.Join(workingDir, file)
+}
+
+// buildEnvironment resolves the effective environment of a command. Layers
+// apply in order: Argus's or the clean base environment, the profile's env
+// files and variables, then the command's env files and variables.
+func (pm *ProcessMonitor) buildEnvironment(cmd ProcessCommand) ([]EnvVar, error) {
+	var profile *EnvProfile
+	if cmd.EnvProfile != "" {
+		p, exists := pm.config.EnvProfiles[cmd.EnvProfile]
+		if !exists {
+			return nil, fmt.Errorf("unknown environment profile: %s", cmd.EnvProfile)
+		}
+		profile = &p
+	}
+
+	layers := newEnvLayers()
+	if cmd.CleanEnv || (profile != nil && profile.CleanEnv) {
+		for _, name := range cleanEnvVars {
+			if value, set := os.LookupEnv(name); set {
+				layers.set(name, value, "clean")
+			}
+		}
+		if _, set := layers.lookup("PATH"); !set {
+			layers.set("PATH", defaultCleanPath, "clean")
+		}
+	} else {
+		for _, entry := range os.Environ() {
+			if name, value, found := strings.Cut(entry, "="); found {
+				layers.set(name, value, "argus")
+			}
+		}
+	}
+
+	if profile != nil {
+		for _, file := range profile.EnvFiles {
+			if err := layers.loadFile(resolveEnvFile(cmd.WorkingDir, file)); err != nil {
+				return nil, err
+			}
+		}
+		layers.setMap(profile.Environment, "profile:"+cmd.EnvProfile)
+	}
+
+	for _, file := range cmd.EnvFiles {
+		if err := layers.loadFile(resolveEnvFile(cmd.WorkingDir, file)); err != nil {
+			return nil, err
+		}
+	}
+	layers.setMap(cmd.Environment, "command")
+
+	return layers.vars, nil
+}
+
+// envList formats variables for exec.Cmd.Env
+func envList(vars []EnvVar) []string {
+	env := make([]string, len(vars))
+	for i, v := range vars {
+		env[i] = v.Name + "=" + v.Value
+	}
+	return env
+}
+
+// maskEnvironment returns variables safe to show: values of secret-looking
+// names are hidden and passwords in URLs are replaced
+func maskEnvironment(vars []EnvVar) []EnvVar {
+	masked := make([]EnvVar, len(vars))
+	for i, v := range vars {
+		switch {
+		case secretEnvName.MatchString(v.Name) && v.Value != "":
+			v.Value, v.Masked = "********", true
+		case urlCredentials.MatchString(v.Value):
+			v.Value, v.Masked = urlCredentials.ReplaceAllString(v.Value, "${1}********@"), true
+		}
+		masked[i] = v
+	}
+
+	sort.Slice(masked, func(i, j int) bool { return masked[i].Name < masked[j].Name })
+	return masked
+}
+
+// minMaskedValue is the shortest secret value maskSecrets replaces in text;
+// shorter values would mask unrelated characters
+const minMaskedValue = 4
+
+// maskSecrets hides the values of secret variables and passwords in URLs
+// within free text such as command output
+func maskSecrets(text string, vars []EnvVar) string {
+	for _, v := range vars {
+		if secretEnvName.MatchString(v.Name) && len(v.Value) >= minMaskedValue {
+			text = strings.ReplaceAll(text, v.Value, "********")
+		}
+	}
+	return urlCredentials.ReplaceAllString(text, "${1}********@")
+}
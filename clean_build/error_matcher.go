@@ -0,0 +1,467 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxMatchLineBytes bounds how much of a line the error matcher looks at, so
+// minified bundles and long JSON log lines stay cheap
+const maxMatchLineBytes = 2048
+
+// defaultErrorPatterns apply to every process regardless of its language.
+// The general patterns only match log levels and exception names, not any
+// line that happens to mention "error".
+var defaultErrorPatterns = []ErrorPattern{
+	// Build and module errors
+	{Pattern: `Module not found: .+`, Type: "dependency"},
+	{Pattern: `Failed to compile`, Type: "compilation"},
+	{Pattern: `Compilation error`, Type: "compilation"},
+	{Pattern: `cannot find package ".+"`, Type: "dependency"},
+	{Pattern: `undefined: .+`, Type: "compilation"},
+
+	// Crashes
+	{Pattern: `^panic: .+`, Type: "runtime"},
+	{Pattern: `^fatal error: .+`, Type: "runtime"},
+	{Pattern: `Traceback \(most recent call last\)`, Type: "runtime"},
+	{Pattern: `(?i)\bunhandled (?:promise )?rejection\b`, Type: "runtime"},
+
+	// Test failures
+	{Pattern: `^\s*--- FAIL: .+`, Type: "test"},
+	{Pattern: `^FAIL\s+\S+`, Type: "test"},
+	{Pattern: `Error: expect\(.+\)`, Type: "test"},
+	{Pattern: `\bAssertionError\b`, Type: "test"},
+
+	// Server errors
+	{Pattern: `\bEADDRINUSE\b`, Type: "server"},
+	{Pattern: `\bECONNREFUSED\b|Connection refused`, Type: "server"},
+	{Pattern: `(?i)\baddress already in use\b`, Type: "server"},
+
+	// General patterns
+	{Pattern: `\b[A-Z][A-Za-z0-9_.]*(?:Error|Exception)(?::\s|$)`, Type: "runtime"},
+	{Pattern: `(?:^|[\s\[|])(?:ERROR|FATAL|CRITICAL)(?:[\]:|]|\s|$)`, Type: "runtime"},
+	{Pattern: `(?i)^\s*(?:error|fatal)(?:\[\w+\])?:\s`, Type: "runtime"},
+	{Pattern: `(?i)\blevel=(?:error|fatal)\b|"level"\s*:\s*"(?:error|fatal)"`, Type: "runtime"},
+	{Pattern: `^npm ERR! .+`, Type: "runtime"},
+	{Pattern: `(?:^|\s)WARN(?:ING)?(?:[\]:|]|\s)`, Type: "runtime", Severity: "warning"},
+}
+
+// defaultIgnorePatterns suppress summaries that report the absence of errors
+var defaultIgnorePatterns = []string{
+	`(?i)\b(?:0|no|zero) (?:errors?|failures?|failed|problems?)\b`,
+	`(?i)\b(?:errors?|failures?|failed)\s*[:=]\s*0\b`,
+	`(?i)\bwithout (?:any )?errors?\b`,
+}
+
+var (
+	// tracebackFramePattern finds the innermost frame of a Python traceback
+	// among the lines before an exception
+	tracebackFramePattern = regexp.MustCompile(`File "([^"]+)", line (\d+)`)
+
+	// locationPattern finds a file:line[:column] location in the matched line
+	locationPattern = regexp.MustCompile(`(?:^|[\s(])((?:[A-Za-z]:)?[\w./\\@-]+\.[A-Za-z]{1,6}):(\d+)(?::(\d+))?`)
+)
+
+var (
+	// warningPattern and the type patterns classify lines matched by custom patterns
+	warningPattern     = regexp.MustCompile(`(?i)\bwarn(?:ing)?\b`)
+	compilationPattern = regexp.MustCompile(`(?i)\b(?:syntax|parse|compile|compilation)\b`)
+	testPattern        = regexp.MustCompile(`(?i)\b(?:test|spec|assertion)\b`)
+	serverPattern      = regexp.MustCompile(`(?i)\b(?:server|port|listen|connect)\b`)
+)
+
+// languageCommands maps the executables of common toolchains to the
+// language plugins whose patterns apply to their output
+var languageCommands = map[string][]string{
+	"go":           {"go"},
+	"node":         {"javascript", "typescript"},
+	"npm":          {"javascript", "typescript"},
+	"npx":          {"javascript", "typescript"},
+	"yarn":         {"javascript", "typescript"},
+	"pnpm":         {"javascript", "typescript"},
+	"bun":          {"javascript", "typescript"},
+	"deno":         {"javascript", "typescript"},
+	"tsc":          {"typescript"},
+	"python":       {"python"},
+	"pip":          {"python"},
+	"pytest":       {"python"},
+	"uvicorn":      {"python"},
+	"gunicorn":     {"python"},
+	"flask":        {"python"},
+	"django-admin": {"python"},
+	"cargo":        {"rust"},
+	"rustc":        {"rust"},
+	"java":         {"java"},
+	"javac":        {"java"},
+	"mvn":          {"java"},
+	"gradle":       {"java"},
+	"dotnet":       {"csharp"},
+	"php":          {"php"},
+	"composer":     {"php"},
+	"ruby":         {"ruby"},
+	"bundle":       {"ruby"},
+	"rails":        {"ruby"},
+	"rake":         {"ruby"},
+}
+
+// compiledErrorPattern is an ErrorPattern ready to match
+type compiledErrorPattern struct {
+	pattern   *regexp.Regexp
+	literals  []string // lowercase; a line must contain one to match, nil when unknown
+	errorType string   // empty for custom patterns, which are classified by content
+	severity  string
+	language  string
+	file      *regexp.Regexp
+	line      *regexp.Regexp
+	column    *regexp.Regexp
+}
+
+// ErrorMatcher finds errors in process output. It is compiled once per
+// process run from the default patterns, the patterns of the languages the
+// process uses and its custom patterns.
+type ErrorMatcher struct {
+	patterns  []compiledErrorPattern
+	ignore    *regexp.Regexp
+	languages []string
+}
+
+// ErrorMatch describes a line the matcher recognised as an error
+type ErrorMatch struct {
+	ErrorType string
+	Severity  string
+	Language  string
+	File      string
+	Line      int
+	Column    int
+}
+
+// validateErrorPatterns checks the custom patterns of a command. A pattern
+// starting with "!" is a negative pattern: lines matching it are ignored.
+func validateErrorPatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := regexp.Compile(strings.TrimPrefix(pattern, "!")); err != nil {
+			return fmt.Errorf("invalid error pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// NewErrorMatcher compiles a matcher. Custom patterns take precedence over
+// language patterns, which take precedence over the defaults; patterns that
+// fail to compile are skipped.
+func NewErrorMatcher(plugins []LanguagePlugin, custom []string) *ErrorMatcher {
+	matcher := &ErrorMatcher{}
+	seen := make(map[string]bool)
+	ignores := append([]string{}, defaultIgnorePatterns...)
+
+	add := func(definition ErrorPattern, custom bool) {
+		if definition.Pattern == "" || seen[definition.Pattern] {
+			return
+		}
+		re, err := regexp.Compile(definition.Pattern)
+		if err != nil {
+			log.Printf("Skipping invalid error pattern %q: %v", definition.Pattern, err)
+			return
+		}
+		seen[definition.Pattern] = true
+
+		compiled := compiledErrorPattern{
+			pattern:  re,
+			literals: requiredLiterals(definition.Pattern),
+			severity: definition.Severity,
+			language: definition.Language,
+			file:     compileOptional(definition.FileRegex),
+			line:     compileOptional(definition.LineRegex),
+			column:   compileOptional(definition.ColumnRegex),
+		}
+		if !custom {
+			compiled.errorType = normalizeErrorType(definition.Type)
+		}
+		matcher.patterns = append(matcher.patterns, compiled)
+	}
+
+	for _, pattern := range custom {
+		if negative, ok := strings.CutPrefix(pattern, "!"); ok {
+			ignores = append(ignores, negative)
+			continue
+		}
+		add(ErrorPattern{Pattern: pattern}, true)
+	}
+
+	for _, plugin := range plugins {
+		matcher.languages = append(matcher.languages, plugin.GetName())
+		for _, definition := range plugin.GetErrorPatterns() {
+			if definition.Language == "" {
+				definition.Language = plugin.GetName()
+			}
+			add(definition, false)
+		}
+	}
+
+	for _, definition := range defaultErrorPatterns {
+		add(definition, false)
+	}
+
+	valid := []string{}
+	for _, pattern := range ignores {
+		if _, err := regexp.Compile(pattern); err == nil {
+			valid = append(valid, "(?:"+pattern+")")
+		}
+	}
+	if len(valid) > 0 {
+		matcher.ignore = regexp.MustCompile(strings.Join(valid, "|"))
+	}
+
+	return matcher
+}
+
+func compileOptional(pattern string) *regexp.Regexp {
+	if pattern == "" {
+		return nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		log.Printf("Skipping invalid location pattern %q: %v", pattern, err)
+		return nil
+	}
+	return re
+}
+
+// normalizeErrorType maps plugin error types onto the StreamError types
+func normalizeErrorType(pluginType string) string {
+	switch pluginType {
+	case "syntax", "compile", "build":
+		return "compilation"
+	case "import":
+		return "dependency"
+	case "":
+		return "runtime"
+	}
+	return pluginType
+}
+
+// Languages returns the languages whose patterns the matcher uses
+func (m *ErrorMatcher) Languages() []string {
+	return m.languages
+}
+
+// Match reports whether a line is an error. context holds the preceding
+// lines and is searched for a source location when the line has none.
+func (m *ErrorMatcher) Match(line string, context []string) *ErrorMatch {
+	if len(line) > maxMatchLineBytes {
+		line = line[:maxMatchLineBytes]
+	}
+
+	// Most lines contain none of the literals and never reach a regex
+	lower := strings.ToLower(line)
+	for i := range m.patterns {
+		pattern := &m.patterns[i]
+		if !pattern.mayMatch(lower) || !pattern.pattern.MatchString(line) {
+			continue
+		}
+		if m.ignore != nil && m.ignore.MatchString(line) {
+			return nil
+		}
+
+		match := &ErrorMatch{
+			ErrorType: pattern.errorType,
+			Severity:  pattern.severity,
+			Language:  pattern.language,
+		}
+		if match.ErrorType == "" {
+			match.ErrorType = classifyErrorLine(line)
+		}
+		if match.Severity == "" {
+			match.Severity = "error"
+			if pattern.errorType == "" && warningPattern.MatchString(line) {
+				match.Severity = "warning"
+			}
+		}
+
+		pattern.locate(match, line, context)
+		return match
+	}
+
+	return nil
+}
+
+// mayMatch reports whether a lowercased line contains one of the literals
+// the pattern requires
+func (p *compiledErrorPattern) mayMatch(lower string) bool {
+	if p.literals == nil {
+		return true
+	}
+	for _, literal := range p.literals {
+		if strings.Contains(lower, literal) {
+			return true
+		}
+	}
+	return false
+}
+
+// requiredLiterals returns lowercase strings of which every match of a
+// pattern contains at least one, or nil when no such set is known
+func requiredLiterals(pattern string) []string {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return nil
+	}
+	return literalsOf(re.Simplify())
+}
+
+func literalsOf(re *syntax.Regexp) []string {
+	switch re.Op {
+	case syntax.OpLiteral:
+		return []string{strings.ToLower(string(re.Rune))}
+	case syntax.OpCapture, syntax.OpPlus:
+		return literalsOf(re.Sub[0])
+	case syntax.OpRepeat:
+		if re.Min >= 1 {
+			return literalsOf(re.Sub[0])
+		}
+	case syntax.OpConcat:
+		// Any required part will do; the one with the longest literals filters best
+		var best []string
+		for _, sub := range re.Sub {
+			if literals := literalsOf(sub); literals != nil && shortest(literals) > shortest(best) {
+				best = literals
+			}
+		}
+		return best
+	case syntax.OpAlternate:
+		var all []string
+		for _, sub := range re.Sub {
+			literals := literalsOf(sub)
+			if literals == nil {
+				return nil
+			}
+			all = append(all, literals...)
+		}
+		return all
+	}
+	return nil
+}
+
+func shortest(literals []string) int {
+	if len(literals) == 0 {
+		return 0
+	}
+	min := len(literals[0])
+	for _, literal := range literals[1:] {
+		if len(literal) < min {
+			min = len(literal)
+		}
+	}
+	return min
+}
+
+// locate fills in the source location from the pattern's own regexes, or
+// from the line or a preceding traceback frame when the pattern has none
+func (p *compiledErrorPattern) locate(match *ErrorMatch, line string, context []string) {
+	candidates := []string{line}
+	for i := len(context) - 1; i >= 0; i-- {
+		candidates = append(candidates, context[i])
+	}
+
+	if p.file != nil || p.line != nil {
+		for _, candidate := range candidates {
+			match.File = firstGroup(p.file, candidate)
+			match.Line, _ = strconv.Atoi(firstGroup(p.line, candidate))
+			match.Column, _ = strconv.Atoi(firstGroup(p.column, candidate))
+			if match.File != "" || match.Line > 0 {
+				return
+			}
+		}
+	}
+
+	if groups := locationPattern.FindStringSubmatch(line); groups != nil {
+		match.File = groups[1]
+		match.Line, _ = strconv.Atoi(groups[2])
+		match.Column, _ = strconv.Atoi(groups[3])
+		return
+	}
+
+	// Other locations in the context may belong to earlier, unrelated output
+	for i := len(context) - 1; i >= 0; i-- {
+		if groups := tracebackFramePattern.FindStringSubmatch(context[i]); groups != nil {
+			match.File = groups[1]
+			match.Line, _ = strconv.Atoi(groups[2])
+			return
+		}
+	}
+}
+
+func firstGroup(re *regexp.Regexp, text string) string {
+	if re == nil {
+		return ""
+	}
+	groups := re.FindStringSubmatch(text)
+	if len(groups) < 2 {
+		return ""
+	}
+	return strings.TrimSpace(groups[1])
+}
+
+// classifyErrorLine guesses the type of a line matched by a custom pattern
+func classifyErrorLine(line string) string {
+	switch {
+	case compilationPattern.MatchString(line):
+		return "compilation"
+	case testPattern.MatchString(line):
+		return "test"
+	case serverPattern.MatchString(line):
+		return "server"
+	}
+	return "runtime"
+}
+
+// commandLanguages returns the plugins implied by the executable of a command
+func (pm *ProcessMonitor) commandLanguages(command string) []LanguagePlugin {
+	name := filepath.Base(command)
+	if strings.HasPrefix(name, "python") {
+		name = "python"
+	}
+
+	var plugins []LanguagePlugin
+	for _, language := range languageCommands[name] {
+		if plugin, ok := pm.plugins.GetPlugin(language); ok {
+			plugins = append(plugins, plugin)
+		}
+	}
+	return plugins
+}
+
+// errorMatcherFor compiles the matcher of a process run. Languages come
+// from the command when it names a known toolchain, otherwise from the
+// working directory, which is scanned once and cached.
+func (pm *ProcessMonitor) errorMatcherFor(cmd ProcessCommand) *ErrorMatcher {
+	plugins := pm.commandLanguages(cmd.Command)
+
+	if len(plugins) == 0 {
+		dir, err := filepath.Abs(cmd.WorkingDir)
+		if err != nil {
+			dir = cmd.WorkingDir
+		}
+
+		pm.mutex.RLock()
+		cached, exists := pm.dirLanguages[dir]
+		pm.mutex.RUnlock()
+
+		if !exists {
+			cached = pm.plugins.DetectLanguages(dir)
+			sort.Slice(cached, func(i, j int) bool { return cached[i].GetName() < cached[j].GetName() })
+			pm.mutex.Lock()
+			pm.dirLanguages[dir] = cached
+			pm.mutex.Unlock()
+		}
+		plugins = cached
+	}
+
+	return NewErrorMatcher(plugins, cmd.ErrorPatterns)
+}
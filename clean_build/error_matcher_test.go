@@ -0,0 +1,241 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// patternPlugin is a language plugin that only contributes error patterns
+type patternPlugin struct {
+	LanguagePlugin
+	name     string
+	patterns []ErrorPattern
+}
+
+func (p patternPlugin) GetName() string                  { return p.name }
+func (p patternPlugin) GetErrorPatterns() []ErrorPattern { return p.patterns }
+
+func TestErrorMatcherDefaults(t *testing.T) {
+	matcher := NewErrorMatcher(nil, nil)
+
+	tests := []struct {
+		line      string
+		errorType string // empty when the line is not an error
+		severity  string
+	}{
+		{"panic: runtime error: index out of range", "runtime", "error"},
+		{"fatal error: all goroutines are asleep - deadlock!", "runtime", "error"},
+		{"Traceback (most recent call last):", "runtime", "error"},
+		{"Module not found: Can't resolve './App'", "dependency", "error"},
+		{"./main.go:12:2: undefined: foo", "compilation", "error"},
+		{"--- FAIL: TestParse (0.00s)", "test", "error"},
+		{"FAIL\tenhanced-argus\t0.01s", "test", "error"},
+		{"Error: listen EADDRINUSE: address already in use :::3000", "server", "error"},
+		{"TypeError: Cannot read properties of undefined", "runtime", "error"},
+		{"2024-01-01 12:00:00 [ERROR] request failed", "runtime", "error"},
+		{`{"level":"error","msg":"db down"}`, "runtime", "error"},
+		{"time=12:00 level=fatal msg=exiting", "runtime", "error"},
+		{"npm ERR! code ELIFECYCLE", "runtime", "error"},
+		{"WARN deprecated option", "runtime", "warning"},
+
+		// Lines that mention errors without being one
+		{"Compiled successfully with 0 errors", "", ""},
+		{"Tests: 12 passed, failures: 0", "", ""},
+		{"Finished without errors", "", ""},
+		{"handling error responses in middleware", "", ""},
+		{"GET /errors 200", "", ""},
+		{"server listening on :3000", "", ""},
+	}
+
+	for _, tt := range tests {
+		match := matcher.Match(tt.line, nil)
+		if tt.errorType == "" {
+			if match != nil {
+				t.Errorf("Match(%q) = %+v, want no match", tt.line, match)
+			}
+			continue
+		}
+		if match == nil {
+			t.Errorf("Match(%q) = nil, want %s %s", tt.line, tt.severity, tt.errorType)
+			continue
+		}
+		if match.ErrorType != tt.errorType || match.Severity != tt.severity {
+			t.Errorf("Match(%q) = %s %s, want %s %s", tt.line, match.Severity, match.ErrorType, tt.severity, tt.errorType)
+		}
+	}
+}
+
+func TestErrorMatcherCustomPatterns(t *testing.T) {
+	matcher := NewErrorMatcher(nil, []string{
+		`^oops\b`,
+		`syntax problem`,
+		`flaky test`,
+		`port busy`,
+		`warning from plugin`,
+		`!known harmless ERROR`,
+		`(unclosed`, // invalid, skipped
+	})
+
+	tests := []struct {
+		line      string
+		errorType string
+		severity  string
+	}{
+		{"oops something broke", "runtime", "error"},
+		{"a syntax problem near line 3", "compilation", "error"},
+		{"flaky test detected", "test", "error"},
+		{"port busy, retrying", "server", "error"},
+		{"warning from plugin loader", "runtime", "warning"},
+	}
+	for _, tt := range tests {
+		match := matcher.Match(tt.line, nil)
+		if match == nil || match.ErrorType != tt.errorType || match.Severity != tt.severity {
+			t.Errorf("Match(%q) = %+v, want %s %s", tt.line, match, tt.severity, tt.errorType)
+		}
+	}
+
+	// Negative patterns suppress lines the defaults would report
+	if match := matcher.Match("[ERROR] known harmless ERROR at startup", nil); match != nil {
+		t.Errorf("line matching a negative pattern reported: %+v", match)
+	}
+	if match := matcher.Match("[ERROR] real failure", nil); match == nil {
+		t.Error("default patterns no longer apply next to custom ones")
+	}
+}
+
+func TestErrorMatcherPrecedence(t *testing.T) {
+	plugin := patternPlugin{name: "go", patterns: []ErrorPattern{
+		{Pattern: `panic: .+`, Type: "build", Severity: "warning"},
+		{Pattern: `^lint: .+`, Type: "lint"},
+	}}
+
+	matcher := NewErrorMatcher([]LanguagePlugin{plugin}, nil)
+	if got := matcher.Languages(); !reflect.DeepEqual(got, []string{"go"}) {
+		t.Errorf("Languages() = %v, want [go]", got)
+	}
+
+	// The language pattern wins over the default for the same line
+	match := matcher.Match("panic: boom", nil)
+	if match == nil || match.ErrorType != "compilation" || match.Severity != "warning" || match.Language != "go" {
+		t.Errorf("Match(panic) = %+v, want the go plugin's pattern", match)
+	}
+	match = matcher.Match("lint: unused variable", nil)
+	if match == nil || match.ErrorType != "lint" || match.Severity != "error" {
+		t.Errorf("Match(lint) = %+v, want a lint error", match)
+	}
+
+	// A custom pattern wins over both and is classified by content
+	matcher = NewErrorMatcher([]LanguagePlugin{plugin}, []string{`panic: .+`})
+	match = matcher.Match("panic: boom", nil)
+	if match == nil || match.ErrorType != "runtime" || match.Severity != "error" || match.Language != "" {
+		t.Errorf("Match(panic) with a custom pattern = %+v, want the custom pattern", match)
+	}
+}
+
+func TestErrorMatcherLocations(t *testing.T) {
+	plugin := patternPlugin{name: "go", patterns: []ErrorPattern{{
+		Pattern:     `(.+\.go):(\d+):(\d+): (.+)`,
+		Type:        "compile",
+		FileRegex:   `(.+\.go):\d+:\d+:`,
+		LineRegex:   `.+\.go:(\d+):\d+:`,
+		ColumnRegex: `.+\.go:\d+:(\d+):`,
+	}}}
+	matcher := NewErrorMatcher([]LanguagePlugin{plugin}, nil)
+
+	tests := []struct {
+		name    string
+		line    string
+		context []string
+		file    string
+		lineNo  int
+		column  int
+	}{
+		{"pattern regexes", "./cmd/main.go:12:5: undefined: foo", nil, "./cmd/main.go", 12, 5},
+		{"location in the line", "TypeError: x is undefined at src/app.js:40:7", nil, "src/app.js", 40, 7},
+		{"traceback frame", "ValueError: bad value", []string{
+			`  File "/app/old.py", line 3, in <module>`,
+			"Traceback (most recent call last):",
+			`  File "/app/main.py", line 10, in <module>`,
+			`  File "/app/util.py", line 22, in parse`,
+		}, "/app/util.py", 22, 0},
+		{"no location", "[ERROR] request failed", []string{"GET / 500"}, "", 0, 0},
+	}
+
+	for _, tt := range tests {
+		match := matcher.Match(tt.line, tt.context)
+		if match == nil {
+			t.Errorf("%s: no match", tt.name)
+			continue
+		}
+		if match.File != tt.file || match.Line != tt.lineNo || match.Column != tt.column {
+			t.Errorf("%s: location = %s:%d:%d, want %s:%d:%d", tt.name, match.File, match.Line, match.Column, tt.file, tt.lineNo, tt.column)
+		}
+	}
+}
+
+func TestErrorMatcherLongLines(t *testing.T) {
+	matcher := NewErrorMatcher(nil, nil)
+
+	// Only the start of a long line is matched
+	if match := matcher.Match("[ERROR] "+strings.Repeat("x", 10000), nil); match == nil {
+		t.Error("error at the start of a long line not matched")
+	}
+	if match := matcher.Match(strings.Repeat("x ", maxMatchLineBytes)+"[ERROR] late", nil); match != nil {
+		t.Errorf("error beyond maxMatchLineBytes matched: %+v", match)
+	}
+}
+
+func TestRequiredLiterals(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		literals []string
+	}{
+		{`Failed to compile`, []string{"failed to compile"}},
+		{`^panic: .+`, []string{"panic: "}},
+		{`\bECONNREFUSED\b|Connection refused`, []string{"econnrefused", "connection refused"}},
+		{`(?:foo|ba+r)`, []string{"foo", "b"}}, // any one required literal of a branch
+		{`cannot find package ".+"`, []string{"cannot find package \""}},
+		{`.*`, nil},
+		{`x|.*`, nil},
+		{`(unclosed`, nil},
+	}
+
+	for _, tt := range tests {
+		if got := requiredLiterals(tt.pattern); !reflect.DeepEqual(got, tt.literals) {
+			t.Errorf("requiredLiterals(%q) = %q, want %q", tt.pattern, got, tt.literals)
+		}
+	}
+}
+
+func TestValidateErrorPatterns(t *testing.T) {
+	if err := validateErrorPatterns([]string{`^oops`, `!harmless`}); err != nil {
+		t.Errorf("valid patterns rejected: %v", err)
+	}
+	if err := validateErrorPatterns([]string{`!(unclosed`}); err == nil {
+		t.Error("invalid negative pattern accepted")
+	}
+}
+
+func TestCommandLanguages(t *testing.T) {
+	pm := &ProcessMonitor{plugins: NewLanguagePluginManager()}
+
+	tests := []struct {
+		command   string
+		languages []string
+	}{
+		{"go", []string{"go"}},
+		{"/usr/bin/python3.12", []string{"python"}},
+		{"npx", []string{"javascript", "typescript"}},
+		{"make", nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, plugin := range pm.commandLanguages(tt.command) {
+			got = append(got, plugin.GetName())
+		}
+		if !reflect.DeepEqual(got, tt.languages) {
+			t.Errorf("commandLanguages(%q) = %v, want %v", tt.command, got, tt.languages)
+		}
+	}
+}
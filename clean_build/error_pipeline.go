@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"time"
+)
+
+// maxErrorBatch is how many errors a WebSocket frame carries before it is
+// sent without waiting for the next flush
+const maxErrorBatch = 100
+
+// errorFlushInterval is how often batched errors and expired coalescing
+// windows are flushed
+const errorFlushInterval = 100 * time.Millisecond
+
+// fingerprintNumbers makes errors that differ only in counters, IDs or
+// durations coalesce together
+var fingerprintNumbers = regexp.MustCompile(`\d+`)
+
+// coalescedError tracks repeats of an error within its coalescing window
+type coalescedError struct {
+	windowStart time.Time
+	firstRepeat time.Time
+	last        StreamError
+	repeats     int
+}
+
+// errorFingerprint identifies errors that count as the same error. The
+// location is part of it, so distinct compile errors never coalesce.
+func errorFingerprint(streamError StreamError) string {
+	return fmt.Sprintf("%s|%s|%s|%s:%d|%s", streamError.ProcessID, streamError.ErrorType, streamError.Severity,
+		streamError.File, streamError.Line, fingerprintNumbers.ReplaceAllString(streamError.Message, "#"))
+}
+
+// coalesce reports whether an error repeats one seen within the coalescing
+// window; repeats are counted and reported once the window ends. Only
+// processErrorStream calls it.
+func (pm *ProcessMonitor) coalesce(streamError StreamError) bool {
+	if pm.config.ErrorCoalesceWindow <= 0 {
+		return false
+	}
+
+	key := errorFingerprint(streamError)
+	entry, exists := pm.coalescing[key]
+	if !exists {
+		pm.coalescing[key] = &coalescedError{windowStart: time.Now()}
+		return false
+	}
+
+	if entry.repeats == 0 {
+		entry.firstRepeat = streamError.Timestamp
+	}
+	entry.repeats++
+	entry.last = streamError
+
+	pm.metrics.mutex.Lock()
+	pm.metrics.ErrorsCoalesced++
+	pm.metrics.mutex.Unlock()
+
+	return true
+}
+
+// queueError hands an error to the workers, making room when they fall behind
+func (pm *ProcessMonitor) queueError(errorBuffer chan StreamError, streamError StreamError) {
+	select {
+	case errorBuffer <- streamError:
+	default:
+		pm.handleBufferOverflow(errorBuffer, streamError)
+	}
+}
+
+// handleBufferOverflow drops the oldest queued error to make room for a new
+// one; the first occurrence of an error has usually been delivered already,
+// and the newest errors describe the current state
+func (pm *ProcessMonitor) handleBufferOverflow(errorBuffer chan StreamError, streamError StreamError) {
+	dropped := int64(0)
+	select {
+	case <-errorBuffer:
+		dropped++
+	default:
+	}
+
+	select {
+	case errorBuffer <- streamError:
+	default:
+		dropped++ // Workers refilled the buffer in the meantime
+	}
+
+	pm.metrics.mutex.Lock()
+	pm.metrics.ErrorsDropped += dropped
+	total := pm.metrics.ErrorsDropped
+	pm.metrics.mutex.Unlock()
+
+	if dropped > 0 && total%100 == 1 {
+		log.Printf("Error stream buffer overflow - dropping oldest errors (%d dropped so far)", total)
+	}
+}
+
+// flushPendingErrors reports the repeats of coalescing windows that have
+// ended and publishes the errors batched since the last flush
+func (pm *ProcessMonitor) flushPendingErrors(errorBuffer chan StreamError) {
+	now := time.Now()
+	for key, entry := range pm.coalescing {
+		if now.Sub(entry.windowStart) < pm.config.ErrorCoalesceWindow {
+			continue
+		}
+		delete(pm.coalescing, key)
+		if entry.repeats == 0 {
+			continue
+		}
+
+		summary := entry.last
+		summary.Repeats = entry.repeats
+		firstSeen := entry.firstRepeat
+		summary.FirstSeen = &firstSeen
+		pm.queueError(errorBuffer, summary)
+	}
+
+	pm.publishErrorBatch()
+}
+
+// batchError adds a processed error to the next WebSocket frame
+func (pm *ProcessMonitor) batchError(streamError StreamError) {
+	pm.batchMutex.Lock()
+	pm.errorBatch = append(pm.errorBatch, streamError)
+	full := len(pm.errorBatch) >= maxErrorBatch
+	pm.batchMutex.Unlock()
+
+	if full {
+		pm.publishErrorBatch()
+	}
+}
+
+// publishErrorBatch sends the batched errors to WebSocket clients as one frame
+func (pm *ProcessMonitor) publishErrorBatch() {
+	pm.batchMutex.Lock()
+	batch := pm.errorBatch
+	pm.errorBatch = nil
+	pm.batchMutex.Unlock()
+
+	if len(batch) == 0 {
+		return
+	}
+
+	pm.errorClients.PublishJSON(map[string]interface{}{
+		"type":      "errors",
+		"errors":    batch,
+		"count":     len(batch),
+		"timestamp": time.Now(),
+	})
+}
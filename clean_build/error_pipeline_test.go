@@ -0,0 +1,122 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestErrorFingerprint(t *testing.T) {
+	base := StreamError{
+		ProcessID: "p-1",
+		ErrorType: "runtime",
+		Severity:  "error",
+		File:      "server.go",
+		Line:      42,
+		Message:   "request 1234 failed after 15ms",
+	}
+	with := func(change func(*StreamError)) StreamError {
+		streamError := base
+		change(&streamError)
+		return streamError
+	}
+
+	tests := []struct {
+		name  string
+		other StreamError
+		same  bool
+	}{
+		{"different numbers", with(func(e *StreamError) { e.Message = "request 98 failed after 3000ms" }), true},
+		{"different time", with(func(e *StreamError) { e.Timestamp = time.Now() }), true},
+		{"different message", with(func(e *StreamError) { e.Message = "request 1234 timed out" }), false},
+		{"different line", with(func(e *StreamError) { e.Line = 43 }), false},
+		{"different file", with(func(e *StreamError) { e.File = "client.go" }), false},
+		{"different process", with(func(e *StreamError) { e.ProcessID = "p-2" }), false},
+		{"different severity", with(func(e *StreamError) { e.Severity = "warning" }), false},
+	}
+
+	for _, tt := range tests {
+		if same := errorFingerprint(base) == errorFingerprint(tt.other); same != tt.same {
+			t.Errorf("%s: same fingerprint = %t, want %t", tt.name, same, tt.same)
+		}
+	}
+}
+
+func newCoalescingMonitor(window time.Duration) *ProcessMonitor {
+	return &ProcessMonitor{
+		config:     &ProcessMonitorConfig{ErrorCoalesceWindow: window},
+		metrics:    &ProcessMetrics{},
+		coalescing: make(map[string]*coalescedError),
+	}
+}
+
+func TestCoalesceReportsRepeatsAfterWindow(t *testing.T) {
+	pm := newCoalescingMonitor(50 * time.Millisecond)
+	buffer := make(chan StreamError, 10)
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		streamError := StreamError{ProcessID: "p-1", Message: "retry 1 failed", Timestamp: start.Add(time.Duration(i) * time.Millisecond)}
+		if coalesced := pm.coalesce(streamError); coalesced != (i > 0) {
+			t.Fatalf("error %d coalesced = %t, want %t", i, coalesced, i > 0)
+		}
+	}
+	if pm.coalesce(StreamError{ProcessID: "p-1", Message: "connection refused"}) {
+		t.Fatal("a different error was coalesced")
+	}
+
+	pm.flushPendingErrors(buffer)
+	if len(buffer) != 0 {
+		t.Fatalf("%d summaries queued before the window ended", len(buffer))
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	pm.flushPendingErrors(buffer)
+	if len(buffer) != 1 {
+		t.Fatalf("%d summaries queued after the window, want 1", len(buffer))
+	}
+
+	summary := <-buffer
+	if summary.Repeats != 3 {
+		t.Errorf("summary repeats = %d, want 3", summary.Repeats)
+	}
+	if summary.FirstSeen == nil || !summary.FirstSeen.Equal(start.Add(time.Millisecond)) {
+		t.Errorf("summary first seen = %v, want the first repeat", summary.FirstSeen)
+	}
+	if pm.metrics.ErrorsCoalesced != 3 {
+		t.Errorf("ErrorsCoalesced = %d, want 3", pm.metrics.ErrorsCoalesced)
+	}
+	if len(pm.coalescing) != 0 {
+		t.Errorf("%d coalescing windows left open", len(pm.coalescing))
+	}
+
+	// A new window starts afterwards
+	if pm.coalesce(StreamError{ProcessID: "p-1", Message: "retry 7 failed"}) {
+		t.Error("first error of a new window was coalesced")
+	}
+}
+
+func TestCoalesceDisabled(t *testing.T) {
+	pm := newCoalescingMonitor(0)
+	for i := 0; i < 3; i++ {
+		if pm.coalesce(StreamError{ProcessID: "p-1", Message: "boom"}) {
+			t.Fatal("error coalesced with coalescing disabled")
+		}
+	}
+}
+
+func TestHandleBufferOverflowDropsOldest(t *testing.T) {
+	pm := newCoalescingMonitor(0)
+	buffer := make(chan StreamError, 2)
+	buffer <- StreamError{Message: "first"}
+	buffer <- StreamError{Message: "second"}
+
+	pm.queueError(buffer, StreamError{Message: "third"})
+
+	got := []string{(<-buffer).Message, (<-buffer).Message}
+	if got[0] != "second" || got[1] != "third" {
+		t.Errorf("buffer holds %v, want [second third]", got)
+	}
+	if pm.metrics.ErrorsDropped != 1 {
+		t.Errorf("ErrorsDropped = %d, want 1", pm.metrics.ErrorsDropped)
+	}
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrorQuery filters stored errors; zero values match everything
+type ErrorQuery struct {
+	Since      time.Time
+	Until      time.Time
+	ProcessID  string
+	PID        int
+	Types      []string
+	Severities []string
+	Source     string
+	Grep       *regexp.Regexp
+	AfterID    uint64 // oldest first, starting after this ID
+	BeforeID   uint64 // newest first, starting before this ID
+	Newest     bool   // return the most recent matches first
+	Limit      int
+}
+
+// ErrorPage is one page of query results
+type ErrorPage struct {
+	Errors  []StreamError `json:"errors"`
+	Count   int           `json:"count"`
+	HasMore bool          `json:"has_more"`
+	Next    uint64        `json:"next,omitempty"` // cursor for the following page
+}
+
+// ErrorStore keeps a bounded history of every StreamError, independent of
+// the processes that reported it. Errors get increasing IDs, so the history
+// is ordered by arrival and an ID locates an error directly.
+type ErrorStore struct {
+	entries    []StreamError
+	firstID    uint64        // ID of entries[0]
+	highWater  []time.Time   // latest timestamp among entries[:i+1], for time range searches
+	maxLag     time.Duration // how far an error's timestamp has trailed an earlier one
+	byProcess  map[string][]uint64
+	byType     map[string][]uint64
+	bySeverity map[string][]uint64
+	maxEntries int
+
+	storePath  string // empty when errors are not persisted
+	file       *os.File
+	storeLines int
+
+	mutex sync.RWMutex
+}
+
+// errorStorePath returns where errors are persisted, or "" when they are not
+func errorStorePath(workspace string, config *ProcessMonitorConfig) string {
+	if !config.PersistErrors {
+		return ""
+	}
+	return filepath.Join(workspace, ".argus", "errors.jsonl")
+}
+
+// NewErrorStore creates an error store; with a storePath errors are appended
+// to a JSON lines file and reloaded on start
+func NewErrorStore(storePath string, maxEntries int) *ErrorStore {
+	if maxEntries <= 0 {
+		maxEntries = 10000
+	}
+
+	es := &ErrorStore{
+		firstID:    1,
+		byProcess:  make(map[string][]uint64),
+		byType:     make(map[string][]uint64),
+		bySeverity: make(map[string][]uint64),
+		maxEntries: maxEntries,
+		storePath:  storePath,
+	}
+
+	if storePath != "" {
+		if err := es.load(); err != nil {
+			log.Printf("Failed to load error history: %v", err)
+		}
+	}
+
+	return es
+}
+
+// load reads previously persisted errors and compacts the file if needed
+func (es *ErrorStore) load() error {
+	file, err := os.Open(es.storePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	renumbered := false
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var streamError StreamError
+		if err := json.Unmarshal(scanner.Bytes(), &streamError); err != nil || streamError.ID == 0 {
+			continue // Skip corrupt lines
+		}
+		if len(es.entries) > 0 && streamError.ID <= es.lastID() {
+			continue
+		}
+		if len(es.entries) == 0 {
+			es.firstID = streamError.ID
+		}
+		// Skipped corrupt lines leave gaps; IDs are kept contiguous
+		if id := es.firstID + uint64(len(es.entries)); streamError.ID != id {
+			streamError.ID = id
+			renumbered = true
+		}
+		es.insert(streamError)
+		es.storeLines++
+	}
+
+	if renumbered || es.storeLines > len(es.entries) {
+		return es.rewrite()
+	}
+	return scanner.Err()
+}
+
+// rewrite compacts the store file down to the retained errors
+func (es *ErrorStore) rewrite() error {
+	if es.file != nil {
+		es.file.Close()
+		es.file = nil
+	}
+
+	var data []byte
+	for _, streamError := range es.entries {
+		line, err := json.Marshal(streamError)
+		if err != nil {
+			return err
+		}
+		data = append(data, line...)
+		data = append(data, '\n')
+	}
+
+	es.storeLines = len(es.entries)
+	return writeFile(es.storePath, data)
+}
+
+// persist appends an error to the store file, compacting it once it holds
+// twice as many lines as are retained
+func (es *ErrorStore) persist(streamError StreamError) error {
+	if es.storeLines >= 2*es.maxEntries {
+		if err := es.rewrite(); err != nil {
+			return err
+		}
+	}
+
+	if es.file == nil {
+		if err := os.MkdirAll(filepath.Dir(es.storePath), 0755); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+		file, err := os.OpenFile(es.storePath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		es.file = file
+	}
+
+	line, err := json.Marshal(streamError)
+	if err != nil {
+		return err
+	}
+	if _, err := es.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	es.storeLines++
+	return nil
+}
+
+func (es *ErrorStore) lastID() uint64 {
+	return es.firstID + uint64(len(es.entries)) - 1
+}
+
+// insert appends an error with its ID already set, evicting the oldest
+// entries beyond the bound. The caller holds the lock.
+func (es *ErrorStore) insert(streamError StreamError) {
+	// Workers report errors concurrently and coalesced errors keep their
+	// first timestamp, so arrival order is only roughly timestamp order
+	highWater := streamError.Timestamp
+	if n := len(es.highWater); n > 0 {
+		if previous := es.highWater[n-1]; previous.After(highWater) {
+			es.maxLag = max(es.maxLag, previous.Sub(highWater))
+			highWater = previous
+		}
+	}
+
+	es.entries = append(es.entries, streamError)
+	es.highWater = append(es.highWater, highWater)
+	es.byProcess[streamError.ProcessID] = append(es.byProcess[streamError.ProcessID], streamError.ID)
+	es.byType[streamError.ErrorType] = append(es.byType[streamError.ErrorType], streamError.ID)
+	es.bySeverity[streamError.Severity] = append(es.bySeverity[streamError.Severity], streamError.ID)
+
+	if excess := len(es.entries) - es.maxEntries; excess > 0 {
+		es.entries = es.entries[excess:] // append reallocates once the slack is used
+		es.highWater = es.highWater[excess:]
+
+		es.firstID += uint64(excess)
+		es.pruneIndexes()
+	}
+}
+
+// pruneIndexes drops evicted IDs; they are only pruned once an index has
+// accumulated enough of them, so eviction stays cheap per error
+func (es *ErrorStore) pruneIndexes() {
+	for _, index := range []map[string][]uint64{es.byProcess, es.byType, es.bySeverity} {
+		for key, ids := range index {
+			if len(ids) == 0 || ids[0] >= es.firstID {
+				continue
+			}
+			keep := sort.Search(len(ids), func(i int) bool { return ids[i] >= es.firstID })
+			if keep == len(ids) {
+				delete(index, key)
+			} else if keep >= len(ids)/2 || keep >= 1024 {
+				index[key] = append([]uint64{}, ids[keep:]...)
+			}
+		}
+	}
+}
+
+// Add assigns the next ID to an error, stores it and returns the stored copy
+func (es *ErrorStore) Add(streamError StreamError) StreamError {
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+
+	streamError.ID = es.firstID + uint64(len(es.entries))
+	es.insert(streamError)
+
+	if es.storePath != "" {
+		if err := es.persist(streamError); err != nil {
+			log.Printf("Failed to persist error %d: %v", streamError.ID, err)
+		}
+	}
+
+	return streamError
+}
+
+// Len returns the number of retained errors
+func (es *ErrorStore) Len() int {
+	es.mutex.RLock()
+	defer es.mutex.RUnlock()
+	return len(es.entries)
+}
+
+// Close closes the store file
+func (es *ErrorStore) Close() {
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+
+	if es.file != nil {
+		es.file.Close()
+		es.file = nil
+	}
+}
+
+// candidates returns the IDs worth checking for a query, in ascending
+// order: from the smallest matching index, or every ID in the time range
+func (es *ErrorStore) candidates(query ErrorQuery) []uint64 {
+	var best []uint64
+	indexed := false
+	consider := func(ids []uint64) {
+		if !indexed || len(ids) < len(best) {
+			best, indexed = ids, true
+		}
+	}
+
+	if query.ProcessID != "" {
+		consider(es.byProcess[query.ProcessID])
+	}
+	if len(query.Types) == 1 {
+		consider(es.byType[query.Types[0]])
+	}
+	if len(query.Severities) == 1 {
+		consider(es.bySeverity[query.Severities[0]])
+	}
+	if indexed {
+		return best
+	}
+
+	// Timestamps are not strictly ordered, but the running latest one is:
+	// nothing before the first high water mark at Since is recent enough,
+	// and nothing whose high water mark is more than maxLag past Until is
+	// old enough. Matches filters the window exactly.
+	start := 0
+	if !query.Since.IsZero() {
+		start = sort.Search(len(es.highWater), func(i int) bool { return !es.highWater[i].Before(query.Since) })
+	}
+	end := len(es.entries)
+	if !query.Until.IsZero() {
+		until := query.Until.Add(es.maxLag)
+		end = sort.Search(len(es.highWater), func(i int) bool { return es.highWater[i].After(until) })
+	}
+
+	ids := make([]uint64, 0, max(end-start, 0))
+	for i := start; i < end; i++ {
+		ids = append(ids, es.firstID+uint64(i))
+	}
+	return ids
+}
+
+// matches reports whether an error satisfies the query's filters
+func (query ErrorQuery) matches(streamError *StreamError) bool {
+	if !query.Since.IsZero() && streamError.Timestamp.Before(query.Since) {
+		return false
+	}
+	if !query.Until.IsZero() && streamError.Timestamp.After(query.Until) {
+		return false
+	}
+	if query.ProcessID != "" && streamError.ProcessID != query.ProcessID {
+		return false
+	}
+	if query.PID != 0 && streamError.ProcessPID != query.PID {
+		return false
+	}
+	if len(query.Types) > 0 && !containsString(query.Types, streamError.ErrorType) {
+		return false
+	}
+	if len(query.Severities) > 0 && !containsString(query.Severities, streamError.Severity) {
+		return false
+	}
+	if query.Source != "" && streamError.Source != query.Source {
+		return false
+	}
+	if query.Grep != nil && !query.Grep.MatchString(streamError.Message) {
+		return false
+	}
+	return true
+}
+
+// Query returns one page of matching errors. Oldest-first pages continue
+// with AfterID set to Next, newest-first pages with BeforeID.
+func (es *ErrorStore) Query(query ErrorQuery) ErrorPage {
+	es.mutex.RLock()
+	defer es.mutex.RUnlock()
+
+	ids := es.candidates(query)
+	page := ErrorPage{Errors: []StreamError{}}
+
+	take := func(id uint64) bool {
+		if id < es.firstID || len(es.entries) == 0 || id > es.lastID() {
+			return true
+		}
+		if query.AfterID != 0 && id <= query.AfterID {
+			return true
+		}
+		if query.BeforeID != 0 && id >= query.BeforeID {
+			return true
+		}
+
+		streamError := &es.entries[id-es.firstID]
+		if !query.matches(streamError) {
+			return true
+		}
+		if query.Limit > 0 && len(page.Errors) == query.Limit {
+			page.HasMore = true
+			return false
+		}
+		page.Errors = append(page.Errors, *streamError)
+		return true
+	}
+
+	if query.Newest || query.BeforeID != 0 {
+		for i := len(ids) - 1; i >= 0 && take(ids[i]); i-- {
+		}
+	} else {
+		start := sort.Search(len(ids), func(i int) bool { return ids[i] > query.AfterID })
+		for i := start; i < len(ids) && take(ids[i]); i++ {
+		}
+	}
+
+	page.Count = len(page.Errors)
+	if page.HasMore {
+		page.Next = page.Errors[len(page.Errors)-1].ID
+	}
+	return page
+}
+
+func containsString(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
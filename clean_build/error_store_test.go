@@ -0,0 +1,191 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// errorIDs returns the IDs of a page's errors in page order
+func errorIDs(page ErrorPage) []uint64 {
+	ids := []uint64{}
+	for _, streamError := range page.Errors {
+		ids = append(ids, streamError.ID)
+	}
+	return ids
+}
+
+// newTestErrorStore returns a store holding errors 1-6, one second apart
+func newTestErrorStore(t *testing.T, base time.Time) *ErrorStore {
+	t.Helper()
+	store := NewErrorStore("", 100)
+	for _, streamError := range []StreamError{
+		{ProcessID: "p-1", ProcessPID: 10, ErrorType: "runtime", Severity: "error", Source: "stderr", Message: "panic: boom"},
+		{ProcessID: "p-1", ProcessPID: 10, ErrorType: "test", Severity: "error", Source: "stdout", Message: "--- FAIL: TestA"},
+		{ProcessID: "p-2", ProcessPID: 20, ErrorType: "runtime", Severity: "warning", Source: "stderr", Message: "WARN slow query"},
+		{ProcessID: "p-1", ProcessPID: 11, ErrorType: "compilation", Severity: "error", Source: "stderr", Message: "undefined: foo"},
+		{ProcessID: "p-2", ProcessPID: 20, ErrorType: "server", Severity: "error", Source: "stderr", Message: "EADDRINUSE"},
+		{ProcessID: "p-1", ProcessPID: 11, ErrorType: "runtime", Severity: "error", Source: "stdout", Message: "panic: again"},
+	} {
+		streamError.Timestamp = base.Add(time.Duration(store.Len()) * time.Second)
+		store.Add(streamError)
+	}
+	return store
+}
+
+func TestErrorStoreQueryFilters(t *testing.T) {
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := newTestErrorStore(t, base)
+
+	tests := []struct {
+		name  string
+		query ErrorQuery
+		ids   []uint64
+	}{
+		{"everything", ErrorQuery{}, []uint64{1, 2, 3, 4, 5, 6}},
+		{"process", ErrorQuery{ProcessID: "p-2"}, []uint64{3, 5}},
+		{"pid", ErrorQuery{PID: 11}, []uint64{4, 6}},
+		{"one type", ErrorQuery{Types: []string{"runtime"}}, []uint64{1, 3, 6}},
+		{"several types", ErrorQuery{Types: []string{"test", "server"}}, []uint64{2, 5}},
+		{"severity", ErrorQuery{Severities: []string{"warning"}}, []uint64{3}},
+		{"source", ErrorQuery{Source: "stdout"}, []uint64{2, 6}},
+		{"grep", ErrorQuery{Grep: regexp.MustCompile(`^panic`)}, []uint64{1, 6}},
+		{"since", ErrorQuery{Since: base.Add(4 * time.Second)}, []uint64{5, 6}},
+		{"until", ErrorQuery{Until: base.Add(time.Second)}, []uint64{1, 2}},
+		{"window", ErrorQuery{Since: base.Add(time.Second), Until: base.Add(3 * time.Second)}, []uint64{2, 3, 4}},
+		{"combined", ErrorQuery{ProcessID: "p-1", Types: []string{"runtime"}, Since: base.Add(time.Second)}, []uint64{6}},
+		{"newest first", ErrorQuery{ProcessID: "p-1", Newest: true}, []uint64{6, 4, 2, 1}},
+		{"no match", ErrorQuery{ProcessID: "p-3"}, []uint64{}},
+	}
+
+	for _, tt := range tests {
+		page := store.Query(tt.query)
+		if got := errorIDs(page); !reflect.DeepEqual(got, tt.ids) {
+			t.Errorf("%s: IDs = %v, want %v", tt.name, got, tt.ids)
+		}
+		if page.Count != len(tt.ids) || page.HasMore {
+			t.Errorf("%s: count %d, has more %t", tt.name, page.Count, page.HasMore)
+		}
+	}
+}
+
+func TestErrorStorePagination(t *testing.T) {
+	store := newTestErrorStore(t, time.Now())
+
+	// Oldest first, continuing after Next
+	var got []uint64
+	query := ErrorQuery{Limit: 4}
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatal("pagination does not end")
+		}
+		page := store.Query(query)
+		got = append(got, errorIDs(page)...)
+		if !page.HasMore {
+			break
+		}
+		query.AfterID = page.Next
+	}
+	if want := []uint64{1, 2, 3, 4, 5, 6}; !reflect.DeepEqual(got, want) {
+		t.Errorf("oldest-first pages = %v, want %v", got, want)
+	}
+
+	// Newest first, continuing before Next, with a filter
+	got = nil
+	query = ErrorQuery{ProcessID: "p-1", Newest: true, Limit: 3}
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatal("pagination does not end")
+		}
+		page := store.Query(query)
+		got = append(got, errorIDs(page)...)
+		if !page.HasMore {
+			break
+		}
+		query.BeforeID = page.Next
+	}
+	if want := []uint64{6, 4, 2, 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("newest-first pages = %v, want %v", got, want)
+	}
+
+	// A limit equal to the remaining matches has no further page
+	page := store.Query(ErrorQuery{AfterID: 4, Limit: 2})
+	if !reflect.DeepEqual(errorIDs(page), []uint64{5, 6}) || page.HasMore || page.Next != 0 {
+		t.Errorf("last page = %v, has more %t, next %d", errorIDs(page), page.HasMore, page.Next)
+	}
+}
+
+func TestErrorStoreOutOfOrderTimestamps(t *testing.T) {
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := NewErrorStore("", 100)
+
+	// Arrival order differs from timestamp order, as with concurrent
+	// workers and coalesced errors that keep their first timestamp
+	for _, offset := range []int{0, 5, 2, 6, 1, 9, 3} {
+		store.Add(StreamError{ErrorType: "runtime", Severity: "error", Timestamp: base.Add(time.Duration(offset) * time.Second)})
+	}
+
+	tests := []struct {
+		name         string
+		since, until int
+		ids          []uint64
+	}{
+		{"since", 3, -1, []uint64{2, 4, 6, 7}},
+		{"until", -1, 2, []uint64{1, 3, 5}},
+		{"window", 1, 3, []uint64{3, 5, 7}},
+		{"late window", 9, 9, []uint64{6}},
+		{"empty window", 7, 8, []uint64{}},
+	}
+	for _, tt := range tests {
+		query := ErrorQuery{}
+		if tt.since >= 0 {
+			query.Since = base.Add(time.Duration(tt.since) * time.Second)
+		}
+		if tt.until >= 0 {
+			query.Until = base.Add(time.Duration(tt.until) * time.Second)
+		}
+		if got := errorIDs(store.Query(query)); !reflect.DeepEqual(got, tt.ids) {
+			t.Errorf("%s: IDs = %v, want %v", tt.name, got, tt.ids)
+		}
+	}
+}
+
+func TestErrorStoreEviction(t *testing.T) {
+	store := NewErrorStore("", 3)
+	base := time.Now()
+	for i := 0; i < 5; i++ {
+		store.Add(StreamError{ProcessID: "p-1", Severity: "error", Timestamp: base.Add(time.Duration(i) * time.Second)})
+	}
+
+	if store.Len() != 3 {
+		t.Fatalf("Len() = %d, want 3", store.Len())
+	}
+	if got := errorIDs(store.Query(ErrorQuery{ProcessID: "p-1"})); !reflect.DeepEqual(got, []uint64{3, 4, 5}) {
+		t.Errorf("indexed query after eviction = %v, want [3 4 5]", got)
+	}
+	if got := errorIDs(store.Query(ErrorQuery{Since: base})); !reflect.DeepEqual(got, []uint64{3, 4, 5}) {
+		t.Errorf("time query after eviction = %v, want [3 4 5]", got)
+	}
+}
+
+func TestErrorStorePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "errors.jsonl")
+	store := NewErrorStore(path, 2)
+	for _, message := range []string{"first", "second", "third"} {
+		store.Add(StreamError{Message: message, Timestamp: time.Now()})
+	}
+	store.Close()
+
+	// Reloading keeps the retained errors and their IDs
+	reloaded := NewErrorStore(path, 2)
+	defer reloaded.Close()
+	page := reloaded.Query(ErrorQuery{})
+	if !reflect.DeepEqual(errorIDs(page), []uint64{2, 3}) || page.Errors[1].Message != "third" {
+		t.Fatalf("reloaded errors = %+v", page.Errors)
+	}
+	if added := reloaded.Add(StreamError{Message: "fourth"}); added.ID != 4 {
+		t.Errorf("ID after reload = %d, want 4", added.ID)
+	}
+}
@@ -0,0 +1,441 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Errors of workspace path resolution; the handlers map them to statuses
+var (
+	errInvalidPath   = errors.New("invalid path")
+	errOutsideRoot   = errors.New("path is outside the workspace")
+	errIgnoredPath   = errors.New("path is excluded by ignore rules")
+	errFileNotFound  = errors.New("file not found")
+	errNotRegular    = errors.New("not a regular file")
+	errInvalidRange  = errors.New("invalid range")
+	errRangeConflict = errors.New("lines and bytes cannot be combined")
+)
+
+// alwaysHiddenDirs are never served, whatever the ignore files say
+var alwaysHiddenDirs = []string{".git", ".argus"}
+
+// binarySniffSize is how much of a file is inspected to detect binary content
+const binarySniffSize = 8000
+
+// lineBufferSize is the most readLines holds of a line it has not returned
+const lineBufferSize = 64 * 1024
+
+// WorkspaceFile is a file resolved inside the workspace
+type WorkspaceFile struct {
+	FullPath     string // symlinks resolved
+	RelativePath string
+	Info         os.FileInfo
+}
+
+// ETag identifies the file's current version by size and modification time
+func (f *WorkspaceFile) ETag() string {
+	return fmt.Sprintf(`"%x-%x"`, f.Info.Size(), f.Info.ModTime().UnixNano())
+}
+
+// resolveWorkspaceFile turns a percent-encoded, workspace-relative path into
+// a regular file inside the workspace. Symlinks are resolved before the
+// check, so a link pointing outside the workspace is rejected, and paths
+// matched by .gitignore or the hidden directories are refused.
+func (pi *ProjectIntelligence) resolveWorkspaceFile(rawPath string) (*WorkspaceFile, error) {
+	relPath, err := url.PathUnescape(rawPath)
+	if err != nil || relPath == "" || strings.ContainsRune(relPath, 0) {
+		return nil, errInvalidPath
+	}
+	if filepath.IsAbs(relPath) || strings.HasPrefix(relPath, "/") {
+		return nil, errOutsideRoot
+	}
+
+	root := resolveDir(pi.workspace)
+	joined := filepath.Join(root, filepath.FromSlash(relPath))
+	if !withinDir(root, joined) {
+		return nil, errOutsideRoot
+	}
+
+	resolved, err := filepath.EvalSymlinks(joined)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errFileNotFound
+		}
+		return nil, err
+	}
+	if !withinDir(root, resolved) {
+		return nil, errOutsideRoot
+	}
+
+	// Both the requested name and the symlink target must be visible
+	requestedRel, _ := filepath.Rel(root, joined)
+	cleanRel, _ := filepath.Rel(root, resolved)
+	if isHiddenWorkspacePath(requestedRel) || isHiddenWorkspacePath(cleanRel) ||
+		pi.ignores.Ignored(requestedRel) || (cleanRel != requestedRel && pi.ignores.Ignored(cleanRel)) {
+		return nil, errIgnoredPath
+	}
+
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return nil, errFileNotFound
+	}
+	if !info.Mode().IsRegular() {
+		return nil, errNotRegular
+	}
+
+	return &WorkspaceFile{FullPath: resolved, RelativePath: filepath.ToSlash(cleanRel), Info: info}, nil
+}
+
+// isHiddenWorkspacePath reports whether a relative path is inside .git or
+// Argus's own state directory
+func isHiddenWorkspacePath(relPath string) bool {
+	for _, part := range strings.Split(filepath.ToSlash(relPath), "/") {
+		if containsString(alwaysHiddenDirs, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// fileStatus maps a resolution or range error to an HTTP status
+func fileStatus(err error) int {
+	switch {
+	case errors.Is(err, errInvalidPath), errors.Is(err, errInvalidRange), errors.Is(err, errRangeConflict), errors.Is(err, errNotRegular):
+		return 400
+	case errors.Is(err, errOutsideRoot), errors.Is(err, errIgnoredPath):
+		return 403
+	case errors.Is(err, errFileNotFound):
+		return 404
+	}
+	return 500
+}
+
+// FileSample describes the content of a file from its first bytes
+type FileSample struct {
+	Binary   bool   `json:"binary"`
+	Encoding string `json:"encoding"` // utf-8, utf-8-bom, utf-16le, utf-16be, iso-8859-1 or binary
+}
+
+// sniffFile detects binary content and the text encoding of a file
+func sniffFile(path string) (FileSample, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return FileSample{}, err
+	}
+	defer file.Close()
+
+	head := make([]byte, binarySniffSize)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return FileSample{}, err
+	}
+	if n == binarySniffSize {
+		// The sample may end in the middle of a rune
+		return detectEncoding(trimPartialRune(head)), nil
+	}
+	return detectEncoding(head[:n]), nil
+}
+
+// detectEncoding classifies a sample by byte order mark, NUL bytes and UTF-8
+// validity
+func detectEncoding(sample []byte) FileSample {
+	switch {
+	case bytes.HasPrefix(sample, []byte{0xEF, 0xBB, 0xBF}):
+		return FileSample{Encoding: "utf-8-bom"}
+	case bytes.HasPrefix(sample, []byte{0xFF, 0xFE}):
+		return FileSample{Encoding: "utf-16le"}
+	case bytes.HasPrefix(sample, []byte{0xFE, 0xFF}):
+		return FileSample{Encoding: "utf-16be"}
+	}
+
+	if bytes.IndexByte(sample, 0) >= 0 {
+		return FileSample{Binary: true, Encoding: "binary"}
+	}
+
+	if utf8.Valid(sample) {
+		return FileSample{Encoding: "utf-8"}
+	}
+
+	// Legacy 8-bit text has few control characters
+	control := 0
+	for _, b := range sample {
+		if b < 0x20 && b != '\n' && b != '\r' && b != '\t' && b != '\f' {
+			control++
+		}
+	}
+	if control*100 > len(sample) {
+		return FileSample{Binary: true, Encoding: "binary"}
+	}
+	return FileSample{Encoding: "iso-8859-1"}
+}
+
+// decodeText converts file bytes in a detected encoding to UTF-8
+func decodeText(data []byte, encoding string) string {
+	switch encoding {
+	case "utf-8-bom":
+		return strings.ToValidUTF8(string(bytes.TrimPrefix(data, []byte{0xEF, 0xBB, 0xBF})), "�")
+	case "utf-16le", "utf-16be":
+		if len(data) >= 2 && (data[0] == 0xFF && data[1] == 0xFE || data[0] == 0xFE && data[1] == 0xFF) {
+			data = data[2:]
+		}
+		units := make([]uint16, len(data)/2)
+		for i := range units {
+			if encoding == "utf-16le" {
+				units[i] = uint16(data[2*i]) | uint16(data[2*i+1])<<8
+			} else {
+				units[i] = uint16(data[2*i])<<8 | uint16(data[2*i+1])
+			}
+		}
+		return string(utf16.Decode(units))
+	case "iso-8859-1":
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		return string(runes)
+	}
+	return strings.ToValidUTF8(string(data), "�")
+}
+
+// FileRange selects part of a file; at most one of the ranges is set
+type FileRange struct {
+	StartLine, EndLine int   // 1-based and inclusive; EndLine 0 reads to the end
+	StartByte, EndByte int64 // inclusive; EndByte -1 reads to the end
+	Lines, Bytes       bool
+}
+
+// parseFileRange reads the lines=a-b and bytes=a-b query parameters. Either
+// end may be left out: lines=100- reads from line 100, bytes=-512 the last
+// 512 bytes.
+func parseFileRange(lines, byteRange string, size int64) (FileRange, error) {
+	var r FileRange
+	if lines != "" && byteRange != "" {
+		return r, errRangeConflict
+	}
+
+	if lines != "" {
+		start, end, err := parseBounds(lines)
+		if err != nil || (start >= 0 && start < 1) || (end >= 0 && end < 1) || (start > 0 && end > 0 && end < start) {
+			return r, fmt.Errorf("%w: lines must be FIRST-LAST with 1-based line numbers", errInvalidRange)
+		}
+		r.Lines, r.StartLine, r.EndLine = true, int(max(start, 1)), int(max(end, 0))
+		return r, nil
+	}
+
+	if byteRange != "" {
+		start, end, err := parseBounds(byteRange)
+		if err != nil || (start >= 0 && end >= 0 && end < start) || (start < 0 && end < 0) {
+			return r, fmt.Errorf("%w: bytes must be FIRST-LAST byte offsets", errInvalidRange)
+		}
+		r.Bytes = true
+		switch {
+		case start < 0: // suffix: the last end bytes
+			r.StartByte, r.EndByte = max(size-end, 0), -1
+		default:
+			r.StartByte, r.EndByte = start, end
+		}
+		if r.StartByte > size {
+			return r, fmt.Errorf("%w: start is past the end of the file (%d bytes)", errInvalidRange, size)
+		}
+	}
+	return r, nil
+}
+
+// checkRangeEncoding rejects ranges that cannot be cut out of a file as
+// text. Newline bytes do not separate UTF-16 lines, and a UTF-16 byte range
+// must start on a code unit; base64 output takes any byte range.
+func checkRangeEncoding(r FileRange, sample FileSample, asBase64 bool) error {
+	switch {
+	case r.Lines && sample.Binary:
+		return fmt.Errorf("%w: binary files have no lines", errInvalidRange)
+	case r.Lines && strings.HasPrefix(sample.Encoding, "utf-16"):
+		return fmt.Errorf("%w: line ranges are not supported for %s files, use bytes", errInvalidRange, sample.Encoding)
+	case r.Bytes && !asBase64 && strings.HasPrefix(sample.Encoding, "utf-16") && r.StartByte%2 != 0:
+		return fmt.Errorf("%w: %s byte ranges must start at an even offset", errInvalidRange, sample.Encoding)
+	}
+	return nil
+}
+
+// parseBounds splits "a-b" into its ends; a missing end is -1
+func parseBounds(value string) (int64, int64, error) {
+	first, last, found := strings.Cut(value, "-")
+	if !found {
+		// A single number selects just that line or byte
+		last = first
+	}
+	start, end := int64(-1), int64(-1)
+	var err error
+	if first != "" {
+		if start, err = strconv.ParseInt(first, 10, 64); err != nil || start < 0 {
+			return 0, 0, errInvalidRange
+		}
+	}
+	if last != "" {
+		if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < 0 {
+			return 0, 0, errInvalidRange
+		}
+	}
+	return start, end, nil
+}
+
+// FileContent is a read of a workspace file
+type FileContent struct {
+	Content   string
+	Base64    bool  // content is base64 encoded
+	Size      int64 // of the whole file
+	Returned  int   // bytes of the file covered by content
+	StartLine int
+	EndLine   int
+	StartByte int64
+	EndByte   int64 // exclusive
+	Truncated bool
+}
+
+// truncationMarker is appended to text cut at the size cap
+const truncationMarker = "\n[... truncated by Argus: %d of %d bytes shown, request a range for more ...]\n"
+
+// readWorkspaceFile reads the selected range of a file, up to maxBytes.
+// Text is converted to UTF-8 and cut at a line or rune boundary; binary
+// content is only returned, base64 encoded, when asBase64 is set.
+func readWorkspaceFile(f *WorkspaceFile, r FileRange, sample FileSample, maxBytes int64, asBase64 bool) (*FileContent, error) {
+	file, err := os.Open(f.FullPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	size := f.Info.Size()
+	result := &FileContent{Size: size}
+
+	var data []byte
+	if r.Lines {
+		data, err = readLines(file, r, maxBytes, result)
+	} else {
+		start, end := int64(0), size
+		if r.Bytes {
+			start = r.StartByte
+			if r.EndByte >= 0 && r.EndByte+1 < size {
+				end = r.EndByte + 1
+			}
+		}
+		length := end - start
+		if length > maxBytes {
+			length, result.Truncated = maxBytes, true
+		}
+		data = make([]byte, length)
+		var n int
+		n, err = file.ReadAt(data, start)
+		if err == io.EOF {
+			err = nil
+		}
+		data = data[:n]
+		result.StartByte = start
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Truncated && !sample.Binary && !asBase64 && !strings.HasPrefix(sample.Encoding, "utf-16") {
+		data = cutAtBoundary(data)
+	}
+	result.Returned = len(data)
+	result.EndByte = result.StartByte + int64(len(data))
+
+	switch {
+	case asBase64:
+		result.Content, result.Base64 = base64.StdEncoding.EncodeToString(data), true
+	case sample.Binary:
+		return result, nil
+	default:
+		result.Content = decodeText(data, sample.Encoding)
+	}
+
+	if result.Truncated && !result.Base64 {
+		result.Content += fmt.Sprintf(truncationMarker, result.Returned, size)
+	}
+	return result, nil
+}
+
+// readLines reads a line range, stopping at maxBytes. Lines are read in
+// pieces of at most lineBufferSize bytes, so a long line costs no more
+// memory than a short one, whether it is skipped or returned.
+func readLines(file io.Reader, r FileRange, maxBytes int64, result *FileContent) ([]byte, error) {
+	reader := bufio.NewReaderSize(file, lineBufferSize)
+	var data []byte
+	var offset int64
+	line := 0
+	lineStart := true
+
+	for {
+		piece, err := reader.ReadSlice('\n')
+		if len(piece) > 0 {
+			if lineStart {
+				line++
+				if line == r.StartLine {
+					result.StartByte, result.StartLine = offset, line
+				}
+			}
+			offset += int64(len(piece))
+			lineStart = piece[len(piece)-1] == '\n'
+
+			if line >= r.StartLine {
+				if int64(len(data)+len(piece)) > maxBytes {
+					data = append(data, piece[:maxBytes-int64(len(data))]...)
+					result.Truncated = true
+					result.EndLine = line
+					return data, nil
+				}
+				data = append(data, piece...)
+				result.EndLine = line
+				if lineStart && r.EndLine > 0 && line >= r.EndLine {
+					return data, nil
+				}
+			}
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == io.EOF {
+			if line < r.StartLine {
+				return nil, fmt.Errorf("%w: the file has %d lines", errInvalidRange, line)
+			}
+			return data, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// cutAtBoundary drops the partial line at the end of truncated text, or an
+// incomplete rune when the text is one long line
+func cutAtBoundary(data []byte) []byte {
+	if i := bytes.LastIndexByte(data, '\n'); i >= 0 {
+		return data[:i+1]
+	}
+	return trimPartialRune(data)
+}
+
+// trimPartialRune drops the start of a multi-byte rune cut off at the end of data
+func trimPartialRune(data []byte) []byte {
+	for i := 1; i < utf8.UTFMax && i <= len(data); i++ {
+		if utf8.RuneStart(data[len(data)-i]) {
+			if !utf8.FullRune(data[len(data)-i:]) {
+				return data[:len(data)-i]
+			}
+			break
+		}
+	}
+	return data
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseBounds(t *testing.T) {
+	tests := []struct {
+		value      string
+		start, end int64
+		valid      bool
+	}{
+		{"10-20", 10, 20, true},
+		{"10-", 10, -1, true},
+		{"-512", -1, 512, true},
+		{"7", 7, 7, true},
+		{"-", -1, -1, true},
+		{"a-5", 0, 0, false},
+		{"5-b", 0, 0, false},
+		{"1-2-3", 0, 0, false},
+		{"", -1, -1, true},
+	}
+
+	for _, tt := range tests {
+		start, end, err := parseBounds(tt.value)
+		if (err == nil) != tt.valid {
+			t.Errorf("parseBounds(%q) error = %v, want valid=%t", tt.value, err, tt.valid)
+			continue
+		}
+		if tt.valid && (start != tt.start || end != tt.end) {
+			t.Errorf("parseBounds(%q) = %d, %d, want %d, %d", tt.value, start, end, tt.start, tt.end)
+		}
+	}
+}
+
+func TestParseFileRange(t *testing.T) {
+	tests := []struct {
+		lines, bytes string
+		want         FileRange
+		err          error
+	}{
+		{"", "", FileRange{}, nil},
+		{"5-10", "", FileRange{Lines: true, StartLine: 5, EndLine: 10}, nil},
+		{"100-", "", FileRange{Lines: true, StartLine: 100}, nil},
+		{"-20", "", FileRange{Lines: true, StartLine: 1, EndLine: 20}, nil},
+		{"3", "", FileRange{Lines: true, StartLine: 3, EndLine: 3}, nil},
+		{"0-4", "", FileRange{}, errInvalidRange},
+		{"10-5", "", FileRange{}, errInvalidRange},
+		{"", "0-99", FileRange{Bytes: true, StartByte: 0, EndByte: 99}, nil},
+		{"", "900-", FileRange{Bytes: true, StartByte: 900, EndByte: -1}, nil},
+		{"", "-100", FileRange{Bytes: true, StartByte: 900, EndByte: -1}, nil},
+		{"", "-5000", FileRange{Bytes: true, StartByte: 0, EndByte: -1}, nil},
+		{"", "50-10", FileRange{}, errInvalidRange},
+		{"", "1001-", FileRange{}, errInvalidRange},
+		{"", "-", FileRange{}, errInvalidRange},
+		{"1-2", "0-10", FileRange{}, errRangeConflict},
+	}
+
+	for _, tt := range tests {
+		got, err := parseFileRange(tt.lines, tt.bytes, 1000)
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Errorf("parseFileRange(%q, %q) error = %v, want %v", tt.lines, tt.bytes, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseFileRange(%q, %q) = %+v, %v, want %+v", tt.lines, tt.bytes, got, err, tt.want)
+		}
+	}
+}
+
+func TestDetectEncoding(t *testing.T) {
+	tests := []struct {
+		name   string
+		sample []byte
+		want   FileSample
+	}{
+		{"ascii", []byte("package main\n"), FileSample{Encoding: "utf-8"}},
+		{"utf-8", []byte("héllo wörld\n"), FileSample{Encoding: "utf-8"}},
+		{"utf-8 bom", []byte("\xEF\xBB\xBFid,name\n"), FileSample{Encoding: "utf-8-bom"}},
+		{"utf-16le", []byte("\xFF\xFEh\x00i\x00"), FileSample{Encoding: "utf-16le"}},
+		{"utf-16be", []byte("\xFE\xFF\x00h\x00i"), FileSample{Encoding: "utf-16be"}},
+		{"nul bytes", []byte("\x7FELF\x02\x01\x01\x00\x00"), FileSample{Binary: true, Encoding: "binary"}},
+		{"latin-1", []byte("caf\xE9 cr\xE8me\n"), FileSample{Encoding: "iso-8859-1"}},
+		{"control bytes", []byte("\x01\x02\x03\xFF\x04\x05"), FileSample{Binary: true, Encoding: "binary"}},
+		{"empty", nil, FileSample{Encoding: "utf-8"}},
+	}
+
+	for _, tt := range tests {
+		if got := detectEncoding(tt.sample); got != tt.want {
+			t.Errorf("%s: detectEncoding() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCheckRangeEncoding(t *testing.T) {
+	utf16 := FileSample{Encoding: "utf-16le"}
+	tests := []struct {
+		name     string
+		r        FileRange
+		sample   FileSample
+		asBase64 bool
+		valid    bool
+	}{
+		{"utf-8 lines", FileRange{Lines: true, StartLine: 1}, FileSample{Encoding: "utf-8"}, false, true},
+		{"binary lines", FileRange{Lines: true, StartLine: 1}, FileSample{Binary: true, Encoding: "binary"}, true, false},
+		{"utf-16 lines", FileRange{Lines: true, StartLine: 1}, utf16, false, false},
+		{"utf-16 even bytes", FileRange{Bytes: true, StartByte: 2, EndByte: 9}, utf16, false, true},
+		{"utf-16 odd bytes", FileRange{Bytes: true, StartByte: 3, EndByte: 9}, utf16, false, false},
+		{"utf-16 odd bytes as base64", FileRange{Bytes: true, StartByte: 3, EndByte: 9}, utf16, true, true},
+		{"utf-16 whole file", FileRange{}, utf16, false, true},
+	}
+
+	for _, tt := range tests {
+		err := checkRangeEncoding(tt.r, tt.sample, tt.asBase64)
+		if (err == nil) != tt.valid || (err != nil && !errors.Is(err, errInvalidRange)) {
+			t.Errorf("%s: checkRangeEncoding() = %v, want valid=%t", tt.name, err, tt.valid)
+		}
+	}
+}
+
+func TestReadLinesSkipsLongLines(t *testing.T) {
+	long := strings.Repeat("x", 3*lineBufferSize) + "\n"
+	text := "first\n" + long + "third\nfourth\n"
+
+	var result FileContent
+	data, err := readLines(strings.NewReader(text), FileRange{Lines: true, StartLine: 3, EndLine: 3}, 1<<20, &result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "third\n" {
+		t.Errorf("read %q, want the third line", data)
+	}
+	if want := int64(len("first\n") + len(long)); result.StartByte != want {
+		t.Errorf("StartByte = %d, want %d", result.StartByte, want)
+	}
+	if result.StartLine != 3 || result.EndLine != 3 {
+		t.Errorf("lines %d-%d, want 3-3", result.StartLine, result.EndLine)
+	}
+}
+
+func TestReadLinesTruncatesLongLine(t *testing.T) {
+	text := "first\n" + strings.Repeat("y", 2*lineBufferSize) + "\nthird\n"
+
+	var result FileContent
+	data, err := readLines(strings.NewReader(text), FileRange{Lines: true, StartLine: 2}, 1000, &result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 1000 || !result.Truncated || result.EndLine != 2 {
+		t.Errorf("read %d bytes, truncated=%t, end line %d, want 1000 bytes of line 2 truncated", len(data), result.Truncated, result.EndLine)
+	}
+
+	// A line longer than the buffer is returned whole when it fits
+	result = FileContent{}
+	data, err = readLines(strings.NewReader(text), FileRange{Lines: true, StartLine: 2, EndLine: 2}, 1<<20, &result)
+	if err != nil || len(data) != 2*lineBufferSize+1 || result.Truncated {
+		t.Errorf("read %d bytes, %v, truncated=%t, want the whole second line", len(data), err, result.Truncated)
+	}
+}
+
+func TestReadLinesPastEnd(t *testing.T) {
+	var result FileContent
+	_, err := readLines(strings.NewReader("one\ntwo"), FileRange{Lines: true, StartLine: 5}, 1<<20, &result)
+	if !errors.Is(err, errInvalidRange) {
+		t.Errorf("error = %v, want errInvalidRange", err)
+	}
+}
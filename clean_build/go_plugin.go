@@ -182,12 +182,8 @@ func (gp *GoPlugin) FindServices(projectPath string) ([]ServiceInfo, error) {
 			Language:  "go",
 			Framework: framework,
 			Port:      8080,
-			Status:    "stopped",
-		}
-
-		if isPortInUse(8080) {
-			service.Status = "running"
 		}
+		applyPortStatus(&service)
 
 		services = append(services, service)
 	}
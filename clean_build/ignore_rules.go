@@ -0,0 +1,210 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ignoreCacheTTL bounds how long a decision is reused when no .gitignore on
+// its path has changed; it covers the excludes files that are not tracked
+const ignoreCacheTTL = 10 * time.Second
+
+// maxIgnoreCacheEntries caps the cache, which is cleared when it fills up
+const maxIgnoreCacheEntries = 4096
+
+// ignoreEntry is a cached decision with the ignore files it was made with
+type ignoreEntry struct {
+	ignored   bool
+	signature string
+	checkedAt time.Time
+}
+
+// IgnoreChecker decides whether workspace paths are ignored. It asks git and
+// parses the .gitignore files itself when the workspace is not a git
+// repository or git is not installed. Decisions are cached so that file
+// requests do not fork git every time.
+type IgnoreChecker struct {
+	root    string
+	entries map[string]ignoreEntry
+	mutex   sync.Mutex
+}
+
+// NewIgnoreChecker creates a checker for the workspace at root
+func NewIgnoreChecker(root string) *IgnoreChecker {
+	return &IgnoreChecker{
+		root:    root,
+		entries: make(map[string]ignoreEntry),
+	}
+}
+
+// Ignored reports whether a workspace-relative path is ignored
+func (ic *IgnoreChecker) Ignored(relPath string) bool {
+	relPath = filepath.ToSlash(filepath.Clean(relPath))
+	signature := ic.signature(relPath)
+
+	ic.mutex.Lock()
+	entry, cached := ic.entries[relPath]
+	ic.mutex.Unlock()
+	if cached && entry.signature == signature && time.Since(entry.checkedAt) < ignoreCacheTTL {
+		return entry.ignored
+	}
+
+	ignored, answered := gitIgnored(ic.root, relPath)
+	if !answered {
+		ignored = gitignoreMatch(ic.root, relPath)
+	}
+
+	ic.mutex.Lock()
+	if len(ic.entries) >= maxIgnoreCacheEntries {
+		ic.entries = make(map[string]ignoreEntry)
+	}
+	ic.entries[relPath] = ignoreEntry{ignored: ignored, signature: signature, checkedAt: time.Now()}
+	ic.mutex.Unlock()
+	return ignored
+}
+
+// signature identifies the versions of the ignore files that apply to a
+// path, so a cached decision is dropped as soon as one of them changes
+func (ic *IgnoreChecker) signature(relPath string) string {
+	files := []string{filepath.Join(ic.root, ".git", "info", "exclude"), filepath.Join(ic.root, ".gitignore")}
+	dir := ic.root
+	parts := strings.Split(relPath, "/")
+	for _, part := range parts[:len(parts)-1] {
+		dir = filepath.Join(dir, part)
+		files = append(files, filepath.Join(dir, ".gitignore"))
+	}
+
+	var signature strings.Builder
+	for i, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			fmt.Fprintf(&signature, "%d:%d:%d;", i, info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	return signature.String()
+}
+
+// gitIgnored asks git whether a path is ignored, which covers nested
+// .gitignore files, .git/info/exclude and the global excludes file.
+// answered is false when git could not decide.
+func gitIgnored(root, relPath string) (ignored, answered bool) {
+	cmd := exec.Command("git", "check-ignore", "-q", "--", relPath)
+	cmd.Dir = root
+	// Exit status 0 means ignored; 1 not ignored; 128 not a repository
+	err := cmd.Run()
+	if err == nil {
+		return true, true
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return false, true
+	}
+	return false, false
+}
+
+// ignoreRule is one pattern of a .gitignore file
+type ignoreRule struct {
+	segments []string // "**" matches any number of path segments
+	negate   bool
+	dirOnly  bool
+}
+
+// parseIgnoreRules reads the patterns of a .gitignore file. Patterns
+// without a slash match at any depth; the others are relative to the
+// directory of the file.
+func parseIgnoreRules(data string) []ignoreRule {
+	var rules []ignoreRule
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimRight(line, "\r ")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var rule ignoreRule
+		if strings.HasPrefix(line, "!") {
+			rule.negate, line = true, line[1:]
+		} else if strings.HasPrefix(line, `\`) {
+			// \# and \! start patterns with a literal # or !
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly, line = true, strings.TrimRight(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+
+		if strings.Contains(line, "/") {
+			line = strings.TrimPrefix(line, "/")
+		} else {
+			line = "**/" + line
+		}
+		rule.segments = strings.Split(line, "/")
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// gitignoreMatch applies the .gitignore files from the workspace root down
+// to a path. As in git, everything inside an ignored directory is ignored.
+func gitignoreMatch(root, relPath string) bool {
+	parts := strings.Split(relPath, "/")
+	levels := make([][]ignoreRule, 0, len(parts))
+
+	for depth := range parts {
+		var rules []ignoreRule
+		if data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(strings.Join(parts[:depth], "/")), ".gitignore")); err == nil {
+			rules = parseIgnoreRules(string(data))
+		}
+		levels = append(levels, rules)
+
+		// Every prefix but the path itself is a directory
+		if ignoredBy(levels, parts[:depth+1], depth < len(parts)-1) {
+			return true
+		}
+	}
+	return false
+}
+
+// ignoredBy applies the rules of each directory level to the path below
+// it; the last matching rule wins
+func ignoredBy(levels [][]ignoreRule, parts []string, isDir bool) bool {
+	ignored := false
+	for depth, rules := range levels {
+		for _, rule := range rules {
+			if rule.dirOnly && !isDir {
+				continue
+			}
+			if matchSegments(rule.segments, parts[depth:]) {
+				ignored = !rule.negate
+			}
+		}
+	}
+	return ignored
+}
+
+// matchSegments matches path segments against glob segments
+func matchSegments(pattern, parts []string) bool {
+	if len(pattern) == 0 {
+		return len(parts) == 0
+	}
+	if pattern[0] == "**" {
+		for skip := 0; skip <= len(parts); skip++ {
+			if matchSegments(pattern[1:], parts[skip:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(parts) == 0 {
+		return false
+	}
+	matched, _ := path.Match(pattern[0], parts[0])
+	return matched && matchSegments(pattern[1:], parts[1:])
+}
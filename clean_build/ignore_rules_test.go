@@ -0,0 +1,127 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// writeWorkspace creates files under root, making parent directories
+func writeWorkspace(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGitignoreMatch(t *testing.T) {
+	root := t.TempDir()
+	writeWorkspace(t, root, map[string]string{
+		".gitignore":     "# build output\n*.log\n!keep.log\nbuild/\n/secrets.txt\ndocs/**/*.tmp\n\\#notes\ncache\n",
+		"web/.gitignore": "dist\n!*.log\n",
+	})
+
+	tests := []struct {
+		path    string
+		ignored bool
+	}{
+		{"server.log", true},
+		{"logs/server.log", true},
+		{"keep.log", false},
+		{"build/app", true},
+		{"src/build/app", true},
+		{"build", false}, // a file named like a directory-only pattern
+		{"secrets.txt", true},
+		{"config/secrets.txt", false},
+		{"docs/a/b/draft.tmp", true},
+		{"docs/draft.tmp", true},
+		{"draft.tmp", false},
+		{"#notes", true},
+		{"cache", true},
+		{"cache/entry", true},
+		{"web/dist/app.js", true},
+		{"web/server.log", false},
+		{"main.go", false},
+	}
+
+	for _, tt := range tests {
+		if got := gitignoreMatch(root, tt.path); got != tt.ignored {
+			t.Errorf("gitignoreMatch(%q) = %t, want %t", tt.path, got, tt.ignored)
+		}
+	}
+}
+
+func TestIgnoreCheckerWithoutGit(t *testing.T) {
+	root := t.TempDir()
+	writeWorkspace(t, root, map[string]string{".gitignore": "*.log\n"})
+	checker := NewIgnoreChecker(root)
+
+	if !checker.Ignored("app.log") {
+		t.Fatal("app.log not ignored outside a git repository")
+	}
+	if checker.Ignored("main.go") {
+		t.Fatal("main.go ignored")
+	}
+
+	// Editing the .gitignore invalidates the cached decision
+	writeWorkspace(t, root, map[string]string{".gitignore": "*.tmp\n"})
+	if checker.Ignored("app.log") {
+		t.Error("cached decision kept after the .gitignore changed")
+	}
+}
+
+func TestIgnoreCheckerCachesDecisions(t *testing.T) {
+	root := t.TempDir()
+	checker := NewIgnoreChecker(root)
+
+	if checker.Ignored("app.log") {
+		t.Fatal("app.log ignored without ignore files")
+	}
+
+	// A decision within the TTL is reused without asking again
+	entry := checker.entries["app.log"]
+	entry.ignored = true
+	checker.entries["app.log"] = entry
+	if !checker.Ignored("app.log") {
+		t.Error("cached decision not used")
+	}
+
+	// An expired one is not
+	entry.checkedAt = entry.checkedAt.Add(-ignoreCacheTTL)
+	checker.entries["app.log"] = entry
+	if checker.Ignored("app.log") {
+		t.Error("expired decision used")
+	}
+}
+
+func TestIgnoreCheckerAsksGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	root := t.TempDir()
+	if err := exec.Command("git", "init", "-q", root).Run(); err != nil {
+		t.Fatal(err)
+	}
+	writeWorkspace(t, root, map[string]string{
+		".gitignore":        "*.log\n",
+		".git/info/exclude": "local/\n",
+	})
+	checker := NewIgnoreChecker(root)
+
+	if !checker.Ignored("app.log") || !checker.Ignored("local/notes.md") {
+		t.Error("paths ignored by git were not reported")
+	}
+	if ignored, answered := gitIgnored(root, "main.go"); ignored || !answered {
+		t.Errorf("gitIgnored(main.go) = %t, %t, want an answer of not ignored", ignored, answered)
+	}
+	if _, answered := gitIgnored(t.TempDir(), "main.go"); answered {
+		t.Error("git answered outside a repository")
+	}
+}
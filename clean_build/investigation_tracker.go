@@ -201,6 +201,35 @@ func (it *InvestigationTracker) AddFinding(title, description, impact, category
 	return f
 }
 
+// AddEvidence attaches evidence to an existing finding
+func (it *InvestigationTracker) AddEvidence(findingID string, evidence Evidence) (*Finding, error) {
+	it.mutex.Lock()
+	defer it.mutex.Unlock()
+
+	finding, exists := it.activeFindings[findingID]
+	if !exists {
+		return nil, fmt.Errorf("finding not found: %s", findingID)
+	}
+
+	if evidence.Timestamp.IsZero() {
+		evidence.Timestamp = time.Now()
+	}
+	finding.Evidence = append(finding.Evidence, evidence)
+
+	// Update in current snapshot
+	if it.currentSnapshot != nil {
+		for i, f := range it.currentSnapshot.Investigation.Findings {
+			if f.ID == findingID {
+				it.currentSnapshot.Investigation.Findings[i] = *finding
+				break
+			}
+		}
+		it.currentSnapshot.UpdatedAt = time.Now()
+	}
+
+	return finding, nil
+}
+
 // AddBlocker adds a new blocker
 func (it *InvestigationTracker) AddBlocker(title, description, severity, blockerType string) *Blocker {
 	it.mutex.Lock()
@@ -405,22 +405,18 @@ func (jsp *JavaScriptPlugin) analyzePackageJSONServices(packageJSONPath string)
 		framework = "next"
 	}
 
-	// Check if service is likely running
-	status := "stopped"
-	if isPortInUse(defaultPort) {
-		status = "running"
-	}
-
 	service := ServiceInfo{
 		ID:         fmt.Sprintf("js-%s", pkg.Name),
 		Name:       pkg.Name,
 		Language:   "javascript",
 		Framework:  framework,
 		Port:       defaultPort,
-		Status:     status,
 		ConfigFile: "package.json",
 	}
 
+	// Check if service is likely running
+	applyPortStatus(&service)
+
 	// Add start command if available
 	if startCmd, exists := pkg.Scripts["start"]; exists {
 		service.StartCommand = fmt.Sprintf("npm run start (%s)", startCmd)
@@ -362,11 +362,21 @@ func (ld *LanguageDetector) DetectLanguages() ([]DetectedLanguage, error) {
 	}
 
 	// Convert map to slice and sort by file count
+	buildTools := detectBuildTools(ld.workspace)
+	ld.BuildSystems = buildTools
+
 	result := make([]DetectedLanguage, 0, len(detected))
-	for _, lang := range detected {
+	for langName, lang := range detected {
 		// Detect testing and linting setup
 		lang.HasTests = ld.hasTestFiles(lang)
 		lang.HasLinting = ld.hasLintingSetup(lang)
+
+		for _, tool := range buildTools {
+			if tool.Language == langName {
+				lang.BuildTools = append(lang.BuildTools, tool)
+			}
+		}
+
 		result = append(result, *lang)
 	}
 
@@ -673,6 +683,60 @@ func (ld *LanguageDetector) hasLintingSetup(detected *DetectedLanguage) bool {
 	return false
 }
 
+// knownBuildTools lists build systems and the directories their output lands in
+var knownBuildTools = []BuildTool{
+	{Name: "go", Language: "go", ConfigFiles: []string{"go.mod"}, Commands: []string{"go build"}, OutputDir: "bin"},
+	{Name: "cargo", Language: "rust", ConfigFiles: []string{"Cargo.toml"}, Commands: []string{"cargo build"}, OutputDir: "target"},
+	{Name: "vite", Language: "javascript", ConfigFiles: []string{"vite.config.js", "vite.config.ts", "vite.config.mjs"}, Commands: []string{"vite build"}, OutputDir: "dist"},
+	{Name: "webpack", Language: "javascript", ConfigFiles: []string{"webpack.config.js", "webpack.config.ts"}, Commands: []string{"webpack"}, OutputDir: "dist"},
+	{Name: "rollup", Language: "javascript", ConfigFiles: []string{"rollup.config.js", "rollup.config.mjs"}, Commands: []string{"rollup -c"}, OutputDir: "dist"},
+	{Name: "tsc", Language: "typescript", ConfigFiles: []string{"tsconfig.json"}, Commands: []string{"tsc"}, OutputDir: "dist"},
+	{Name: "react-scripts", Language: "javascript", ConfigFiles: []string{"package.json"}, Commands: []string{"react-scripts build"}, OutputDir: "build"},
+}
+
+// detectBuildTools returns the build tools configured in the workspace
+func detectBuildTools(workspace string) []BuildTool {
+	tools := []BuildTool{}
+
+	for _, tool := range knownBuildTools {
+		for _, configFile := range tool.ConfigFiles {
+			if _, err := os.Stat(filepath.Join(workspace, configFile)); err != nil {
+				continue
+			}
+
+			// react-scripts shares package.json with every Node project
+			if tool.Name == "react-scripts" && !packageJSONDependsOn(workspace, "react-scripts") {
+				break
+			}
+
+			tools = append(tools, tool)
+			break
+		}
+	}
+
+	return tools
+}
+
+// packageJSONDependsOn reports whether package.json lists the given dependency
+func packageJSONDependsOn(workspace, dependency string) bool {
+	content, err := os.ReadFile(filepath.Join(workspace, "package.json"))
+	if err != nil {
+		return false
+	}
+
+	var pkg struct {
+		Dependencies    map[string]string `json:"dependencies"`
+		DevDependencies map[string]string `json:"devDependencies"`
+	}
+	if err := json.Unmarshal(content, &pkg); err != nil {
+		return false
+	}
+
+	_, inDeps := pkg.Dependencies[dependency]
+	_, inDevDeps := pkg.DevDependencies[dependency]
+	return inDeps || inDevDeps
+}
+
 // GetProjectTopology returns the complete project topology
 func (ld *LanguageDetector) GetProjectTopology() (*ProjectTopology, error) {
 	languages, err := ld.DetectLanguages()
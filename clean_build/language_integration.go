@@ -259,8 +259,8 @@ type EnhancedIntelligenceServer struct {
 
 // NewEnhancedIntelligenceServer creates an enhanced intelligence server
 func NewEnhancedIntelligenceServer(workspace string) *EnhancedIntelligenceServer {
-	baseServer := NewIntelligenceServer(workspace)
 	epi := NewEnhancedProjectIntelligence(workspace)
+	baseServer := newIntelligenceServer(epi.ProjectIntelligence)
 	snapshotManager := NewSnapshotManager(filepath.Join(workspace, ".argus", "snapshots"))
 	investigationTracker := NewInvestigationTracker()
 	versionManager := NewVersionManager(snapshotManager)
@@ -277,9 +277,6 @@ func NewEnhancedIntelligenceServer(workspace string) *EnhancedIntelligenceServer
 		snapshotSharer:       snapshotSharer,
 	}
 
-	// Replace the base PI with enhanced PI
-	server.IntelligenceServer.pi = epi.ProjectIntelligence
-
 	// Setup enhanced routes
 	server.setupEnhancedRoutes()
 	
@@ -334,6 +331,7 @@ func (eis *EnhancedIntelligenceServer) setupEnhancedRoutes() {
 	eis.app.Post("/api/investigation/hypotheses", eis.addHypothesisHandler)
 	eis.app.Put("/api/investigation/hypotheses/:id", eis.updateHypothesisHandler)
 	eis.app.Post("/api/investigation/findings", eis.addFindingHandler)
+	eis.app.Post("/api/investigation/findings/:id/evidence", eis.addEvidenceHandler)
 	eis.app.Post("/api/investigation/blockers", eis.addBlockerHandler)
 	eis.app.Put("/api/investigation/blockers/:id", eis.resolveBlockerHandler)
 
@@ -1313,6 +1311,65 @@ func (eis *EnhancedIntelligenceServer) addFindingHandler(c *fiber.Ctx) error {
 	})
 }
 
+// addEvidenceHandler attaches evidence to a finding; a process recording
+// is referenced by its download endpoint and path in the workspace
+func (eis *EnhancedIntelligenceServer) addEvidenceHandler(c *fiber.Ctx) error {
+	var req struct {
+		Type      string `json:"type"`
+		Source    string `json:"source"`
+		Content   string `json:"content"`
+		Process   string `json:"process"`
+		Recording string `json:"recording"`
+	}
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	evidence := Evidence{Type: req.Type, Source: req.Source, Content: req.Content}
+	if req.Recording != "" {
+		pm := eis.epi.processMonitor
+		id := req.Process
+		if process, err := pm.ResolveProcess(id); err == nil {
+			id = process.ID
+		}
+
+		path, err := pm.recordings.Path(id, req.Recording)
+		if err != nil {
+			return c.Status(404).JSON(fiber.Map{
+				"error":   "Recording not found",
+				"details": err.Error(),
+			})
+		}
+		if rel, err := filepath.Rel(eis.epi.workspace, path); err == nil {
+			path = rel
+		}
+
+		evidence = Evidence{
+			Type:    "recording",
+			Source:  fmt.Sprintf("/processes/%s/recordings/%s", id, req.Recording),
+			Content: path,
+		}
+	}
+
+	if evidence.Type == "" || (evidence.Source == "" && evidence.Content == "") {
+		return c.Status(400).JSON(fiber.Map{"error": "Type and source or content are required"})
+	}
+
+	finding, err := eis.investigationTracker.AddEvidence(c.Params("id"), evidence)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error":   "Finding not found",
+			"details": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Evidence added to finding",
+		"finding": finding,
+	})
+}
+
 func (eis *EnhancedIntelligenceServer) addBlockerHandler(c *fiber.Ctx) error {
 	var req struct {
 		Title       string `json:"title"`
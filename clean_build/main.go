@@ -3,9 +3,13 @@ package main
 import (
 	"bufio"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"go/parser"
+	"go/token"
 	"io"
 	"io/fs"
 	"log"
@@ -37,18 +41,36 @@ type ProjectIntelligence struct {
 	buildWatcher   *BuildWatcher
 	processWatcher *ProcessWatcher
 	processMonitor *ProcessMonitor
+	services       *ServiceManager
+	alerts         *AlertManager
 	lastSnapshot   *ProjectSnapshot
 	config         *ProcessMonitorConfig
+	ignores        *IgnoreChecker
 	mutex          sync.RWMutex
 }
 
 // ProcessMonitor manages real-time process monitoring
 type ProcessMonitor struct {
-	activeProcesses map[int]*MonitoredProcess
+	activeProcesses map[string]*MonitoredProcess // keyed by stable process ID
 	errorStream     chan StreamError
 	config          *ProcessMonitorConfig
 	metrics         *ProcessMetrics
-	wsConnections   map[*websocket.Conn]bool
+	errorClients    *Broadcaster // batches of StreamErrors for WebSocket clients
+	errorBatch      []StreamError
+	batchMutex      sync.Mutex
+	coalescing      map[string]*coalescedError // owned by processErrorStream
+	inspector       *ProcInspector
+	sampler         *ProcInspector // resource sampling only, with its own CPU baselines
+	logs            *ProcessLogStore
+	recordings      *RecordingStore
+	errors          *ErrorStore    // every reported error, kept after processes are cleaned up
+	ended           []EndedProcess // run history of cleaned up processes, oldest first
+	plugins         *LanguagePluginManager
+	alerts          *AlertManager
+	policy          *PolicyEngine
+	dirLanguages    map[string][]LanguagePlugin // languages detected per working directory
+	starting        int                         // starts between reserveStart and releaseStart
+	startingNames   map[string]bool
 	mutex           sync.RWMutex
 	ctx             context.Context
 	cancel          context.CancelFunc
@@ -56,43 +78,98 @@ type ProcessMonitor struct {
 
 // MonitoredProcess represents a monitored process
 type MonitoredProcess struct {
-	PID         int          `json:"pid"`
-	Command     string       `json:"command"`
-	Args        []string     `json:"args"`
-	StartTime   time.Time    `json:"start_time"`
-	Status      string       `json:"status"` // running, stopped, error
-	OutputLines []string     `json:"output_lines"`
-	ErrorLines  []string     `json:"error_lines"`
-	LastError   *StreamError `json:"last_error,omitempty"`
-	WorkingDir  string       `json:"working_dir"`
-	cmd         *exec.Cmd
-	stdoutPipe  io.ReadCloser
-	stderrPipe  io.ReadCloser
-	mutex       sync.RWMutex
+	ID          string          `json:"id"`             // stable across restarts
+	Name        string          `json:"name,omitempty"` // optional, unique among monitored processes
+	PID         int             `json:"pid"`            // of the current run
+	Command     string          `json:"command"`
+	Args        []string        `json:"args"`
+	StartTime   time.Time       `json:"start_time"`
+	Status      string          `json:"status"` // running, unhealthy, stopped, error, restarting, crash_loop, timeout, oom_killed, pids_limit, cpu_time
+	OutputLines []string        `json:"output_lines"`
+	ErrorLines  []string        `json:"error_lines"`
+	LastError   *StreamError    `json:"last_error,omitempty"`
+	WorkingDir  string          `json:"working_dir"`
+	Service     string          `json:"service,omitempty"`
+	Resources   *ResourceSample `json:"resources,omitempty"` // latest sample
+	resources   *ResourceSeries
+
+	// Exit and supervision state, carried over across automatic restarts
+	ExitCode         *int           `json:"exit_code,omitempty"`
+	ExitCodes        []int          `json:"exit_codes,omitempty"`
+	RestartCount     int            `json:"restart_count"`
+	Runs             []ProcessRun   `json:"runs"`
+	Restarts         []RestartEvent `json:"restarts,omitempty"`
+	NextRestart      *time.Time     `json:"next_restart,omitempty"`
+	StderrTail       []string       `json:"stderr_tail,omitempty"` // captured on crash_loop
+	Health           *ProbeStatus   `json:"health,omitempty"`      // set when a liveness probe is configured
+	Prompt           *InputPrompt   `json:"prompt,omitempty"`      // output waiting for input, cleared by input
+	Limits           *LimitStatus   `json:"limits,omitempty"`      // timeout and resource limits of the current run
+	restartRequested bool           // killed by a failed liveness probe
+	restartPending   bool           // exited and handed to the supervisor, which has not decided yet
+	spec             ProcessCommand
+	stderrTail       []string
+	stopRequested    chan struct{} // closed when a stop is requested
+	exited           chan struct{} // closed once the process has been reaped
+	rawOutput        []OutputChunk // unprocessed output including escape codes
+	rawBytes         int
+	logFile          *ProcessLog
+	recording        *ProcessRecording // asciicast of the current run, when recorded
+	env              []EnvVar          // effective environment of the current run
+	outputReaders    sync.WaitGroup
+	matcher          *ErrorMatcher
+
+	cmd           *exec.Cmd
+	stdin         processInput // nil once closed, or when the process has no stdin
+	stdoutPipe    io.ReadCloser
+	stderrPipe    io.ReadCloser
+	listeners     map[chan ProcessIOEvent]struct{}
+	output        *Broadcaster // numbered output lines for streaming clients
+	outputSeq     uint64
+	outputHistory []OutputLine // recent lines for clients resuming a stream
+	inputMutex    sync.Mutex
+	mutex         sync.RWMutex
 }
 
 // StreamError represents a real-time error from a monitored process
 type StreamError struct {
-	ProcessPID int       `json:"process_pid"`
-	Command    string    `json:"command"`
-	ErrorType  string    `json:"error_type"` // runtime, compilation, test, server
-	Message    string    `json:"message"`
-	Timestamp  time.Time `json:"timestamp"`
-	Severity   string    `json:"severity"` // error, warning, info
-	Context    []string  `json:"context"`  // surrounding lines
-	Source     string    `json:"source"`   // stdout, stderr
-	Line       int       `json:"line,omitempty"`
-	Column     int       `json:"column,omitempty"`
+	ID         uint64     `json:"id,omitempty"` // assigned by the error store
+	ProcessID  string     `json:"process_id,omitempty"`
+	ProcessPID int        `json:"process_pid"`
+	Command    string     `json:"command"`
+	ErrorType  string     `json:"error_type"` // runtime, compilation, dependency, lint, test, server
+	Message    string     `json:"message"`
+	Timestamp  time.Time  `json:"timestamp"`
+	Severity   string     `json:"severity"` // error, warning, info
+	Context    []string   `json:"context"`  // surrounding lines
+	Source     string     `json:"source"`   // stdout, stderr
+	Language   string     `json:"language,omitempty"`
+	File       string     `json:"file,omitempty"`
+	Line       int        `json:"line,omitempty"`
+	Column     int        `json:"column,omitempty"`
+	Repeats    int        `json:"repeats,omitempty"`    // further occurrences coalesced into this error
+	FirstSeen  *time.Time `json:"first_seen,omitempty"` // of the first coalesced repeat
 }
 
 // ProcessCommand represents a command to monitor
 type ProcessCommand struct {
+	Name          string            `json:"name,omitempty"` // optional stable name to address the process by
 	Command       string            `json:"command"`
 	Args          []string          `json:"args"`
 	WorkingDir    string            `json:"working_dir"`
 	Environment   map[string]string `json:"environment"`
+	EnvFiles      []string          `json:"env_files,omitempty"`   // .env files, relative to the working directory
+	EnvProfile    string            `json:"env_profile,omitempty"` // named profile from the config
+	CleanEnv      bool              `json:"clean_env,omitempty"`   // start from a minimal environment instead of Argus's own
 	AutoRestart   bool              `json:"auto_restart"`
-	ErrorPatterns []string          `json:"error_patterns"`
+	ErrorPatterns []string          `json:"error_patterns"` // regexes; a leading "!" ignores matching lines
+	PTY           bool              `json:"pty"`            // run under a pseudo-terminal
+	WindowSize    *PTYWindowSize    `json:"window_size,omitempty"`
+	Service       string            `json:"service,omitempty"` // name in the services file
+	Liveness      *LivenessProbe    `json:"liveness,omitempty"`
+	Stdin         bool              `json:"stdin,omitempty"`   // keep stdin open for input; otherwise it reads /dev/null
+	Timeout       string            `json:"timeout,omitempty"` // wall-clock limit per run; empty uses ProcessTimeout, "0" disables
+	Limits        *ResourceLimits   `json:"limits,omitempty"`
+	Record        bool              `json:"record,omitempty"` // record output as an asciicast
 }
 
 // ProcessMonitorConfig contains configuration for process monitoring
@@ -105,6 +182,65 @@ type ProcessMonitorConfig struct {
 	MaxOutputLines     int           `json:"max_output_lines"`
 	AllowedCommands    []string      `json:"allowed_commands"`
 	RateLimitPerMinute int           `json:"rate_limit_per_minute"`
+
+	// ArtifactSizeThreshold is the growth in percent that flags a build artifact
+	ArtifactSizeThreshold float64 `json:"artifact_size_threshold"`
+
+	// Automatic builds at startup and after source changes; POST /build/run always works.
+	// Builds pass the process policy and run with BuildLimits and BuildTimeout.
+	AutoBuild     bool            `json:"auto_build"`
+	BuildDebounce time.Duration   `json:"build_debounce"` // quiet time after the last change before building
+	BuildTimeout  time.Duration   `json:"build_timeout"`
+	BuildLimits   *ResourceLimits `json:"build_limits,omitempty"`
+
+	// Resource sampling and leak alerts for monitored processes
+	MetricsInterval      time.Duration `json:"metrics_interval"`
+	MetricsHistorySize   int           `json:"metrics_history_size"`
+	ResourceAlertWindow  time.Duration `json:"resource_alert_window"`
+	MemoryGrowthMBPerMin float64       `json:"memory_growth_mb_per_min"`
+	FDLeakThreshold      int           `json:"fd_leak_threshold"`
+	CPUPegPercent        float64       `json:"cpu_peg_percent"`
+
+	// Auto-restart supervision
+	RestartInitialDelay time.Duration `json:"restart_initial_delay"`
+	RestartMaxDelay     time.Duration `json:"restart_max_delay"`
+	RestartMaxCount     int           `json:"restart_max_count"` // per RestartWindow before crash_loop
+	RestartWindow       time.Duration `json:"restart_window"`
+
+	// StopGracePeriod is how long a stopped process tree gets before SIGKILL
+	StopGracePeriod time.Duration `json:"stop_grace_period"`
+
+	// On-disk process logs under .argus/logs
+	LogMaxSizeMB int64         `json:"log_max_size_mb"`
+	LogMaxAge    time.Duration `json:"log_max_age"`
+	LogMaxFiles  int           `json:"log_max_files"`
+	LogRetention time.Duration `json:"log_retention"`
+
+	// Asciicast recordings under .argus/recordings; RecordSessions records every process
+	RecordSessions     bool  `json:"record_sessions"`
+	RecordingMaxSizeMB int64 `json:"recording_max_size_mb"`
+
+	// Largest read /files/:path/content returns before truncating
+	FileReadMaxSizeKB int64 `json:"file_read_max_size_kb"`
+
+	// Error history, persisted to .argus/errors.jsonl when enabled
+	ErrorHistorySize int  `json:"error_history_size"`
+	PersistErrors    bool `json:"persist_errors"`
+
+	// ErrorCoalesceWindow folds repeats of an error into one count; zero disables it
+	ErrorCoalesceWindow time.Duration `json:"error_coalesce_window"`
+
+	// Alert rules and notification sinks
+	Alerts AlertConfig `json:"alerts"`
+
+	// Named environments processes can select with env_profile
+	EnvProfiles map[string]EnvProfile `json:"env_profiles"`
+
+	// Argument, working directory and environment policy for started processes
+	Policy PolicyConfig `json:"policy"`
+
+	// API tokens, request rate limits and allowed CORS origins
+	Auth AuthConfig `json:"auth"`
 }
 
 // ProcessMetrics tracks monitoring metrics
@@ -113,6 +249,8 @@ type ProcessMetrics struct {
 	ProcessStartFailures int64 `json:"process_start_failures"`
 	ActiveProcesses      int64 `json:"active_processes"`
 	TotalErrors          int64 `json:"total_errors"`
+	ErrorsDropped        int64 `json:"errors_dropped"`   // lost to a full error stream
+	ErrorsCoalesced      int64 `json:"errors_coalesced"` // folded into a repeat count
 	mutex                sync.RWMutex
 }
 
@@ -152,6 +290,9 @@ type FileInfo struct {
 	IsExecutable bool      `json:"is_executable"`
 	Language     string    `json:"language"`
 	LineCount    int       `json:"line_count,omitempty"`
+	Binary       bool      `json:"binary,omitempty"`
+	Encoding     string    `json:"encoding,omitempty"`
+	ETag         string    `json:"etag,omitempty"`
 }
 
 // DirectoryInfo represents directory information
@@ -211,11 +352,18 @@ type BuildStatus struct {
 // ProcessInfo represents running process information
 type ProcessInfo struct {
 	PID              int       `json:"pid"`
+	ParentPID        int       `json:"parent_pid"`
+	ChildPIDs        []int     `json:"child_pids,omitempty"`
 	Name             string    `json:"name"`
 	Command          string    `json:"command"`
+	Executable       string    `json:"executable,omitempty"`
+	Cwd              string    `json:"cwd,omitempty"`
+	State            string    `json:"state"`
 	StartTime        time.Time `json:"start_time"`
 	CPUPercent       float64   `json:"cpu_percent"`
-	MemoryMB         float64   `json:"memory_mb"`
+	MemoryMB         float64   `json:"memory_mb"` // resident set size
+	Threads          int       `json:"threads"`
+	OpenFiles        int       `json:"open_files"`
 	IsProjectRelated bool      `json:"is_project_related"`
 }
 
@@ -278,6 +426,8 @@ type FileWatcher struct {
 type GitWatcher struct {
 	workspace string
 	status    *GitStatus
+	head      string     // full hash of the commit checked out
+	events    []GitEvent // commits and branch switches, for the timeline
 	mutex     sync.RWMutex
 }
 
@@ -289,13 +439,24 @@ type ErrorWatcher struct {
 
 // BuildWatcher monitors build processes
 type BuildWatcher struct {
-	status *BuildStatus
-	mutex  sync.RWMutex
+	workspace   string
+	config      *ProcessMonitorConfig
+	status      *BuildStatus
+	history     *BuildHistory
+	artifacts   *ArtifactTracker
+	alerts      *AlertManager
+	monitor     *ProcessMonitor // policy and environment of build commands
+	fileWatcher *FileWatcher
+	lastBuild   time.Time
+	gitChanges  map[string][]string // files changed between two commits, by "from..to"
+	buildMutex  sync.Mutex          // serializes build runs
+	mutex       sync.RWMutex
 }
 
 // ProcessWatcher monitors running processes
 type ProcessWatcher struct {
 	processes []ProcessInfo
+	inspector *ProcInspector
 	mutex     sync.RWMutex
 }
 
@@ -309,7 +470,45 @@ func loadConfig() *ProcessMonitorConfig {
 		CleanupInterval:    30 * time.Second,
 		MaxOutputLines:     10000,
 		RateLimitPerMinute: 10,
-		AllowedCommands:    []string{"npm", "node", "go", "python", "yarn", "cargo", "next", "vite", "jest", "make", "mvn", "gradle"},
+		AllowedCommands:    []string{"npm", "node", "go", "python", "python3", "yarn", "cargo", "next", "vite", "jest", "make", "mvn", "gradle"},
+
+		ArtifactSizeThreshold: 10,
+
+		BuildDebounce: 5 * time.Second,
+		BuildTimeout:  10 * time.Minute,
+
+		MetricsInterval:      5 * time.Second,
+		MetricsHistorySize:   720,
+		ResourceAlertWindow:  2 * time.Minute,
+		MemoryGrowthMBPerMin: 20,
+		FDLeakThreshold:      100,
+		CPUPegPercent:        95,
+
+		RestartInitialDelay: time.Second,
+		RestartMaxDelay:     30 * time.Second,
+		RestartMaxCount:     5,
+		RestartWindow:       2 * time.Minute,
+
+		StopGracePeriod: 5 * time.Second,
+
+		LogMaxSizeMB: 10,
+		LogMaxAge:    24 * time.Hour,
+		LogMaxFiles:  5,
+		LogRetention: 7 * 24 * time.Hour,
+
+		RecordingMaxSizeMB: 50,
+
+		FileReadMaxSizeKB: 1024,
+
+		ErrorHistorySize:    10000,
+		ErrorCoalesceWindow: 5 * time.Second,
+
+		Policy: defaultPolicyConfig(),
+
+		Auth: AuthConfig{
+			RequestsPerMinute:   600,
+			IPRequestsPerMinute: 1200,
+		},
 	}
 
 	// Load from config file if exists
@@ -330,19 +529,60 @@ func loadConfig() *ProcessMonitorConfig {
 		}
 	}
 
+	if persist := os.Getenv("ARGUS_PERSIST_ERRORS"); persist != "" {
+		if val, err := strconv.ParseBool(persist); err == nil {
+			config.PersistErrors = val
+		}
+	}
+
+	if record := os.Getenv("ARGUS_RECORD_SESSIONS"); record != "" {
+		if val, err := strconv.ParseBool(record); err == nil {
+			config.RecordSessions = val
+		}
+	}
+
+	if tokenFile := os.Getenv("ARGUS_TOKEN_FILE"); tokenFile != "" {
+		config.Auth.TokenFile = tokenFile
+	}
+
+	if origins := os.Getenv("ARGUS_CORS_ORIGINS"); origins != "" {
+		config.Auth.CORSOrigins = strings.Split(origins, ",")
+	}
+
+	if autoBuild := os.Getenv("ARGUS_AUTO_BUILD"); autoBuild != "" {
+		if val, err := strconv.ParseBool(autoBuild); err == nil {
+			config.AutoBuild = val
+		}
+	}
+
+	if threshold := os.Getenv("ARGUS_ARTIFACT_THRESHOLD"); threshold != "" {
+		if val, err := strconv.ParseFloat(threshold, 64); err == nil {
+			config.ArtifactSizeThreshold = val
+		}
+	}
+
 	return config
 }
 
 // NewProcessMonitor creates a new process monitor
-func NewProcessMonitor(config *ProcessMonitorConfig) *ProcessMonitor {
+func NewProcessMonitor(workspace string, config *ProcessMonitorConfig) *ProcessMonitor {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	return &ProcessMonitor{
-		activeProcesses: make(map[int]*MonitoredProcess),
+		activeProcesses: make(map[string]*MonitoredProcess),
 		errorStream:     make(chan StreamError, config.ErrorStreamBuffer),
 		config:          config,
 		metrics:         &ProcessMetrics{},
-		wsConnections:   make(map[*websocket.Conn]bool),
+		errorClients:    NewBroadcaster(),
+		coalescing:      make(map[string]*coalescedError),
+		inspector:       NewProcInspector(workspace),
+		sampler:         NewProcInspector(workspace),
+		logs:            NewProcessLogStore(filepath.Join(workspace, ".argus", "logs"), config),
+		recordings:      NewRecordingStore(filepath.Join(workspace, ".argus", "recordings"), config),
+		errors:          NewErrorStore(errorStorePath(workspace, config), config.ErrorHistorySize),
+		policy:          NewPolicyEngine(workspace, config),
+		plugins:         NewLanguagePluginManager(),
+		dirLanguages:    make(map[string][]LanguagePlugin),
 		ctx:             ctx,
 		cancel:          cancel,
 	}
@@ -351,17 +591,24 @@ func NewProcessMonitor(config *ProcessMonitorConfig) *ProcessMonitor {
 // NewProjectIntelligence creates a new Project Argus instance
 func NewProjectIntelligence(workspace string) *ProjectIntelligence {
 	config := loadConfig()
+	fileWatcher := &FileWatcher{workspace: workspace, changes: []FileChange{}}
 
 	pi := &ProjectIntelligence{
 		workspace:      workspace,
-		fileWatcher:    &FileWatcher{workspace: workspace, changes: []FileChange{}},
+		fileWatcher:    fileWatcher,
 		gitWatcher:     &GitWatcher{workspace: workspace},
 		errorWatcher:   &ErrorWatcher{errors: []ErrorInfo{}},
-		buildWatcher:   &BuildWatcher{status: &BuildStatus{}},
-		processWatcher: &ProcessWatcher{processes: []ProcessInfo{}},
-		processMonitor: NewProcessMonitor(config),
+		buildWatcher:   NewBuildWatcher(workspace, fileWatcher, config),
+		processWatcher: NewProcessWatcher(workspace),
+		processMonitor: NewProcessMonitor(workspace, config),
 		config:         config,
+		ignores:        NewIgnoreChecker(resolveDir(workspace)),
 	}
+	pi.services = NewServiceManager(workspace, pi.processMonitor)
+	pi.alerts = NewAlertManager(workspace, config.Alerts)
+	pi.processMonitor.alerts = pi.alerts
+	pi.buildWatcher.alerts = pi.alerts
+	pi.buildWatcher.monitor = pi.processMonitor
 
 	return pi
 }
@@ -379,6 +626,7 @@ func (pi *ProjectIntelligence) StartWatching() {
 
 	// Start process monitor
 	go pi.processMonitor.startMonitoring()
+	go pi.alerts.deliverAlerts(pi.processMonitor.ctx)
 
 	// Generate initial snapshot
 	go func() {
@@ -416,6 +664,7 @@ func (pi *ProjectIntelligence) updateSnapshot() {
 	}
 
 	pi.lastSnapshot = snapshot
+	pi.alerts.ObserveHealth(snapshot.Health)
 	log.Printf("Snapshot updated - %d files, %d errors, %d processes",
 		len(snapshot.Structure.Files), len(snapshot.ActiveErrors), len(snapshot.RunningProcesses))
 }
@@ -566,6 +815,21 @@ func (fw *FileWatcher) addChange(change FileChange) {
 	}
 }
 
+// getChangesSince returns changes recorded after the given time
+func (fw *FileWatcher) getChangesSince(since time.Time) []FileChange {
+	fw.mutex.RLock()
+	defer fw.mutex.RUnlock()
+
+	changes := []FileChange{}
+	for _, change := range fw.changes {
+		if change.Timestamp.After(since) {
+			changes = append(changes, change)
+		}
+	}
+
+	return changes
+}
+
 func (fw *FileWatcher) getRecentChanges() []FileChange {
 	fw.mutex.RLock()
 	defer fw.mutex.RUnlock()
@@ -607,11 +871,13 @@ func (gw *GitWatcher) updateGitStatus() {
 	}
 
 	// Get commit hash and message
+	head := ""
 	cmd = exec.Command("git", "log", "-1", "--pretty=format:%H|%s|%ct")
 	cmd.Dir = gw.workspace
 	if output, err := cmd.Output(); err == nil {
 		parts := strings.Split(string(output), "|")
 		if len(parts) >= 3 {
+			head = parts[0]
 			status.CommitHash = parts[0][:8] // Short hash
 			status.CommitMessage = parts[1]
 			if timestamp, err := strconv.ParseInt(parts[2], 10, 64); err == nil {
@@ -646,6 +912,7 @@ func (gw *GitWatcher) updateGitStatus() {
 		status.IsDirty = len(status.ModifiedFiles) > 0 || len(status.UntrackedFiles) > 0
 	}
 
+	gw.recordGitEvents(status, head)
 	gw.status = status
 }
 
@@ -818,6 +1085,25 @@ func (ew *ErrorWatcher) getErrors() []ErrorInfo {
 	return append([]ErrorInfo{}, ew.errors...)
 }
 
+// Build output classification patterns
+var (
+	buildErrorLinePattern   = regexp.MustCompile(`(?i)\berror\b|^\S+\.\w+:\d+:\d+: `)
+	buildWarningLinePattern = regexp.MustCompile(`(?i)\bwarn(ing)?\b`)
+)
+
+// NewBuildWatcher creates a build watcher with a persisted build history
+func NewBuildWatcher(workspace string, fileWatcher *FileWatcher, config *ProcessMonitorConfig) *BuildWatcher {
+	return &BuildWatcher{
+		workspace:   workspace,
+		config:      config,
+		status:      &BuildStatus{},
+		history:     NewBuildHistory(filepath.Join(workspace, ".argus", "builds", "history.jsonl"), 1000),
+		artifacts:   NewArtifactTracker(workspace, config.ArtifactSizeThreshold),
+		fileWatcher: fileWatcher,
+		gitChanges:  make(map[string][]string),
+	}
+}
+
 // Build watcher implementation
 func (bw *BuildWatcher) startWatching(workspace string) {
 	log.Println("Build watcher started")
@@ -829,14 +1115,209 @@ func (bw *BuildWatcher) startWatching(workspace string) {
 }
 
 func (bw *BuildWatcher) checkBuildStatus(workspace string) {
+	if !bw.config.AutoBuild {
+		return
+	}
+
+	bw.mutex.RLock()
+	lastBuild := bw.lastBuild
+	bw.mutex.RUnlock()
+
+	// Build once at startup, then only when source files change
+	if lastBuild.IsZero() {
+		bw.RunBuild("startup")
+		return
+	}
+
+	// Wait until changes settle, so a save of several files builds once
+	latest := bw.latestRelevantChange(lastBuild)
+	if !latest.IsZero() && time.Since(latest) >= bw.config.BuildDebounce {
+		bw.RunBuild("file_change")
+	}
+}
+
+// RunBuild executes the detected build command and records the result
+func (bw *BuildWatcher) RunBuild(trigger string) (*BuildRecord, error) {
+	bw.buildMutex.Lock()
+	defer bw.buildMutex.Unlock()
+
+	command, args := detectBuildCommand(bw.workspace)
+	if command == "" {
+		return nil, errors.New("no build command detected for workspace")
+	}
+
 	bw.mutex.Lock()
-	defer bw.mutex.Unlock()
+	changedFiles := []string{}
+	if !bw.lastBuild.IsZero() {
+		changedFiles = bw.relevantChangesSince(bw.lastBuild)
+	}
+	bw.status.IsBuilding = true
+	bw.mutex.Unlock()
 
-	// Check if build is currently running by looking for build processes
-	// This is a simplified implementation
-	bw.status.IsBuilding = false
-	bw.status.LastBuildTime = time.Now()
-	bw.status.Success = true
+	record := BuildRecord{
+		ID:           generateBuildID(),
+		Trigger:      trigger,
+		Command:      strings.TrimSpace(command + " " + strings.Join(args, " ")),
+		StartTime:    time.Now(),
+		ChangedFiles: changedFiles,
+	}
+	record.Commit, record.Branch = currentGitRevision(bw.workspace)
+
+	// Binaries of an earlier build must not be measured as this build's
+	if command == "go" {
+		os.RemoveAll(filepath.Join(bw.workspace, goBuildOutputDir))
+	}
+
+	output, err := bw.runBuildCommand(ProcessCommand{
+		Name:       "build",
+		Command:    command,
+		Args:       args,
+		WorkingDir: bw.workspace,
+		Limits:     bw.config.BuildLimits,
+	})
+	if errors.Is(err, errBuildDenied) {
+		bw.mutex.Lock()
+		bw.status.IsBuilding = false
+		bw.mutex.Unlock()
+		return nil, err
+	}
+
+	duration := time.Since(record.StartTime)
+	record.DurationMs = duration.Milliseconds()
+	record.Success = err == nil
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		record.ExitCode = exitErr.ExitCode()
+	} else if err != nil {
+		record.ExitCode = -1
+	}
+
+	digest := sha256.Sum256(output)
+	record.OutputDigest = "sha256:" + hex.EncodeToString(digest[:])
+
+	buildErrors, buildWarnings := classifyBuildOutput(string(output))
+	record.ErrorCount = len(buildErrors)
+	record.WarningCount = len(buildWarnings)
+	if !record.Success && record.ErrorCount == 0 {
+		record.ErrorCount = 1
+	}
+
+	bw.mutex.Lock()
+	bw.lastBuild = record.StartTime
+	bw.status = &BuildStatus{
+		IsBuilding:    false,
+		LastBuildTime: record.StartTime,
+		Success:       record.Success,
+		Duration:      duration.String(),
+		Output:        string(output),
+		Errors:        buildErrors,
+		Warnings:      buildWarnings,
+	}
+	bw.mutex.Unlock()
+
+	bw.history.Add(record)
+	bw.alerts.ObserveBuild(record)
+	if record.Success {
+		bw.artifacts.Record(record.ID)
+	}
+
+	log.Printf("Build %s (%s) finished in %v - success=%t, %d errors, %d warnings",
+		record.ID, trigger, duration, record.Success, record.ErrorCount, record.WarningCount)
+
+	return &record, nil
+}
+
+// errBuildDenied reports a build command the process policy does not allow
+var errBuildDenied = errors.New("build command denied by policy")
+
+// runBuildCommand runs a build through the same policy, environment and
+// resource limits as monitored processes and returns its combined output
+func (bw *BuildWatcher) runBuildCommand(cmd ProcessCommand) ([]byte, error) {
+	pm := bw.monitor
+
+	env, err := pm.authorizeProcess(cmd)
+	var denied *policyError
+	if errors.As(err, &denied) {
+		return nil, fmt.Errorf("%w: %v", errBuildDenied, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	output, stopped, err := pm.runLimited(cmd, env, "argus-build", bw.config.BuildTimeout)
+	if stopped != "" {
+		output = append(output, "\nargus: build stopped: "+stopped+"\n"...)
+	}
+	return output, err
+}
+
+// latestRelevantChange returns when a source file last changed after since
+func (bw *BuildWatcher) latestRelevantChange(since time.Time) time.Time {
+	var latest time.Time
+	for _, change := range bw.fileWatcher.getChangesSince(since) {
+		relPath, err := filepath.Rel(bw.workspace, change.Path)
+		if err != nil || isIgnoredBuildPath(relPath) {
+			continue
+		}
+		if change.Timestamp.After(latest) {
+			latest = change.Timestamp
+		}
+	}
+	return latest
+}
+
+// relevantChangesSince returns changed source files, ignoring hidden and output directories
+func (bw *BuildWatcher) relevantChangesSince(since time.Time) []string {
+	seen := make(map[string]bool)
+	files := []string{}
+
+	for _, change := range bw.fileWatcher.getChangesSince(since) {
+		relPath, err := filepath.Rel(bw.workspace, change.Path)
+		if err != nil || isIgnoredBuildPath(relPath) || seen[relPath] {
+			continue
+		}
+		seen[relPath] = true
+		files = append(files, relPath)
+	}
+
+	return files
+}
+
+// getHistory returns recorded builds and trend statistics over the given window
+func (bw *BuildWatcher) getHistory(limit int) ([]BuildRecord, BuildTrends) {
+	trends := bw.history.Trends(limit)
+
+	if trends.Regression != nil {
+		from := trends.Regression.LastSuccess.Commit
+		to := trends.Regression.FirstFailure.Commit
+		if from != "" && to != "" && from != to {
+			trends.Regression.GitChangedFiles = bw.cachedGitChanges(from, to)
+		}
+	}
+
+	return bw.history.Records(limit), trends
+}
+
+// cachedGitChanges lists the files changed between two commits; commits
+// never change, so git runs once per pair
+func (bw *BuildWatcher) cachedGitChanges(from, to string) []string {
+	key := from + ".." + to
+
+	bw.mutex.RLock()
+	files, cached := bw.gitChanges[key]
+	bw.mutex.RUnlock()
+	if cached {
+		return files
+	}
+
+	files = gitChangedFilesBetween(bw.workspace, from, to)
+	bw.mutex.Lock()
+	if len(bw.gitChanges) >= 100 {
+		bw.gitChanges = make(map[string][]string)
+	}
+	bw.gitChanges[key] = files
+	bw.mutex.Unlock()
+	return files
 }
 
 func (bw *BuildWatcher) getStatus() *BuildStatus {
@@ -846,8 +1327,169 @@ func (bw *BuildWatcher) getStatus() *BuildStatus {
 	return bw.status
 }
 
+// detectBuildCommand picks the build command for the workspace's project type
+func detectBuildCommand(workspace string) (string, []string) {
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(workspace, name))
+		return err == nil
+	}
+
+	switch {
+	case exists("go.mod"):
+		// A trailing separator makes go build write every main package's binary
+		// there; it fails when there is none, so libraries are only compiled
+		if hasGoMainPackage(workspace) {
+			return "go", []string{"build", "-o", goBuildOutputDir + "/", "./..."}
+		}
+		return "go", []string{"build", "./..."}
+	case exists("Cargo.toml"):
+		return "cargo", []string{"build"}
+	case exists("package.json"):
+		var pkg struct {
+			Scripts map[string]string `json:"scripts"`
+		}
+		if data, err := os.ReadFile(filepath.Join(workspace, "package.json")); err == nil {
+			json.Unmarshal(data, &pkg)
+		}
+		if _, ok := pkg.Scripts["build"]; ok {
+			return "npm", []string{"run", "build"}
+		}
+	case exists("Makefile"):
+		return "make", []string{}
+	}
+
+	return "", nil
+}
+
+// hasGoMainPackage reports whether a Go module has a command to build,
+// skipping the directories the go tool ignores for ./...
+func hasGoMainPackage(workspace string) bool {
+	found := false
+	fset := token.NewFileSet()
+
+	filepath.WalkDir(workspace, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || found {
+			return filepath.SkipDir
+		}
+		name := d.Name()
+		if d.IsDir() {
+			if path != workspace && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "testdata" || name == "vendor" || name == "node_modules") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			return nil
+		}
+		if file, err := parser.ParseFile(fset, path, nil, parser.PackageClauseOnly); err == nil && file.Name.Name == "main" {
+			found = true
+			return filepath.SkipAll
+		}
+		return nil
+	})
+
+	return found
+}
+
+// classifyBuildOutput splits build output into error and warning lines
+func classifyBuildOutput(output string) ([]string, []string) {
+	buildErrors := []string{}
+	buildWarnings := []string{}
+
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		switch {
+		case buildWarningLinePattern.MatchString(line):
+			buildWarnings = append(buildWarnings, line)
+		case buildErrorLinePattern.MatchString(line):
+			buildErrors = append(buildErrors, line)
+		}
+	}
+
+	return buildErrors, buildWarnings
+}
+
+// isIgnoredBuildPath reports whether a workspace-relative path is outside the build inputs
+func isIgnoredBuildPath(relPath string) bool {
+	for _, part := range strings.Split(filepath.ToSlash(relPath), "/") {
+		if strings.HasPrefix(part, ".") {
+			return true
+		}
+		switch part {
+		case "node_modules", "vendor", "target", "dist", "build", "bin", "__pycache__":
+			return true
+		}
+	}
+
+	return false
+}
+
+// currentGitRevision returns the short commit hash and branch of the workspace
+func currentGitRevision(workspace string) (string, string) {
+	var commit, branch string
+
+	cmd := exec.Command("git", "rev-parse", "--short", "HEAD")
+	cmd.Dir = workspace
+	if output, err := cmd.Output(); err == nil {
+		commit = strings.TrimSpace(string(output))
+	}
+
+	cmd = exec.Command("git", "rev-parse", "--abbrev-ref", "HEAD")
+	cmd.Dir = workspace
+	if output, err := cmd.Output(); err == nil {
+		branch = strings.TrimSpace(string(output))
+	}
+
+	return commit, branch
+}
+
+// gitChangedFilesBetween lists files changed between two commits
+func gitChangedFilesBetween(workspace, from, to string) []string {
+	cmd := exec.Command("git", "diff", "--name-only", from, to)
+	cmd.Dir = workspace
+	output, err := cmd.Output()
+	if err != nil {
+		return nil
+	}
+
+	files := []string{}
+	for _, line := range strings.Split(string(output), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			files = append(files, line)
+		}
+	}
+
+	return files
+}
+
+// devRuntimeNames are runtimes listed even when they run outside the workspace
+var devRuntimeNames = map[string]bool{
+	"node": true, "go": true, "python": true, "python3": true, "deno": true, "bun": true,
+}
+
+// NewProcessWatcher creates a process watcher backed by /proc
+func NewProcessWatcher(workspace string) *ProcessWatcher {
+	if absWorkspace, err := filepath.Abs(workspace); err == nil {
+		workspace = absWorkspace
+	}
+
+	return &ProcessWatcher{
+		processes: []ProcessInfo{},
+		inspector: NewProcInspector(workspace),
+	}
+}
+
 // Process watcher implementation
 func (pw *ProcessWatcher) startWatching(workspace string) {
+	if !procAvailable() {
+		log.Println("Process watcher disabled: /proc is not available")
+		return
+	}
+
 	log.Println("Process watcher started")
 
 	for {
@@ -857,40 +1499,31 @@ func (pw *ProcessWatcher) startWatching(workspace string) {
 }
 
 func (pw *ProcessWatcher) updateProcesses(workspace string) {
-	pw.mutex.Lock()
-	defer pw.mutex.Unlock()
-
-	pw.processes = []ProcessInfo{}
-
-	// Get process list (simplified for cross-platform compatibility)
-	cmd := exec.Command("ps", "aux")
-	output, err := cmd.Output()
-	if err != nil {
-		return
+	all := pw.inspector.Inspect()
+
+	// Keep project processes with their whole subtree, plus known dev runtimes
+	keep := make(map[int]bool)
+	for _, process := range all {
+		if process.IsProjectRelated {
+			keep[process.PID] = true
+			for _, pid := range descendantPIDs(all, process.PID) {
+				keep[pid] = true
+			}
+		} else if devRuntimeNames[process.Name] || devRuntimeNames[filepath.Base(process.Executable)] {
+			keep[process.PID] = true
+		}
 	}
 
-	lines := strings.Split(string(output), "\n")
-	for _, line := range lines[1:] { // Skip header
-		if strings.Contains(line, "node") ||
-			strings.Contains(line, "go") ||
-			strings.Contains(line, "python") ||
-			strings.Contains(line, workspace) {
-
-			// This is a simplified process parsing
-			fields := strings.Fields(line)
-			if len(fields) >= 11 {
-				if pid, err := strconv.Atoi(fields[1]); err == nil {
-					pw.processes = append(pw.processes, ProcessInfo{
-						PID:              pid,
-						Name:             fields[10],
-						Command:          strings.Join(fields[10:], " "),
-						StartTime:        time.Now(), // Simplified
-						IsProjectRelated: strings.Contains(line, workspace),
-					})
-				}
-			}
+	processes := []ProcessInfo{}
+	for _, process := range all {
+		if keep[process.PID] && process.PID != os.Getpid() {
+			processes = append(processes, process)
 		}
 	}
+
+	pw.mutex.Lock()
+	pw.processes = processes
+	pw.mutex.Unlock()
 }
 
 func (pw *ProcessWatcher) getProcesses() []ProcessInfo {
@@ -910,6 +1543,9 @@ func (pm *ProcessMonitor) startMonitoring() {
 	// Monitor for common development processes
 	go pm.autoDetectDevProcesses()
 
+	// Sample resource usage of monitored processes
+	go pm.sampleResources()
+
 	// Cleanup stopped processes periodically
 	ticker := time.NewTicker(pm.config.CleanupInterval)
 	defer ticker.Stop()
@@ -921,6 +1557,8 @@ func (pm *ProcessMonitor) startMonitoring() {
 			return
 		case <-ticker.C:
 			pm.cleanupStoppedProcesses()
+			pm.logs.Prune()
+			pm.recordings.Prune()
 		}
 	}
 }
@@ -935,7 +1573,7 @@ func (pm *ProcessMonitor) processErrorStream() {
 	}
 
 	// Process incoming errors with backpressure handling
-	ticker := time.NewTicker(100 * time.Millisecond)
+	ticker := time.NewTicker(errorFlushInterval)
 	defer ticker.Stop()
 
 	for {
@@ -943,15 +1581,11 @@ func (pm *ProcessMonitor) processErrorStream() {
 		case <-pm.ctx.Done():
 			return
 		case streamError := <-pm.errorStream:
-			select {
-			case errorBuffer <- streamError:
-				// Successfully queued
-			default:
-				// Buffer full - implement overflow strategy
-				pm.handleBufferOverflow()
+			if !pm.coalesce(streamError) {
+				pm.queueError(errorBuffer, streamError)
 			}
 		case <-ticker.C:
-			pm.flushPendingErrors()
+			pm.flushPendingErrors(errorBuffer)
 		}
 	}
 }
@@ -968,7 +1602,13 @@ func (pm *ProcessMonitor) errorWorker(errorBuffer <-chan StreamError) {
 }
 
 func (pm *ProcessMonitor) processStreamError(streamError StreamError) {
-	log.Printf("Stream Error: [%s] %s - %s", streamError.Command, streamError.ErrorType, streamError.Message)
+	if streamError.Repeats > 0 {
+		log.Printf("Stream Error: [%s] %s - %s (×%d more)", streamError.Command, streamError.ErrorType, streamError.Message, streamError.Repeats)
+	} else {
+		log.Printf("Stream Error: [%s] %s - %s", streamError.Command, streamError.ErrorType, streamError.Message)
+	}
+
+	streamError = pm.errors.Add(streamError)
 
 	// Update metrics
 	pm.metrics.mutex.Lock()
@@ -976,8 +1616,10 @@ func (pm *ProcessMonitor) processStreamError(streamError StreamError) {
 	pm.metrics.mutex.Unlock()
 
 	// Update process with error
+	name := ""
 	pm.mutex.Lock()
-	if process, exists := pm.activeProcesses[streamError.ProcessPID]; exists {
+	if process, exists := pm.activeProcesses[streamError.ProcessID]; exists {
+		name = process.Name
 		process.mutex.Lock()
 		process.LastError = &streamError
 		process.ErrorLines = append(process.ErrorLines, streamError.Message)
@@ -990,31 +1632,9 @@ func (pm *ProcessMonitor) processStreamError(streamError StreamError) {
 	}
 	pm.mutex.Unlock()
 
-	// Broadcast to WebSocket clients
-	pm.broadcastToWebSockets(streamError)
-}
-
-func (pm *ProcessMonitor) broadcastToWebSockets(streamError StreamError) {
-	pm.mutex.RLock()
-	defer pm.mutex.RUnlock()
-
-	message, _ := json.Marshal(streamError)
-
-	for conn := range pm.wsConnections {
-		if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
-			log.Printf("WebSocket write error: %v", err)
-			delete(pm.wsConnections, conn)
-			conn.Close()
-		}
-	}
-}
-
-func (pm *ProcessMonitor) handleBufferOverflow() {
-	log.Println("Error stream buffer overflow - dropping oldest errors")
-}
-
-func (pm *ProcessMonitor) flushPendingErrors() {
-	// Placeholder for batching logic if needed
+	// Broadcast to WebSocket clients with the next batch
+	pm.batchError(streamError)
+	pm.alerts.ObserveError(streamError, name)
 }
 
 func (pm *ProcessMonitor) StartProcess(cmd ProcessCommand) (*MonitoredProcess, error) {
@@ -1041,44 +1661,135 @@ func (pm *ProcessMonitor) StartProcess(cmd ProcessCommand) (*MonitoredProcess, e
 		return nil, err
 	}
 
-	// Check process limits
-	pm.mutex.RLock()
-	if len(pm.activeProcesses) >= pm.config.MaxProcesses {
-		pm.mutex.RUnlock()
-		return nil, fmt.Errorf("maximum number of processes (%d) already running", pm.config.MaxProcesses)
+	// Check process limits and claim the name in one step, so concurrent
+	// starts cannot both take it
+	existing, err := pm.reserveStart(cmd.Name)
+	if err != nil {
+		return nil, err
 	}
-	pm.mutex.RUnlock()
-
-	// Create the command
-	execCmd := exec.Command(cmd.Command, cmd.Args...)
-	execCmd.Dir = cmd.WorkingDir
+	defer pm.releaseStart(cmd.Name)
 
-	// Set environment variables
-	if cmd.Environment != nil {
-		env := os.Environ()
-		for key, value := range cmd.Environment {
-			env = append(env, fmt.Sprintf("%s=%s", key, value))
-		}
-		execCmd.Env = env
+	if existing != nil {
+		pm.cleanupProcess(existing)
 	}
 
-	// Create pipes for stdout and stderr
-	stdoutPipe, err := execCmd.StdoutPipe()
+	process, err := pm.spawnProcess(cmd, nil, RestartEvent{})
 	if err != nil {
-		return nil, fmt.Errorf("failed to create stdout pipe: %w", err)
+		return nil, err
+	}
+
+	log.Printf("Successfully started process %s (PID %d)", process.ID, process.PID)
+
+	return process, nil
+}
+
+// spawnProcess starts a command and begins monitoring it. When previous is
+// set, the new process is an automatic restart and inherits its history.
+func (pm *ProcessMonitor) spawnProcess(cmd ProcessCommand, previous *MonitoredProcess, restart RestartEvent) (*MonitoredProcess, error) {
+	id := newProcessID()
+	if previous != nil {
+		id = previous.ID
 	}
 
-	stderrPipe, err := execCmd.StderrPipe()
+	timeout, err := processTimeout(cmd, pm.config)
 	if err != nil {
-		stdoutPipe.Close()
-		return nil, fmt.Errorf("failed to create stderr pipe: %w", err)
+		return nil, err
 	}
 
-	// Start the process
-	if err := execCmd.Start(); err != nil {
-		stdoutPipe.Close()
-		stderrPipe.Close()
-		pm.metrics.mutex.Lock()
+	// Create the command
+	execCmd := exec.Command(cmd.Command, cmd.Args...)
+	execCmd.Dir = cmd.WorkingDir
+	execCmd.SysProcAttr = processGroupAttr()
+
+	// Env files are read again on every run, so restarts pick up edits
+	// and are checked against the policy like the first run
+	env, err := pm.authorizeProcess(cmd)
+	if err != nil {
+		return nil, err
+	}
+	execCmd.Env = envList(env)
+
+	var stdoutPipe, stderrPipe io.ReadCloser
+	var stdinPipe processInput
+	var childEnds []*os.File // The child's copies, closed here once it has started
+
+	if cmd.PTY {
+		// A terminal merges stdout and stderr into one stream
+		size := defaultPTYWindowSize
+		if cmd.WindowSize != nil {
+			size = *cmd.WindowSize
+		}
+
+		master, slave, err := openPTY(size)
+		if err != nil {
+			return nil, err
+		}
+		execCmd.Stdin, execCmd.Stdout, execCmd.Stderr = slave, slave, slave
+		execCmd.SysProcAttr = ptyProcAttr()
+		stdoutPipe, childEnds = master, []*os.File{slave}
+		if cmd.Stdin {
+			stdinPipe = &ptyInput{master: master}
+		}
+	} else {
+		// Create pipes for stdout and stderr, and for stdin when the process takes input
+		var err error
+		if cmd.Stdin {
+			stdinReader, stdinWriter, err := os.Pipe()
+			if err != nil {
+				return nil, fmt.Errorf("failed to create stdin pipe: %w", err)
+			}
+			execCmd.Stdin, stdinPipe = stdinReader, stdinWriter
+			childEnds = append(childEnds, stdinReader)
+		}
+
+		// Plain pipes rather than StdoutPipe, which Wait closes before
+		// the readers have drained what the process wrote last
+		var stdoutWriter, stderrWriter *os.File
+		stdoutPipe, stdoutWriter, err = os.Pipe()
+		if err == nil {
+			stderrPipe, stderrWriter, err = os.Pipe()
+			if err != nil {
+				stdoutPipe.Close()
+				stdoutWriter.Close()
+			}
+		}
+		if err != nil {
+			if stdinPipe != nil {
+				stdinPipe.Close()
+				childEnds[0].Close()
+			}
+			return nil, fmt.Errorf("failed to create output pipes: %w", err)
+		}
+		execCmd.Stdout, execCmd.Stderr = stdoutWriter, stderrWriter
+		childEnds = append(childEnds, stdoutWriter, stderrWriter)
+	}
+
+	limitStatus, cgroupFD := prepareLimits(cmd, execCmd, fmt.Sprintf("argus-%s-%d", id, time.Now().UnixNano()), timeout)
+	if err := wrapWithRlimits(execCmd, cmd.Limits); err != nil {
+		log.Printf("Failed to set rlimits for %s: %v", cmd.Command, err)
+		limitStatus.Unenforced = append(limitStatus.Unenforced, "cpu_seconds")
+	}
+
+	// Start the process
+	err = execCmd.Start()
+	for _, end := range childEnds {
+		end.Close()
+	}
+	if cgroupFD >= 0 {
+		syscall.Close(cgroupFD)
+	}
+	if err != nil {
+		if limitStatus != nil && limitStatus.Cgroup != "" {
+			removeLimitCgroup(limitStatus.Cgroup)
+		}
+		stdoutPipe.Close()
+		if stderrPipe != nil {
+			stderrPipe.Close()
+		}
+		if stdinPipe != nil && !cmd.PTY {
+			stdinPipe.Close()
+		}
+		pm.metrics.mutex.Lock()
 		pm.metrics.ProcessStartFailures++
 		pm.metrics.mutex.Unlock()
 		return nil, fmt.Errorf("failed to start process: %w", err)
@@ -1086,22 +1797,91 @@ func (pm *ProcessMonitor) StartProcess(cmd ProcessCommand) (*MonitoredProcess, e
 
 	// Create monitored process
 	process := &MonitoredProcess{
-		PID:         execCmd.Process.Pid,
-		Command:     cmd.Command,
-		Args:        cmd.Args,
-		StartTime:   time.Now(),
-		Status:      "running",
-		OutputLines: make([]string, 0),
-		ErrorLines:  make([]string, 0),
-		WorkingDir:  cmd.WorkingDir,
-		cmd:         execCmd,
-		stdoutPipe:  stdoutPipe,
-		stderrPipe:  stderrPipe,
-	}
-
-	// Add to active processes
+		ID:            id,
+		Name:          cmd.Name,
+		PID:           execCmd.Process.Pid,
+		Command:       cmd.Command,
+		Args:          cmd.Args,
+		StartTime:     time.Now(),
+		Status:        "running",
+		OutputLines:   make([]string, 0),
+		ErrorLines:    make([]string, 0),
+		WorkingDir:    cmd.WorkingDir,
+		Service:       cmd.Service,
+		resources:     NewResourceSeries(pm.config.MetricsHistorySize),
+		spec:          cmd,
+		stopRequested: make(chan struct{}),
+		exited:        make(chan struct{}),
+		cmd:           execCmd,
+		stdin:         stdinPipe,
+		output:        NewBroadcaster(),
+		stdoutPipe:    stdoutPipe,
+		stderrPipe:    stderrPipe,
+		matcher:       pm.errorMatcherFor(cmd),
+		env:           env,
+	}
+
+	process.Runs = []ProcessRun{{PID: process.PID, StartTime: process.StartTime}}
+
+	if limitStatus != nil {
+		if timeout > 0 {
+			deadline := process.StartTime.Add(timeout)
+			limitStatus.Deadline = &deadline
+		}
+		process.Limits = limitStatus
+	}
+
+	if logFile, err := pm.logs.Open(process.ID, process.PID, process.StartTime); err == nil {
+		process.logFile = logFile
+		logFile.Write("system", fmt.Sprintf("started: %s", strings.Join(append([]string{cmd.Command}, cmd.Args...), " ")), process.StartTime)
+	} else {
+		log.Printf("Failed to open log file for PID %d: %v", process.PID, err)
+	}
+
+	if cmd.Record || pm.config.RecordSessions {
+		size := defaultPTYWindowSize
+		if cmd.WindowSize != nil {
+			size = *cmd.WindowSize
+		}
+		if recording, err := pm.recordings.Open(process, size); err == nil {
+			process.recording = recording
+		} else {
+			log.Printf("Failed to open recording for PID %d: %v", process.PID, err)
+		}
+	}
+
+	if cmd.Liveness != nil {
+		process.Health = &ProbeStatus{Status: "unknown"}
+	}
+
+	if previous != nil {
+		restart.NewPID = process.PID
+
+		previous.mutex.RLock()
+		// Output numbering continues, so clients resume across runs
+		process.output = previous.output
+		process.outputSeq = previous.outputSeq
+		process.outputHistory = append([]OutputLine{}, previous.outputHistory...)
+		process.ExitCodes = append([]int{}, previous.ExitCodes...)
+		process.Restarts = append(append([]RestartEvent{}, previous.Restarts...), restart)
+		process.RestartCount = previous.RestartCount + 1
+		process.Runs = append(append([]ProcessRun{}, previous.Runs...), process.Runs...)
+		if len(process.Runs) > maxRunHistory {
+			process.Runs = process.Runs[len(process.Runs)-maxRunHistory:]
+		}
+		previous.mutex.RUnlock()
+	}
+
+	// Add to active processes; a restart replaces its previous run unless
+	// the process was stopped meanwhile, which requestStop decides under
+	// the same lock
 	pm.mutex.Lock()
-	pm.activeProcesses[process.PID] = process
+	stopped := previous != nil && previous.stopIsRequested()
+	if stopped {
+		close(process.stopRequested)
+	} else {
+		pm.activeProcesses[process.ID] = process
+	}
 	pm.mutex.Unlock()
 
 	// Update metrics
@@ -1110,13 +1890,36 @@ func (pm *ProcessMonitor) StartProcess(cmd ProcessCommand) (*MonitoredProcess, e
 	pm.metrics.mutex.Unlock()
 
 	// Start output monitoring
-	go pm.monitorProcessOutput(process, stdoutPipe, "stdout", cmd.ErrorPatterns)
-	go pm.monitorProcessOutput(process, stderrPipe, "stderr", cmd.ErrorPatterns)
+	if cmd.PTY {
+		process.outputReaders.Add(1)
+		go pm.monitorProcessOutput(process, stdoutPipe, "pty")
+	} else {
+		process.outputReaders.Add(2)
+		go pm.monitorProcessOutput(process, stdoutPipe, "stdout")
+		go pm.monitorProcessOutput(process, stderrPipe, "stderr")
+	}
 
 	// Monitor process completion
-	go pm.monitorProcessCompletion(process, cmd.AutoRestart)
+	go pm.monitorProcessCompletion(process)
+
+	if stopped {
+		// The restart lost the race with a stop; end it like a stopped run
+		pm.terminateProcessTree(process, pm.config.StopGracePeriod)
+		pm.cleanupProcess(process)
+		return nil, errStopRequested
+	}
 
-	log.Printf("Successfully started process PID %d", process.PID)
+	if cmd.Liveness != nil {
+		go pm.runLivenessProbe(process, cmd.Liveness)
+	}
+
+	if limitStatus != nil && (timeout > 0 || limitStatus.Mode == "sampled") {
+		limits := cmd.Limits
+		if limits == nil {
+			limits = &ResourceLimits{}
+		}
+		go pm.enforceLimits(process, limits, timeout, limitStatus.Mode == "sampled")
+	}
 
 	return process, nil
 }
@@ -1126,6 +1929,24 @@ func (pm *ProcessMonitor) validateProcessCommand(cmd ProcessCommand) error {
 		return errors.New("command cannot be empty")
 	}
 
+	if err := validateProcessName(cmd.Name); err != nil {
+		return err
+	}
+
+	if _, err := processTimeout(cmd, pm.config); err != nil {
+		return err
+	}
+
+	if cmd.Limits != nil {
+		if err := cmd.Limits.validate(); err != nil {
+			return err
+		}
+	}
+
+	if err := validateErrorPatterns(cmd.ErrorPatterns); err != nil {
+		return err
+	}
+
 	if len(cmd.Command) > 1000 {
 		return errors.New("command too long")
 	}
@@ -1144,20 +1965,48 @@ func (pm *ProcessMonitor) validateProcessCommand(cmd ProcessCommand) error {
 		return fmt.Errorf("working directory does not exist: %s", cmd.WorkingDir)
 	}
 
-	// Security: whitelist allowed commands
-	allowed := false
-	for _, allowedCmd := range pm.config.AllowedCommands {
-		if cmd.Command == allowedCmd {
-			allowed = true
-			break
+	if cmd.Liveness != nil {
+		if err := cmd.Liveness.validate(); err != nil {
+			return err
 		}
 	}
 
-	if !allowed {
-		return fmt.Errorf("command not allowed: %s", cmd.Command)
+	return nil
+}
+
+// authorizeProcess checks a command and its exec liveness probe against the
+// policy and audits the decisions, returning the environment they were
+// checked with. It runs on every spawn, restarts included, so env files
+// edited in the meantime are checked before the process sees them.
+func (pm *ProcessMonitor) authorizeProcess(cmd ProcessCommand) ([]EnvVar, error) {
+	// Security: allowed commands, arguments, working directory and environment
+	if decision := pm.policy.CheckLocation(cmd); decision != nil {
+		pm.policy.Audit(cmd, nil, *decision)
+		return nil, &policyError{decision: *decision}
 	}
 
-	return nil
+	env, err := pm.buildEnvironment(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	decision := pm.policy.Evaluate(cmd, env)
+	pm.policy.Audit(cmd, env, decision)
+	if !decision.Allowed {
+		return nil, &policyError{decision: decision}
+	}
+
+	// The probe runs with the same environment and working directory
+	if cmd.Liveness != nil && len(cmd.Liveness.Exec) > 0 {
+		probe := execProbeCommand(cmd, cmd.Liveness.Exec)
+		decision := pm.policy.Evaluate(probe, env)
+		pm.policy.Audit(probe, env, decision)
+		if !decision.Allowed {
+			decision.Reason = "liveness probe: " + decision.Reason
+			return nil, &policyError{decision: decision}
+		}
+	}
+	return env, nil
 }
 
 // Helper functions
@@ -1480,11 +2329,20 @@ func (pi *ProjectIntelligence) GetSnapshot() *ProjectSnapshot {
 
 // Server implementation
 type IntelligenceServer struct {
-	app *fiber.App
-	pi  *ProjectIntelligence
+	app  *fiber.App
+	pi   *ProjectIntelligence
+	auth *Authenticator
 }
 
 func NewIntelligenceServer(workspace string) *IntelligenceServer {
+	server := newIntelligenceServer(NewProjectIntelligence(workspace))
+	server.pi.StartWatching()
+
+	return server
+}
+
+// newIntelligenceServer wires the HTTP app around an existing intelligence instance
+func newIntelligenceServer(pi *ProjectIntelligence) *IntelligenceServer {
 	app := fiber.New(fiber.Config{
 		AppName: "Project Argus",
 	})
@@ -1492,37 +2350,38 @@ func NewIntelligenceServer(workspace string) *IntelligenceServer {
 	// Middleware
 	app.Use(logger.New())
 	app.Use(recover.New())
-	app.Use(cors.New(cors.Config{
-		AllowOrigins: "*",
-		AllowMethods: "GET,POST,PUT,DELETE,OPTIONS",
-		AllowHeaders: "Origin,Content-Type,Accept,Authorization",
-	}))
 
-	pi := NewProjectIntelligence(workspace)
+	// Browsers may only call the API from the configured origins
+	config := pi.processMonitor.config
+	if origins := corsOrigins(config.Auth.CORSOrigins); origins != "" {
+		app.Use(cors.New(cors.Config{
+			AllowOrigins: origins,
+			AllowMethods: "GET,POST,PUT,DELETE,OPTIONS",
+			AllowHeaders: "Origin,Content-Type,Accept,Authorization",
+		}))
+	}
+
+	auth, err := NewAuthenticator(pi.workspace, config)
+	if err != nil {
+		log.Fatalf("Failed to set up API authentication: %v", err)
+	}
+	app.Use(auth.Middleware())
 
 	server := &IntelligenceServer{
-		app: app,
-		pi:  pi,
+		app:  app,
+		pi:   pi,
+		auth: auth,
 	}
 
 	server.setupRoutes()
-	pi.StartWatching()
 
 	return server
 }
 
 func (is *IntelligenceServer) setupRoutes() {
-	// CORS middleware for browser compatibility
-	is.app.Use(func(c *fiber.Ctx) error {
-		c.Set("Access-Control-Allow-Origin", "*")
-		c.Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Set("Access-Control-Allow-Headers", "Origin, Content-Type, Accept, Authorization")
-
-		if c.Method() == "OPTIONS" {
-			return c.SendStatus(204)
-		}
-
-		return c.Next()
+	// Preflights from origins outside the allowlist get no CORS headers
+	is.app.Options("/*", func(c *fiber.Ctx) error {
+		return c.SendStatus(204)
 	})
 
 	// WebSocket middleware
@@ -1537,6 +2396,8 @@ func (is *IntelligenceServer) setupRoutes() {
 	// WebSocket routes
 	is.app.Get("/ws/errors", websocket.New(is.errorStreamHandler))
 	is.app.Get("/ws/processes", websocket.New(is.processStreamHandler))
+	is.app.Get("/ws/processes/:id/io", websocket.New(is.processIOHandler))
+	is.app.Get("/ws/processes/:id/output", websocket.New(is.processOutputStreamHandler))
 
 	// Main intelligence routes
 	is.app.Get("/", is.statusHandler)
@@ -1546,7 +2407,18 @@ func (is *IntelligenceServer) setupRoutes() {
 	is.app.Get("/git", is.gitHandler)
 	is.app.Get("/errors", is.errorsHandler)
 	is.app.Get("/build", is.buildHandler)
+	is.app.Get("/build/history", is.buildHistoryHandler)
+	is.app.Post("/build/run", is.runBuildHandler)
+	is.app.Get("/build/artifacts", is.buildArtifactsHandler)
 	is.app.Get("/processes", is.processesHandler)
+	is.app.Get("/monitor/metrics", is.monitorMetricsHandler)
+	is.app.Get("/timeline", is.timelineHandler)
+	is.app.Get("/alerts", is.alertsHandler)
+	is.app.Post("/alerts/test", is.alertTestHandler)
+	is.app.Get("/policy", is.policyHandler)
+	is.app.Get("/policy/audit", is.policyAuditHandler)
+	is.app.Get("/auth", is.authHandler)
+	is.app.Get("/ports", is.portsHandler)
 	is.app.Get("/dependencies", is.dependenciesHandler)
 	is.app.Get("/todos", is.todosHandler)
 	is.app.Get("/health", is.healthHandler)
@@ -1554,13 +2426,28 @@ func (is *IntelligenceServer) setupRoutes() {
 	// Process monitoring routes
 	is.app.Get("/processes/monitored", is.monitoredProcessesHandler)
 	is.app.Post("/processes/start", is.startProcessHandler)
-	is.app.Delete("/processes/:pid", is.stopProcessHandler)
-	is.app.Get("/processes/:pid/output", is.processOutputHandler)
+	is.app.Delete("/processes/:id", is.stopProcessHandler)
+	is.app.Get("/processes/:id/output", is.processOutputHandler)
+	is.app.Get("/processes/:id/metrics", is.processMetricsHandler)
+	is.app.Get("/processes/:id/tree", is.processTreeHandler)
+	is.app.Get("/processes/:id/logs", is.processLogsHandler)
+	is.app.Post("/processes/:id/input", is.processInputHandler)
+	is.app.Get("/processes/:id/env", is.processEnvHandler)
+	is.app.Get("/processes/:id/recordings", is.processRecordingsHandler)
+	is.app.Get("/processes/:id/recordings/:name", is.processRecordingHandler)
+	is.app.Post("/processes/:id/recordings/:name/replay", is.replayRecordingHandler)
+	is.app.Get("/processes/logs", is.processLogListHandler)
+	is.app.Get("/processes/:id", is.processDetailHandler)
 
 	// Real-time error streaming
 	is.app.Get("/errors/stream", is.errorStreamHTTPHandler)
 	is.app.Get("/errors/latest", is.latestErrorsHandler)
 
+	// Declared services
+	is.app.Get("/services", is.servicesHandler)
+	is.app.Post("/services/up", is.servicesUpHandler)
+	is.app.Post("/services/down", is.servicesDownHandler)
+
 	// Development server integration
 	is.app.Post("/dev/start/:type", is.startDevServerHandler)
 	is.app.Post("/dev/stop/:type", is.stopDevServerHandler)
@@ -1598,7 +2485,17 @@ func (is *IntelligenceServer) statusHandler(c *fiber.Ctx) error {
 			"/git - Git repository status",
 			"/errors - Active errors and warnings",
 			"/build - Build status",
+			"/build/history - Build history with duration trends",
+			"/build/artifacts - Build artifact sizes and regressions",
 			"/processes - Running processes",
+			"/processes/:id/recordings - Asciicast recordings of process output",
+			"/monitor/metrics - Process monitor and error stream counters",
+			"/timeline - Output, errors, process, file and git events in one stream",
+			"/files/:path/content - Workspace file content (URL-encoded path, ?lines= or ?bytes= ranges)",
+			"/alerts - Fired alerts and alert rules",
+			"/policy/audit - Process start policy decisions",
+			"/auth - The scopes of the request's token",
+			"/ports - Listening ports mapped to processes",
 			"/dependencies - Project dependencies",
 			"/todos - TODO items in code",
 			"/health - Project health metrics",
@@ -1663,15 +2560,126 @@ func (is *IntelligenceServer) buildHandler(c *fiber.Ctx) error {
 	return c.JSON(snapshot.BuildStatus)
 }
 
+func (is *IntelligenceServer) buildHistoryHandler(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", 100)
+	builds, trends := is.pi.buildWatcher.getHistory(limit)
+
+	return c.JSON(fiber.Map{
+		"builds":    builds,
+		"count":     len(builds),
+		"trends":    trends,
+		"timestamp": time.Now(),
+	})
+}
+
+func (is *IntelligenceServer) runBuildHandler(c *fiber.Ctx) error {
+	record, err := is.pi.buildWatcher.RunBuild("manual")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "Failed to run build",
+			"details": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Build completed",
+		"build":   record,
+	})
+}
+
+func (is *IntelligenceServer) buildArtifactsHandler(c *fiber.Ctx) error {
+	tracker := is.pi.buildWatcher.artifacts
+
+	current, previous := tracker.Latest()
+	if buildID := c.Query("build"); buildID != "" {
+		current, previous = tracker.ForBuild(buildID)
+	}
+
+	if current == nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "No build artifacts recorded yet",
+		})
+	}
+
+	threshold := c.QueryFloat("threshold", tracker.threshold)
+	diffs := tracker.Diff(current, previous, threshold)
+
+	regressions := []ArtifactDiff{}
+	for _, diff := range diffs {
+		if diff.Regression {
+			regressions = append(regressions, diff)
+		}
+	}
+
+	// Symbol table breakdown is expensive, so binaries are only analyzed on request
+	artifacts := append([]ArtifactInfo{}, current.Artifacts...)
+	if c.QueryBool("packages", false) {
+		for i := range artifacts {
+			if artifacts[i].Kind == "binary" {
+				artifacts[i].Packages = tracker.PackageBreakdown(artifacts[i].Path)
+			}
+		}
+	}
+
+	response := fiber.Map{
+		"build_id":    current.BuildID,
+		"timestamp":   current.Timestamp,
+		"output_dirs": current.OutputDirs,
+		"total_bytes": current.TotalBytes,
+		"artifacts":   artifacts,
+		"diff":        diffs,
+		"regressions": regressions,
+		"threshold":   threshold,
+	}
+
+	if previous != nil {
+		response["previous_build_id"] = previous.BuildID
+		response["total_delta_bytes"] = current.TotalBytes - previous.TotalBytes
+	}
+
+	return c.JSON(response)
+}
+
 func (is *IntelligenceServer) processesHandler(c *fiber.Ctx) error {
 	snapshot := is.pi.GetSnapshot()
 	if snapshot == nil {
 		return c.Status(503).JSON(fiber.Map{"error": "Not ready"})
 	}
 
+	if c.QueryBool("tree", false) {
+		return c.JSON(buildProcessTree(snapshot.RunningProcesses))
+	}
+
 	return c.JSON(snapshot.RunningProcesses)
 }
 
+func (is *IntelligenceServer) portsHandler(c *fiber.Ctx) error {
+	if !procAvailable() {
+		return c.Status(501).JSON(fiber.Map{
+			"error": "Port discovery requires /proc",
+		})
+	}
+
+	table := currentPortTable()
+	ports := table.ForWorkspace(is.pi.workspace)
+
+	if c.QueryBool("project", false) {
+		filtered := []ListeningPort{}
+		for _, port := range ports {
+			if port.IsProjectRelated {
+				filtered = append(filtered, port)
+			}
+		}
+		ports = filtered
+	}
+
+	return c.JSON(fiber.Map{
+		"ports":     ports,
+		"count":     len(ports),
+		"timestamp": table.Timestamp,
+	})
+}
+
 func (is *IntelligenceServer) dependenciesHandler(c *fiber.Ctx) error {
 	snapshot := is.pi.GetSnapshot()
 	if snapshot == nil {
@@ -1699,50 +2707,122 @@ func (is *IntelligenceServer) healthHandler(c *fiber.Ctx) error {
 	return c.JSON(snapshot.Health)
 }
 
+// resolveFile resolves the :path parameter and answers If-None-Match; done
+// reports that the response has been sent
+func (is *IntelligenceServer) resolveFile(c *fiber.Ctx) (*WorkspaceFile, bool, error) {
+	file, err := is.pi.resolveWorkspaceFile(c.Params("path"))
+	if err != nil {
+		return nil, true, c.Status(fileStatus(err)).JSON(fiber.Map{
+			"error":   "File not available",
+			"details": err.Error(),
+		})
+	}
+
+	etag := file.ETag()
+	c.Set(fiber.HeaderETag, etag)
+	if match := c.Get(fiber.HeaderIfNoneMatch); match != "" {
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == etag || candidate == "*" {
+				return nil, true, c.SendStatus(fiber.StatusNotModified)
+			}
+		}
+	}
+	return file, false, nil
+}
+
 func (is *IntelligenceServer) fileHandler(c *fiber.Ctx) error {
-	path := c.Params("path")
-	fullPath := filepath.Join(is.pi.workspace, path)
+	file, done, err := is.resolveFile(c)
+	if done {
+		return err
+	}
 
-	info, err := os.Stat(fullPath)
+	sample, err := sniffFile(file.FullPath)
 	if err != nil {
-		return c.Status(404).JSON(fiber.Map{
-			"error": "File not found",
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "Failed to read file",
+			"details": err.Error(),
 		})
 	}
 
 	fileInfo := FileInfo{
-		Path:         fullPath,
-		RelativePath: path,
-		Size:         info.Size(),
-		ModTime:      info.ModTime(),
-		IsExecutable: info.Mode()&0111 != 0,
-		Language:     detectLanguage(fullPath),
+		Path:         file.FullPath,
+		RelativePath: file.RelativePath,
+		Size:         file.Info.Size(),
+		ModTime:      file.Info.ModTime(),
+		IsExecutable: file.Info.Mode()&0111 != 0,
+		Language:     detectLanguage(file.FullPath),
+		Binary:       sample.Binary,
+		Encoding:     sample.Encoding,
+		ETag:         file.ETag(),
 	}
 
-	if isCodeFile(fullPath) {
-		fileInfo.LineCount = countLines(fullPath)
+	if isCodeFile(file.FullPath) && !sample.Binary {
+		fileInfo.LineCount = countLines(file.FullPath)
 	}
 
 	return c.JSON(fileInfo)
 }
 
+// fileContentHandler reads a workspace file, or the part selected with
+// ?lines=FIRST-LAST or ?bytes=FIRST-LAST, capped at file_read_max_size_kb.
+// Binary files are only returned with ?base64=true.
 func (is *IntelligenceServer) fileContentHandler(c *fiber.Ctx) error {
-	path := c.Params("path")
-	fullPath := filepath.Join(is.pi.workspace, path)
+	file, done, err := is.resolveFile(c)
+	if done {
+		return err
+	}
 
-	content, err := os.ReadFile(fullPath)
+	fileRange, err := parseFileRange(c.Query("lines"), c.Query("bytes"), file.Info.Size())
 	if err != nil {
-		return c.Status(404).JSON(fiber.Map{
-			"error": "File not found or cannot be read",
+		return c.Status(fileStatus(err)).JSON(fiber.Map{
+			"error":   "Invalid range",
+			"details": err.Error(),
 		})
 	}
 
-	return c.JSON(fiber.Map{
-		"path":     path,
-		"content":  string(content),
-		"size":     len(content),
-		"language": detectLanguage(fullPath),
-	})
+	asBase64 := c.QueryBool("base64")
+	sample, err := sniffFile(file.FullPath)
+	if err == nil {
+		err = checkRangeEncoding(fileRange, sample, asBase64)
+	}
+	if err != nil {
+		return c.Status(fileStatus(err)).JSON(fiber.Map{
+			"error":   "Failed to read file",
+			"details": err.Error(),
+		})
+	}
+
+	maxBytes := is.pi.processMonitor.config.FileReadMaxSizeKB * 1024
+	if maxBytes <= 0 {
+		maxBytes = 1 << 20
+	}
+	content, err := readWorkspaceFile(file, fileRange, sample, maxBytes, asBase64)
+	if err != nil {
+		return c.Status(fileStatus(err)).JSON(fiber.Map{
+			"error":   "Failed to read file",
+			"details": err.Error(),
+		})
+	}
+
+	response := fiber.Map{
+		"path":           file.RelativePath,
+		"language":       detectLanguage(file.FullPath),
+		"binary":         sample.Binary,
+		"encoding":       sample.Encoding,
+		"etag":           file.ETag(),
+		"content":        content.Content,
+		"base64":         content.Base64,
+		"size":           content.Size,
+		"returned_bytes": content.Returned,
+		"start_byte":     content.StartByte,
+		"end_byte":       content.EndByte,
+		"truncated":      content.Truncated,
+	}
+	if fileRange.Lines {
+		response["start_line"], response["end_line"] = content.StartLine, content.EndLine
+	}
+	return c.JSON(response)
 }
 
 func (is *IntelligenceServer) searchHandler(c *fiber.Ctx) error {
@@ -1866,9 +2946,9 @@ func (is *IntelligenceServer) workspaceChangeHandler(c *fiber.Ctx) error {
 
 // WebSocket handlers
 func (is *IntelligenceServer) errorStreamHandler(c *websocket.Conn) {
-	// Add connection to process monitor
-	is.pi.processMonitor.AddWebSocketConnection(c)
-	defer is.pi.processMonitor.RemoveWebSocketConnection(c)
+	// Subscribe to the process monitor's error stream
+	sub := is.pi.processMonitor.SubscribeErrors()
+	defer is.pi.processMonitor.UnsubscribeErrors(sub)
 
 	// Send initial connection message
 	initialMsg := map[string]interface{}{
@@ -1881,24 +2961,37 @@ func (is *IntelligenceServer) errorStreamHandler(c *websocket.Conn) {
 		c.WriteMessage(websocket.TextMessage, data)
 	}
 
-	// Keep connection alive and handle messages
+	closed := watchWebSocketClose(c)
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+
 	for {
-		// Read message (ping/pong for keepalive)
-		_, _, err := c.ReadMessage()
-		if err != nil {
-			log.Printf("WebSocket read error: %v", err)
-			break
+		select {
+		case frame, ok := <-sub.C:
+			if !ok {
+				return // Fell too far behind
+			}
+			if err := c.WriteMessage(websocket.TextMessage, frame); err != nil {
+				log.Printf("WebSocket write error: %v", err)
+				return
+			}
+		case <-ping.C:
+			if err := c.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case <-closed:
+			return
 		}
 	}
 }
 
 func (is *IntelligenceServer) processStreamHandler(c *websocket.Conn) {
-	// Add connection to process monitor
-	is.pi.processMonitor.AddWebSocketConnection(c)
-	defer is.pi.processMonitor.RemoveWebSocketConnection(c)
+	// Errors are interleaved with the periodic process updates
+	sub := is.pi.processMonitor.SubscribeErrors()
+	defer is.pi.processMonitor.UnsubscribeErrors(sub)
 
 	// Send current process status
-	processes := is.pi.processMonitor.GetMonitoredProcesses()
+	processes := is.pi.processMonitor.ProcessSnapshots()
 	statusMsg := map[string]interface{}{
 		"type":      "process_status",
 		"processes": processes,
@@ -1909,14 +3002,18 @@ func (is *IntelligenceServer) processStreamHandler(c *websocket.Conn) {
 		c.WriteMessage(websocket.TextMessage, data)
 	}
 
+	closed := watchWebSocketClose(c)
+
 	// Send updates every 5 seconds
 	ticker := time.NewTicker(5 * time.Second)
 	defer ticker.Stop()
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
-			processes := is.pi.processMonitor.GetMonitoredProcesses()
+			processes := is.pi.processMonitor.ProcessSnapshots()
 			statusMsg := map[string]interface{}{
 				"type":      "process_update",
 				"processes": processes,
@@ -1929,90 +3026,566 @@ func (is *IntelligenceServer) processStreamHandler(c *websocket.Conn) {
 					return
 				}
 			}
-		default:
-			// Check if connection is still alive
+		case frame, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			if err := c.WriteMessage(websocket.TextMessage, frame); err != nil {
+				return
+			}
+		case <-ping.C:
 			if err := c.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
-			time.Sleep(1 * time.Second)
+		case <-closed:
+			return
 		}
 	}
 }
 
-// Process monitoring handlers
-func (is *IntelligenceServer) monitoredProcessesHandler(c *fiber.Ctx) error {
-	processes := is.pi.processMonitor.GetMonitoredProcesses()
-
-	return c.JSON(fiber.Map{
-		"processes": processes,
-		"count":     len(processes),
-		"timestamp": time.Now(),
-	})
-}
-
-func (is *IntelligenceServer) startProcessHandler(c *fiber.Ctx) error {
-	var cmd ProcessCommand
-	if err := c.BodyParser(&cmd); err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"error":   "Invalid JSON format",
-			"details": err.Error(),
-		})
-	}
-
-	// Rate limiting check
-	if !is.checkRateLimit(c.IP()) {
-		return c.Status(429).JSON(fiber.Map{
-			"error": "Rate limit exceeded",
-		})
+// processOutputStreamHandler streams a process's output lines as they
+// arrive. since_seq resumes after the last line a client saw, across
+// restarts too; a "gap" message reports lines that were discarded before it
+// reconnected, a "reset" message a since_seq this stream never reached, and
+// a "lagged" message that the client fell behind and should resume.
+func (is *IntelligenceServer) processOutputStreamHandler(c *websocket.Conn) {
+	var sinceSeq uint64
+	var err error
+	if value := c.Query("since_seq"); value != "" {
+		if sinceSeq, err = strconv.ParseUint(value, 10, 64); err != nil {
+			c.WriteJSON(fiber.Map{"type": "error", "error": "Invalid since_seq"})
+			return
+		}
 	}
 
-	// Validate and start process
-	process, err := is.pi.processMonitor.StartProcess(cmd)
+	process, err := is.pi.processMonitor.ResolveProcess(c.Params("id"))
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error":   "Failed to start process",
-			"details": err.Error(),
-		})
+		c.WriteJSON(fiber.Map{"type": "error", "error": err.Error()})
+		return
 	}
 
-	return c.JSON(fiber.Map{
-		"message": "Process started successfully",
-		"process": process,
+	resume, sub := process.SubscribeOutput(sinceSeq)
+	defer process.output.Unsubscribe(sub)
+
+	c.WriteJSON(fiber.Map{
+		"type":      "connection",
+		"id":        process.ID,
+		"pid":       process.PID,
+		"since_seq": sinceSeq,
+		"timestamp": time.Now(),
 	})
-}
 
-func (is *IntelligenceServer) stopProcessHandler(c *fiber.Ctx) error {
-	pidStr := c.Params("pid")
-	pid, err := strconv.Atoi(pidStr)
-	if err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "Invalid PID",
-		})
+	if resume.Reset {
+		c.WriteJSON(fiber.Map{"type": "reset", "message": "since_seq is ahead of this stream, replaying from the start"})
 	}
-
-	if err := is.pi.processMonitor.StopProcess(pid); err != nil {
-		return c.Status(404).JSON(fiber.Map{
-			"error":   "Failed to stop process",
-			"details": err.Error(),
-		})
+	if c.Query("since_seq") != "" && resume.GapFrom > 0 {
+		c.WriteJSON(fiber.Map{"type": "gap", "from_seq": resume.GapFrom, "to_seq": resume.GapTo})
 	}
 
-	return c.JSON(fiber.Map{
-		"message": fmt.Sprintf("Process %d stopped successfully", pid),
-	})
-}
-
-func (is *IntelligenceServer) processOutputHandler(c *fiber.Ctx) error {
-	pidStr := c.Params("pid")
-	pid, err := strconv.Atoi(pidStr)
-	if err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "Invalid PID",
-		})
+	for _, entry := range resume.Backlog {
+		if err := c.WriteJSON(outputLineMessage(entry)); err != nil {
+			return
+		}
+	}
+
+	closed := watchWebSocketClose(c)
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case frame, ok := <-sub.C:
+			if !ok {
+				c.WriteJSON(fiber.Map{"type": "lagged", "message": "client fell behind, reconnect with since_seq"})
+				return
+			}
+			if err := c.WriteMessage(websocket.TextMessage, frame); err != nil {
+				return
+			}
+		case <-process.exited:
+			// Lines read before the exit are still queued
+			for len(sub.C) > 0 {
+				c.WriteMessage(websocket.TextMessage, <-sub.C)
+			}
+			process.mutex.RLock()
+			exitCode := process.ExitCode
+			lastSeq := process.outputSeq
+			process.mutex.RUnlock()
+			c.WriteJSON(fiber.Map{"type": "exit", "exit_code": exitCode, "last_seq": lastSeq})
+			c.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "process exited"))
+			return
+		case <-ping.C:
+			if err := c.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+// processIOHandler attaches a client to a process's terminal: output and
+// detected prompts are sent as JSON events, every message received is
+// written to the process's stdin verbatim
+func (is *IntelligenceServer) processIOHandler(c *websocket.Conn) {
+	monitor := is.pi.processMonitor
+	process, events, detach, err := monitor.AttachProcess(c.Params("id"))
+	if err != nil {
+		c.WriteJSON(fiber.Map{"type": "error", "error": err.Error()})
+		return
+	}
+	defer detach()
+
+	process.mutex.RLock()
+	prompt := process.Prompt
+	process.mutex.RUnlock()
+
+	c.WriteJSON(fiber.Map{
+		"type":      "connection",
+		"id":        process.ID,
+		"pid":       process.PID,
+		"prompt":    prompt,
+		"timestamp": time.Now(),
+	})
+
+	// Reads run separately so input never waits for output to be sent
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			_, message, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			if _, err := monitor.WriteProcessInput(process.ID, string(message)); err != nil {
+				log.Printf("WebSocket input for process %s: %v", process.ID, err)
+			}
+		}
+	}()
+
+	for {
+		select {
+		case event := <-events:
+			if err := c.WriteJSON(event); err != nil {
+				return
+			}
+		case <-process.exited:
+			for len(events) > 0 {
+				c.WriteJSON(<-events)
+			}
+			process.mutex.RLock()
+			exitCode := process.ExitCode
+			process.mutex.RUnlock()
+			c.WriteJSON(ProcessIOEvent{Type: "exit", ExitCode: exitCode})
+			return
+		case <-closed:
+			return
+		}
+	}
+}
+
+// Process monitoring handlers
+func (is *IntelligenceServer) monitoredProcessesHandler(c *fiber.Ctx) error {
+	processes := is.pi.processMonitor.ProcessSnapshots()
+
+	return c.JSON(fiber.Map{
+		"processes": processes,
+		"count":     len(processes),
+		"ended":     is.pi.processMonitor.EndedProcesses(),
+		"timestamp": time.Now(),
+	})
+}
+
+func (is *IntelligenceServer) startProcessHandler(c *fiber.Ctx) error {
+	var cmd ProcessCommand
+	if err := c.BodyParser(&cmd); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "Invalid JSON format",
+			"details": err.Error(),
+		})
+	}
+
+	// Rate limiting check
+	if !is.checkRateLimit(c) {
+		return c.Status(429).JSON(fiber.Map{
+			"error":   "Rate limit exceeded",
+			"details": fmt.Sprintf("at most %d process starts per minute", is.pi.processMonitor.config.RateLimitPerMinute),
+		})
+	}
+
+	// Validate and start process
+	process, err := is.pi.processMonitor.StartProcess(cmd)
+	var denied *policyError
+	if errors.As(err, &denied) {
+		return c.Status(403).JSON(fiber.Map{
+			"error":   "Process denied by policy",
+			"details": err.Error(),
+			"rule":    denied.decision.Rule,
+		})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error":   "Failed to start process",
+			"details": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Process started successfully",
+		"process": process.Snapshot(),
+	})
+}
+
+// processDetailHandler returns one monitored process, including the runs
+// that share its stable ID. Processes already cleaned up are reported with
+// their run history only.
+func (is *IntelligenceServer) processDetailHandler(c *fiber.Ctx) error {
+	process, err := is.pi.processMonitor.ResolveProcess(c.Params("id"))
+	if err != nil {
+		if ended, found := is.pi.processMonitor.LookupEnded(c.Params("id")); found {
+			return c.JSON(fiber.Map{
+				"process":   ended,
+				"ended":     true,
+				"timestamp": time.Now(),
+			})
+		}
+		return c.Status(404).JSON(fiber.Map{
+			"error":   "Process not found",
+			"details": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"process":   process.Snapshot(),
+		"timestamp": time.Now(),
+	})
+}
+
+func (is *IntelligenceServer) stopProcessHandler(c *fiber.Ctx) error {
+	process, err := is.pi.processMonitor.ResolveProcess(c.Params("id"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error":   "Process not found",
+			"details": err.Error(),
+		})
+	}
+
+	grace := is.pi.config.StopGracePeriod
+	if value := c.Query("grace"); value != "" {
+		if grace, err = time.ParseDuration(value); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid grace period",
+			})
+		}
+	}
+
+	if err := is.pi.processMonitor.StopProcessWithGrace(process.ID, grace); err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error":   "Failed to stop process",
+			"details": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": fmt.Sprintf("Process %s stopped successfully", process.ID),
+		"id":      process.ID,
+		"pid":     process.PID,
+	})
+}
+
+func (is *IntelligenceServer) processOutputHandler(c *fiber.Ctx) error {
+	process, err := is.pi.processMonitor.ResolveProcess(c.Params("id"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error":   "Process not found",
+			"details": err.Error(),
+		})
+	}
+
+	// Raw output keeps escape codes and timing for terminal replay
+	if c.QueryBool("raw", false) {
+		chunks, err := is.pi.processMonitor.GetProcessRawOutput(process.ID)
+		if err != nil {
+			return c.Status(404).JSON(fiber.Map{
+				"error":   "Process not found",
+				"details": err.Error(),
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"id":     process.ID,
+			"pid":    process.PID,
+			"chunks": chunks,
+		})
 	}
 
 	lines := c.QueryInt("lines", 50)
-	output, err := is.pi.processMonitor.GetProcessOutput(pid, lines)
+	output, err := is.pi.processMonitor.GetProcessOutput(process.ID, lines)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error":   "Process not found",
+			"details": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"id":     process.ID,
+		"pid":    process.PID,
+		"lines":  lines,
+		"output": output,
+	})
+}
+
+func (is *IntelligenceServer) processMetricsHandler(c *fiber.Ctx) error {
+	process, err := is.pi.processMonitor.ResolveProcess(c.Params("id"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error":   "Process not found",
+			"details": err.Error(),
+		})
+	}
+
+	samples, summary, err := is.pi.processMonitor.GetProcessResources(process.ID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error":   "Process not found",
+			"details": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"id":        process.ID,
+		"pid":       process.PID,
+		"interval":  is.pi.config.MetricsInterval.String(),
+		"samples":   samples,
+		"summary":   summary,
+		"timestamp": time.Now(),
+	})
+}
+
+func (is *IntelligenceServer) processTreeHandler(c *fiber.Ctx) error {
+	process, err := is.pi.processMonitor.ResolveProcess(c.Params("id"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error":   "Process not found",
+			"details": err.Error(),
+		})
+	}
+
+	tree, err := is.pi.processMonitor.GetProcessTree(process.ID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error":   "Process not found",
+			"details": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"id":        process.ID,
+		"pid":       process.PID,
+		"tree":      tree,
+		"timestamp": time.Now(),
+	})
+}
+
+func (is *IntelligenceServer) processLogsHandler(c *fiber.Ctx) error {
+	// Logs outlive the process; a name only resolves while it is monitored
+	ref := c.Params("id")
+	if process, err := is.pi.processMonitor.ResolveProcess(ref); err == nil {
+		ref = process.ID
+	}
+
+	var err error
+	query := LogQuery{
+		Stream: c.Query("stream"),
+		Limit:  c.QueryInt("limit", 1000),
+	}
+
+	if query.Since, err = parseLogTime(c.Query("since")); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if query.Until, err = parseLogTime(c.Query("until")); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if grep := c.Query("grep"); grep != "" {
+		if query.Grep, err = regexp.Compile(grep); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error":   "Invalid grep pattern",
+				"details": err.Error(),
+			})
+		}
+	}
+
+	entries, err := is.pi.processMonitor.logs.Query(ref, query)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error":   "Logs not found",
+			"details": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"id":        ref,
+		"entries":   entries,
+		"count":     len(entries),
+		"timestamp": time.Now(),
+	})
+}
+
+func (is *IntelligenceServer) processLogListHandler(c *fiber.Ctx) error {
+	runs := is.pi.processMonitor.logs.List()
+
+	return c.JSON(fiber.Map{
+		"logs":      runs,
+		"count":     len(runs),
+		"timestamp": time.Now(),
+	})
+}
+
+// processEnvHandler shows the effective environment of a process's current
+// run with secrets masked
+func (is *IntelligenceServer) processEnvHandler(c *fiber.Ctx) error {
+	process, err := is.pi.processMonitor.ResolveProcess(c.Params("id"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error":   "Process not found",
+			"details": err.Error(),
+		})
+	}
+
+	process.mutex.RLock()
+	env := maskEnvironment(process.env)
+	spec := process.spec
+	process.mutex.RUnlock()
+
+	clean := spec.CleanEnv
+	if profile, exists := is.pi.processMonitor.config.EnvProfiles[spec.EnvProfile]; exists {
+		clean = clean || profile.CleanEnv
+	}
+
+	return c.JSON(fiber.Map{
+		"id":          process.ID,
+		"pid":         process.PID,
+		"env_profile": spec.EnvProfile,
+		"env_files":   spec.EnvFiles,
+		"clean_env":   clean,
+		"environment": env,
+		"count":       len(env),
+		"timestamp":   time.Now(),
+	})
+}
+
+// recordingProcessID resolves the process a recording request refers to;
+// like logs, recordings outlive the process
+func (is *IntelligenceServer) recordingProcessID(c *fiber.Ctx) string {
+	ref := c.Params("id")
+	if process, err := is.pi.processMonitor.ResolveProcess(ref); err == nil {
+		return process.ID
+	}
+	return ref
+}
+
+func (is *IntelligenceServer) processRecordingsHandler(c *fiber.Ctx) error {
+	id := is.recordingProcessID(c)
+	recordings := is.pi.processMonitor.recordings.List(id)
+
+	return c.JSON(fiber.Map{
+		"id":         id,
+		"recordings": recordings,
+		"count":      len(recordings),
+		"timestamp":  time.Now(),
+	})
+}
+
+func (is *IntelligenceServer) processRecordingHandler(c *fiber.Ctx) error {
+	path, err := is.pi.processMonitor.recordings.Path(is.recordingProcessID(c), c.Params("name"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error":   "Recording not found",
+			"details": err.Error(),
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, "application/x-asciicast")
+	return c.SendFile(path)
+}
+
+// replayRequest is the body of POST /processes/:id/recordings/:name/replay
+type replayRequest struct {
+	ErrorPatterns []string `json:"error_patterns"` // tried before the process's own patterns
+	Emit          bool     `json:"emit"`           // also report the errors to the error stream
+}
+
+func (is *IntelligenceServer) replayRecordingHandler(c *fiber.Ctx) error {
+	var req replayRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error":   "Invalid request body",
+				"details": err.Error(),
+			})
+		}
+	}
+	if err := validateErrorPatterns(req.ErrorPatterns); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "Invalid error patterns",
+			"details": err.Error(),
+		})
+	}
+
+	pm := is.pi.processMonitor
+	id := is.recordingProcessID(c)
+	path, err := pm.recordings.Path(id, c.Params("name"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error":   "Recording not found",
+			"details": err.Error(),
+		})
+	}
+
+	header, events, err := readRecording(path)
+	if err != nil {
+		return c.Status(422).JSON(fiber.Map{
+			"error":   "Failed to read recording",
+			"details": err.Error(),
+		})
+	}
+
+	// Match the way the process itself would, with the new patterns first
+	spec := ProcessCommand{WorkingDir: is.pi.workspace}
+	if process, err := pm.ResolveProcess(id); err == nil {
+		spec = process.spec
+	} else if fields := strings.Fields(header.Command); len(fields) > 0 {
+		spec.Command = fields[0]
+	}
+	spec.ErrorPatterns = append(append([]string{}, req.ErrorPatterns...), spec.ErrorPatterns...)
+
+	found := replayRecording(header, events, id, pm.errorMatcherFor(spec))
+	if req.Emit {
+		for _, streamError := range found {
+			pm.emitStreamError(streamError)
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"id":        id,
+		"recording": c.Params("name"),
+		"errors":    found,
+		"count":     len(found),
+		"emitted":   req.Emit,
+		"timestamp": time.Now(),
+	})
+}
+
+// processInputRequest is the body of POST /processes/:id/input
+type processInputRequest struct {
+	Data    string `json:"data"`
+	Newline bool   `json:"newline"` // append a newline, as if Enter was pressed
+	Close   bool   `json:"close"`   // send end-of-file after the data
+}
+
+func (is *IntelligenceServer) processInputHandler(c *fiber.Ctx) error {
+	process, err := is.pi.processMonitor.ResolveProcess(c.Params("id"))
 	if err != nil {
 		return c.Status(404).JSON(fiber.Map{
 			"error":   "Process not found",
@@ -2020,45 +3593,377 @@ func (is *IntelligenceServer) processOutputHandler(c *fiber.Ctx) error {
 		})
 	}
 
+	var req processInputRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "Invalid request body",
+			"details": err.Error(),
+		})
+	}
+
+	data := req.Data
+	if req.Newline {
+		data += "\n"
+	}
+
+	written := 0
+	if data != "" {
+		if written, err = is.pi.processMonitor.WriteProcessInput(process.ID, data); err != nil {
+			status := 409
+			if errors.Is(err, errInputTimeout) {
+				status = 504
+			}
+			return c.Status(status).JSON(fiber.Map{
+				"error":   "Failed to write input",
+				"details": err.Error(),
+			})
+		}
+	}
+
+	if req.Close {
+		if err := is.pi.processMonitor.CloseProcessInput(process.ID); err != nil {
+			return c.Status(409).JSON(fiber.Map{
+				"error":   "Failed to close input",
+				"details": err.Error(),
+			})
+		}
+	}
+
 	return c.JSON(fiber.Map{
-		"pid":    pid,
-		"lines":  lines,
-		"output": output,
+		"id":        process.ID,
+		"pid":       process.PID,
+		"bytes":     written,
+		"closed":    req.Close,
+		"timestamp": time.Now(),
 	})
 }
 
+// parseErrorQuery reads the filters and cursors shared by the error
+// history endpoints; without a cursor only errors within since are returned
+func (is *IntelligenceServer) parseErrorQuery(c *fiber.Ctx) (ErrorQuery, error) {
+	var err error
+	query := ErrorQuery{
+		Source:   c.Query("source"),
+		PID:      c.QueryInt("pid"),
+		AfterID:  uint64(c.QueryInt("after")),
+		BeforeID: uint64(c.QueryInt("before")),
+		Limit:    c.QueryInt("limit", 100),
+	}
+
+	if query.Limit <= 0 || query.Limit > 1000 {
+		query.Limit = 1000
+	}
+
+	since := c.Query("since")
+	if since == "" && query.AfterID == 0 && query.BeforeID == 0 {
+		since = "5m"
+	}
+	if query.Since, err = parseLogTime(since); err != nil {
+		return query, err
+	}
+	if query.Until, err = parseLogTime(c.Query("until")); err != nil {
+		return query, err
+	}
+
+	if ref := c.Query("process"); ref != "" {
+		// Stored errors outlive their process; a name only resolves while it is monitored
+		query.ProcessID = ref
+		if process, err := is.pi.processMonitor.ResolveProcess(ref); err == nil {
+			query.ProcessID = process.ID
+		}
+	}
+	if types := c.Query("type"); types != "" {
+		query.Types = strings.Split(types, ",")
+	}
+	if severities := c.Query("severity"); severities != "" {
+		query.Severities = strings.Split(severities, ",")
+	}
+	if grep := c.Query("grep"); grep != "" {
+		if query.Grep, err = regexp.Compile(grep); err != nil {
+			return query, fmt.Errorf("invalid grep pattern: %w", err)
+		}
+	}
+
+	return query, nil
+}
+
+// errorStreamHTTPHandler pages through stored errors oldest first; polling
+// clients pass the last ID they saw as after
 func (is *IntelligenceServer) errorStreamHTTPHandler(c *fiber.Ctx) error {
-	since := c.Query("since", "5m")
-	duration, err := time.ParseDuration(since)
+	query, err := is.parseErrorQuery(c)
 	if err != nil {
-		duration = 5 * time.Minute
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "Invalid error query",
+			"details": err.Error(),
+		})
 	}
 
-	errors := is.pi.processMonitor.GetLatestErrors(duration)
+	page := is.pi.processMonitor.QueryErrors(query)
+
+	lastID := query.AfterID
+	if page.Count > 0 {
+		lastID = page.Errors[page.Count-1].ID
+	}
 
 	return c.JSON(fiber.Map{
-		"since":       since,
-		"error_count": len(errors),
-		"errors":      errors,
+		"since":       c.Query("since"),
+		"error_count": page.Count,
+		"errors":      page.Errors,
+		"has_more":    page.HasMore,
+		"next_after":  lastID,
 		"timestamp":   time.Now(),
 	})
 }
 
+// latestErrorsHandler pages through stored errors newest first
 func (is *IntelligenceServer) latestErrorsHandler(c *fiber.Ctx) error {
-	since := c.Query("since", "5m")
-	duration, err := time.ParseDuration(since)
+	query, err := is.parseErrorQuery(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "Invalid error query",
+			"details": err.Error(),
+		})
+	}
+
+	query.Newest = true
+	page := is.pi.processMonitor.QueryErrors(query)
+
+	response := fiber.Map{
+		"since":       c.Query("since", "5m"),
+		"cutoff":      query.Since,
+		"error_count": page.Count,
+		"errors":      page.Errors,
+		"has_more":    page.HasMore,
+		"timestamp":   time.Now(),
+	}
+	if page.HasMore {
+		response["next_before"] = page.Next
+	}
+
+	return c.JSON(response)
+}
+
+// timelineHandler merges process and workspace events; filters are since,
+// until, source, process (comma-separated), grep and limit
+func (is *IntelligenceServer) timelineHandler(c *fiber.Ctx) error {
+	var err error
+	query := TimelineQuery{Limit: c.QueryInt("limit", 500)}
+	if query.Limit <= 0 || query.Limit > 5000 {
+		query.Limit = 5000
+	}
+
+	since := c.Query("since", "15m")
+	if query.Since, err = parseLogTime(since); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if query.Until, err = parseLogTime(c.Query("until")); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if sources := c.Query("source"); sources != "" {
+		for _, source := range strings.Split(sources, ",") {
+			if !containsString(timelineSources, source) {
+				return c.Status(400).JSON(fiber.Map{
+					"error":   "Invalid source",
+					"details": fmt.Sprintf("unknown source %q: use %s", source, strings.Join(timelineSources, ", ")),
+				})
+			}
+			query.Sources = append(query.Sources, source)
+		}
+	}
+
+	if refs := c.Query("process"); refs != "" {
+		for _, ref := range strings.Split(refs, ",") {
+			// Errors outlive their process; a name only resolves while it is monitored
+			if process, err := is.pi.processMonitor.ResolveProcess(ref); err == nil {
+				ref = process.ID
+			}
+			query.Processes = append(query.Processes, ref)
+		}
+	}
+
+	if grep := c.Query("grep"); grep != "" {
+		if query.Grep, err = regexp.Compile(grep); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error":   "Invalid grep pattern",
+				"details": err.Error(),
+			})
+		}
+	}
+
+	page := is.pi.Timeline(query)
+
+	return c.JSON(fiber.Map{
+		"events":    page.Events,
+		"count":     page.Count,
+		"has_more":  page.HasMore,
+		"since":     query.Since,
+		"timestamp": time.Now(),
+	})
+}
+
+func (is *IntelligenceServer) monitorMetricsHandler(c *fiber.Ctx) error {
+	pm := is.pi.processMonitor
+
+	pm.metrics.mutex.RLock()
+	metrics := fiber.Map{
+		"process_start_attempts": pm.metrics.ProcessStartAttempts,
+		"process_start_failures": pm.metrics.ProcessStartFailures,
+		"active_processes":       pm.metrics.ActiveProcesses,
+		"total_errors":           pm.metrics.TotalErrors,
+		"errors_dropped":         pm.metrics.ErrorsDropped,
+		"errors_coalesced":       pm.metrics.ErrorsCoalesced,
+	}
+	pm.metrics.mutex.RUnlock()
+
+	metrics["errors_stored"] = pm.errors.Len()
+	metrics["error_stream_queued"] = len(pm.errorStream)
+	metrics["error_stream_subscribers"] = pm.errorClients.Len()
+	metrics["timestamp"] = time.Now()
+
+	return c.JSON(metrics)
+}
+
+func (is *IntelligenceServer) alertsHandler(c *fiber.Ctx) error {
+	alerts := is.pi.alerts.Alerts(c.QueryInt("limit", 100))
+
+	return c.JSON(fiber.Map{
+		"alerts":    alerts,
+		"count":     len(alerts),
+		"rules":     is.pi.alerts.Rules(),
+		"timestamp": time.Now(),
+	})
+}
+
+func (is *IntelligenceServer) policyHandler(c *fiber.Ctx) error {
+	config := is.pi.processMonitor.config
+
+	return c.JSON(fiber.Map{
+		"allowed_commands": config.AllowedCommands,
+		"policy":           config.Policy,
+		"workspace":        is.pi.processMonitor.policy.workspace,
+		"timestamp":        time.Now(),
+	})
+}
+
+func (is *IntelligenceServer) authHandler(c *fiber.Ctx) error {
+	config := is.pi.processMonitor.config
+	token, _ := c.Locals("token").(*apiToken)
+
+	return c.JSON(fiber.Map{
+		"authenticated":          token != nil,
+		"token":                  token,
+		"scopes":                 allScopes,
+		"cors_origins":           config.Auth.CORSOrigins,
+		"requests_per_minute":    config.Auth.RequestsPerMinute,
+		"ip_requests_per_minute": config.Auth.IPRequestsPerMinute,
+		"timestamp":              time.Now(),
+	})
+}
+
+func (is *IntelligenceServer) policyAuditHandler(c *fiber.Ctx) error {
+	decision := c.Query("decision")
+	if decision != "" && decision != "allow" && decision != "deny" {
+		return c.Status(400).JSON(fiber.Map{"error": "decision must be allow or deny"})
+	}
+
+	entries := is.pi.processMonitor.policy.AuditLog(decision, c.QueryInt("limit", 100))
+
+	return c.JSON(fiber.Map{
+		"entries":   entries,
+		"count":     len(entries),
+		"timestamp": time.Now(),
+	})
+}
+
+func (is *IntelligenceServer) alertTestHandler(c *fiber.Ctx) error {
+	results := is.pi.alerts.SendTest(c.Context(), c.Query("sink"))
+	if len(results) == 0 {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "No matching alert sinks configured",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"results":   results,
+		"timestamp": time.Now(),
+	})
+}
+
+func (is *IntelligenceServer) servicesHandler(c *fiber.Ctx) error {
+	services, err := is.pi.services.Status()
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error":   "Services not available",
+			"details": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"services":  services,
+		"count":     len(services),
+		"timestamp": time.Now(),
+	})
+}
+
+// servicesRequest selects services for up and down; empty means all
+type servicesRequest struct {
+	Services []string `json:"services"`
+}
+
+func (is *IntelligenceServer) servicesUpHandler(c *fiber.Ctx) error {
+	var request servicesRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&request); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error":   "Invalid JSON format",
+				"details": err.Error(),
+			})
+		}
+	}
+
+	results, err := is.pi.services.Up(request.Services)
+	if err != nil && results == nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "Failed to start services",
+			"details": err.Error(),
+		})
+	}
+
+	response := fiber.Map{
+		"results":   results,
+		"timestamp": time.Now(),
+	}
 	if err != nil {
-		duration = 5 * time.Minute
+		response["error"] = err.Error()
+		return c.Status(500).JSON(response)
+	}
+
+	return c.JSON(response)
+}
+
+func (is *IntelligenceServer) servicesDownHandler(c *fiber.Ctx) error {
+	var request servicesRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&request); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error":   "Invalid JSON format",
+				"details": err.Error(),
+			})
+		}
 	}
 
-	cutoff := time.Now().Add(-duration)
-	recentErrors := is.pi.processMonitor.GetLatestErrors(duration)
+	results, err := is.pi.services.Down(request.Services)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   "Failed to stop services",
+			"details": err.Error(),
+		})
+	}
 
 	return c.JSON(fiber.Map{
-		"since":       since,
-		"cutoff":      cutoff,
-		"error_count": len(recentErrors),
-		"errors":      recentErrors,
+		"results":   results,
+		"timestamp": time.Now(),
 	})
 }
 
@@ -2111,6 +4016,7 @@ func (is *IntelligenceServer) startDevServerHandler(c *fiber.Ctx) error {
 			"server_type": serverType,
 		})
 	}
+	cmd.Timeout = "0" // Dev servers run until stopped
 
 	process, err := is.pi.processMonitor.StartProcess(cmd)
 	if err != nil {
@@ -2123,7 +4029,7 @@ func (is *IntelligenceServer) startDevServerHandler(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{
 		"message":     fmt.Sprintf("Started %s development server", serverType),
 		"server_type": serverType,
-		"process":     process,
+		"process":     process.Snapshot(),
 	})
 }
 
@@ -2137,7 +4043,7 @@ func (is *IntelligenceServer) stopDevServerHandler(c *fiber.Ctx) error {
 	for _, process := range processes {
 		// Simple matching by command - could be enhanced
 		if strings.Contains(process.Command, serverType) {
-			if err := is.pi.processMonitor.StopProcess(process.PID); err != nil {
+			if err := is.pi.processMonitor.StopProcess(process.ID); err != nil {
 				log.Printf("Failed to stop process %d: %v", process.PID, err)
 			} else {
 				stopped++
@@ -2153,7 +4059,7 @@ func (is *IntelligenceServer) stopDevServerHandler(c *fiber.Ctx) error {
 }
 
 func (is *IntelligenceServer) devServerStatusHandler(c *fiber.Ctx) error {
-	processes := is.pi.processMonitor.GetMonitoredProcesses()
+	processes := is.pi.processMonitor.ProcessSnapshots()
 
 	devServers := make(map[string]interface{})
 
@@ -2189,11 +4095,16 @@ func (is *IntelligenceServer) devServerStatusHandler(c *fiber.Ctx) error {
 	})
 }
 
-// Rate limiting helper
-func (is *IntelligenceServer) checkRateLimit(ip string) bool {
-	// Simple in-memory rate limiting
-	// In production, you'd use Redis or similar
-	return true // Simplified for now
+// checkRateLimit applies rate_limit_per_minute to process starts, both per
+// token and per client IP
+func (is *IntelligenceServer) checkRateLimit(c *fiber.Ctx) bool {
+	if name := requestTokenName(c); name != "" {
+		if allowed, _ := is.auth.starts.Allow("token:" + name); !allowed {
+			return false
+		}
+	}
+	allowed, _ := is.auth.starts.Allow("ip:" + c.IP())
+	return allowed
 }
 
 // Search implementation
@@ -2321,23 +4232,38 @@ func (is *IntelligenceServer) Start(port string) error {
 }
 
 // Additional ProcessMonitor methods
-func (pm *ProcessMonitor) monitorProcessOutput(process *MonitoredProcess, pipe io.ReadCloser, source string, errorPatterns []string) {
+func (pm *ProcessMonitor) monitorProcessOutput(process *MonitoredProcess, pipe io.ReadCloser, source string) {
+	defer process.outputReaders.Done()
 	defer pipe.Close()
 
-	scanner := bufio.NewScanner(pipe)
+	// Raw bytes are kept for replay; lines are cleaned of terminal escapes
+	scanner := bufio.NewScanner(io.TeeReader(pipe, &rawOutputRecorder{monitor: pm, process: process, source: source}))
 	contextLines := make([]string, 0, 5) // Keep context for error detection
 
 	for scanner.Scan() {
-		line := scanner.Text()
+		line := cleanTerminalLine(scanner.Text())
+		now := time.Now()
+
+		if process.logFile != nil {
+			process.logFile.Write(source, line, now)
+		}
 
 		// Add to process output
 		process.mutex.Lock()
 		process.OutputLines = append(process.OutputLines, line)
+		process.recordOutputLine(source, line, now, pm.config.MaxOutputLines)
 
 		// Keep only recent output lines
 		if len(process.OutputLines) > pm.config.MaxOutputLines {
 			process.OutputLines = process.OutputLines[len(process.OutputLines)-pm.config.MaxOutputLines:]
 		}
+
+		if source == "stderr" || source == "pty" {
+			process.stderrTail = append(process.stderrTail, line)
+			if len(process.stderrTail) > maxStderrTail {
+				process.stderrTail = process.stderrTail[1:]
+			}
+		}
 		process.mutex.Unlock()
 
 		// Maintain context window
@@ -2347,172 +4273,150 @@ func (pm *ProcessMonitor) monitorProcessOutput(process *MonitoredProcess, pipe i
 		}
 
 		// Check for error patterns
-		if streamError := pm.parseOutputForErrors(line, source, process, contextLines, errorPatterns); streamError != nil {
-			select {
-			case pm.errorStream <- *streamError:
-			case <-pm.ctx.Done():
-				return
-			default:
-				// Channel full, drop error
-				log.Printf("Error stream full, dropping error from PID %d", process.PID)
-			}
+		if streamError := pm.parseOutputForErrors(line, source, process, contextLines); streamError != nil {
+			pm.emitStreamError(*streamError)
 		}
 	}
 
-	if err := scanner.Err(); err != nil {
+	if err := scanner.Err(); err != nil && !isPTYClosed(err) {
 		log.Printf("Error reading process output (PID %d): %v", process.PID, err)
 	}
 }
 
-func (pm *ProcessMonitor) parseOutputForErrors(line, source string, process *MonitoredProcess, context []string, customPatterns []string) *StreamError {
-	// Combine default patterns with custom patterns
-	allPatterns := append(pm.getDefaultErrorPatterns(), customPatterns...)
-
-	for _, pattern := range allPatterns {
-		if matched, _ := regexp.MatchString(pattern, line); matched {
-			severity := "error"
-			errorType := "runtime"
-
-			// Determine error type and severity based on pattern
-			if matched, _ := regexp.MatchString(`(?i)(warn|warning)`, line); matched {
-				severity = "warning"
-			}
-
-			if matched, _ := regexp.MatchString(`(?i)(syntax|parse|compile)`, line); matched {
-				errorType = "compilation"
-			} else if matched, _ := regexp.MatchString(`(?i)(test|spec|assertion)`, line); matched {
-				errorType = "test"
-			} else if matched, _ := regexp.MatchString(`(?i)(server|port|listen|connect)`, line); matched {
-				errorType = "server"
-			}
-
-			return &StreamError{
-				ProcessPID: process.PID,
-				Command:    process.Command,
-				ErrorType:  errorType,
-				Message:    line,
-				Timestamp:  time.Now(),
-				Severity:   severity,
-				Context:    append([]string{}, context...),
-				Source:     source,
-			}
-		}
+func (pm *ProcessMonitor) parseOutputForErrors(line, source string, process *MonitoredProcess, context []string) *StreamError {
+	match := process.matcher.Match(line, context)
+	if match == nil {
+		return nil
 	}
 
-	return nil
+	return &StreamError{
+		ProcessID:  process.ID,
+		ProcessPID: process.PID,
+		Command:    process.Command,
+		ErrorType:  match.ErrorType,
+		Message:    line,
+		Timestamp:  time.Now(),
+		Severity:   match.Severity,
+		Context:    append([]string{}, context...),
+		Source:     source,
+		Language:   match.Language,
+		File:       match.File,
+		Line:       match.Line,
+		Column:     match.Column,
+	}
 }
 
-func (pm *ProcessMonitor) getDefaultErrorPatterns() []string {
-	return []string{
-		// JavaScript/TypeScript errors
-		`Error: .+`,
-		`TypeError: .+`,
-		`SyntaxError: .+`,
-		`Module not found: .+`,
-		`Failed to compile`,
-		`Compilation error`,
-
-		// Go errors
-		`panic: .+`,
-		`fatal error: .+`,
-		`cannot find package ".+"`,
-		`undefined: .+`,
-
-		// Python errors
-		`Traceback \(most recent call last\)`,
-		`ImportError: .+`,
-		`SyntaxError: .+`,
-		`NameError: .+`,
-
-		// Test errors
-		`FAIL .+`,
-		`Error: expect\(.+\)`,
-		`AssertionError`,
-
-		// Server errors
-		`EADDRINUSE .+`,
-		`listen EADDRINUSE .+`,
-		`Connection refused`,
-		`ECONNREFUSED`,
-
-		// General patterns
-		`(?i)error.*`,
-		`(?i)exception.*`,
-		`(?i)failed.*`,
-		`(?i)fatal.*`,
-	}
-}
-
-func (pm *ProcessMonitor) monitorProcessCompletion(process *MonitoredProcess, autoRestart bool) {
+func (pm *ProcessMonitor) monitorProcessCompletion(process *MonitoredProcess) {
 	err := process.cmd.Wait()
+	exitCode := exitCodeOf(err)
+	pm.finishLimits(process, err)
+
+	// The stderr tail, exit frames and recordings need the last lines
+	process.waitOutputReaders(outputDrainTimeout)
+	process.closeInputPipe()
+
+	stopping := false
+	select {
+	case <-process.stopRequested:
+		stopping = true
+	default:
+	}
 
 	process.mutex.Lock()
-	if err != nil {
+	process.ExitCode = &exitCode
+	process.finishRun(exitCode, time.Now())
+	process.ExitCodes = append(process.ExitCodes, exitCode)
+	if len(process.ExitCodes) > maxExitCodeHistory {
+		process.ExitCodes = process.ExitCodes[len(process.ExitCodes)-maxExitCodeHistory:]
+	}
+	if process.Limits != nil && process.Limits.Exceeded != "" {
+		process.Status = process.Limits.Exceeded
+		log.Printf("Process PID %d was stopped: %s", process.PID, process.Limits.Exceeded)
+	} else if err != nil {
 		process.Status = "error"
 		log.Printf("Process PID %d exited with error: %v", process.PID, err)
 	} else {
 		process.Status = "stopped"
 		log.Printf("Process PID %d exited normally", process.PID)
 	}
+	// Restart crashes and hung processes, but not exits caused by StopProcess
+	restart := (process.spec.AutoRestart || process.restartRequested) && err != nil && !stopping
+	process.restartPending = restart
+	status := process.Status
 	process.mutex.Unlock()
+	close(process.exited)
+
+	if process.logFile != nil {
+		process.logFile.Write("system", fmt.Sprintf("exited with code %d", exitCode), time.Now())
+	}
+	go process.closeRecording()
 
 	// Update metrics
 	pm.metrics.mutex.Lock()
 	pm.metrics.ActiveProcesses--
 	pm.metrics.mutex.Unlock()
 
-	// Handle auto-restart if enabled
-	if autoRestart && err != nil {
-		log.Printf("Auto-restarting process: %s", process.Command)
-		// Implement restart logic here if needed
+	if err != nil && !stopping {
+		pm.alerts.ObserveExit(process, exitCode, status)
 	}
-}
 
-func (pm *ProcessMonitor) StopProcess(pid int) error {
-	pm.mutex.Lock()
-	process, exists := pm.activeProcesses[pid]
-	if !exists {
-		pm.mutex.Unlock()
-		return fmt.Errorf("process with PID %d not found", pid)
+	if restart {
+		pm.superviseExit(process, exitCode)
 	}
-	pm.mutex.Unlock()
+}
 
-	log.Printf("Stopping process PID %d", pid)
+func (pm *ProcessMonitor) StopProcess(ref string) error {
+	return pm.StopProcessWithGrace(ref, pm.config.StopGracePeriod)
+}
 
-	// Graceful shutdown first
-	if err := process.cmd.Process.Signal(syscall.SIGTERM); err != nil {
-		// If graceful shutdown fails, force kill
-		if killErr := process.cmd.Process.Kill(); killErr != nil {
-			return fmt.Errorf("failed to kill process: %w", killErr)
-		}
+// StopProcessWithGrace terminates the process and all of its descendants,
+// escalating to SIGKILL once the grace period has passed
+func (pm *ProcessMonitor) StopProcessWithGrace(ref string, grace time.Duration) error {
+	process, err := pm.ResolveProcess(ref)
+	if err != nil {
+		return err
 	}
+	return pm.stopRun(process, grace)
+}
 
-	// Wait for process to exit with timeout
-	done := make(chan error, 1)
-	go func() {
-		done <- process.cmd.Wait()
-	}()
+// stopRun stops one run of a process and any restart of it that was
+// registered before the stop took effect
+func (pm *ProcessMonitor) stopRun(process *MonitoredProcess, grace time.Duration) error {
+	log.Printf("Stopping process %s (PID %d)", process.ID, process.PID)
 
-	select {
-	case <-done:
-		log.Printf("Process PID %d stopped successfully", pid)
-	case <-time.After(5 * time.Second):
-		// Force kill if still running
-		process.cmd.Process.Kill()
-		log.Printf("Force killed process PID %d", pid)
-	}
+	// Prevent the supervisor from restarting it
+	pm.requestStop(process)
+
+	// Also reaps grandchildren left behind when the leader already exited
+	pm.terminateProcessTree(process, grace)
 
 	// Cleanup
 	pm.cleanupProcess(process)
 
+	// A restart registered just before the request is stopped as well
+	if current, err := pm.ResolveProcess(process.ID); err == nil && current != process {
+		return pm.stopRun(current, grace)
+	}
+
 	return nil
 }
 
 func (pm *ProcessMonitor) cleanupProcess(process *MonitoredProcess) {
 	pm.mutex.Lock()
-	delete(pm.activeProcesses, process.PID)
+	// The ID may already belong to a newer run of the same process
+	if pm.activeProcesses[process.ID] == process {
+		delete(pm.activeProcesses, process.ID)
+		pm.rememberEndedLocked(process)
+	}
 	pm.mutex.Unlock()
 
+	if process.logFile != nil {
+		process.logFile.Close()
+	}
+	if process.recording != nil {
+		process.recording.Close()
+	}
+
 	// Close pipes
 	if process.stdoutPipe != nil {
 		process.stdoutPipe.Close()
@@ -2524,14 +4428,11 @@ func (pm *ProcessMonitor) cleanupProcess(process *MonitoredProcess) {
 	log.Printf("Cleaned up process PID %d", process.PID)
 }
 
-func (pm *ProcessMonitor) GetProcessOutput(pid int, lines int) ([]string, error) {
-	pm.mutex.RLock()
-	process, exists := pm.activeProcesses[pid]
-	if !exists {
-		pm.mutex.RUnlock()
-		return nil, fmt.Errorf("process with PID %d not found", pid)
+func (pm *ProcessMonitor) GetProcessOutput(ref string, lines int) ([]string, error) {
+	process, err := pm.ResolveProcess(ref)
+	if err != nil {
+		return nil, err
 	}
-	pm.mutex.RUnlock()
 
 	process.mutex.RLock()
 	defer process.mutex.RUnlock()
@@ -2550,26 +4451,32 @@ func (pm *ProcessMonitor) GetProcessOutput(pid int, lines int) ([]string, error)
 }
 
 func (pm *ProcessMonitor) cleanupStoppedProcesses() {
-	pm.mutex.Lock()
-	defer pm.mutex.Unlock()
+	stopped := []*MonitoredProcess{}
 
-	for pid, process := range pm.activeProcesses {
-		if !pm.isProcessRunning(pid) {
-			log.Printf("Cleaning up stopped process PID %d", pid)
-			pm.cleanupProcess(process)
+	pm.mutex.RLock()
+	for _, process := range pm.activeProcesses {
+		// The exited channel belongs to this run, unlike a PID the kernel may reuse
+		select {
+		case <-process.exited:
+		default:
+			continue
 		}
-	}
-}
 
-func (pm *ProcessMonitor) isProcessRunning(pid int) bool {
-	process, err := os.FindProcess(pid)
-	if err != nil {
-		return false
+		process.mutex.RLock()
+		supervised := process.restartPending || process.Status == "restarting" || process.Status == "crash_loop"
+		process.mutex.RUnlock()
+
+		// Supervised processes stay visible until restarted or explicitly stopped
+		if !supervised {
+			stopped = append(stopped, process)
+		}
 	}
+	pm.mutex.RUnlock()
 
-	// Send signal 0 to check if process exists
-	err = process.Signal(syscall.Signal(0))
-	return err == nil
+	for _, process := range stopped {
+		log.Printf("Cleaning up stopped process PID %d", process.PID)
+		pm.cleanupProcess(process)
+	}
 }
 
 func (pm *ProcessMonitor) autoDetectDevProcesses() {
@@ -2594,61 +4501,60 @@ func (pm *ProcessMonitor) GetMonitoredProcesses() []*MonitoredProcess {
 	return processes
 }
 
-func (pm *ProcessMonitor) AddWebSocketConnection(conn *websocket.Conn) {
-	pm.mutex.Lock()
-	defer pm.mutex.Unlock()
-
-	pm.wsConnections[conn] = true
-	log.Printf("Added WebSocket connection, total: %d", len(pm.wsConnections))
+// SubscribeErrors registers a WebSocket client for StreamErrors
+func (pm *ProcessMonitor) SubscribeErrors() *Subscription {
+	sub := pm.errorClients.Subscribe()
+	log.Printf("Added WebSocket connection, total: %d", pm.errorClients.Len())
+	return sub
 }
 
-func (pm *ProcessMonitor) RemoveWebSocketConnection(conn *websocket.Conn) {
-	pm.mutex.Lock()
-	defer pm.mutex.Unlock()
-
-	delete(pm.wsConnections, conn)
-	log.Printf("Removed WebSocket connection, total: %d", len(pm.wsConnections))
+// UnsubscribeErrors removes a WebSocket client added by SubscribeErrors
+func (pm *ProcessMonitor) UnsubscribeErrors(sub *Subscription) {
+	if pm.errorClients.Lagged(sub) {
+		log.Printf("Dropped lagging WebSocket connection")
+	}
+	pm.errorClients.Unsubscribe(sub)
+	log.Printf("Removed WebSocket connection, total: %d", pm.errorClients.Len())
 }
 
 func (pm *ProcessMonitor) StopAllProcesses() {
 	pm.mutex.RLock()
-	pids := make([]int, 0, len(pm.activeProcesses))
-	for pid := range pm.activeProcesses {
-		pids = append(pids, pid)
+	ids := make([]string, 0, len(pm.activeProcesses))
+	for id := range pm.activeProcesses {
+		ids = append(ids, id)
 	}
 	pm.mutex.RUnlock()
 
-	log.Printf("Stopping all %d monitored processes", len(pids))
+	log.Printf("Stopping all %d monitored processes", len(ids))
 
-	for _, pid := range pids {
-		if err := pm.StopProcess(pid); err != nil {
-			log.Printf("Error stopping process PID %d: %v", pid, err)
+	for _, id := range ids {
+		if err := pm.StopProcess(id); err != nil {
+			log.Printf("Error stopping process %s: %v", id, err)
 		}
 	}
 
 	// Cancel context to stop all monitoring goroutines
 	pm.cancel()
+	pm.errors.Close()
 }
 
+// GetLatestErrors returns every stored error reported within since, oldest first
 func (pm *ProcessMonitor) GetLatestErrors(since time.Duration) []StreamError {
-	cutoff := time.Now().Add(-since)
-	errors := make([]StreamError, 0)
-
-	pm.mutex.RLock()
-	defer pm.mutex.RUnlock()
-
-	for _, process := range pm.activeProcesses {
-		process.mutex.RLock()
-		if process.LastError != nil && process.LastError.Timestamp.After(cutoff) {
-			errors = append(errors, *process.LastError)
-		}
-		process.mutex.RUnlock()
-	}
+	return pm.errors.Query(ErrorQuery{Since: time.Now().Add(-since)}).Errors
+}
 
-	return errors
+// QueryErrors returns a page of stored errors, including those of
+// processes that have already been cleaned up
+func (pm *ProcessMonitor) QueryErrors(query ErrorQuery) ErrorPage {
+	return pm.errors.Query(query)
 }
 
 func main() {
+	// Argus re-executes itself to set rlimits for a command before it starts
+	if len(os.Args) > 1 && os.Args[1] == rlimitExecArg {
+		runRlimitExec(os.Args[2:])
+	}
+
 	// Get workspace from command line argument or environment variable
 	workspace := "."
 	if len(os.Args) > 1 {
@@ -2671,6 +4577,12 @@ func main() {
 
 	log.Printf("Starting Enhanced Project Argus monitoring for: %s", absWorkspace)
 
+	// Set up limit cgroups before any command starts, while Argus may still
+	// be the only process in its cgroup
+	if _, err := limitCgroupParent(); err != nil {
+		log.Printf("Resource limits will be sampled: %v", err)
+	}
+
 	// Create enhanced intelligence service with multi-language support
 	server := NewEnhancedIntelligenceServer(absWorkspace)
 
@@ -0,0 +1,541 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PolicyConfig restricts what processes may be started, beyond the binary
+// allowlist in AllowedCommands
+type PolicyConfig struct {
+	Disabled              bool                   `json:"disabled"`                // only check AllowedCommands
+	Rules                 map[string]CommandRule `json:"rules"`                   // keyed by command, merged over the defaults
+	DeniedEnv             []string               `json:"denied_env"`              // variable names or globs such as DYLD_*
+	AllowOutsideWorkspace bool                   `json:"allow_outside_workspace"` // let working directories leave the workspace
+	AllowedWorkDirs       []string               `json:"allowed_work_dirs,omitempty"`
+}
+
+// CommandRule limits the arguments of one allowed command. The subcommand
+// is the first argument; patterns are regular expressions.
+type CommandRule struct {
+	Subcommands       []string `json:"subcommands,omitempty"`        // allowed subcommands; empty allows any
+	DeniedSubcommands []string `json:"denied_subcommands,omitempty"` // never allowed
+	AllowedArgs       []string `json:"allowed_args,omitempty"`       // every further argument must match one; empty allows any
+	DeniedArgs        []string `json:"denied_args,omitempty"`        // no argument may match
+	DeniedFlags       []string `json:"denied_flags,omitempty"`       // also matched as --flag=value and -fVALUE
+	DeniedEnv         []string `json:"denied_env,omitempty"`         // in addition to the global list
+	ValueFlags        []string `json:"value_flags,omitempty"`        // flags whose value may be the next argument
+	ClusteredFlags    bool     `json:"clustered_flags,omitempty"`    // single-letter flags combine, as in -Ic
+	RequireScript     bool     `json:"require_script,omitempty"`     // the first operand must be a file in the workspace
+}
+
+// PolicyDecision is the outcome of checking a command against the policy
+type PolicyDecision struct {
+	Allowed bool   `json:"allowed"`
+	Rule    string `json:"rule"` // the rule that decided, such as rules.node.denied_flags["-e"]
+	Reason  string `json:"reason"`
+}
+
+// AuditEntry records one policy decision
+type AuditEntry struct {
+	Timestamp  time.Time `json:"timestamp"`
+	Decision   string    `json:"decision"` // allow, deny
+	Rule       string    `json:"rule"`
+	Reason     string    `json:"reason"`
+	Name       string    `json:"name,omitempty"`
+	Command    string    `json:"command"`
+	Args       []string  `json:"args"`
+	WorkingDir string    `json:"working_dir"`
+	Env        []string  `json:"env,omitempty"` // names of variables the request set
+	Service    string    `json:"service,omitempty"`
+}
+
+// policyError is a start refused by the policy
+type policyError struct {
+	decision PolicyDecision
+}
+
+func (e *policyError) Error() string {
+	return fmt.Sprintf("%s (policy rule %s)", e.decision.Reason, e.decision.Rule)
+}
+
+// maxAuditHistory bounds the audit entries kept in memory for /policy/audit
+const maxAuditHistory = 500
+
+// defaultPolicyConfig blocks the usual ways of running code that is not in
+// the workspace through an allowed command. Interpreters must run a script
+// from the workspace: without one they read code from stdin or start a REPL.
+func defaultPolicyConfig() PolicyConfig {
+	nodeRule := CommandRule{
+		DeniedFlags: []string{"-e", "--eval", "-p", "--print", "-r", "--require", "--import", "--loader", "--experimental-loader",
+			"-i", "--interactive", "--env-file", "--env-file-if-exists",
+			// The inspector runs arbitrary code for anyone who can reach its port
+			"--inspect", "--inspect-brk", "--inspect-wait", "--inspect-port", "--debug-port"},
+		ValueFlags: []string{"-e", "--eval", "-p", "--print", "-r", "--require", "--import", "--loader", "--experimental-loader", "-C", "--conditions", "--title", "--input-type",
+			"--inspect-port", "--debug-port"},
+		ClusteredFlags: true,
+		RequireScript:  true,
+	}
+	pythonRule := CommandRule{
+		DeniedFlags:    []string{"-c", "-m", "-i"},
+		ValueFlags:     []string{"-c", "-m", "-W", "-X"},
+		ClusteredFlags: true,
+		RequireScript:  true,
+	}
+
+	return PolicyConfig{
+		Rules: map[string]CommandRule{
+			"npm":     {DeniedSubcommands: []string{"exec", "x"}},
+			"yarn":    {DeniedSubcommands: []string{"dlx", "exec"}},
+			"node":    nodeRule,
+			"python":  pythonRule,
+			"python3": pythonRule,
+			"go": {
+				Subcommands: []string{"build", "test", "run", "vet", "fmt", "generate", "mod", "list", "version", "env", "doc", "clean"},
+				DeniedArgs:  []string{`://`, `@`},
+				DeniedFlags: []string{"-toolexec", "-exec", "-overlay"},
+			},
+		},
+		DeniedEnv: []string{"LD_PRELOAD", "LD_LIBRARY_PATH", "LD_AUDIT", "DYLD_*", "NODE_OPTIONS", "BASH_ENV", "ENV", "PYTHONSTARTUP", "PYTHONINSPECT"},
+	}
+}
+
+// commandRule is a rule with its patterns compiled; a rule that does not
+// compile denies its command rather than allowing everything
+type commandRule struct {
+	CommandRule
+	allowedArgs []*regexp.Regexp
+	deniedArgs  []*regexp.Regexp
+	invalid     error
+}
+
+// PolicyEngine decides whether a process may start and audits every decision
+type PolicyEngine struct {
+	workspace   string
+	config      *ProcessMonitorConfig
+	rules       map[string]*commandRule
+	allowedDirs []string
+	auditPath   string
+	audit       []AuditEntry
+	mutex       sync.Mutex
+}
+
+// NewPolicyEngine compiles the policy of the config
+func NewPolicyEngine(workspace string, config *ProcessMonitorConfig) *PolicyEngine {
+	pe := &PolicyEngine{
+		workspace: resolveDir(workspace),
+		config:    config,
+		rules:     make(map[string]*commandRule),
+		auditPath: filepath.Join(workspace, ".argus", "audit.jsonl"),
+	}
+
+	for _, pattern := range config.Policy.DeniedEnv {
+		if _, err := path.Match(pattern, ""); err != nil {
+			log.Printf("Invalid denied_env pattern %q: %v", pattern, err)
+		}
+	}
+
+	for _, dir := range config.Policy.AllowedWorkDirs {
+		pe.allowedDirs = append(pe.allowedDirs, resolveDir(dir))
+	}
+
+	for command, rule := range config.Policy.Rules {
+		compiled := &commandRule{CommandRule: rule}
+		if err := compiled.compile(); err != nil {
+			log.Printf("Policy rule for %s is invalid, denying the command: %v", command, err)
+			compiled.invalid = err
+		}
+		pe.rules[command] = compiled
+	}
+
+	return pe
+}
+
+func (r *commandRule) compile() error {
+	for _, pattern := range r.AllowedArgs {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid allowed_args pattern %q: %w", pattern, err)
+		}
+		r.allowedArgs = append(r.allowedArgs, re)
+	}
+	for _, pattern := range r.DeniedArgs {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid denied_args pattern %q: %w", pattern, err)
+		}
+		r.deniedArgs = append(r.deniedArgs, re)
+	}
+	for _, pattern := range r.DeniedEnv {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid denied_env pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// resolveDir returns an absolute directory with symlinks resolved, so that
+// links cannot lead out of the workspace
+func resolveDir(dir string) string {
+	if dir == "" {
+		dir = "."
+	}
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = resolved
+	}
+	return dir
+}
+
+// resolvePath makes path absolute and resolves symlinks in its longest
+// existing prefix, so paths that do not exist yet still compare correctly
+func resolvePath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+
+	existing, rest := path, ""
+	for {
+		if resolved, err := filepath.EvalSymlinks(existing); err == nil {
+			return filepath.Join(resolved, rest)
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			return path
+		}
+		rest = filepath.Join(filepath.Base(existing), rest)
+		existing = parent
+	}
+}
+
+// withinDir reports whether path is root or below it once both are
+// resolved, so a symlink cannot point a path out of root
+func withinDir(root, path string) bool {
+	if root == "" || path == "" {
+		return false
+	}
+	rel, err := filepath.Rel(resolvePath(root), resolvePath(path))
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// matchesFlag reports whether an argument sets a flag, including the
+// --flag=value form and short flags with an attached value
+func matchesFlag(arg, flag string) bool {
+	if arg == flag || strings.HasPrefix(arg, flag+"=") {
+		return true
+	}
+	return len(flag) == 2 && flag[0] == '-' && flag[1] != '-' && strings.HasPrefix(arg, flag)
+}
+
+// splitFlags splits a cluster of single-letter flags such as -Ic into -I
+// and -c when the rule allows clusters; a flag that takes a value keeps the
+// rest of the argument, as in -Wignore
+func (r *commandRule) splitFlags(arg string) []string {
+	if !r.ClusteredFlags || len(arg) < 3 || arg[0] != '-' || arg[1] == '-' {
+		return []string{arg}
+	}
+
+	flags := []string{}
+	for i := 1; i < len(arg); i++ {
+		flag := "-" + arg[i:i+1]
+		if containsString(r.ValueFlags, flag) {
+			return append(flags, flag+arg[i+1:])
+		}
+		flags = append(flags, flag)
+	}
+	return flags
+}
+
+// scriptIndex returns the position of the first operand, skipping flags and
+// the values of flags that take the next argument; -1 means there is none
+func (r *commandRule) scriptIndex(args []string) int {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			if i+1 < len(args) {
+				return i + 1
+			}
+			return -1
+		}
+		if arg == "-" || !strings.HasPrefix(arg, "-") {
+			return i
+		}
+
+		flags := r.splitFlags(arg)
+		if containsString(r.ValueFlags, flags[len(flags)-1]) {
+			i++
+		}
+	}
+	return -1
+}
+
+// matchEnvPattern returns the first pattern matching a variable name
+func matchEnvPattern(patterns []string, name string) (string, bool) {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
+func policyAllow(rule, reason string) PolicyDecision {
+	return PolicyDecision{Allowed: true, Rule: rule, Reason: reason}
+}
+
+func policyDeny(rule, reason string, args ...interface{}) PolicyDecision {
+	return PolicyDecision{Allowed: false, Rule: rule, Reason: fmt.Sprintf(reason, args...)}
+}
+
+// CheckLocation checks the command and the paths a request refers to; it
+// runs before env files are read, so they are never read from outside the
+// workspace. A nil decision means the checks passed.
+func (pe *PolicyEngine) CheckLocation(cmd ProcessCommand) *PolicyDecision {
+	allowed := false
+	for _, allowedCmd := range pe.config.AllowedCommands {
+		if cmd.Command == allowedCmd {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		decision := policyDeny("allowed_commands", "command not allowed: %s", cmd.Command)
+		return &decision
+	}
+
+	policy := pe.config.Policy
+	if policy.Disabled || policy.AllowOutsideWorkspace {
+		return nil
+	}
+
+	dir := resolveDir(cmd.WorkingDir)
+	inside := withinDir(pe.workspace, dir)
+	for _, allowedDir := range pe.allowedDirs {
+		inside = inside || withinDir(allowedDir, dir)
+	}
+	if !inside {
+		decision := policyDeny("workdir", "working directory %s is outside the workspace %s", dir, pe.workspace)
+		return &decision
+	}
+
+	// Profile env files come from the config; request env files are confined too
+	for _, file := range cmd.EnvFiles {
+		if resolved := resolveDir(resolveEnvFile(cmd.WorkingDir, file)); !withinDir(pe.workspace, resolved) {
+			decision := policyDeny("env_files", "env file %s is outside the workspace %s", resolved, pe.workspace)
+			return &decision
+		}
+	}
+
+	return nil
+}
+
+// Evaluate checks a command and the variables its request sets against the
+// policy. env is the effective environment; only variables that did not come
+// from Argus's own environment are checked.
+func (pe *PolicyEngine) Evaluate(cmd ProcessCommand, env []EnvVar) PolicyDecision {
+	if decision := pe.CheckLocation(cmd); decision != nil {
+		return *decision
+	}
+
+	policy := pe.config.Policy
+	if policy.Disabled {
+		return policyAllow("allowed_commands", "policy disabled; command is allowed")
+	}
+
+	rule := pe.rules[cmd.Command]
+
+	for _, v := range env {
+		if v.Source == "argus" || v.Source == "clean" {
+			continue
+		}
+		if pattern, denied := matchEnvPattern(policy.DeniedEnv, v.Name); denied {
+			return policyDeny(fmt.Sprintf("denied_env[%q]", pattern), "environment variable %s is not allowed", v.Name)
+		}
+		if rule != nil {
+			if pattern, denied := matchEnvPattern(rule.DeniedEnv, v.Name); denied {
+				return policyDeny(fmt.Sprintf("rules.%s.denied_env[%q]", cmd.Command, pattern), "environment variable %s is not allowed for %s", v.Name, cmd.Command)
+			}
+		}
+	}
+
+	if rule == nil {
+		return policyAllow("allowed_commands", "command is allowed and has no argument rule")
+	}
+	return rule.evaluate(cmd, pe.inWorkspace)
+}
+
+// inWorkspace reports whether a path may be used by started processes
+func (pe *PolicyEngine) inWorkspace(path string) bool {
+	if pe.config.Policy.AllowOutsideWorkspace || withinDir(pe.workspace, path) {
+		return true
+	}
+	for _, allowedDir := range pe.allowedDirs {
+		if withinDir(allowedDir, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// evaluate checks the arguments of a command against its rule
+func (r *commandRule) evaluate(cmd ProcessCommand, inWorkspace func(path string) bool) PolicyDecision {
+	command, args := cmd.Command, cmd.Args
+	prefix := "rules." + command
+	if r.invalid != nil {
+		return policyDeny(prefix, "policy rule is invalid: %v", r.invalid)
+	}
+
+	rest := args
+	if len(r.Subcommands) > 0 || len(r.DeniedSubcommands) > 0 {
+		subcommand := ""
+		if len(args) > 0 {
+			subcommand = args[0]
+		}
+
+		if strings.HasPrefix(subcommand, "-") {
+			// Options such as --prefix take values that would hide the subcommand
+			for _, arg := range args {
+				if !strings.HasPrefix(arg, "-") {
+					return policyDeny(prefix+".subcommands", "options must follow the subcommand of %s", command)
+				}
+			}
+			subcommand = ""
+		} else if subcommand != "" {
+			rest = args[1:]
+		}
+
+		if subcommand != "" {
+			if containsString(r.DeniedSubcommands, subcommand) {
+				return policyDeny(fmt.Sprintf("%s.denied_subcommands[%q]", prefix, subcommand), "%s %s is not allowed", command, subcommand)
+			}
+			if len(r.Subcommands) > 0 && !containsString(r.Subcommands, subcommand) {
+				return policyDeny(prefix+".subcommands", "%s %s is not an allowed subcommand", command, subcommand)
+			}
+		}
+	}
+
+	// Arguments after an interpreter's script belong to the script
+	script := -1
+	flagArgs := args
+	if r.RequireScript {
+		if script = r.scriptIndex(args); script >= 0 {
+			flagArgs = args[:script]
+		}
+	}
+
+	for _, arg := range flagArgs {
+		for _, split := range r.splitFlags(arg) {
+			for _, flag := range r.DeniedFlags {
+				if matchesFlag(split, flag) {
+					return policyDeny(fmt.Sprintf("%s.denied_flags[%q]", prefix, flag), "flag %s is not allowed for %s", flag, command)
+				}
+			}
+		}
+	}
+
+	if r.RequireScript {
+		if script < 0 || args[script] == "-" {
+			return policyDeny(prefix+".require_script", "%s must run a script file from the workspace, not read code from stdin", command)
+		}
+
+		path := args[script]
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(resolveDir(cmd.WorkingDir), path)
+		}
+		if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+			return policyDeny(prefix+".require_script", "script %s of %s is not a file", args[script], command)
+		}
+		if !inWorkspace(path) {
+			return policyDeny(prefix+".require_script", "script %s of %s is outside the workspace", args[script], command)
+		}
+	}
+
+	for _, arg := range args {
+		for _, pattern := range r.deniedArgs {
+			if pattern.MatchString(arg) {
+				return policyDeny(fmt.Sprintf("%s.denied_args[%q]", prefix, pattern.String()), "argument %q is not allowed for %s", arg, command)
+			}
+		}
+	}
+
+	if len(r.allowedArgs) > 0 {
+		for _, arg := range rest {
+			matched := false
+			for _, pattern := range r.allowedArgs {
+				if pattern.MatchString(arg) {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return policyDeny(prefix+".allowed_args", "argument %q matches no allowed pattern for %s", arg, command)
+			}
+		}
+	}
+
+	return policyAllow(prefix, "arguments satisfy the rule for "+command)
+}
+
+// Audit records a decision in the audit log and the in-memory history
+func (pe *PolicyEngine) Audit(cmd ProcessCommand, env []EnvVar, decision PolicyDecision) {
+	entry := AuditEntry{
+		Timestamp:  time.Now(),
+		Decision:   "deny",
+		Rule:       decision.Rule,
+		Reason:     decision.Reason,
+		Name:       cmd.Name,
+		Command:    cmd.Command,
+		Args:       cmd.Args,
+		WorkingDir: resolveDir(cmd.WorkingDir),
+		Service:    cmd.Service,
+	}
+	if decision.Allowed {
+		entry.Decision = "allow"
+	}
+	if entry.Args == nil {
+		entry.Args = []string{}
+	}
+	for _, v := range env {
+		if v.Source != "argus" && v.Source != "clean" {
+			entry.Env = append(entry.Env, v.Name)
+		}
+	}
+
+	pe.mutex.Lock()
+	pe.audit = append(pe.audit, entry)
+	if len(pe.audit) > maxAuditHistory {
+		pe.audit = pe.audit[len(pe.audit)-maxAuditHistory:]
+	}
+	pe.mutex.Unlock()
+
+	if err := appendJSONLine(pe.auditPath, entry); err != nil {
+		log.Printf("Failed to write audit log: %v", err)
+	}
+	if !decision.Allowed {
+		log.Printf("Policy denied %s %v: %s (%s)", cmd.Command, cmd.Args, decision.Reason, decision.Rule)
+	}
+}
+
+// AuditLog returns the most recent decisions, newest first, optionally only
+// allow or deny decisions
+func (pe *PolicyEngine) AuditLog(decision string, limit int) []AuditEntry {
+	pe.mutex.Lock()
+	defer pe.mutex.Unlock()
+
+	entries := []AuditEntry{}
+	for i := len(pe.audit) - 1; i >= 0 && (limit <= 0 || len(entries) < limit); i-- {
+		if decision == "" || pe.audit[i].Decision == decision {
+			entries = append(entries, pe.audit[i])
+		}
+	}
+	return entries
+}
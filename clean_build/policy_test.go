@@ -0,0 +1,237 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWithinDir(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "workspace")
+	outside := filepath.Join(base, "outside")
+	for _, dir := range []string{filepath.Join(root, "src"), outside} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(root, filepath.Join(base, "alias")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		root string
+		path string
+		want bool
+	}{
+		{"root itself", root, root, true},
+		{"child", root, filepath.Join(root, "src"), true},
+		{"missing child", root, filepath.Join(root, "src", "new", "file.go"), true},
+		{"sibling", root, outside, false},
+		{"prefix sibling", root, root + "-other", false},
+		{"dot dot", root, filepath.Join(root, "src", "..", ".."), false},
+		{"symlink out", root, filepath.Join(root, "escape"), false},
+		{"missing file behind symlink out", root, filepath.Join(root, "escape", "new.txt"), false},
+		{"root through symlink", filepath.Join(base, "alias"), filepath.Join(root, "src"), true},
+		{"path through symlink", root, filepath.Join(base, "alias", "src"), true},
+		{"empty root", "", root, false},
+		{"empty path", root, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := withinDir(tt.root, tt.path); got != tt.want {
+				t.Errorf("withinDir(%q, %q) = %t, want %t", tt.root, tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+// newTestPolicy returns a policy engine with the default rules over a
+// workspace holding app.py and server.js, and a script outside of it
+func newTestPolicy(t *testing.T) (*PolicyEngine, string) {
+	base := t.TempDir()
+	workspace := filepath.Join(base, "workspace")
+	outside := filepath.Join(base, "outside")
+	for _, dir := range []string{workspace, outside} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range []string{filepath.Join(workspace, "app.py"), filepath.Join(workspace, "server.js"), filepath.Join(outside, "evil.py")} {
+		if err := os.WriteFile(file, []byte("print(1)\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(outside, "evil.py"), filepath.Join(workspace, "link.py")); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &ProcessMonitorConfig{
+		AllowedCommands: []string{"python3", "node", "go", "npm"},
+		Policy:          defaultPolicyConfig(),
+	}
+	return NewPolicyEngine(workspace, config), workspace
+}
+
+func TestPolicyEvaluate(t *testing.T) {
+	pe, workspace := newTestPolicy(t)
+
+	tests := []struct {
+		command string
+		args    []string
+		allowed bool
+		rule    string
+	}{
+		// Interpreters need a script from the workspace
+		{"python3", nil, false, "rules.python3.require_script"},
+		{"python3", []string{"-"}, false, "rules.python3.require_script"},
+		{"python3", []string{"-u"}, false, "rules.python3.require_script"},
+		{"python3", []string{"-W", "ignore"}, false, "rules.python3.require_script"},
+		{"python3", []string{"app.py"}, true, "rules.python3"},
+		{"python3", []string{"-u", "-W", "ignore", "app.py"}, true, "rules.python3"},
+		{"python3", []string{"-Wignore", "-X", "dev", "app.py"}, true, "rules.python3"},
+		{"python3", []string{"--", "app.py"}, true, "rules.python3"},
+		{"python3", []string{filepath.Join(workspace, "app.py")}, true, "rules.python3"},
+		{"python3", []string{"missing.py"}, false, "rules.python3.require_script"},
+		{"python3", []string{"../outside/evil.py"}, false, "rules.python3.require_script"},
+		{"python3", []string{"link.py"}, false, "rules.python3.require_script"},
+		{"python3", []string{"/dev/stdin"}, false, "rules.python3.require_script"},
+		{"python3", []string{"."}, false, "rules.python3.require_script"},
+
+		// Code on the command line, including flags combined into one argument
+		{"python3", []string{"-c", "print(1)"}, false, `rules.python3.denied_flags["-c"]`},
+		{"python3", []string{"-cprint(1)"}, false, `rules.python3.denied_flags["-c"]`},
+		{"python3", []string{"-Ic", "print(1)"}, false, `rules.python3.denied_flags["-c"]`},
+		{"python3", []string{"-Bc", "print(1)"}, false, `rules.python3.denied_flags["-c"]`},
+		{"python3", []string{"-BIc", "print(1)"}, false, `rules.python3.denied_flags["-c"]`},
+		{"python3", []string{"-m", "http.server"}, false, `rules.python3.denied_flags["-m"]`},
+		{"python3", []string{"-Im", "http.server"}, false, `rules.python3.denied_flags["-m"]`},
+		{"python3", []string{"-i", "app.py"}, false, `rules.python3.denied_flags["-i"]`},
+		{"python3", []string{"-Bi", "app.py"}, false, `rules.python3.denied_flags["-i"]`},
+
+		// Arguments after the script are the script's own
+		{"python3", []string{"app.py", "-c", "config.yml"}, true, "rules.python3"},
+
+		{"node", nil, false, "rules.node.require_script"},
+		{"node", []string{"server.js"}, true, "rules.node"},
+		{"node", []string{"--trace-warnings", "server.js", "-e"}, true, "rules.node"},
+		{"node", []string{"-e", "1"}, false, `rules.node.denied_flags["-e"]`},
+		{"node", []string{"-pe", "1"}, false, `rules.node.denied_flags["-p"]`},
+		{"node", []string{"--eval=1"}, false, `rules.node.denied_flags["--eval"]`},
+		{"node", []string{"-i"}, false, `rules.node.denied_flags["-i"]`},
+		{"node", []string{"--env-file=.env", "server.js"}, false, `rules.node.denied_flags["--env-file"]`},
+		{"node", []string{"--title", "api", "server.js"}, true, "rules.node"},
+
+		// The inspector accepts code from whoever connects to it
+		{"node", []string{"--inspect", "server.js"}, false, `rules.node.denied_flags["--inspect"]`},
+		{"node", []string{"--inspect=0.0.0.0:9229", "server.js"}, false, `rules.node.denied_flags["--inspect"]`},
+		{"node", []string{"--inspect-brk", "server.js"}, false, `rules.node.denied_flags["--inspect-brk"]`},
+		{"node", []string{"--inspect-brk=0.0.0.0", "server.js"}, false, `rules.node.denied_flags["--inspect-brk"]`},
+		{"node", []string{"--inspect-wait", "server.js"}, false, `rules.node.denied_flags["--inspect-wait"]`},
+		{"node", []string{"--inspect-port", "0.0.0.0:9229", "server.js"}, false, `rules.node.denied_flags["--inspect-port"]`},
+		{"node", []string{"--inspect-port=9229", "server.js"}, false, `rules.node.denied_flags["--inspect-port"]`},
+		{"node", []string{"--debug-port=9229", "server.js"}, false, `rules.node.denied_flags["--debug-port"]`},
+		{"node", []string{"server.js", "--inspect"}, true, "rules.node"}, // the script's own argument
+
+		// Rules without clusters keep single-dash long flags whole
+		{"go", []string{"build", "./..."}, true, "rules.go"},
+		{"go", []string{"build", "-toolexec", "x", "./..."}, false, `rules.go.denied_flags["-toolexec"]`},
+		{"go", []string{"build", "-o", "bin/app", "."}, true, "rules.go"},
+		{"go", []string{"install", "example.com/tool@latest"}, false, "rules.go.subcommands"},
+
+		{"npm", []string{"exec", "cowsay"}, false, `rules.npm.denied_subcommands["exec"]`},
+		{"npm", []string{"run", "dev"}, true, "rules.npm"},
+
+		{"bash", []string{"-c", "id"}, false, "allowed_commands"},
+	}
+
+	for _, tt := range tests {
+		cmd := ProcessCommand{Command: tt.command, Args: tt.args, WorkingDir: workspace}
+		decision := pe.Evaluate(cmd, nil)
+		if decision.Allowed != tt.allowed || decision.Rule != tt.rule {
+			t.Errorf("%s %q: allowed=%t rule=%s (%s), want allowed=%t rule=%s",
+				tt.command, tt.args, decision.Allowed, decision.Rule, decision.Reason, tt.allowed, tt.rule)
+		}
+	}
+}
+
+func TestSplitFlags(t *testing.T) {
+	rule := &commandRule{CommandRule: CommandRule{ClusteredFlags: true, ValueFlags: []string{"-c", "-W"}}}
+
+	tests := []struct {
+		arg  string
+		want []string
+	}{
+		{"-Ic", []string{"-I", "-c"}},
+		{"-BIcprint(1)", []string{"-B", "-I", "-cprint(1)"}},
+		{"-Wignore", []string{"-Wignore"}},
+		{"-u", []string{"-u"}},
+		{"--check", []string{"--check"}},
+		{"app.py", []string{"app.py"}},
+	}
+	for _, tt := range tests {
+		if got := rule.splitFlags(tt.arg); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitFlags(%q) = %q, want %q", tt.arg, got, tt.want)
+		}
+	}
+
+	rule.ClusteredFlags = false
+	if got := rule.splitFlags("-toolexec"); !reflect.DeepEqual(got, []string{"-toolexec"}) {
+		t.Errorf("splitFlags without clusters = %q, want the argument unchanged", got)
+	}
+}
+
+func TestPolicyDeniesEnvFileEdits(t *testing.T) {
+	pe, workspace := newTestPolicy(t)
+	pm := &ProcessMonitor{config: pe.config, policy: pe}
+	envFile := filepath.Join(workspace, ".env")
+	cmd := ProcessCommand{Command: "python3", Args: []string{"app.py"}, WorkingDir: workspace, EnvFiles: []string{".env"}}
+
+	if err := os.WriteFile(envFile, []byte("DEBUG=1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pm.authorizeProcess(cmd); err != nil {
+		t.Fatalf("first run denied: %v", err)
+	}
+
+	// A restart reads the env file again and must check it again
+	if err := os.WriteFile(envFile, []byte("DEBUG=1\nLD_PRELOAD=/tmp/evil.so\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := pm.authorizeProcess(cmd)
+	var denied *policyError
+	if !errors.As(err, &denied) || denied.decision.Rule != `denied_env["LD_PRELOAD"]` {
+		t.Fatalf("run after adding LD_PRELOAD: %v, want denied_env", err)
+	}
+
+	audit := pe.AuditLog("", 0)
+	if len(audit) != 2 || audit[0].Decision != "deny" || audit[1].Decision != "allow" {
+		t.Errorf("audit log = %+v, want allow then deny", audit)
+	}
+}
+
+func TestDefaultPolicyMatchesAllowedCommands(t *testing.T) {
+	allowed := loadConfig().AllowedCommands
+	rules := defaultPolicyConfig().Rules
+
+	// A rule only for an alias that is not allowed, such as python3 next
+	// to python, leaves the allowed spelling unchecked
+	for command := range rules {
+		if !containsString(allowed, command) {
+			t.Errorf("default rule for %s, which is not an allowed command", command)
+		}
+	}
+	for _, interpreter := range []string{"node", "python", "python3"} {
+		if rule, exists := rules[interpreter]; !containsString(allowed, interpreter) || !exists || !rule.RequireScript {
+			t.Errorf("interpreter %s: allowed %t, rule %t, want both with a required script",
+				interpreter, containsString(allowed, interpreter), exists)
+		}
+	}
+}
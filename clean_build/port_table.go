@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ListeningPort is a TCP socket in LISTEN state and the process owning it
+type ListeningPort struct {
+	Port             int    `json:"port"`
+	Protocol         string `json:"protocol"` // tcp, tcp6
+	Address          string `json:"address"`
+	Inode            uint64 `json:"inode"`
+	PID              int    `json:"pid,omitempty"` // zero when the owner is not visible to us
+	Name             string `json:"name,omitempty"`
+	Command          string `json:"command,omitempty"`
+	Cwd              string `json:"cwd,omitempty"`
+	IsProjectRelated bool   `json:"is_project_related"`
+}
+
+// PortTable is a point-in-time map of listening ports to processes
+type PortTable struct {
+	Ports     []ListeningPort `json:"ports"`
+	Timestamp time.Time       `json:"timestamp"`
+	byPort    map[int]ListeningPort
+}
+
+// tcpListenState is the hex state code of a listening socket in /proc/net/tcp
+const tcpListenState = "0A"
+
+// portTableTTL bounds how often /proc is rescanned when every plugin asks at once
+const portTableTTL = 2 * time.Second
+
+var (
+	portTableCache *PortTable
+	portTableMutex sync.Mutex
+)
+
+// currentPortTable returns a recent port table, rescanning /proc when stale
+func currentPortTable() *PortTable {
+	portTableMutex.Lock()
+	defer portTableMutex.Unlock()
+
+	if portTableCache == nil || time.Since(portTableCache.Timestamp) > portTableTTL {
+		portTableCache = readPortTable()
+	}
+
+	return portTableCache
+}
+
+// readPortTable joins /proc/net/tcp{,6} with the socket inodes in /proc/*/fd
+func readPortTable() *PortTable {
+	table := &PortTable{
+		Ports:     []ListeningPort{},
+		Timestamp: time.Now(),
+		byPort:    make(map[int]ListeningPort),
+	}
+
+	listening := append(readProcNetTCP("/proc/net/tcp", "tcp"), readProcNetTCP("/proc/net/tcp6", "tcp6")...)
+	if len(listening) == 0 {
+		return table
+	}
+
+	owners := socketInodeOwners()
+
+	for _, port := range listening {
+		if pid, ok := owners[port.Inode]; ok {
+			port.PID = pid
+			if stat, err := readProcStat(pid); err == nil {
+				port.Name = stat.Comm
+			}
+			port.Command = strings.Join(readProcCmdline(pid), " ")
+			port.Cwd, _ = os.Readlink(filepath.Join("/proc", strconv.Itoa(pid), "cwd"))
+		}
+
+		table.Ports = append(table.Ports, port)
+
+		// Prefer an entry with a known owner when tcp and tcp6 both listen
+		if existing, exists := table.byPort[port.Port]; !exists || (existing.PID == 0 && port.PID != 0) {
+			table.byPort[port.Port] = port
+		}
+	}
+
+	sort.Slice(table.Ports, func(i, j int) bool {
+		if table.Ports[i].Port != table.Ports[j].Port {
+			return table.Ports[i].Port < table.Ports[j].Port
+		}
+		return table.Ports[i].Protocol < table.Ports[j].Protocol
+	})
+
+	return table
+}
+
+// Lookup returns the listener on a port
+func (pt *PortTable) Lookup(port int) (ListeningPort, bool) {
+	listener, exists := pt.byPort[port]
+	return listener, exists
+}
+
+// ForWorkspace returns the table with IsProjectRelated set against workspace
+func (pt *PortTable) ForWorkspace(workspace string) []ListeningPort {
+	ports := make([]ListeningPort, len(pt.Ports))
+	for i, port := range pt.Ports {
+		port.IsProjectRelated = withinDir(workspace, port.Cwd)
+		ports[i] = port
+	}
+
+	return ports
+}
+
+// readProcNetTCP parses the listening sockets of a /proc/net/tcp style file
+func readProcNetTCP(path, protocol string) []ListeningPort {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	ports := []ListeningPort{}
+	scanner := bufio.NewScanner(file)
+	scanner.Scan() // Skip header
+
+	for scanner.Scan() {
+		// sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || fields[3] != tcpListenState {
+			continue
+		}
+
+		address, port, ok := parseProcNetAddress(fields[1])
+		if !ok {
+			continue
+		}
+
+		inode, err := strconv.ParseUint(fields[9], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		ports = append(ports, ListeningPort{
+			Port:     port,
+			Protocol: protocol,
+			Address:  address,
+			Inode:    inode,
+		})
+	}
+
+	return ports
+}
+
+// parseProcNetAddress decodes "0100007F:1F90"; the address is stored as
+// native-endian 32-bit words, which is little-endian on supported platforms
+func parseProcNetAddress(value string) (string, int, bool) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 2 {
+		return "", 0, false
+	}
+
+	port, err := strconv.ParseUint(parts[1], 16, 16)
+	if err != nil {
+		return "", 0, false
+	}
+
+	raw, err := hex.DecodeString(parts[0])
+	if err != nil || (len(raw) != net.IPv4len && len(raw) != net.IPv6len) {
+		return "", 0, false
+	}
+
+	ip := make(net.IP, len(raw))
+	for word := 0; word < len(raw); word += 4 {
+		for i := 0; i < 4; i++ {
+			ip[word+i] = raw[word+3-i]
+		}
+	}
+
+	return ip.String(), int(port), true
+}
+
+// socketInodeOwners maps socket inodes to the PID holding them open
+func socketInodeOwners() map[uint64]int {
+	owners := make(map[uint64]int)
+
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return owners
+	}
+
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+
+		fdDir := filepath.Join("/proc", entry.Name(), "fd")
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue // Exited or owned by another user
+		}
+
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+			if err != nil || !strings.HasPrefix(link, "socket:[") {
+				continue
+			}
+
+			inode, err := strconv.ParseUint(strings.TrimSuffix(link[len("socket:["):], "]"), 10, 64)
+			if err != nil {
+				continue
+			}
+
+			// Forked children inherit listeners; the lowest PID is the parent server
+			if owner, exists := owners[inode]; !exists || pid < owner {
+				owners[inode] = pid
+			}
+		}
+	}
+
+	return owners
+}
+
+// applyPortStatus fills a service's Status and ProcessID from the port table
+func applyPortStatus(service *ServiceInfo) {
+	service.Status = "stopped"
+	service.ProcessID = 0
+
+	if procAvailable() {
+		if listener, exists := currentPortTable().Lookup(service.Port); exists {
+			service.Status = "running"
+			service.ProcessID = listener.PID
+		}
+		return
+	}
+
+	if isPortInUse(service.Port) {
+		service.Status = "running"
+	}
+}
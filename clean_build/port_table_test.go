@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseProcNetAddress(t *testing.T) {
+	tests := []struct {
+		value   string
+		address string
+		port    int
+		ok      bool
+	}{
+		{"0100007F:1F90", "127.0.0.1", 8080, true},
+		{"00000000:0050", "0.0.0.0", 80, true},
+		{"0101A8C0:D431", "192.168.1.1", 54321, true},
+		{"00000000000000000000000001000000:1F90", "::1", 8080, true},
+		{"00000000000000000000000000000000:0016", "::", 22, true},
+		{"0000000000000000FFFF00000100007F:0BB8", "127.0.0.1", 3000, true}, // IPv4-mapped
+		{"000080FE00000000000000000100000:0050", "", 0, false},             // odd length
+		{"000080FE000000000000000001000000:0050", "fe80::1", 80, true},
+		{"B80D0120000000000000000001000000:01BB", "2001:db8::1", 443, true},
+		{"0100007F", "", 0, false},
+		{"0100007F:XYZ", "", 0, false},
+		{"0100007F:10000", "", 0, false}, // port beyond 16 bits
+		{"00007F:1F90", "", 0, false},
+		{"GG00007F:1F90", "", 0, false},
+	}
+
+	for _, tt := range tests {
+		address, port, ok := parseProcNetAddress(tt.value)
+		if ok != tt.ok || address != tt.address || port != tt.port {
+			t.Errorf("parseProcNetAddress(%q) = %q, %d, %t, want %q, %d, %t",
+				tt.value, address, port, ok, tt.address, tt.port, tt.ok)
+		}
+	}
+}
+
+func TestReadProcNetTCP(t *testing.T) {
+	content := `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 0100007F:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000  1000        0 41234 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:9C40 0100007F:1F90 01 00000000:00000000 00:00000000 00000000  1000        0 41235 1 0000000000000000 20 4 30 10 -1
+   2: 00000000:0016 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1999 1 0000000000000000 100 0 0 10 0
+   3: garbage
+   4: 0100007F:0BB8 00000000:0000 0A 00000000:00000000 00:00000000 00000000  1000        0 notanumber 1
+`
+	path := filepath.Join(t.TempDir(), "tcp")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []ListeningPort{
+		{Port: 8080, Protocol: "tcp", Address: "127.0.0.1", Inode: 41234},
+		{Port: 22, Protocol: "tcp", Address: "0.0.0.0", Inode: 1999},
+	}
+	if got := readProcNetTCP(path, "tcp"); !reflect.DeepEqual(got, want) {
+		t.Errorf("readProcNetTCP() = %+v, want %+v", got, want)
+	}
+
+	if got := readProcNetTCP(filepath.Join(t.TempDir(), "missing"), "tcp6"); got != nil {
+		t.Errorf("readProcNetTCP of a missing file = %+v, want nil", got)
+	}
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// clockTicksPerSecond is USER_HZ, which is 100 on every mainstream Linux build
+const clockTicksPerSecond = 100
+
+// procStat holds the fields of /proc/<pid>/stat that the inspector uses
+type procStat struct {
+	PID        int
+	PPID       int
+	Comm       string
+	State      string
+	CPUTicks   uint64 // utime + stime
+	Threads    int
+	StartTicks uint64 // since boot
+	RSSPages   int64
+}
+
+// ProcessTreeNode is a process with its descendants
+type ProcessTreeNode struct {
+	ProcessInfo
+	Children []*ProcessTreeNode `json:"children,omitempty"`
+}
+
+// cpuSample remembers CPU time between inspections to derive CPU %
+type cpuSample struct {
+	startTicks uint64
+	cpuTicks   uint64
+	sampledAt  time.Time
+}
+
+// ProcInspector reads process details from /proc
+type ProcInspector struct {
+	workspace string
+	samples   map[int]cpuSample
+	mutex     sync.Mutex
+}
+
+var (
+	procBootTimeOnce sync.Once
+	procBootTime     time.Time
+	procPageSize     = int64(os.Getpagesize())
+)
+
+// NewProcInspector creates an inspector that classifies processes against the workspace
+func NewProcInspector(workspace string) *ProcInspector {
+	return &ProcInspector{
+		workspace: workspace,
+		samples:   make(map[int]cpuSample),
+	}
+}
+
+// procAvailable reports whether a /proc filesystem is mounted
+func procAvailable() bool {
+	_, err := os.Stat("/proc/self/stat")
+	return err == nil
+}
+
+// Inspect returns details for every process visible in /proc
+func (pi *ProcInspector) Inspect() []ProcessInfo {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+
+	pi.mutex.Lock()
+	defer pi.mutex.Unlock()
+
+	now := time.Now()
+	processes := []ProcessInfo{}
+	seen := make(map[int]bool)
+
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+
+		info, err := pi.inspect(pid, now)
+		if err != nil {
+			continue // Process exited while scanning
+		}
+
+		seen[pid] = true
+		processes = append(processes, *info)
+	}
+
+	// Forget samples of processes that are gone
+	for pid := range pi.samples {
+		if !seen[pid] {
+			delete(pi.samples, pid)
+		}
+	}
+
+	linkProcessChildren(processes)
+	return processes
+}
+
+// InspectPID returns details for a single process
+func (pi *ProcInspector) InspectPID(pid int) (*ProcessInfo, error) {
+	pi.mutex.Lock()
+	defer pi.mutex.Unlock()
+
+	return pi.inspect(pid, time.Now())
+}
+
+// InspectTree returns details for a process with the CPU, memory, open
+// files and threads of its descendants added in, and the PIDs it read
+func (pi *ProcInspector) InspectTree(root int) (*ProcessInfo, []int, error) {
+	pi.mutex.Lock()
+	defer pi.mutex.Unlock()
+
+	now := time.Now()
+	info, err := pi.inspect(root, now)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pids := []int{root}
+	for _, pid := range procDescendants(root) {
+		child, err := pi.inspect(pid, now)
+		if err != nil {
+			continue // Exited while walking the tree
+		}
+		pids = append(pids, pid)
+		info.CPUPercent += child.CPUPercent
+		info.MemoryMB += child.MemoryMB
+		info.OpenFiles += child.OpenFiles
+		info.Threads += child.Threads
+		info.ChildPIDs = append(info.ChildPIDs, pid)
+	}
+
+	return info, pids, nil
+}
+
+// Retain forgets the CPU samples of every process not in pids
+func (pi *ProcInspector) Retain(pids map[int]bool) {
+	pi.mutex.Lock()
+	defer pi.mutex.Unlock()
+
+	for pid := range pi.samples {
+		if !pids[pid] {
+			delete(pi.samples, pid)
+		}
+	}
+}
+
+func (pi *ProcInspector) inspect(pid int, now time.Time) (*ProcessInfo, error) {
+	stat, err := readProcStat(pid)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Join("/proc", strconv.Itoa(pid))
+	cwd, _ := os.Readlink(filepath.Join(dir, "cwd"))
+	exe, _ := os.Readlink(filepath.Join(dir, "exe"))
+	exe = strings.TrimSuffix(exe, " (deleted)")
+
+	command := strings.Join(readProcCmdline(pid), " ")
+	if command == "" {
+		command = "[" + stat.Comm + "]" // Kernel threads have no command line
+	}
+
+	info := &ProcessInfo{
+		PID:              pid,
+		ParentPID:        stat.PPID,
+		Name:             stat.Comm,
+		Command:          command,
+		Executable:       exe,
+		Cwd:              cwd,
+		State:            stat.State,
+		StartTime:        procStartTime(stat.StartTicks),
+		CPUPercent:       pi.cpuPercent(stat, now),
+		MemoryMB:         float64(stat.RSSPages*procPageSize) / (1024 * 1024),
+		Threads:          stat.Threads,
+		OpenFiles:        countOpenFDs(pid),
+		IsProjectRelated: withinDir(pi.workspace, cwd) || withinDir(pi.workspace, exe),
+	}
+
+	return info, nil
+}
+
+// cpuPercent is the CPU usage since the previous inspection, or over the
+// process lifetime on first sight. 100% equals one fully used core.
+func (pi *ProcInspector) cpuPercent(stat *procStat, now time.Time) float64 {
+	previous, exists := pi.samples[stat.PID]
+	pi.samples[stat.PID] = cpuSample{startTicks: stat.StartTicks, cpuTicks: stat.CPUTicks, sampledAt: now}
+
+	var ticks uint64
+	var elapsed time.Duration
+
+	// A different start time means the PID was reused
+	if exists && previous.startTicks == stat.StartTicks && stat.CPUTicks >= previous.cpuTicks {
+		ticks = stat.CPUTicks - previous.cpuTicks
+		elapsed = now.Sub(previous.sampledAt)
+	} else {
+		ticks = stat.CPUTicks
+		elapsed = now.Sub(procStartTime(stat.StartTicks))
+	}
+
+	if elapsed <= 0 {
+		return 0
+	}
+
+	return float64(ticks) / clockTicksPerSecond / elapsed.Seconds() * 100
+}
+
+// readProcStat parses /proc/<pid>/stat
+func readProcStat(pid int) (*procStat, error) {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return nil, err
+	}
+
+	// The command name may contain spaces and parentheses, so split on the last ')'
+	content := string(data)
+	open := strings.IndexByte(content, '(')
+	end := strings.LastIndexByte(content, ')')
+	if open < 0 || end < open {
+		return nil, fmt.Errorf("malformed stat for pid %d", pid)
+	}
+
+	// fields[0] is the state, the third field of the stat line
+	fields := strings.Fields(content[end+1:])
+	if len(fields) < 22 {
+		return nil, fmt.Errorf("short stat for pid %d", pid)
+	}
+
+	field := func(n int) uint64 {
+		value, _ := strconv.ParseUint(fields[n-3], 10, 64)
+		return value
+	}
+
+	return &procStat{
+		PID:        pid,
+		Comm:       content[open+1 : end],
+		State:      fields[0],
+		PPID:       int(field(4)),
+		CPUTicks:   field(14) + field(15),
+		Threads:    int(field(20)),
+		StartTicks: field(22),
+		RSSPages:   int64(field(24)),
+	}, nil
+}
+
+// readProcCmdline returns the NUL separated arguments of a process
+func readProcCmdline(pid int) []string {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "cmdline"))
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+
+	return strings.Split(strings.TrimRight(string(data), "\x00"), "\x00")
+}
+
+// countOpenFDs counts the open file descriptors of a process
+func countOpenFDs(pid int) int {
+	entries, err := os.ReadDir(filepath.Join("/proc", strconv.Itoa(pid), "fd"))
+	if err != nil {
+		return 0 // Not permitted for other users' processes
+	}
+	return len(entries)
+}
+
+// procStartTime converts a start time in clock ticks since boot to wall time
+func procStartTime(startTicks uint64) time.Time {
+	procBootTimeOnce.Do(func() {
+		data, err := os.ReadFile("/proc/stat")
+		if err != nil {
+			return
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if strings.HasPrefix(line, "btime ") {
+				if secs, err := strconv.ParseInt(strings.TrimSpace(line[6:]), 10, 64); err == nil {
+					procBootTime = time.Unix(secs, 0)
+				}
+				break
+			}
+		}
+	})
+
+	return procBootTime.Add(time.Duration(startTicks) * time.Second / clockTicksPerSecond)
+}
+
+// linkProcessChildren fills the ChildPIDs of each process
+func linkProcessChildren(processes []ProcessInfo) {
+	index := make(map[int]int, len(processes))
+	for i := range processes {
+		index[processes[i].PID] = i
+		processes[i].ChildPIDs = nil
+	}
+
+	for _, process := range processes {
+		if parent, exists := index[process.ParentPID]; exists && process.ParentPID != process.PID {
+			processes[parent].ChildPIDs = append(processes[parent].ChildPIDs, process.PID)
+		}
+	}
+
+	for i := range processes {
+		sort.Ints(processes[i].ChildPIDs)
+	}
+}
+
+// descendantPIDs returns every PID below root, breadth first
+func descendantPIDs(processes []ProcessInfo, root int) []int {
+	children := make(map[int][]int)
+	for _, process := range processes {
+		if process.PID != process.ParentPID {
+			children[process.ParentPID] = append(children[process.ParentPID], process.PID)
+		}
+	}
+
+	return walkDescendants(children, root)
+}
+
+// procDescendants reads the current descendants of a process straight from /proc
+func procDescendants(root int) []int {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+
+	children := make(map[int][]int)
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		if stat, err := readProcStat(pid); err == nil && stat.PPID != pid {
+			children[stat.PPID] = append(children[stat.PPID], pid)
+		}
+	}
+
+	return walkDescendants(children, root)
+}
+
+func walkDescendants(children map[int][]int, root int) []int {
+	descendants := []int{}
+	queue := append([]int{}, children[root]...)
+	for len(queue) > 0 {
+		pid := queue[0]
+		queue = queue[1:]
+		descendants = append(descendants, pid)
+		queue = append(queue, children[pid]...)
+	}
+
+	return descendants
+}
+
+// buildProcessTree nests processes under their parents; processes whose
+// parent is not in the list become roots
+func buildProcessTree(processes []ProcessInfo) []*ProcessTreeNode {
+	nodes := make(map[int]*ProcessTreeNode, len(processes))
+	for _, process := range processes {
+		nodes[process.PID] = &ProcessTreeNode{ProcessInfo: process}
+	}
+
+	roots := []*ProcessTreeNode{}
+	for _, process := range processes {
+		node := nodes[process.PID]
+		if parent, exists := nodes[process.ParentPID]; exists && process.ParentPID != process.PID {
+			parent.Children = append(parent.Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+
+	return roots
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestInspectTreeIncludesDescendants(t *testing.T) {
+	if !procAvailable() {
+		t.Skip("/proc is not available")
+	}
+
+	cmd := exec.Command("sh", "-c", "sleep 30 & sleep 30 & wait")
+	if err := cmd.Start(); err != nil {
+		t.Skip("cannot start sh:", err)
+	}
+	defer func() {
+		for _, pid := range procDescendants(cmd.Process.Pid) {
+			syscall.Kill(pid, syscall.SIGKILL)
+		}
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	// Wait for both children to appear
+	deadline := time.Now().Add(5 * time.Second)
+	for len(procDescendants(cmd.Process.Pid)) < 2 && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	pi := NewProcInspector(t.TempDir())
+	leader, err := pi.InspectPID(cmd.Process.Pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, pids, err := pi.InspectTree(cmd.Process.Pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pids) != 3 || len(tree.ChildPIDs) != 2 {
+		t.Fatalf("tree read pids %v with children %v, want the leader and two children", pids, tree.ChildPIDs)
+	}
+	if tree.Threads < leader.Threads+2 {
+		t.Errorf("tree threads = %d, want at least %d", tree.Threads, leader.Threads+2)
+	}
+	if tree.MemoryMB <= leader.MemoryMB {
+		t.Errorf("tree memory = %.2f MB, want more than the leader's %.2f MB", tree.MemoryMB, leader.MemoryMB)
+	}
+
+	pi.Retain(map[int]bool{cmd.Process.Pid: true})
+	if len(pi.samples) != 1 {
+		t.Errorf("retained %d samples, want 1", len(pi.samples))
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"syscall"
+	"time"
+)
+
+// processGroupAttr starts a command as the leader of a new process group, so
+// the whole tree it spawns can be signalled at once
+func processGroupAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setpgid: true}
+}
+
+// terminateProcessTree sends SIGTERM to the process group and every known
+// descendant, then SIGKILL to whatever is still alive after the grace period
+func (pm *ProcessMonitor) terminateProcessTree(process *MonitoredProcess, grace time.Duration) {
+	pgid := process.PID // Leader of its own group
+
+	// Descendants that moved to another group or session still belong to the tree
+	descendants := procDescendants(process.PID)
+
+	signalTree := func(sig syscall.Signal) {
+		if err := syscall.Kill(-pgid, sig); err != nil && !errors.Is(err, syscall.ESRCH) {
+			log.Printf("Failed to signal process group %d: %v", pgid, err)
+		}
+		for _, pid := range descendants {
+			syscall.Kill(pid, sig)
+		}
+	}
+
+	alive := func() bool {
+		select {
+		case <-process.exited:
+		default:
+			return true
+		}
+		if syscall.Kill(-pgid, 0) == nil {
+			return true
+		}
+		for _, pid := range descendants {
+			if syscall.Kill(pid, 0) == nil {
+				return true
+			}
+		}
+		return false
+	}
+
+	if !alive() {
+		return
+	}
+
+	signalTree(syscall.SIGTERM)
+
+	deadline := time.Now().Add(grace)
+	for time.Now().Before(deadline) {
+		if !alive() {
+			log.Printf("Process tree of PID %d stopped gracefully", process.PID)
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	signalTree(syscall.SIGKILL)
+	log.Printf("Force killed process tree of PID %d after %v", process.PID, grace)
+
+	// Give the kernel a moment to reap the leader
+	select {
+	case <-process.exited:
+	case <-time.After(time.Second):
+	}
+}
+
+// GetProcessTree returns a monitored process with all of its descendants
+func (pm *ProcessMonitor) GetProcessTree(ref string) (*ProcessTreeNode, error) {
+	process, err := pm.ResolveProcess(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	process.mutex.RLock()
+	pid := process.PID
+	process.mutex.RUnlock()
+
+	root, err := pm.inspector.InspectPID(pid)
+	if err != nil {
+		return nil, fmt.Errorf("process with PID %d is not running", pid)
+	}
+
+	processes := []ProcessInfo{*root}
+	for _, child := range procDescendants(pid) {
+		if info, err := pm.inspector.InspectPID(child); err == nil {
+			processes = append(processes, *info)
+		}
+	}
+
+	linkProcessChildren(processes)
+	return buildProcessTree(processes)[0], nil
+}
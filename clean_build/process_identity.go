@@ -0,0 +1,296 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// ProcessRun is one execution of a monitored process; a restart starts a new run
+type ProcessRun struct {
+	PID        int        `json:"pid"`
+	StartTime  time.Time  `json:"start_time"`
+	EndTime    *time.Time `json:"end_time,omitempty"`
+	ExitCode   *int       `json:"exit_code,omitempty"`
+	DurationMs int64      `json:"duration_ms,omitempty"`
+}
+
+// maxRunHistory bounds the runs kept per monitored process
+const maxRunHistory = 50
+
+// processNamePattern keeps names usable in URLs and distinct from IDs and PIDs
+var processNamePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9._-]{0,63}$`)
+
+// processIDPattern matches the IDs generated by newProcessID
+var processIDPattern = regexp.MustCompile(`^p-[0-9a-f]{8}$`)
+
+// newProcessID returns a random stable identifier for a monitored process
+func newProcessID() string {
+	buf := make([]byte, 4)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("p-%08x", time.Now().UnixNano()&0xffffffff)
+	}
+	return "p-" + hex.EncodeToString(buf)
+}
+
+// validateProcessName checks an optional process name
+func validateProcessName(name string) error {
+	if name == "" {
+		return nil
+	}
+	if !processNamePattern.MatchString(name) || processIDPattern.MatchString(name) {
+		return fmt.Errorf("invalid process name %q: use letters, digits, '.', '_' or '-', starting with a letter", name)
+	}
+	return nil
+}
+
+// lookupProcessLocked resolves a reference to a monitored process: its
+// stable ID, its name, or, for older clients, the PID of its current run.
+// The caller holds pm.mutex.
+func (pm *ProcessMonitor) lookupProcessLocked(ref string) (*MonitoredProcess, bool) {
+	if process, exists := pm.activeProcesses[ref]; exists {
+		return process, true
+	}
+
+	pid, err := strconv.Atoi(ref)
+	for _, process := range pm.activeProcesses {
+		if process.Name != "" && process.Name == ref {
+			return process, true
+		}
+		if err == nil && process.PID == pid {
+			return process, true
+		}
+	}
+
+	return nil, false
+}
+
+// reserveStart counts a starting process against MaxProcesses and claims
+// its name until releaseStart. A name can be reused once its previous owner
+// has exited for good; that owner is returned for cleanup.
+func (pm *ProcessMonitor) reserveStart(name string) (*MonitoredProcess, error) {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+
+	if len(pm.activeProcesses)+pm.starting >= pm.config.MaxProcesses {
+		return nil, fmt.Errorf("maximum number of processes (%d) already running", pm.config.MaxProcesses)
+	}
+
+	var existing *MonitoredProcess
+	if name != "" {
+		if pm.startingNames[name] {
+			return nil, fmt.Errorf("a process named %s is already starting", name)
+		}
+
+		existing, _ = pm.lookupProcessLocked(name)
+		if existing != nil {
+			existing.mutex.RLock()
+			reusable := existing.ExitCode != nil && existing.Status != "restarting" && !existing.restartPending
+			existing.mutex.RUnlock()
+			if !reusable {
+				return nil, fmt.Errorf("a process named %s is already running (%s)", name, existing.ID)
+			}
+		}
+
+		if pm.startingNames == nil {
+			pm.startingNames = make(map[string]bool)
+		}
+		pm.startingNames[name] = true
+	}
+
+	pm.starting++
+	return existing, nil
+}
+
+// releaseStart gives up a reservation once the process is registered or failed to start
+func (pm *ProcessMonitor) releaseStart(name string) {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+
+	pm.starting--
+	delete(pm.startingNames, name)
+}
+
+// ResolveProcess finds a monitored process by ID, name or current PID
+func (pm *ProcessMonitor) ResolveProcess(ref string) (*MonitoredProcess, error) {
+	pm.mutex.RLock()
+	defer pm.mutex.RUnlock()
+
+	process, exists := pm.lookupProcessLocked(ref)
+	if !exists {
+		return nil, fmt.Errorf("process %s not found", ref)
+	}
+	return process, nil
+}
+
+// EndedProcess is what is kept of a monitored process after cleanup: its
+// identity and run history, without the output buffers
+type EndedProcess struct {
+	ID           string       `json:"id"`
+	Name         string       `json:"name,omitempty"`
+	Command      string       `json:"command"`
+	Args         []string     `json:"args"`
+	WorkingDir   string       `json:"working_dir"`
+	Service      string       `json:"service,omitempty"`
+	Status       string       `json:"status"`
+	ExitCode     *int         `json:"exit_code,omitempty"`
+	RestartCount int          `json:"restart_count"`
+	Runs         []ProcessRun `json:"runs"`
+	CleanedUp    time.Time    `json:"cleaned_up"`
+}
+
+// maxEndedProcesses bounds the ended processes remembered after cleanup
+const maxEndedProcesses = 100
+
+// rememberEndedLocked keeps the run history of a process being removed from
+// the active processes, dropping the oldest entries beyond
+// maxEndedProcesses. The caller holds pm.mutex.
+func (pm *ProcessMonitor) rememberEndedLocked(process *MonitoredProcess) {
+	process.mutex.RLock()
+	ended := EndedProcess{
+		ID:           process.ID,
+		Name:         process.Name,
+		Command:      process.Command,
+		Args:         slices.Clone(process.Args),
+		WorkingDir:   process.WorkingDir,
+		Service:      process.Service,
+		Status:       process.Status,
+		ExitCode:     copyValue(process.ExitCode),
+		RestartCount: process.RestartCount,
+		Runs:         slices.Clone(process.Runs),
+		CleanedUp:    time.Now(),
+	}
+	process.mutex.RUnlock()
+
+	pm.ended = slices.DeleteFunc(pm.ended, func(previous EndedProcess) bool {
+		return previous.ID == ended.ID
+	})
+	pm.ended = append(pm.ended, ended)
+	if len(pm.ended) > maxEndedProcesses {
+		pm.ended = slices.Delete(pm.ended, 0, len(pm.ended)-maxEndedProcesses)
+	}
+}
+
+// EndedProcesses returns the remembered ended processes, oldest first
+func (pm *ProcessMonitor) EndedProcesses() []EndedProcess {
+	pm.mutex.RLock()
+	defer pm.mutex.RUnlock()
+
+	return append([]EndedProcess{}, pm.ended...)
+}
+
+// LookupEnded finds a cleaned up process by its stable ID or, for the most
+// recent one, its name
+func (pm *ProcessMonitor) LookupEnded(ref string) (EndedProcess, bool) {
+	pm.mutex.RLock()
+	defer pm.mutex.RUnlock()
+
+	for i := len(pm.ended) - 1; i >= 0; i-- {
+		if pm.ended[i].ID == ref || (pm.ended[i].Name != "" && pm.ended[i].Name == ref) {
+			return pm.ended[i], true
+		}
+	}
+	return EndedProcess{}, false
+}
+
+// finishRun records the end of the current run
+func (p *MonitoredProcess) finishRun(exitCode int, endTime time.Time) {
+	if len(p.Runs) == 0 {
+		return
+	}
+
+	run := &p.Runs[len(p.Runs)-1]
+	run.EndTime = &endTime
+	run.ExitCode = &exitCode
+	run.DurationMs = endTime.Sub(run.StartTime).Milliseconds()
+}
+
+// ProcessSnapshot is the reported state of a monitored process, copied
+// under its lock so it can be serialized while the process keeps running
+type ProcessSnapshot struct {
+	ID           string          `json:"id"`
+	Name         string          `json:"name,omitempty"`
+	PID          int             `json:"pid"`
+	Command      string          `json:"command"`
+	Args         []string        `json:"args"`
+	StartTime    time.Time       `json:"start_time"`
+	Status       string          `json:"status"`
+	OutputLines  []string        `json:"output_lines"`
+	ErrorLines   []string        `json:"error_lines"`
+	LastError    *StreamError    `json:"last_error,omitempty"`
+	WorkingDir   string          `json:"working_dir"`
+	Service      string          `json:"service,omitempty"`
+	Resources    *ResourceSample `json:"resources,omitempty"`
+	ExitCode     *int            `json:"exit_code,omitempty"`
+	ExitCodes    []int           `json:"exit_codes,omitempty"`
+	RestartCount int             `json:"restart_count"`
+	Runs         []ProcessRun    `json:"runs"`
+	Restarts     []RestartEvent  `json:"restarts,omitempty"`
+	NextRestart  *time.Time      `json:"next_restart,omitempty"`
+	StderrTail   []string        `json:"stderr_tail,omitempty"`
+	Health       *ProbeStatus    `json:"health,omitempty"`
+	Prompt       *InputPrompt    `json:"prompt,omitempty"`
+	Limits       *LimitStatus    `json:"limits,omitempty"`
+}
+
+// Snapshot copies the process's reported state. Slices and pointed-to
+// values are copied too, since the supervisor, probes and output readers
+// update them in place.
+func (p *MonitoredProcess) Snapshot() ProcessSnapshot {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	snapshot := ProcessSnapshot{
+		ID:           p.ID,
+		Name:         p.Name,
+		PID:          p.PID,
+		Command:      p.Command,
+		Args:         slices.Clone(p.Args),
+		StartTime:    p.StartTime,
+		Status:       p.Status,
+		OutputLines:  slices.Clone(p.OutputLines),
+		ErrorLines:   slices.Clone(p.ErrorLines),
+		LastError:    copyValue(p.LastError),
+		WorkingDir:   p.WorkingDir,
+		Service:      p.Service,
+		Resources:    copyValue(p.Resources),
+		ExitCode:     copyValue(p.ExitCode),
+		ExitCodes:    slices.Clone(p.ExitCodes),
+		RestartCount: p.RestartCount,
+		Runs:         slices.Clone(p.Runs),
+		Restarts:     slices.Clone(p.Restarts),
+		NextRestart:  copyValue(p.NextRestart),
+		StderrTail:   slices.Clone(p.StderrTail),
+		Health:       copyValue(p.Health),
+		Prompt:       copyValue(p.Prompt),
+		Limits:       copyValue(p.Limits),
+	}
+	if snapshot.Limits != nil {
+		snapshot.Limits.Unenforced = slices.Clone(snapshot.Limits.Unenforced)
+	}
+	return snapshot
+}
+
+// copyValue returns a pointer to a copy of *value, or nil
+func copyValue[T any](value *T) *T {
+	if value == nil {
+		return nil
+	}
+	copied := *value
+	return &copied
+}
+
+// ProcessSnapshots returns snapshots of all monitored processes
+func (pm *ProcessMonitor) ProcessSnapshots() []ProcessSnapshot {
+	processes := pm.GetMonitoredProcesses()
+
+	snapshots := make([]ProcessSnapshot, 0, len(processes))
+	for _, process := range processes {
+		snapshots = append(snapshots, process.Snapshot())
+	}
+	return snapshots
+}
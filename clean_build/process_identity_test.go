@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestReserveStartClaimsNameOnce(t *testing.T) {
+	pm := &ProcessMonitor{
+		activeProcesses: make(map[string]*MonitoredProcess),
+		config:          &ProcessMonitorConfig{MaxProcesses: 100},
+	}
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	claimed := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := pm.reserveStart("web"); err == nil {
+				mutex.Lock()
+				claimed++
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if claimed != 1 {
+		t.Fatalf("%d concurrent starts claimed the name, want 1", claimed)
+	}
+
+	pm.releaseStart("web")
+	if _, err := pm.reserveStart("web"); err != nil {
+		t.Errorf("name not reusable after release: %v", err)
+	}
+}
+
+func TestReserveStartCountsStartingProcesses(t *testing.T) {
+	pm := &ProcessMonitor{
+		activeProcesses: map[string]*MonitoredProcess{"p-1": {ID: "p-1"}},
+		config:          &ProcessMonitorConfig{MaxProcesses: 2},
+	}
+
+	if _, err := pm.reserveStart(""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pm.reserveStart(""); err == nil {
+		t.Error("start beyond MaxProcesses was allowed while another was starting")
+	}
+}
+
+func TestCleanupStoppedProcessesIgnoresReusedPIDs(t *testing.T) {
+	exited := make(chan struct{})
+	close(exited)
+
+	// The PID of a reaped run may belong to a live process again
+	reaped := &MonitoredProcess{ID: "p-reaped", PID: os.Getpid(), Status: "stopped", exited: exited}
+	restarting := &MonitoredProcess{ID: "p-restarting", PID: os.Getpid(), Status: "error", restartPending: true, exited: exited}
+	running := &MonitoredProcess{ID: "p-running", PID: 999999, Status: "running", exited: make(chan struct{})}
+
+	pm := &ProcessMonitor{activeProcesses: map[string]*MonitoredProcess{
+		reaped.ID:     reaped,
+		restarting.ID: restarting,
+		running.ID:    running,
+	}}
+	pm.cleanupStoppedProcesses()
+
+	if _, exists := pm.activeProcesses[reaped.ID]; exists {
+		t.Error("reaped process kept because its PID is in use")
+	}
+	if _, exists := pm.activeProcesses[restarting.ID]; !exists {
+		t.Error("process awaiting restart was cleaned up")
+	}
+	if _, exists := pm.activeProcesses[running.ID]; !exists {
+		t.Error("running process was cleaned up")
+	}
+}
+
+func TestSnapshotCopiesMutableState(t *testing.T) {
+	exitCode := 1
+	process := &MonitoredProcess{
+		ID:          "p-0000abcd",
+		Status:      "running",
+		Args:        []string{"run", "dev"},
+		OutputLines: []string{},
+		Runs:        []ProcessRun{{PID: 10}},
+		ExitCode:    &exitCode,
+		Health:      &ProbeStatus{Status: "healthy"},
+		Limits:      &LimitStatus{Mode: "sampled", Unenforced: []string{"cpu_percent"}},
+	}
+
+	snapshot := process.Snapshot()
+
+	// Updates made in place after the snapshot must not show through it
+	process.Args[0] = "build"
+	process.Runs[0].PID = 11
+	*process.ExitCode = 2
+	process.Health.Status = "unhealthy"
+	process.Limits.Unenforced[0] = "memory"
+
+	if snapshot.Args[0] != "run" || snapshot.Runs[0].PID != 10 || *snapshot.ExitCode != 1 ||
+		snapshot.Health.Status != "healthy" || snapshot.Limits.Unenforced[0] != "cpu_percent" {
+		t.Errorf("snapshot shares state with the process: %+v", snapshot)
+	}
+	if snapshot.OutputLines == nil {
+		t.Error("empty output lines became nil and would marshal as null")
+	}
+	if snapshot.LastError != nil || snapshot.Prompt != nil {
+		t.Error("nil pointers were not kept nil")
+	}
+}
+
+func TestProcessSnapshotsWhileUpdating(t *testing.T) {
+	process := &MonitoredProcess{ID: "p-0000abcd", Status: "running", Health: &ProbeStatus{}}
+	pm := &ProcessMonitor{activeProcesses: map[string]*MonitoredProcess{process.ID: process}}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			process.mutex.Lock()
+			process.Health.ConsecutiveFailures++
+			process.OutputLines = append(process.OutputLines, "line")
+			process.mutex.Unlock()
+		}
+	}()
+
+	// Run with -race: marshalling must only read the copies
+	for i := 0; i < 100; i++ {
+		if _, err := json.Marshal(pm.ProcessSnapshots()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+}
+
+func TestCleanupKeepsRunHistory(t *testing.T) {
+	pm := &ProcessMonitor{activeProcesses: make(map[string]*MonitoredProcess)}
+	exitCode := 3
+	process := &MonitoredProcess{
+		ID:       "p-0000abcd",
+		Name:     "web",
+		Status:   "error",
+		ExitCode: &exitCode,
+		Runs:     []ProcessRun{{PID: 10}, {PID: 11, ExitCode: &exitCode}},
+		exited:   make(chan struct{}),
+	}
+	pm.activeProcesses[process.ID] = process
+	close(process.exited)
+
+	pm.cleanupStoppedProcesses()
+
+	if _, err := pm.ResolveProcess(process.ID); err == nil {
+		t.Fatal("exited process still active after cleanup")
+	}
+	for _, ref := range []string{"p-0000abcd", "web"} {
+		ended, found := pm.LookupEnded(ref)
+		if !found {
+			t.Fatalf("LookupEnded(%q) found nothing", ref)
+		}
+		if len(ended.Runs) != 2 || ended.Runs[1].PID != 11 || *ended.ExitCode != 3 {
+			t.Errorf("LookupEnded(%q) = %+v, want both runs and the exit code", ref, ended)
+		}
+	}
+	if _, found := pm.LookupEnded("p-ffffffff"); found {
+		t.Error("LookupEnded found an unknown process")
+	}
+}
+
+func TestEndedProcessesAreBounded(t *testing.T) {
+	pm := &ProcessMonitor{activeProcesses: make(map[string]*MonitoredProcess)}
+	for i := 0; i < maxEndedProcesses+5; i++ {
+		process := &MonitoredProcess{ID: fmt.Sprintf("p-%08x", i)}
+		pm.activeProcesses[process.ID] = process
+		pm.cleanupProcess(process)
+	}
+
+	ended := pm.EndedProcesses()
+	if len(ended) != maxEndedProcesses {
+		t.Fatalf("%d ended processes kept, want %d", len(ended), maxEndedProcesses)
+	}
+	if ended[0].ID != "p-00000005" || ended[len(ended)-1].ID != fmt.Sprintf("p-%08x", maxEndedProcesses+4) {
+		t.Errorf("kept %s..%s, want the most recent", ended[0].ID, ended[len(ended)-1].ID)
+	}
+
+	// A replaced run is not the registered process, so it is not remembered
+	replaced := &MonitoredProcess{ID: ended[0].ID}
+	pm.activeProcesses[replaced.ID] = &MonitoredProcess{ID: replaced.ID}
+	pm.cleanupProcess(replaced)
+	if got := pm.EndedProcesses(); got[0].ID != ended[0].ID {
+		t.Error("cleanup of a replaced run changed the ended history")
+	}
+}
+
+func TestEndedProcessesMarshalAsArray(t *testing.T) {
+	pm := &ProcessMonitor{activeProcesses: make(map[string]*MonitoredProcess)}
+	if data, _ := json.Marshal(pm.EndedProcesses()); string(data) != "[]" {
+		t.Errorf("no ended processes marshal as %s, want []", data)
+	}
+}
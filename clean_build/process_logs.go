@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogEntry is a single timestamped line of process output
+type LogEntry struct {
+	Timestamp time.Time `json:"ts"`
+	Stream    string    `json:"stream"` // stdout, stderr, pty, system
+	Line      string    `json:"line"`
+}
+
+// LogQuery filters log entries; zero values match everything
+type LogQuery struct {
+	Since  time.Time
+	Until  time.Time
+	Stream string
+	Grep   *regexp.Regexp
+	Limit  int // most recent matches to return, zero for all
+}
+
+// ProcessLogInfo describes the log files of one process run
+type ProcessLogInfo struct {
+	ProcessID string    `json:"process_id,omitempty"`
+	PID       int       `json:"pid"`
+	Name      string    `json:"name"`
+	Files     []string  `json:"files"`
+	SizeBytes int64     `json:"size_bytes"`
+	Modified  time.Time `json:"modified"`
+}
+
+// ProcessLog is the rotating log file of a single process run
+type ProcessLog struct {
+	path     string
+	file     *os.File
+	size     int64
+	openedAt time.Time
+	closed   bool
+	store    *ProcessLogStore
+	mutex    sync.Mutex
+}
+
+// ProcessLogStore owns the on-disk logs of monitored processes
+type ProcessLogStore struct {
+	dir       string
+	maxSize   int64
+	maxAge    time.Duration // rotate the active file once it is this old
+	maxFiles  int           // rotated files kept per process run
+	retention time.Duration // delete logs untouched for this long
+}
+
+// logFileNamePattern matches "<id>-<pid>-<start>.log" and its rotations
+// "<id>-<pid>-<start>.log.N"; logs written before stable IDs have no "<id>-"
+var logFileNamePattern = regexp.MustCompile(`^(?:(p-[0-9a-f]{8})-)?(\d+)-(\d{8}T\d{6})\.log(?:\.(\d+))?$`)
+
+// NewProcessLogStore creates a log store in dir
+func NewProcessLogStore(dir string, config *ProcessMonitorConfig) *ProcessLogStore {
+	return &ProcessLogStore{
+		dir:       dir,
+		maxSize:   config.LogMaxSizeMB * 1024 * 1024,
+		maxAge:    config.LogMaxAge,
+		maxFiles:  config.LogMaxFiles,
+		retention: config.LogRetention,
+	}
+}
+
+// Open creates the log file for a new process run
+func (ls *ProcessLogStore) Open(id string, pid int, startTime time.Time) (*ProcessLog, error) {
+	if err := os.MkdirAll(ls.dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+
+	name := fmt.Sprintf("%s-%d-%s.log", id, pid, startTime.UTC().Format("20060102T150405"))
+	pl := &ProcessLog{path: filepath.Join(ls.dir, name), store: ls}
+	if err := pl.openFile(); err != nil {
+		return nil, err
+	}
+
+	return pl, nil
+}
+
+func (pl *ProcessLog) openFile() error {
+	file, err := os.OpenFile(pl.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	pl.file = file
+	pl.size = info.Size()
+	pl.openedAt = time.Now()
+	return nil
+}
+
+// Write appends a line, rotating the file when it grows too big or too old
+func (pl *ProcessLog) Write(stream, line string, timestamp time.Time) {
+	pl.mutex.Lock()
+	defer pl.mutex.Unlock()
+
+	if pl.closed {
+		return
+	}
+
+	data, err := json.Marshal(LogEntry{Timestamp: timestamp, Stream: stream, Line: line})
+	if err != nil {
+		return
+	}
+	data = append(data, '\n')
+
+	if pl.size+int64(len(data)) > pl.store.maxSize || time.Since(pl.openedAt) > pl.store.maxAge {
+		if err := pl.rotate(); err != nil {
+			log.Printf("Failed to rotate process log %s: %v", pl.path, err)
+		}
+	}
+
+	if n, err := pl.file.Write(data); err == nil {
+		pl.size += int64(n)
+	}
+}
+
+// rotate shifts path.N to path.N+1, drops the oldest and starts a new file
+func (pl *ProcessLog) rotate() error {
+	pl.file.Close()
+
+	maxFiles := pl.store.maxFiles
+	os.Remove(fmt.Sprintf("%s.%d", pl.path, maxFiles))
+	for i := maxFiles - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", pl.path, i), fmt.Sprintf("%s.%d", pl.path, i+1))
+	}
+	if maxFiles > 0 {
+		os.Rename(pl.path, pl.path+".1")
+	} else {
+		os.Remove(pl.path)
+	}
+
+	return pl.openFile()
+}
+
+// Close stops writing; the files stay on disk for post-mortem queries
+func (pl *ProcessLog) Close() {
+	pl.mutex.Lock()
+	defer pl.mutex.Unlock()
+
+	if !pl.closed {
+		pl.closed = true
+		pl.file.Close()
+	}
+}
+
+// List returns the log runs on disk, most recent first
+func (ls *ProcessLogStore) List() []ProcessLogInfo {
+	entries, err := os.ReadDir(ls.dir)
+	if err != nil {
+		return []ProcessLogInfo{}
+	}
+
+	runs := make(map[string]*ProcessLogInfo)
+	for _, entry := range entries {
+		match := logFileNamePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		name := strings.TrimSuffix(entry.Name(), "."+match[4])
+		run, exists := runs[name]
+		if !exists {
+			var pid int
+			fmt.Sscanf(match[2], "%d", &pid)
+			run = &ProcessLogInfo{ProcessID: match[1], PID: pid, Name: name, Files: []string{}}
+			runs[name] = run
+		}
+
+		run.Files = append(run.Files, entry.Name())
+		run.SizeBytes += info.Size()
+		if info.ModTime().After(run.Modified) {
+			run.Modified = info.ModTime()
+		}
+	}
+
+	list := make([]ProcessLogInfo, 0, len(runs))
+	for _, run := range runs {
+		sortLogFiles(run.Files)
+		list = append(list, *run)
+	}
+	sort.Slice(list, func(i, j int) bool { return logRunStart(list[i].Name) > logRunStart(list[j].Name) })
+
+	return list
+}
+
+// logRunStart extracts the sortable start time from a run name
+func logRunStart(name string) string {
+	if match := logFileNamePattern.FindStringSubmatch(name); match != nil {
+		return match[3]
+	}
+	return name
+}
+
+// selectRuns picks the runs a query reads, oldest first: every run of a
+// stable process ID, or the most recent run of a PID
+func (ls *ProcessLogStore) selectRuns(ref string) []ProcessLogInfo {
+	runs := ls.List()
+	selected := []ProcessLogInfo{}
+
+	for i := len(runs) - 1; i >= 0; i-- {
+		if runs[i].ProcessID != "" && runs[i].ProcessID == ref {
+			selected = append(selected, runs[i])
+		}
+	}
+	if len(selected) > 0 {
+		return selected
+	}
+
+	for _, run := range runs {
+		if strconv.Itoa(run.PID) == ref {
+			return []ProcessLogInfo{run}
+		}
+	}
+	return selected
+}
+
+// Query reads the logs of a process ID across all of its runs, or of the
+// most recent run of a PID, oldest rotation first
+func (ls *ProcessLogStore) Query(ref string, query LogQuery) ([]LogEntry, error) {
+	runs := ls.selectRuns(ref)
+	if len(runs) == 0 {
+		return nil, fmt.Errorf("no logs found for %s", ref)
+	}
+
+	files := []string{}
+	for _, run := range runs {
+		files = append(files, run.Files...)
+	}
+
+	entries := []LogEntry{}
+	for _, name := range files {
+		file, err := os.Open(filepath.Join(ls.dir, name))
+		if err != nil {
+			continue // Rotated away while reading
+		}
+
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+		for scanner.Scan() {
+			var entry LogEntry
+			if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+				continue
+			}
+			if query.matches(entry) {
+				entries = append(entries, entry)
+			}
+		}
+		file.Close()
+	}
+
+	if query.Limit > 0 && len(entries) > query.Limit {
+		entries = entries[len(entries)-query.Limit:]
+	}
+
+	return entries, nil
+}
+
+func (q LogQuery) matches(entry LogEntry) bool {
+	if !q.Since.IsZero() && entry.Timestamp.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && entry.Timestamp.After(q.Until) {
+		return false
+	}
+	if q.Stream != "" && entry.Stream != q.Stream {
+		return false
+	}
+	if q.Grep != nil && !q.Grep.MatchString(entry.Line) {
+		return false
+	}
+	return true
+}
+
+// Prune deletes log files that have not been written for the retention period
+func (ls *ProcessLogStore) Prune() {
+	entries, err := os.ReadDir(ls.dir)
+	if err != nil {
+		return
+	}
+
+	cutoff := time.Now().Add(-ls.retention)
+	for _, entry := range entries {
+		if !logFileNamePattern.MatchString(entry.Name()) {
+			continue
+		}
+		if info, err := entry.Info(); err == nil && info.ModTime().Before(cutoff) {
+			os.Remove(filepath.Join(ls.dir, entry.Name()))
+		}
+	}
+}
+
+// sortLogFiles orders rotations oldest first: name.log.N, ..., name.log.1, name.log
+func sortLogFiles(files []string) {
+	rotation := func(name string) int {
+		match := logFileNamePattern.FindStringSubmatch(name)
+		if match == nil || match[4] == "" {
+			return 0
+		}
+		var n int
+		fmt.Sscanf(match[4], "%d", &n)
+		return n
+	}
+
+	sort.Slice(files, func(i, j int) bool { return rotation(files[i]) > rotation(files[j]) })
+}
+
+// parseLogTime accepts an RFC 3339 timestamp or a duration meaning "that long ago"
+func parseLogTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q: use RFC 3339 or a duration such as 10m", value)
+}
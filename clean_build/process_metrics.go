@@ -0,0 +1,249 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// ResourceSample is a single resource reading of a monitored process and its descendants
+type ResourceSample struct {
+	Timestamp  time.Time `json:"timestamp"`
+	CPUPercent float64   `json:"cpu_percent"`
+	MemoryMB   float64   `json:"memory_mb"`
+	OpenFiles  int       `json:"open_files"`
+	Threads    int       `json:"threads"`
+}
+
+// ResourceSeries is a bounded time series of resource samples
+type ResourceSeries struct {
+	samples    []ResourceSample
+	maxSamples int
+
+	// Active alerts, raised once and cleared when the condition ends
+	memoryAlert bool
+	fdAlert     bool
+	cpuAlert    bool
+}
+
+// ResourceSummary describes a series over its retained window
+type ResourceSummary struct {
+	Samples        int      `json:"samples"`
+	PeakCPUPercent float64  `json:"peak_cpu_percent"`
+	AvgCPUPercent  float64  `json:"avg_cpu_percent"`
+	PeakMemoryMB   float64  `json:"peak_memory_mb"`
+	MemoryGrowthMB float64  `json:"memory_growth_mb"`
+	OpenFilesDelta int      `json:"open_files_delta"`
+	ActiveAlerts   []string `json:"active_alerts"`
+}
+
+// NewResourceSeries creates a series holding at most maxSamples readings
+func NewResourceSeries(maxSamples int) *ResourceSeries {
+	return &ResourceSeries{
+		samples:    make([]ResourceSample, 0, maxSamples),
+		maxSamples: maxSamples,
+	}
+}
+
+func (rs *ResourceSeries) add(sample ResourceSample) {
+	rs.samples = append(rs.samples, sample)
+	if len(rs.samples) > rs.maxSamples {
+		rs.samples = rs.samples[len(rs.samples)-rs.maxSamples:]
+	}
+}
+
+// window returns the trailing samples covering at least the given duration,
+// or nil when the series is not that long yet
+func (rs *ResourceSeries) window(duration time.Duration) []ResourceSample {
+	if len(rs.samples) < 2 {
+		return nil
+	}
+
+	last := rs.samples[len(rs.samples)-1].Timestamp
+	for i := len(rs.samples) - 2; i >= 0; i-- {
+		if last.Sub(rs.samples[i].Timestamp) >= duration {
+			return rs.samples[i:]
+		}
+	}
+
+	return nil
+}
+
+func (rs *ResourceSeries) summary() ResourceSummary {
+	summary := ResourceSummary{Samples: len(rs.samples), ActiveAlerts: []string{}}
+	if len(rs.samples) == 0 {
+		return summary
+	}
+
+	var totalCPU float64
+	for _, sample := range rs.samples {
+		totalCPU += sample.CPUPercent
+		if sample.CPUPercent > summary.PeakCPUPercent {
+			summary.PeakCPUPercent = sample.CPUPercent
+		}
+		if sample.MemoryMB > summary.PeakMemoryMB {
+			summary.PeakMemoryMB = sample.MemoryMB
+		}
+	}
+
+	first, last := rs.samples[0], rs.samples[len(rs.samples)-1]
+	summary.AvgCPUPercent = totalCPU / float64(len(rs.samples))
+	summary.MemoryGrowthMB = last.MemoryMB - first.MemoryMB
+	summary.OpenFilesDelta = last.OpenFiles - first.OpenFiles
+
+	if rs.memoryAlert {
+		summary.ActiveAlerts = append(summary.ActiveAlerts, "memory_growth")
+	}
+	if rs.fdAlert {
+		summary.ActiveAlerts = append(summary.ActiveAlerts, "fd_leak")
+	}
+	if rs.cpuAlert {
+		summary.ActiveAlerts = append(summary.ActiveAlerts, "cpu_pegged")
+	}
+
+	return summary
+}
+
+// detectResourceAlerts checks the series for leaks and returns newly raised alerts
+func (rs *ResourceSeries) detectResourceAlerts(config *ProcessMonitorConfig) []string {
+	samples := rs.window(config.ResourceAlertWindow)
+	if samples == nil {
+		return nil
+	}
+
+	first, last := samples[0], samples[len(samples)-1]
+	minutes := last.Timestamp.Sub(first.Timestamp).Minutes()
+	alerts := []string{}
+
+	// Sustained memory growth: fast enough overall and rising in most intervals
+	rising := 0
+	for i := 1; i < len(samples); i++ {
+		if samples[i].MemoryMB > samples[i-1].MemoryMB {
+			rising++
+		}
+	}
+	growthRate := (last.MemoryMB - first.MemoryMB) / minutes
+	memoryGrowing := growthRate >= config.MemoryGrowthMBPerMin && float64(rising) >= 0.8*float64(len(samples)-1)
+	if memoryGrowing && !rs.memoryAlert {
+		alerts = append(alerts, fmt.Sprintf("Sustained memory growth: %.1f MB to %.1f MB (%.1f MB/min)",
+			first.MemoryMB, last.MemoryMB, growthRate))
+	}
+	rs.memoryAlert = memoryGrowing
+
+	// FD leak: descriptors only ever accumulate over the window
+	fdLeaking := last.OpenFiles-first.OpenFiles >= config.FDLeakThreshold
+	for i := 1; i < len(samples) && fdLeaking; i++ {
+		if samples[i].OpenFiles < samples[i-1].OpenFiles {
+			fdLeaking = false
+		}
+	}
+	if fdLeaking && !rs.fdAlert {
+		alerts = append(alerts, fmt.Sprintf("Possible file descriptor leak: %d to %d open files",
+			first.OpenFiles, last.OpenFiles))
+	}
+	rs.fdAlert = fdLeaking
+
+	// CPU pegging: every sample over the threshold
+	cpuPegged := true
+	for _, sample := range samples[1:] {
+		if sample.CPUPercent < config.CPUPegPercent {
+			cpuPegged = false
+			break
+		}
+	}
+	if cpuPegged && !rs.cpuAlert {
+		alerts = append(alerts, fmt.Sprintf("CPU pegged above %.0f%% for %s",
+			config.CPUPegPercent, last.Timestamp.Sub(first.Timestamp).Round(time.Second)))
+	}
+	rs.cpuAlert = cpuPegged
+
+	return alerts
+}
+
+// sampleResources periodically records resource usage of every running process
+func (pm *ProcessMonitor) sampleResources() {
+	if !procAvailable() {
+		log.Println("Resource sampling disabled: /proc is not available")
+		return
+	}
+
+	ticker := time.NewTicker(pm.config.MetricsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-pm.ctx.Done():
+			return
+		case <-ticker.C:
+			sampled := make(map[int]bool)
+			for _, process := range pm.GetMonitoredProcesses() {
+				for _, pid := range pm.sampleProcess(process) {
+					sampled[pid] = true
+				}
+			}
+			pm.sampler.Retain(sampled)
+		}
+	}
+}
+
+// sampleProcess records the usage of a process and its descendants and
+// returns the PIDs it read. The sampler keeps its own CPU baselines, so
+// ad-hoc inspections in between do not shorten the measured interval.
+func (pm *ProcessMonitor) sampleProcess(process *MonitoredProcess) []int {
+	process.mutex.RLock()
+	running := process.Status == "running" || process.Status == "unhealthy"
+	process.mutex.RUnlock()
+	if !running {
+		return nil
+	}
+
+	info, pids, err := pm.sampler.InspectTree(process.PID)
+	if err != nil {
+		return nil // Exited between listing and sampling
+	}
+
+	sample := ResourceSample{
+		Timestamp:  time.Now(),
+		CPUPercent: info.CPUPercent,
+		MemoryMB:   info.MemoryMB,
+		OpenFiles:  info.OpenFiles,
+		Threads:    info.Threads,
+	}
+
+	process.mutex.Lock()
+	process.resources.add(sample)
+	process.Resources = &sample
+	alerts := process.resources.detectResourceAlerts(pm.config)
+	process.mutex.Unlock()
+
+	for _, alert := range alerts {
+		streamError := StreamError{
+			ProcessID:  process.ID,
+			ProcessPID: process.PID,
+			Command:    process.Command,
+			ErrorType:  "resource",
+			Message:    alert,
+			Timestamp:  sample.Timestamp,
+			Severity:   "warning",
+			Context:    []string{},
+			Source:     "monitor",
+		}
+
+		pm.emitStreamError(streamError)
+	}
+
+	return pids
+}
+
+// GetProcessResources returns the resource series of a monitored process
+func (pm *ProcessMonitor) GetProcessResources(ref string) ([]ResourceSample, ResourceSummary, error) {
+	process, err := pm.ResolveProcess(ref)
+	if err != nil {
+		return nil, ResourceSummary{}, err
+	}
+
+	process.mutex.RLock()
+	defer process.mutex.RUnlock()
+
+	return append([]ResourceSample{}, process.resources.samples...), process.resources.summary(), nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// PTYWindowSize is the terminal size reported to a process running under a PTY
+type PTYWindowSize struct {
+	Cols uint16 `json:"cols"`
+	Rows uint16 `json:"rows"`
+}
+
+// OutputChunk is a piece of unprocessed process output, kept for replay
+type OutputChunk struct {
+	Timestamp time.Time `json:"timestamp"`
+	Source    string    `json:"source"` // stdout, stderr, pty
+	Data      string    `json:"data"`
+}
+
+// maxRawOutputBytes bounds the raw output retained per process
+const maxRawOutputBytes = 1 << 20
+
+var defaultPTYWindowSize = PTYWindowSize{Cols: 120, Rows: 40}
+
+// ansiPattern matches CSI, OSC and two-character escape sequences
+var ansiPattern = regexp.MustCompile(`\x1b(?:\[[0-?]*[ -/]*[@-~]|\][^\x07\x1b]*(?:\x07|\x1b\\)|[@-Z\\-_])`)
+
+// stripANSI removes terminal escape sequences from text
+func stripANSI(text string) string {
+	if !strings.ContainsRune(text, '\x1b') {
+		return text
+	}
+	return ansiPattern.ReplaceAllString(text, "")
+}
+
+// cleanTerminalLine turns a raw output line into what a terminal would show:
+// escapes removed and only the text after the last carriage return kept
+func cleanTerminalLine(line string) string {
+	line = stripANSI(strings.TrimRight(line, "\r"))
+	if idx := strings.LastIndexByte(line, '\r'); idx >= 0 {
+		line = line[idx+1:]
+	}
+	return line
+}
+
+// openPTY allocates a pseudo-terminal pair with the given window size
+func openPTY(size PTYWindowSize) (*os.File, *os.File, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open pty master: %w", err)
+	}
+
+	// Fd would switch the master to blocking mode and lose write deadlines
+	var number int
+	if err := controlFile(master, func(fd int) error {
+		if err := unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+			return fmt.Errorf("failed to unlock pty: %w", err)
+		}
+		var err error
+		if number, err = unix.IoctlGetInt(fd, unix.TIOCGPTN); err != nil {
+			return fmt.Errorf("failed to get pty number: %w", err)
+		}
+		return nil
+	}); err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+
+	slave, err := os.OpenFile(fmt.Sprintf("/dev/pts/%d", number), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("failed to open pty slave: %w", err)
+	}
+
+	if err := controlFile(master, func(fd int) error {
+		return unix.IoctlSetWinsize(fd, unix.TIOCSWINSZ, &unix.Winsize{Col: size.Cols, Row: size.Rows})
+	}); err != nil {
+		master.Close()
+		slave.Close()
+		return nil, nil, fmt.Errorf("failed to set pty window size: %w", err)
+	}
+
+	return master, slave, nil
+}
+
+// controlFile runs fn with the descriptor of f without taking it out of
+// non-blocking mode, as f.Fd would
+func controlFile(f *os.File, fn func(fd int) error) error {
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var fnErr error
+	if err := conn.Control(func(fd uintptr) { fnErr = fn(int(fd)) }); err != nil {
+		return err
+	}
+	return fnErr
+}
+
+// ptyProcAttr makes the process a session leader with the PTY as its
+// controlling terminal; as session leader it also leads its own process group
+func ptyProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true, Setctty: true, Ctty: 0}
+}
+
+// isPTYClosed reports whether a read error means the terminal's last writer exited
+func isPTYClosed(err error) bool {
+	return errors.Is(err, syscall.EIO)
+}
+
+// rawOutputRecorder copies everything read from a process stream into its raw output
+// and forwards it to attached clients and prompt detection
+type rawOutputRecorder struct {
+	monitor    *ProcessMonitor
+	process    *MonitoredProcess
+	source     string
+	pending    string // unterminated last line
+	lastPrompt string
+	generation uint64      // scans so far, to tell whether output arrived during a quiet period
+	quiet      *time.Timer // checks the unterminated line once output pauses
+	mutex      sync.Mutex
+}
+
+func (r *rawOutputRecorder) Write(data []byte) (int, error) {
+	p := r.process
+	chunk := OutputChunk{
+		Timestamp: time.Now(),
+		Source:    r.source,
+		Data:      string(data),
+	}
+
+	p.mutex.Lock()
+	p.rawOutput = append(p.rawOutput, chunk)
+	p.rawBytes += len(data)
+
+	for p.rawBytes > maxRawOutputBytes && len(p.rawOutput) > 1 {
+		p.rawBytes -= len(p.rawOutput[0].Data)
+		p.rawOutput = p.rawOutput[1:]
+	}
+	p.mutex.Unlock()
+
+	if p.recording != nil {
+		p.recording.Output(r.source, data)
+	}
+
+	p.publish(ProcessIOEvent{Type: "output", Chunk: &chunk})
+	r.scanForPrompts(data)
+
+	return len(data), nil
+}
+
+// GetProcessRawOutput returns the unprocessed output of a process, escapes included
+func (pm *ProcessMonitor) GetProcessRawOutput(ref string) ([]OutputChunk, error) {
+	process, err := pm.ResolveProcess(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	process.mutex.RLock()
+	defer process.mutex.RUnlock()
+
+	return append([]OutputChunk{}, process.rawOutput...), nil
+}
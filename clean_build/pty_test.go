@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func TestCleanTerminalLine(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{"plain", "server listening on :8080", "server listening on :8080"},
+		{"colors", "\x1b[1;31merror\x1b[0m: boom", "error: boom"},
+		{"256 colors", "\x1b[38;5;208mwarn\x1b[39m", "warn"},
+		{"hidden cursor", "\x1b[?25lcompiling\x1b[?25h", "compiling"},
+		{"osc title with bell", "\x1b]0;vite\x07ready", "ready"},
+		{"osc hyperlink", "see \x1b]8;;http://localhost:5173\x1b\\link\x1b]8;;\x1b\\", "see link"},
+		{"two character escape", "\x1bMscrolled", "scrolled"},
+		{"line ending", "done\r", "done"},
+		{"line endings", "done\r\r", "done"},
+		{"progress redraw", "10%\r20%\r30%", "30%"},
+		{"colored redraw", "\x1b[32m10%\x1b[0m\r\x1b[32m100%\x1b[0m", "100%"},
+		{"redraw then erase", "building...\r\x1b[K", ""},
+		{"redraw ending in carriage return", "step 1\rstep 2\r", "step 2"},
+		{"empty", "", ""},
+	}
+
+	for _, tt := range tests {
+		if got := cleanTerminalLine(tt.line); got != tt.want {
+			t.Errorf("%s: cleanTerminalLine(%q) = %q, want %q", tt.name, tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestStripANSIKeepsPlainText(t *testing.T) {
+	text := "no escapes here [31m, just brackets\r"
+	if got := stripANSI(text); got != text {
+		t.Errorf("stripANSI(%q) = %q, want it unchanged", text, got)
+	}
+}
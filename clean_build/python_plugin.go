@@ -620,13 +620,8 @@ func (pp *PythonPlugin) FindServices(projectPath string) ([]ServiceInfo, error)
 			Language:  "python",
 			Framework: framework,
 			Port:      pp.getFrameworkDefaultPort(framework),
-			Status:    "stopped",
-		}
-
-		// Check if service is running
-		if isPortInUse(service.Port) {
-			service.Status = "running"
 		}
+		applyPortStatus(&service)
 
 		services = append(services, service)
 	}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// RecordingInfo describes the asciicast recording of one process run
+type RecordingInfo struct {
+	Name      string    `json:"name"`
+	ProcessID string    `json:"process_id"`
+	PID       int       `json:"pid"`
+	StartTime time.Time `json:"start_time"`
+	SizeBytes int64     `json:"size_bytes"`
+	Modified  time.Time `json:"modified"`
+}
+
+// asciicastHeader is the first line of an asciicast v2 file
+type asciicastHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Command   string            `json:"command,omitempty"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// asciicastEvent is one timed piece of output ("o") or input ("i")
+type asciicastEvent struct {
+	Offset float64
+	Type   string
+	Data   string
+}
+
+// ProcessRecording writes a process run's terminal session as asciicast v2
+type ProcessRecording struct {
+	path      string
+	file      *bufio.Writer
+	handle    *os.File
+	start     time.Time
+	size      int64
+	maxSize   int64
+	partial   map[string][]byte // incomplete UTF-8 sequence at the end of each stream
+	truncated bool
+	closed    bool
+	mutex     sync.Mutex
+}
+
+// RecordingStore owns the asciicast recordings under .argus/recordings
+type RecordingStore struct {
+	dir       string
+	maxSize   int64
+	retention time.Duration
+}
+
+// recordingNamePattern matches "<id>-<pid>-<start>.cast"
+var recordingNamePattern = regexp.MustCompile(`^(p-[0-9a-f]{8})-(\d+)-(\d{8}T\d{6})\.cast$`)
+
+// NewRecordingStore creates a recording store in dir
+func NewRecordingStore(dir string, config *ProcessMonitorConfig) *RecordingStore {
+	return &RecordingStore{
+		dir:       dir,
+		maxSize:   config.RecordingMaxSizeMB * 1024 * 1024,
+		retention: config.LogRetention,
+	}
+}
+
+// Open starts the recording of a new process run
+func (rs *RecordingStore) Open(process *MonitoredProcess, size PTYWindowSize) (*ProcessRecording, error) {
+	if err := os.MkdirAll(rs.dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create recording directory: %w", err)
+	}
+
+	name := fmt.Sprintf("%s-%d-%s.cast", process.ID, process.PID, process.StartTime.UTC().Format("20060102T150405"))
+	path := filepath.Join(rs.dir, name)
+	handle, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	title := process.ID
+	if process.Name != "" {
+		title = process.Name
+	}
+	header, _ := json.Marshal(asciicastHeader{
+		Version:   2,
+		Width:     int(size.Cols),
+		Height:    int(size.Rows),
+		Timestamp: process.StartTime.Unix(),
+		Command:   strings.Join(append([]string{process.Command}, process.Args...), " "),
+		Title:     title,
+		Env:       map[string]string{"TERM": "xterm-256color", "SHELL": os.Getenv("SHELL")},
+	})
+
+	recording := &ProcessRecording{
+		path:    path,
+		file:    bufio.NewWriter(handle),
+		handle:  handle,
+		start:   process.StartTime,
+		maxSize: rs.maxSize,
+		partial: make(map[string][]byte),
+	}
+	recording.file.Write(append(header, '\n'))
+	recording.size = int64(len(header) + 1)
+
+	return recording, nil
+}
+
+// Output records process output from one stream
+func (r *ProcessRecording) Output(source string, data []byte) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// A read can end inside a multi-byte character; hold it for the next one
+	data = append(r.partial[source], data...)
+	complete := validUTF8Prefix(data)
+	r.partial[source] = append([]byte{}, data[complete:]...)
+
+	r.writeEvent("o", data[:complete])
+}
+
+// Input records data written to the process's stdin
+func (r *ProcessRecording) Input(data []byte) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.writeEvent("i", data)
+}
+
+// writeEvent appends an event line; the caller holds the lock
+func (r *ProcessRecording) writeEvent(eventType string, data []byte) {
+	if r.closed || r.truncated || len(data) == 0 {
+		return
+	}
+
+	offset := time.Since(r.start).Seconds()
+	line, err := json.Marshal([]interface{}{json.Number(strconv.FormatFloat(offset, 'f', 6, 64)), eventType, string(data)})
+	if err != nil {
+		return
+	}
+
+	if r.maxSize > 0 && r.size+int64(len(line))+1 > r.maxSize {
+		r.truncated = true
+		log.Printf("Recording %s reached its size limit, stopped recording", filepath.Base(r.path))
+		return
+	}
+
+	r.file.Write(append(line, '\n'))
+	r.size += int64(len(line)) + 1
+
+	// Flush output events promptly so a running session can be downloaded
+	r.file.Flush()
+}
+
+// Close finishes the recording
+func (r *ProcessRecording) Close() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.closed {
+		return
+	}
+	for source, rest := range r.partial {
+		r.writeEvent("o", []byte(strings.ToValidUTF8(string(rest), "�")))
+		delete(r.partial, source)
+	}
+	r.closed = true
+	r.file.Flush()
+	r.handle.Close()
+}
+
+// validUTF8Prefix returns the length of data without a trailing incomplete
+// UTF-8 sequence; invalid bytes elsewhere are left to the JSON encoder
+func validUTF8Prefix(data []byte) int {
+	for back := 1; back <= utf8.UTFMax-1 && back <= len(data); back++ {
+		start := len(data) - back
+		if !utf8.RuneStart(data[start]) {
+			continue
+		}
+		if !utf8.FullRune(data[start:]) {
+			return start
+		}
+		break
+	}
+	return len(data)
+}
+
+// List returns the recordings of a process, newest first
+func (rs *RecordingStore) List(processID string) []RecordingInfo {
+	entries, err := os.ReadDir(rs.dir)
+	if err != nil {
+		return []RecordingInfo{}
+	}
+
+	list := []RecordingInfo{}
+	for _, entry := range entries {
+		match := recordingNamePattern.FindStringSubmatch(entry.Name())
+		if match == nil || match[1] != processID {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		pid, _ := strconv.Atoi(match[2])
+		start, _ := time.Parse("20060102T150405", match[3])
+		list = append(list, RecordingInfo{
+			Name:      entry.Name(),
+			ProcessID: match[1],
+			PID:       pid,
+			StartTime: start,
+			SizeBytes: info.Size(),
+			Modified:  info.ModTime(),
+		})
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Name > list[j].Name })
+	return list
+}
+
+// Path returns the file of a process's recording; names that do not belong
+// to the process are rejected
+func (rs *RecordingStore) Path(processID, name string) (string, error) {
+	match := recordingNamePattern.FindStringSubmatch(name)
+	if match == nil || match[1] != processID {
+		return "", fmt.Errorf("recording %s not found for process %s", name, processID)
+	}
+
+	path := filepath.Join(rs.dir, name)
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("recording %s not found for process %s", name, processID)
+	}
+	return path, nil
+}
+
+// Prune removes recordings untouched for longer than the log retention
+func (rs *RecordingStore) Prune() {
+	entries, err := os.ReadDir(rs.dir)
+	if err != nil {
+		return
+	}
+
+	cutoff := time.Now().Add(-rs.retention)
+	for _, entry := range entries {
+		if !recordingNamePattern.MatchString(entry.Name()) {
+			continue
+		}
+		if info, err := entry.Info(); err == nil && info.ModTime().Before(cutoff) {
+			os.Remove(filepath.Join(rs.dir, entry.Name()))
+		}
+	}
+}
+
+// readRecording parses an asciicast v2 file
+func readRecording(path string) (*asciicastHeader, []asciicastEvent, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	if !scanner.Scan() {
+		return nil, nil, errors.New("recording is empty")
+	}
+
+	var header asciicastHeader
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil || header.Version != 2 {
+		return nil, nil, errors.New("not an asciicast v2 recording")
+	}
+
+	events := []asciicastEvent{}
+	for scanner.Scan() {
+		var fields []interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &fields); err != nil || len(fields) != 3 {
+			continue // Skip corrupt lines
+		}
+		offset, ok1 := fields[0].(float64)
+		eventType, ok2 := fields[1].(string)
+		data, ok3 := fields[2].(string)
+		if ok1 && ok2 && ok3 {
+			events = append(events, asciicastEvent{Offset: offset, Type: eventType, Data: data})
+		}
+	}
+
+	return &header, events, scanner.Err()
+}
+
+// replayRecording runs the output of a recording through an error matcher
+// the way monitorProcessOutput handles live output. Errors are timestamped
+// at their original time in the session, to the second of the header.
+func replayRecording(header *asciicastHeader, events []asciicastEvent, processID string, matcher *ErrorMatcher) []StreamError {
+	start := time.Unix(header.Timestamp, 0)
+	found := []StreamError{}
+	contextLines := make([]string, 0, 5)
+	pending := ""
+
+	for _, event := range events {
+		if event.Type != "o" {
+			continue
+		}
+
+		lines := strings.Split(pending+event.Data, "\n")
+		pending = lines[len(lines)-1]
+		for _, raw := range lines[:len(lines)-1] {
+			line := cleanTerminalLine(raw)
+			contextLines = append(contextLines, line)
+			if len(contextLines) > 5 {
+				contextLines = contextLines[1:]
+			}
+
+			match := matcher.Match(line, contextLines)
+			if match == nil {
+				continue
+			}
+			found = append(found, StreamError{
+				ProcessID: processID,
+				Command:   header.Command,
+				ErrorType: match.ErrorType,
+				Message:   line,
+				Timestamp: start.Add(time.Duration(event.Offset * float64(time.Second))),
+				Severity:  match.Severity,
+				Context:   append([]string{}, contextLines...),
+				Source:    "replay",
+				Language:  match.Language,
+				File:      match.File,
+				Line:      match.Line,
+				Column:    match.Column,
+			})
+		}
+	}
+
+	return found
+}
+
+// closeRecording finishes a run's recording once its output has been read
+func (p *MonitoredProcess) closeRecording() {
+	if p.recording == nil {
+		return
+	}
+
+	p.waitOutputReaders(outputDrainTimeout)
+	p.recording.Close()
+}
+
+// waitOutputReaders waits until the output of a run has been read to the
+// end, or until timeout when descendants still hold the pipes open
+func (p *MonitoredProcess) waitOutputReaders(timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		p.outputReaders.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+	}
+}
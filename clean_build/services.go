@@ -0,0 +1,431 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// servicesFileName is the declarative services file in the workspace root
+const servicesFileName = "argus-services.json"
+
+// ServiceDefinition declares a named service in the services file
+type ServiceDefinition struct {
+	Command     string            `json:"command"`
+	Args        []string          `json:"args"`
+	Cwd         string            `json:"cwd"` // relative to the workspace
+	Env         map[string]string `json:"env"`
+	EnvFiles    []string          `json:"env_files,omitempty"` // relative to cwd
+	EnvProfile  string            `json:"env_profile,omitempty"`
+	CleanEnv    bool              `json:"clean_env,omitempty"`
+	DependsOn   []string          `json:"depends_on"`
+	AutoRestart bool              `json:"auto_restart"`
+	PTY         bool              `json:"pty"`
+	Stdin       bool              `json:"stdin,omitempty"` // accept input through the input endpoints
+	Ready       *ReadinessProbe   `json:"ready,omitempty"`
+	Liveness    *LivenessProbe    `json:"liveness,omitempty"`
+	Timeout     string            `json:"timeout,omitempty"` // services run until stopped unless set
+	Limits      *ResourceLimits   `json:"limits,omitempty"`
+}
+
+// ReadinessProbe decides when a started service can accept work; exactly one
+// of Port, HTTP or Log should be set
+type ReadinessProbe struct {
+	Port    int    `json:"port,omitempty"`    // TCP port accepts connections
+	HTTP    string `json:"http,omitempty"`    // URL answers 200
+	Log     string `json:"log,omitempty"`     // output line matches regex
+	Timeout string `json:"timeout,omitempty"` // default 60s
+}
+
+// ServicesFile is the parsed services file
+type ServicesFile struct {
+	Services map[string]ServiceDefinition `json:"services"`
+}
+
+// ServiceResult reports what happened to one service during up or down
+type ServiceResult struct {
+	Name       string `json:"name"`
+	ID         string `json:"id,omitempty"`
+	Status     string `json:"status"` // ready, started, already_running, stopped, not_running, failed, skipped
+	PID        int    `json:"pid,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// ServiceManager starts and stops the services declared in the workspace
+type ServiceManager struct {
+	workspace string
+	monitor   *ProcessMonitor
+}
+
+// NewServiceManager creates a service manager on top of the process monitor
+func NewServiceManager(workspace string, monitor *ProcessMonitor) *ServiceManager {
+	return &ServiceManager{workspace: workspace, monitor: monitor}
+}
+
+// Load reads and validates the services file
+func (sm *ServiceManager) Load() (*ServicesFile, error) {
+	data, err := os.ReadFile(filepath.Join(sm.workspace, servicesFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("no %s in workspace", servicesFileName)
+		}
+		return nil, err
+	}
+
+	var file ServicesFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", servicesFileName, err)
+	}
+
+	for name, service := range file.Services {
+		if service.Command == "" {
+			return nil, fmt.Errorf("service %s has no command", name)
+		}
+		for _, dep := range service.DependsOn {
+			if _, exists := file.Services[dep]; !exists {
+				return nil, fmt.Errorf("service %s depends on unknown service %s", name, dep)
+			}
+		}
+		if service.Ready != nil && service.Ready.Log != "" {
+			if _, err := regexp.Compile(service.Ready.Log); err != nil {
+				return nil, fmt.Errorf("service %s has an invalid log readiness pattern: %w", name, err)
+			}
+		}
+	}
+
+	return &file, nil
+}
+
+// startOrder returns the requested services and their dependencies,
+// dependencies first; an empty request selects every service
+func (sf *ServicesFile) startOrder(requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		for name := range sf.Services {
+			requested = append(requested, name)
+		}
+	}
+	sort.Strings(requested)
+
+	order := []string{}
+	state := make(map[string]int) // 1 visiting, 2 done
+
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		service, exists := sf.Services[name]
+		if !exists {
+			return fmt.Errorf("unknown service %s", name)
+		}
+
+		switch state[name] {
+		case 1:
+			return fmt.Errorf("dependency cycle: %v", append(path, name))
+		case 2:
+			return nil
+		}
+
+		state[name] = 1
+		deps := append([]string{}, service.DependsOn...)
+		sort.Strings(deps)
+		for _, dep := range deps {
+			if err := visit(dep, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = 2
+		order = append(order, name)
+		return nil
+	}
+
+	for _, name := range requested {
+		if err := visit(name, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return order, nil
+}
+
+// findProcess returns the monitored process running a service
+func (sm *ServiceManager) findProcess(name string) *MonitoredProcess {
+	for _, process := range sm.monitor.GetMonitoredProcesses() {
+		process.mutex.RLock()
+		matches := process.Service == name && !process.ended()
+		process.mutex.RUnlock()
+		if matches {
+			return process
+		}
+	}
+	return nil
+}
+
+// Up starts services in dependency order, waiting for each to become ready.
+// A failure stops the rollout since dependents could not work anyway.
+func (sm *ServiceManager) Up(requested []string) ([]ServiceResult, error) {
+	file, err := sm.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	order, err := file.startOrder(requested)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []ServiceResult{}
+	var failure error
+
+	for _, name := range order {
+		if failure != nil {
+			results = append(results, ServiceResult{Name: name, Status: "skipped"})
+			continue
+		}
+
+		result := sm.startService(name, file.Services[name])
+		results = append(results, result)
+		if result.Status == "failed" {
+			failure = fmt.Errorf("service %s failed: %s", name, result.Error)
+		}
+	}
+
+	return results, failure
+}
+
+func (sm *ServiceManager) startService(name string, service ServiceDefinition) ServiceResult {
+	startTime := time.Now()
+	result := ServiceResult{Name: name}
+
+	// Cwd comes from a file in the workspace, so it must not lead out of it
+	workingDir := filepath.Join(sm.workspace, service.Cwd)
+	if !withinDir(sm.workspace, workingDir) {
+		result.Status = "failed"
+		result.Error = fmt.Sprintf("cwd %s is outside the workspace", service.Cwd)
+		return result
+	}
+
+	if process := sm.findProcess(name); process != nil {
+		result.Status = "already_running"
+		result.ID = process.ID
+		result.PID = process.PID
+		return result
+	}
+
+	timeout := service.Timeout
+	if timeout == "" {
+		timeout = "0"
+	}
+
+	process, err := sm.monitor.StartProcess(ProcessCommand{
+		Name:        name,
+		Command:     service.Command,
+		Args:        service.Args,
+		WorkingDir:  workingDir,
+		Environment: service.Env,
+		EnvFiles:    service.EnvFiles,
+		EnvProfile:  service.EnvProfile,
+		CleanEnv:    service.CleanEnv,
+		AutoRestart: service.AutoRestart,
+		PTY:         service.PTY,
+		Stdin:       service.Stdin,
+		Service:     name,
+		Liveness:    service.Liveness,
+		Timeout:     timeout,
+		Limits:      service.Limits,
+	})
+	if err != nil {
+		result.Status = "failed"
+		result.Error = err.Error()
+		return result
+	}
+	result.ID = process.ID
+	result.PID = process.PID
+
+	result.Status = "started"
+	if service.Ready != nil {
+		if err := sm.waitReady(name, service.Ready); err != nil {
+			result.Status = "failed"
+			result.Error = err.Error()
+		} else {
+			result.Status = "ready"
+		}
+	}
+
+	result.DurationMs = time.Since(startTime).Milliseconds()
+	log.Printf("Service %s %s in %dms", name, result.Status, result.DurationMs)
+	return result
+}
+
+// waitReady polls the readiness probe until it passes, the service dies or time runs out
+func (sm *ServiceManager) waitReady(name string, probe *ReadinessProbe) error {
+	timeout := 60 * time.Second
+	if probe.Timeout != "" {
+		if parsed, err := time.ParseDuration(probe.Timeout); err == nil {
+			timeout = parsed
+		}
+	}
+
+	var logPattern *regexp.Regexp
+	if probe.Log != "" {
+		logPattern = regexp.MustCompile(probe.Log) // Validated in Load
+	}
+
+	client := &http.Client{Timeout: 2 * time.Second}
+	deadline := time.Now().Add(timeout)
+	var watched *MonitoredProcess
+	var lastSeq uint64 // Only lines not yet matched against the log pattern
+
+	for time.Now().Before(deadline) {
+		process := sm.findProcess(name)
+		if process == nil {
+			return errors.New("process exited before becoming ready")
+		}
+
+		switch {
+		case probe.Port > 0:
+			conn, err := net.DialTimeout("tcp", net.JoinHostPort("localhost", strconv.Itoa(probe.Port)), time.Second)
+			if err == nil {
+				conn.Close()
+				return nil
+			}
+		case probe.HTTP != "":
+			if resp, err := client.Get(probe.HTTP); err == nil {
+				resp.Body.Close()
+				if resp.StatusCode == http.StatusOK {
+					return nil
+				}
+			}
+		case logPattern != nil:
+			if process != watched {
+				watched, lastSeq = process, 0 // A restart starts a new run
+			}
+			lines, latest := process.OutputSince(lastSeq)
+			for _, line := range lines {
+				if logPattern.MatchString(line.Line) {
+					return nil
+				}
+			}
+			lastSeq = latest
+		default:
+			return nil
+		}
+
+		time.Sleep(250 * time.Millisecond)
+	}
+
+	return fmt.Errorf("not ready after %v", timeout)
+}
+
+// Down stops services in reverse dependency order
+func (sm *ServiceManager) Down(requested []string) ([]ServiceResult, error) {
+	file, err := sm.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	order, err := file.startOrder(requested)
+	if err != nil {
+		return nil, err
+	}
+
+	// Stopping a dependency also stops what depends on it
+	if len(requested) > 0 {
+		order = file.withDependents(order)
+	}
+
+	results := []ServiceResult{}
+	for i := len(order) - 1; i >= 0; i-- {
+		name := order[i]
+		result := ServiceResult{Name: name, Status: "not_running"}
+		startTime := time.Now()
+
+		if process := sm.findProcess(name); process != nil {
+			result.ID = process.ID
+			result.PID = process.PID
+			if err := sm.monitor.StopProcess(process.ID); err != nil {
+				result.Status = "failed"
+				result.Error = err.Error()
+			} else {
+				result.Status = "stopped"
+			}
+		}
+
+		result.DurationMs = time.Since(startTime).Milliseconds()
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// withDependents extends a start order with every service depending on it
+func (sf *ServicesFile) withDependents(order []string) []string {
+	selected := make(map[string]bool)
+	for _, name := range order {
+		selected[name] = true
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for name, service := range sf.Services {
+			if selected[name] {
+				continue
+			}
+			for _, dep := range service.DependsOn {
+				if selected[dep] {
+					selected[name] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+
+	names := []string{}
+	for name := range selected {
+		names = append(names, name)
+	}
+
+	full, _ := sf.startOrder(names) // Already validated
+	return full
+}
+
+// Status lists every declared service with its running process
+func (sm *ServiceManager) Status() ([]map[string]interface{}, error) {
+	file, err := sm.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	order, err := file.startOrder(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	services := []map[string]interface{}{}
+	for _, name := range order {
+		entry := map[string]interface{}{
+			"name":       name,
+			"definition": file.Services[name],
+			"status":     "stopped",
+		}
+		if process := sm.findProcess(name); process != nil {
+			process.mutex.RLock()
+			entry["status"] = process.Status
+			entry["id"] = process.ID
+			entry["pid"] = process.PID
+			entry["start_time"] = process.StartTime
+			process.mutex.RUnlock()
+		}
+		services = append(services, entry)
+	}
+
+	return services, nil
+}
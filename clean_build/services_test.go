@@ -0,0 +1,86 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStartOrder(t *testing.T) {
+	services := func(deps map[string][]string) *ServicesFile {
+		file := &ServicesFile{Services: map[string]ServiceDefinition{}}
+		for name, dependsOn := range deps {
+			file.Services[name] = ServiceDefinition{Command: "true", DependsOn: dependsOn}
+		}
+		return file
+	}
+
+	tests := []struct {
+		name      string
+		deps      map[string][]string
+		requested []string
+		want      []string
+		wantErr   string
+	}{
+		{
+			name: "dependencies first",
+			deps: map[string][]string{"web": {"api"}, "api": {"db", "cache"}, "db": nil, "cache": nil},
+			want: []string{"cache", "db", "api", "web"},
+		},
+		{
+			name:      "only what was requested",
+			deps:      map[string][]string{"web": {"api"}, "api": {"db"}, "db": nil, "worker": {"db"}},
+			requested: []string{"api"},
+			want:      []string{"db", "api"},
+		},
+		{
+			name:      "shared dependency once",
+			deps:      map[string][]string{"a": {"db"}, "b": {"db"}, "db": nil},
+			requested: []string{"b", "a"},
+			want:      []string{"db", "a", "b"},
+		},
+		{
+			name:    "self cycle",
+			deps:    map[string][]string{"a": {"a"}},
+			wantErr: "dependency cycle: [a a]",
+		},
+		{
+			name:    "indirect cycle",
+			deps:    map[string][]string{"a": {"b"}, "b": {"c"}, "c": {"a"}},
+			wantErr: "dependency cycle: [a b c a]",
+		},
+		{
+			name:      "unknown service",
+			deps:      map[string][]string{"a": nil},
+			requested: []string{"b"},
+			wantErr:   "unknown service b",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order, err := services(tt.deps).startOrder(tt.requested)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("startOrder() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(order, tt.want) {
+				t.Errorf("startOrder() = %v, want %v", order, tt.want)
+			}
+		})
+	}
+}
+
+func TestStartServiceConfinesCwd(t *testing.T) {
+	sm := NewServiceManager(t.TempDir(), nil)
+
+	result := sm.startService("escape", ServiceDefinition{Command: "true", Cwd: "../.."})
+	if result.Status != "failed" || !strings.Contains(result.Error, "outside the workspace") {
+		t.Errorf("startService with cwd ../.. = %+v, want failed outside the workspace", result)
+	}
+}
@@ -83,7 +83,7 @@ type Finding struct {
 
 // Evidence represents supporting data for findings
 type Evidence struct {
-	Type      string    `json:"type"`    // code, log, metric, observation
+	Type      string    `json:"type"`    // code, log, metric, observation, recording
 	Source    string    `json:"source"`  // file path, API endpoint, etc.
 	Content   string    `json:"content"` // The actual evidence
 	Timestamp time.Time `json:"timestamp"`
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// InputPrompt is output that looks like the process is waiting for input
+type InputPrompt struct {
+	Text      string    `json:"text"`
+	Kind      string    `json:"kind"`           // key, continue, confirm, secret, input
+	Keys      []string  `json:"keys,omitempty"` // suggested answers
+	Source    string    `json:"source"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// ProcessIOEvent is sent to clients attached to a process's terminal
+type ProcessIOEvent struct {
+	Type     string       `json:"type"` // output, prompt, exit
+	Chunk    *OutputChunk `json:"chunk,omitempty"`
+	Prompt   *InputPrompt `json:"prompt,omitempty"`
+	ExitCode *int         `json:"exit_code,omitempty"`
+}
+
+// maxPendingPromptBytes bounds the unterminated output line kept for prompt detection
+const maxPendingPromptBytes = 4096
+
+// promptQuietPeriod is how long output must pause before an unterminated
+// line counts as a prompt, so lines arriving in pieces are not reported
+const promptQuietPeriod = 300 * time.Millisecond
+
+// inputWriteTimeout bounds a write to a process that is not reading its stdin
+const inputWriteTimeout = 5 * time.Second
+
+var (
+	errInputBusy    = errors.New("another write to stdin is in progress")
+	errInputTimeout = errors.New("process is not reading its stdin")
+)
+
+// processInput is the write end of a process's stdin
+type processInput interface {
+	io.WriteCloser
+	SetWriteDeadline(t time.Time) error
+}
+
+var (
+	// promptPatterns recognise prompts on complete lines and on partial lines
+	promptPatterns = []struct {
+		kind    string
+		pattern *regexp.Regexp
+	}{
+		{"confirm", regexp.MustCompile(`(?i)[\[(]\s*y(?:es)?\s*/\s*n(?:o)?\s*[\])]`)},
+		{"continue", regexp.MustCompile(`(?i)\bpress\s+(?:any\s+key|enter|return)\b`)},
+		{"key", regexp.MustCompile(`(?i)\bpress\s+\[?[a-z0-9]\]?\s+(?:\+\s*enter\s+)?to\b`)},
+		{"secret", regexp.MustCompile(`(?i)\b(?:password|passphrase|passcode)\b[^:]*:\s*$`)},
+		{"input", regexp.MustCompile(`(?i)^\s*(?:\?\s+\S|(?:please\s+)?(?:enter|type|choose|select)\b).*[:?]\s*$`)},
+	}
+
+	// partialPromptPattern matches an unterminated line the process stopped at,
+	// such as a REPL prompt or a question without a newline
+	partialPromptPattern = regexp.MustCompile(`[?:>]\s*$`)
+
+	// promptKeyPattern extracts the keys offered by "press r to restart, q to quit"
+	promptKeyPattern = regexp.MustCompile(`(?i)(?:^|press\s+|,\s*|\s)\[?([a-z0-9])\]?(?:\s*\+\s*enter)?\s+to\s+\w`)
+)
+
+// detectPrompt classifies a line of output as a prompt; partial lines are
+// unterminated output the process may be waiting at
+func detectPrompt(line string, partial bool) *InputPrompt {
+	line = strings.TrimSpace(cleanTerminalLine(line))
+	if line == "" {
+		return nil
+	}
+
+	for _, candidate := range promptPatterns {
+		if candidate.pattern.MatchString(line) {
+			return &InputPrompt{Text: line, Kind: candidate.kind, Keys: promptKeys(candidate.kind, line)}
+		}
+	}
+
+	if partial && partialPromptPattern.MatchString(line) {
+		return &InputPrompt{Text: line, Kind: "input"}
+	}
+
+	return nil
+}
+
+func promptKeys(kind, line string) []string {
+	switch kind {
+	case "confirm":
+		return []string{"y", "n"}
+	case "continue":
+		return []string{"\n"}
+	case "key":
+		keys := []string{}
+		for _, match := range promptKeyPattern.FindAllStringSubmatch(line, -1) {
+			keys = append(keys, strings.ToLower(match[1]))
+		}
+		return keys
+	}
+	return nil
+}
+
+// ptyInput writes to the terminal master; closing it sends end-of-file
+// (Ctrl-D) to the process rather than closing the terminal
+type ptyInput struct {
+	master *os.File
+}
+
+func (p *ptyInput) Write(data []byte) (int, error) {
+	return p.master.Write(data)
+}
+
+func (p *ptyInput) Close() error {
+	_, err := p.master.Write([]byte{0x04})
+	return err
+}
+
+func (p *ptyInput) SetWriteDeadline(t time.Time) error {
+	return p.master.SetWriteDeadline(t)
+}
+
+// scanForPrompts feeds raw output to prompt detection, keeping the trailing
+// unterminated line until it is completed. The unterminated line is only
+// checked once output has been quiet for promptQuietPeriod.
+func (r *rawOutputRecorder) scanForPrompts(data []byte) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	text := r.pending + string(data)
+	lines := strings.Split(text, "\n")
+	r.pending = lines[len(lines)-1]
+	if len(r.pending) > maxPendingPromptBytes {
+		r.pending = r.pending[len(r.pending)-maxPendingPromptBytes:]
+	}
+
+	for _, line := range lines[:len(lines)-1] {
+		prompt := detectPrompt(line, false)
+		if prompt != nil && prompt.Text == r.lastPrompt {
+			continue // Already reported while the line was partial
+		}
+		r.lastPrompt = ""
+		if prompt != nil {
+			r.monitor.reportPrompt(r.process, prompt, r.source)
+		}
+	}
+
+	r.generation++
+	if r.quiet != nil {
+		r.quiet.Stop()
+	}
+	if strings.TrimSpace(r.pending) != "" {
+		generation := r.generation
+		r.quiet = time.AfterFunc(promptQuietPeriod, func() { r.checkPendingPrompt(generation) })
+	}
+}
+
+// checkPendingPrompt reports the unterminated line as a prompt if no output
+// has arrived since the scan that started the quiet period
+func (r *rawOutputRecorder) checkPendingPrompt(generation uint64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if generation != r.generation {
+		return
+	}
+	select {
+	case <-r.process.exited:
+		return
+	default:
+	}
+
+	if prompt := detectPrompt(r.pending, true); prompt != nil && prompt.Text != r.lastPrompt {
+		r.lastPrompt = prompt.Text
+		r.monitor.reportPrompt(r.process, prompt, r.source)
+	}
+}
+
+// reportPrompt records a prompt as pending and tells attached clients and
+// error stream listeners that the process is waiting for input
+func (pm *ProcessMonitor) reportPrompt(process *MonitoredProcess, prompt *InputPrompt, source string) {
+	prompt.Source = source
+	prompt.Timestamp = time.Now()
+
+	process.mutex.Lock()
+	// Watch modes print one "press x to ..." line per key; keep them together
+	if pending := process.Prompt; pending != nil && pending.Kind == "key" && prompt.Kind == "key" &&
+		prompt.Timestamp.Sub(pending.Timestamp) < time.Second {
+		merged := *pending
+		merged.Text = pending.Text + "\n" + prompt.Text
+		merged.Keys = append(append([]string{}, pending.Keys...), prompt.Keys...)
+		prompt = &merged
+	}
+	process.Prompt = prompt
+	process.mutex.Unlock()
+
+	process.publish(ProcessIOEvent{Type: "prompt", Prompt: prompt})
+
+	pm.emitStreamError(StreamError{
+		ProcessID:  process.ID,
+		ProcessPID: process.PID,
+		Command:    process.Command,
+		ErrorType:  "input_required",
+		Message:    prompt.Text,
+		Timestamp:  prompt.Timestamp,
+		Severity:   "info",
+		Context:    append([]string{}, prompt.Keys...),
+		Source:     source,
+	})
+}
+
+// publish sends an event to attached clients, dropping it for clients that fall behind
+func (p *MonitoredProcess) publish(event ProcessIOEvent) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	for listener := range p.listeners {
+		select {
+		case listener <- event:
+		default:
+		}
+	}
+}
+
+// AttachProcess subscribes to a process's output and prompts; call the
+// returned function to detach
+func (pm *ProcessMonitor) AttachProcess(ref string) (*MonitoredProcess, <-chan ProcessIOEvent, func(), error) {
+	process, err := pm.ResolveProcess(ref)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	events := make(chan ProcessIOEvent, 256)
+
+	process.mutex.Lock()
+	if process.listeners == nil {
+		process.listeners = make(map[chan ProcessIOEvent]struct{})
+	}
+	process.listeners[events] = struct{}{}
+	process.mutex.Unlock()
+
+	detach := func() {
+		process.mutex.Lock()
+		delete(process.listeners, events)
+		process.mutex.Unlock()
+	}
+
+	return process, events, detach, nil
+}
+
+// WriteProcessInput writes data to the stdin of a monitored process and
+// clears its pending prompt
+func (pm *ProcessMonitor) WriteProcessInput(ref string, data string) (int, error) {
+	process, err := pm.ResolveProcess(ref)
+	if err != nil {
+		return 0, err
+	}
+
+	select {
+	case <-process.exited:
+		return 0, fmt.Errorf("process %s has exited", process.ID)
+	default:
+	}
+
+	// A separate lock: a child that stops reading must not block output
+	// handling, and a write that is stuck must not queue up the next ones
+	if !process.inputMutex.TryLock() {
+		return 0, errInputBusy
+	}
+	defer process.inputMutex.Unlock()
+
+	if process.stdin == nil {
+		return 0, fmt.Errorf("process %s has no open stdin", process.ID)
+	}
+
+	if err := process.stdin.SetWriteDeadline(time.Now().Add(inputWriteTimeout)); err != nil {
+		log.Printf("Stdin of process %s does not support write deadlines: %v", process.ID, err)
+	}
+	n, err := process.stdin.Write([]byte(data))
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return n, errInputTimeout
+	}
+	if err != nil {
+		return n, fmt.Errorf("failed to write to process %s: %w", process.ID, err)
+	}
+
+	// Answers to password prompts stay out of recordings
+	secret := process.awaitingSecret()
+	if process.recording != nil && !secret {
+		process.recording.Input([]byte(data[:n]))
+	}
+
+	// A secret may be typed a key at a time, so it is answered by a line end
+	process.mutex.Lock()
+	if !secret || strings.ContainsAny(data[:n], "\r\n") {
+		process.Prompt = nil
+	}
+	process.mutex.Unlock()
+
+	return n, nil
+}
+
+// awaitingSecret reports whether the process is waiting for a password,
+// either as a reported prompt or as output still in its quiet period
+func (p *MonitoredProcess) awaitingSecret() bool {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	if p.Prompt != nil && p.Prompt.Kind == "secret" {
+		return true
+	}
+
+	// The unterminated end of the output, as prompt detection will see it
+	tail := ""
+	for i := len(p.rawOutput) - 1; i >= 0 && len(tail) < maxPendingPromptBytes; i-- {
+		data := p.rawOutput[i].Data
+		if newline := strings.LastIndexByte(data, '\n'); newline >= 0 {
+			tail = data[newline+1:] + tail
+			break
+		}
+		tail = data + tail
+	}
+
+	prompt := detectPrompt(tail, true)
+	return prompt != nil && prompt.Kind == "secret"
+}
+
+// closeInputPipe releases the stdin pipe of a run that has exited; a
+// terminal's master is closed by its output reader instead
+func (p *MonitoredProcess) closeInputPipe() {
+	p.inputMutex.Lock()
+	defer p.inputMutex.Unlock()
+
+	if p.stdin != nil && !p.spec.PTY {
+		p.stdin.Close()
+	}
+	p.stdin = nil
+}
+
+// CloseProcessInput signals end-of-file on the stdin of a monitored process
+func (pm *ProcessMonitor) CloseProcessInput(ref string) error {
+	process, err := pm.ResolveProcess(ref)
+	if err != nil {
+		return err
+	}
+
+	process.inputMutex.Lock()
+	defer process.inputMutex.Unlock()
+
+	if process.stdin == nil {
+		return nil
+	}
+
+	err = process.stdin.Close()
+	if !process.spec.PTY {
+		process.stdin = nil // A terminal can receive end-of-file more than once
+	}
+	if err != nil {
+		log.Printf("Failed to close stdin of process %s: %v", process.ID, err)
+	}
+	return err
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"io"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDetectPrompt(t *testing.T) {
+	tests := []struct {
+		line    string
+		partial bool
+		kind    string
+		keys    []string
+	}{
+		{"Apply migration? [y/N]", false, "confirm", []string{"y", "n"}},
+		{"Press any key to continue", false, "continue", []string{"\n"}},
+		{"press r to restart, q to quit", false, "key", []string{"r", "q"}},
+		{"Password for admin: ", true, "secret", nil},
+		{"Please enter your name:", false, "input", nil},
+		{">>> ", true, "input", nil},
+		{"Compiling: ", true, "input", nil},
+		{"Compiling: ", false, "", nil},
+		{"server listening on :8080", false, "", nil},
+		{"   ", true, "", nil},
+	}
+
+	for _, tt := range tests {
+		prompt := detectPrompt(tt.line, tt.partial)
+		if tt.kind == "" {
+			if prompt != nil {
+				t.Errorf("detectPrompt(%q, %t) = %s prompt, want none", tt.line, tt.partial, prompt.Kind)
+			}
+			continue
+		}
+		if prompt == nil {
+			t.Errorf("detectPrompt(%q, %t) = nil, want %s prompt", tt.line, tt.partial, tt.kind)
+			continue
+		}
+		if prompt.Kind != tt.kind || !reflect.DeepEqual(prompt.Keys, tt.keys) {
+			t.Errorf("detectPrompt(%q, %t) = %s %q, want %s %q", tt.line, tt.partial, prompt.Kind, prompt.Keys, tt.kind, tt.keys)
+		}
+	}
+}
+
+func TestPartialPromptWaitsForQuietOutput(t *testing.T) {
+	pm := &ProcessMonitor{errorStream: make(chan StreamError, 10)}
+	process := &MonitoredProcess{ID: "p-test", exited: make(chan struct{})}
+	recorder := &rawOutputRecorder{monitor: pm, process: process, source: "stdout"}
+
+	pendingPrompt := func() *InputPrompt {
+		process.mutex.RLock()
+		defer process.mutex.RUnlock()
+		return process.Prompt
+	}
+
+	// Output that continues within the quiet period is not a prompt
+	recorder.scanForPrompts([]byte("Compiling: "))
+	time.Sleep(promptQuietPeriod / 3)
+	recorder.scanForPrompts([]byte("done\n"))
+	time.Sleep(promptQuietPeriod * 2)
+	if prompt := pendingPrompt(); prompt != nil {
+		t.Fatalf("got prompt %q for a line that was completed", prompt.Text)
+	}
+
+	// Output that stops at a prompt is reported once it has been quiet
+	recorder.scanForPrompts([]byte("Name: "))
+	if prompt := pendingPrompt(); prompt != nil {
+		t.Fatalf("prompt %q reported before the quiet period", prompt.Text)
+	}
+	time.Sleep(promptQuietPeriod * 2)
+	if prompt := pendingPrompt(); prompt == nil || prompt.Text != "Name:" {
+		t.Fatalf("got prompt %v after the quiet period, want Name:", prompt)
+	}
+	if len(pm.errorStream) != 1 {
+		t.Errorf("emitted %d input_required events, want 1", len(pm.errorStream))
+	}
+}
+
+func TestAwaitingSecret(t *testing.T) {
+	tests := []struct {
+		name   string
+		output []string
+		prompt *InputPrompt
+		want   bool
+	}{
+		{"reported secret prompt", nil, &InputPrompt{Kind: "secret"}, true},
+		{"password prompt in quiet period", []string{"Connecting\n", "Password for ", "admin: "}, nil, true},
+		{"other prompt", []string{"Name: "}, &InputPrompt{Kind: "input"}, false},
+		{"answered password prompt", []string{"Password: \n", "logged in\n"}, nil, false},
+		{"no output", nil, nil, false},
+	}
+
+	for _, tt := range tests {
+		process := &MonitoredProcess{Prompt: tt.prompt}
+		for _, data := range tt.output {
+			process.rawOutput = append(process.rawOutput, OutputChunk{Data: data})
+		}
+		if got := process.awaitingSecret(); got != tt.want {
+			t.Errorf("%s: awaitingSecret() = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSecretPromptAnsweredByLineEnd(t *testing.T) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	defer writer.Close()
+	go io.Copy(io.Discard, reader)
+
+	process := &MonitoredProcess{
+		ID:     "p-secret",
+		Prompt: &InputPrompt{Kind: "secret", Text: "Password:"},
+		stdin:  writer,
+		exited: make(chan struct{}),
+	}
+	pm := &ProcessMonitor{activeProcesses: map[string]*MonitoredProcess{process.ID: process}}
+
+	for _, key := range []string{"h", "u", "n", "t", "e", "r", "2"} {
+		if _, err := pm.WriteProcessInput(process.ID, key); err != nil {
+			t.Fatal(err)
+		}
+		if process.Prompt == nil {
+			t.Fatalf("secret prompt cleared after typing %q", key)
+		}
+	}
+	if _, err := pm.WriteProcessInput(process.ID, "\r"); err != nil {
+		t.Fatal(err)
+	}
+	if process.Prompt != nil {
+		t.Error("secret prompt still pending after the line end")
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"os/exec"
+	"time"
+)
+
+// RestartEvent records one automatic restart of a supervised process
+type RestartEvent struct {
+	Attempt     int       `json:"attempt"`
+	Timestamp   time.Time `json:"timestamp"`
+	PreviousPID int       `json:"previous_pid"`
+	NewPID      int       `json:"new_pid,omitempty"`
+	ExitCode    int       `json:"exit_code"`
+	DelayMs     int64     `json:"delay_ms"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// maxExitCodeHistory bounds the exit codes kept per supervised process
+const maxExitCodeHistory = 10
+
+// maxStderrTail bounds the stderr lines kept for crash reports
+const maxStderrTail = 20
+
+// errStopRequested refuses a restart of a process that is being stopped
+var errStopRequested = errors.New("process was stopped")
+
+// outputDrainTimeout bounds the wait for a run's last output after it exits,
+// since descendants that outlive it may keep the pipes open
+const outputDrainTimeout = 2 * time.Second
+
+// exitCodeOf extracts the exit code from a Wait error; -1 means killed by a signal
+func exitCodeOf(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+// restartBackoff returns the delay before the given restart attempt (1-based):
+// exponential from the initial delay, capped, with ±20% jitter
+func restartBackoff(attempt int, initial, max time.Duration) time.Duration {
+	// Capped before converting, since huge floats do not fit a Duration
+	exponential := float64(initial) * math.Pow(2, float64(attempt-1))
+	delay := max
+	if exponential > 0 && exponential < float64(max) {
+		delay = time.Duration(exponential)
+	}
+
+	jitter := (rand.Float64()*0.4 - 0.2) * float64(delay)
+	return delay + time.Duration(jitter)
+}
+
+// recentRestarts counts restarts inside the supervision window
+func recentRestarts(restarts []RestartEvent, window time.Duration) int {
+	cutoff := time.Now().Add(-window)
+	count := 0
+	for _, restart := range restarts {
+		if restart.Timestamp.After(cutoff) {
+			count++
+		}
+	}
+	return count
+}
+
+// superviseExit decides what happens after a process with AutoRestart exits
+// with a failure: a delayed restart, or giving up with a crash_loop status
+func (pm *ProcessMonitor) superviseExit(process *MonitoredProcess, exitCode int) {
+	process.mutex.Lock()
+	process.restartPending = false // The status says what happens next
+	attempt := recentRestarts(process.Restarts, pm.config.RestartWindow) + 1
+	if attempt > pm.config.RestartMaxCount {
+		process.Status = "crash_loop"
+		process.StderrTail = append([]string{}, process.stderrTail...)
+		exitCodes := append([]int{}, process.ExitCodes...)
+		process.mutex.Unlock()
+
+		log.Printf("Process PID %d is crash looping (%d restarts within %v), giving up",
+			process.PID, pm.config.RestartMaxCount, pm.config.RestartWindow)
+
+		pm.emitStreamError(StreamError{
+			ProcessID:  process.ID,
+			ProcessPID: process.PID,
+			Command:    process.Command,
+			ErrorType:  "crash_loop",
+			Message: fmt.Sprintf("%s crashed %d times within %v, last exit codes %v",
+				process.Command, attempt, pm.config.RestartWindow, exitCodes),
+			Timestamp: time.Now(),
+			Severity:  "error",
+			Context:   append([]string{}, process.StderrTail...),
+			Source:    "supervisor",
+		})
+		return
+	}
+
+	delay := restartBackoff(attempt, pm.config.RestartInitialDelay, pm.config.RestartMaxDelay)
+	process.Status = "restarting"
+	next := time.Now().Add(delay)
+	process.NextRestart = &next
+	process.mutex.Unlock()
+
+	log.Printf("Restarting process PID %d in %v (attempt %d/%d)", process.PID, delay.Round(time.Millisecond), attempt, pm.config.RestartMaxCount)
+
+	select {
+	case <-pm.ctx.Done():
+		return
+	case <-process.stopRequested:
+		return
+	case <-time.After(delay):
+	}
+
+	// Orphaned grandchildren of the crashed process would hold on to its ports
+	pm.terminateProcessTree(process, pm.config.StopGracePeriod)
+
+	// A stop may have arrived while the old tree was terminated
+	process.mutex.RLock()
+	stopped := process.stopIsRequested()
+	process.mutex.RUnlock()
+	if stopped {
+		return
+	}
+
+	event := RestartEvent{
+		Attempt:     attempt,
+		Timestamp:   time.Now(),
+		PreviousPID: process.PID,
+		ExitCode:    exitCode,
+		DelayMs:     delay.Milliseconds(),
+	}
+
+	restarted, err := pm.spawnProcess(process.spec, process, event)
+	if errors.Is(err, errStopRequested) {
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to restart %s: %v", process.Command, err)
+
+		// A failed start counts as another crash of the same process
+		process.mutex.Lock()
+		event.Error = err.Error()
+		process.Restarts = append(process.Restarts, event)
+		process.RestartCount++
+		process.NextRestart = nil
+		process.mutex.Unlock()
+
+		pm.superviseExit(process, exitCode)
+		return
+	}
+
+	log.Printf("Restarted %s (%s): PID %d -> %d", process.Command, process.ID, process.PID, restarted.PID)
+}
+
+// requestStop keeps the supervisor from restarting a process. It holds
+// pm.mutex, which spawnProcess also holds when it registers a restart, so
+// a restart is either registered before the request or refused.
+func (pm *ProcessMonitor) requestStop(process *MonitoredProcess) {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+
+	if !process.stopIsRequested() {
+		close(process.stopRequested)
+	}
+}
+
+// stopIsRequested reports whether the process was asked to stop
+func (p *MonitoredProcess) stopIsRequested() bool {
+	select {
+	case <-p.stopRequested:
+		return true
+	default:
+		return false
+	}
+}
+
+// ended reports whether a process run is over for good: exited and not
+// about to be restarted. The caller holds process.mutex.
+func (p *MonitoredProcess) ended() bool {
+	switch p.Status {
+	case "stopped", "error", "timeout", "oom_killed", "pids_limit", "cpu_time":
+		return true
+	}
+	return false
+}
+
+// emitStreamError queues an error without blocking the caller; when the
+// stream is full the oldest queued error is dropped instead
+func (pm *ProcessMonitor) emitStreamError(streamError StreamError) {
+	select {
+	case pm.errorStream <- streamError:
+		return
+	default:
+	}
+
+	pm.handleBufferOverflow(pm.errorStream, streamError)
+}
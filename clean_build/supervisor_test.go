@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestRestartBackoff(t *testing.T) {
+	initial, max := time.Second, 30*time.Second
+
+	tests := []struct {
+		attempt int
+		base    time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{5, 16 * time.Second},
+		{6, max}, // 32s is capped
+		{40, max},
+		{64, max},
+		{1100, max}, // 2^1099 overflows a Duration
+		{100000, max},
+	}
+
+	for _, tt := range tests {
+		low := tt.base - tt.base/5
+		high := tt.base + tt.base/5
+		for i := 0; i < 50; i++ {
+			if got := restartBackoff(tt.attempt, initial, max); got < low || got > high {
+				t.Fatalf("restartBackoff(%d) = %v, want %v ±20%%", tt.attempt, got, tt.base)
+			}
+		}
+	}
+
+	if got := restartBackoff(3, 0, max); got < max-max/5 || got > max+max/5 {
+		t.Errorf("restartBackoff without an initial delay = %v, want the cap", got)
+	}
+}
+
+// newSpawnTestMonitor returns a monitor that may run sleep in a temporary workspace
+func newSpawnTestMonitor(t *testing.T) (*ProcessMonitor, ProcessCommand) {
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("sleep is not installed")
+	}
+	workspace := t.TempDir()
+	config := loadConfig()
+	config.AllowedCommands = []string{"sleep"}
+	config.StopGracePeriod = time.Second
+	pm := NewProcessMonitor(workspace, config)
+	t.Cleanup(pm.cancel)
+
+	return pm, ProcessCommand{Command: "sleep", Args: []string{"30"}, WorkingDir: workspace, Timeout: "0"}
+}
+
+func TestSpawnRefusesRestartAfterStop(t *testing.T) {
+	pm, cmd := newSpawnTestMonitor(t)
+
+	previous, err := pm.spawnProcess(cmd, nil, RestartEvent{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pm.StopProcessWithGrace(previous.ID, time.Second)
+
+	// A stop arrives while the supervisor is starting the next run
+	pm.requestStop(previous)
+	restarted, err := pm.spawnProcess(cmd, previous, RestartEvent{Attempt: 1})
+	if !errors.Is(err, errStopRequested) || restarted != nil {
+		t.Fatalf("restart after a stop request = %v, %v, want errStopRequested", restarted, err)
+	}
+
+	current, err := pm.ResolveProcess(previous.ID)
+	if err != nil || current != previous {
+		t.Errorf("registered run = %v, %v, want the stopped run left in place", current, err)
+	}
+}
+
+func TestStopProcessStopsRegisteredRestart(t *testing.T) {
+	pm, cmd := newSpawnTestMonitor(t)
+
+	previous, err := pm.spawnProcess(cmd, nil, RestartEvent{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm.terminateProcessTree(previous, time.Second)
+
+	// The stop resolved the old run just before the restart was registered
+	restarted, err := pm.spawnProcess(cmd, previous, RestartEvent{Attempt: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pm.stopRun(previous, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-restarted.exited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("restarted run still running after the stop")
+	}
+	if _, err := pm.ResolveProcess(previous.ID); err == nil {
+		t.Error("process still registered after the stop")
+	}
+}
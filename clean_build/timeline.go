@@ -0,0 +1,363 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Timeline sources
+const (
+	timelineOutput    = "output"
+	timelineError     = "error"
+	timelineLifecycle = "lifecycle"
+	timelineFile      = "file"
+	timelineGit       = "git"
+)
+
+var timelineSources = []string{timelineOutput, timelineError, timelineLifecycle, timelineFile, timelineGit}
+
+// maxGitEvents bounds the git events kept for the timeline
+const maxGitEvents = 100
+
+// GitEvent is a change of the repository seen by the git watcher
+type GitEvent struct {
+	Type      string    `json:"type"` // commit, checkout
+	Timestamp time.Time `json:"timestamp"`
+	Branch    string    `json:"branch"`
+	Commit    string    `json:"commit,omitempty"`
+	Message   string    `json:"message"`
+	Author    string    `json:"author,omitempty"`
+}
+
+// TimelineEvent is one entry of the merged timeline. Tag names the process
+// an event belongs to, or "files" and "git" for workspace events.
+type TimelineEvent struct {
+	Timestamp time.Time   `json:"timestamp"`
+	Source    string      `json:"source"` // output, error, lifecycle, file, git
+	Kind      string      `json:"kind"`   // stream, severity, or lifecycle, change or git event type
+	Tag       string      `json:"tag"`
+	ProcessID string      `json:"process_id,omitempty"`
+	PID       int         `json:"pid,omitempty"`
+	Message   string      `json:"message"`
+	Data      interface{} `json:"data,omitempty"` // the original output line, error, run or change
+}
+
+// TimelineQuery filters the timeline; zero values match everything
+type TimelineQuery struct {
+	Since     time.Time
+	Until     time.Time
+	Sources   []string
+	Processes []string // process IDs
+	Grep      *regexp.Regexp
+	Limit     int // most recent events kept
+}
+
+// TimelinePage is the result of a timeline query, oldest event first
+type TimelinePage struct {
+	Events  []TimelineEvent `json:"events"`
+	Count   int             `json:"count"`
+	HasMore bool            `json:"has_more"` // older matching events were left out
+}
+
+// recordGitEvents compares a new git status with the previous one and keeps
+// the commits and branch switches in between; the caller holds gw.mutex
+func (gw *GitWatcher) recordGitEvents(status *GitStatus, head string) {
+	previous := gw.status
+	previousHead := gw.head
+	gw.head = head
+
+	if previous == nil {
+		// The commit checked out when watching starts anchors the timeline
+		if head != "" {
+			gw.addEvent(GitEvent{
+				Type:      "commit",
+				Timestamp: status.LastCommitTime,
+				Branch:    status.Branch,
+				Commit:    status.CommitHash,
+				Message:   status.CommitMessage,
+			})
+		}
+		return
+	}
+
+	if previous.Branch != status.Branch {
+		gw.addEvent(GitEvent{
+			Type:      "checkout",
+			Timestamp: time.Now(),
+			Branch:    status.Branch,
+			Commit:    status.CommitHash,
+			Message:   fmt.Sprintf("switched from %s to %s", previous.Branch, status.Branch),
+		})
+	}
+
+	if head == "" || head == previousHead {
+		return
+	}
+
+	commits := gw.commitsBetween(previousHead, head)
+	if len(commits) == 0 {
+		// Rewritten history has no range to list; record where HEAD is now
+		commits = []GitEvent{{
+			Type:      "commit",
+			Timestamp: status.LastCommitTime,
+			Commit:    status.CommitHash,
+			Message:   status.CommitMessage,
+		}}
+	}
+	for _, commit := range commits {
+		commit.Branch = status.Branch
+		gw.addEvent(commit)
+	}
+}
+
+// commitsBetween lists the commits reachable from head but not from base,
+// oldest first
+func (gw *GitWatcher) commitsBetween(base, head string) []GitEvent {
+	if base == "" {
+		return nil
+	}
+
+	cmd := exec.Command("git", "log", "--reverse", "--max-count=50", "--pretty=format:%H|%ct|%an|%s", base+".."+head)
+	cmd.Dir = gw.workspace
+	output, err := cmd.Output()
+	if err != nil {
+		return nil
+	}
+
+	commits := []GitEvent{}
+	for _, line := range strings.Split(string(output), "\n") {
+		parts := strings.SplitN(line, "|", 4)
+		if len(parts) < 4 || len(parts[0]) < 8 {
+			continue
+		}
+		timestamp, _ := strconv.ParseInt(parts[1], 10, 64)
+		commits = append(commits, GitEvent{
+			Type:      "commit",
+			Timestamp: time.Unix(timestamp, 0),
+			Commit:    parts[0][:8],
+			Author:    parts[2],
+			Message:   parts[3],
+		})
+	}
+	return commits
+}
+
+func (gw *GitWatcher) addEvent(event GitEvent) {
+	gw.events = append(gw.events, event)
+	if len(gw.events) > maxGitEvents {
+		gw.events = gw.events[len(gw.events)-maxGitEvents:]
+	}
+}
+
+// getEvents returns the recorded git events
+func (gw *GitWatcher) getEvents() []GitEvent {
+	gw.mutex.RLock()
+	defer gw.mutex.RUnlock()
+
+	return append([]GitEvent{}, gw.events...)
+}
+
+// wants reports whether the query includes a source
+func (query TimelineQuery) wants(source string) bool {
+	return len(query.Sources) == 0 || containsString(query.Sources, source)
+}
+
+// matches applies the time, process and grep filters to an event
+func (query TimelineQuery) matches(event *TimelineEvent) bool {
+	if !query.Since.IsZero() && event.Timestamp.Before(query.Since) {
+		return false
+	}
+	if !query.Until.IsZero() && event.Timestamp.After(query.Until) {
+		return false
+	}
+	if len(query.Processes) > 0 && !containsString(query.Processes, event.ProcessID) {
+		return false
+	}
+	if query.Grep != nil && !query.Grep.MatchString(event.Message) {
+		return false
+	}
+	return true
+}
+
+// processTag is how a process is labelled in the timeline
+func processTag(process *MonitoredProcess) string {
+	if process.Name != "" {
+		return process.Name
+	}
+	return process.ID
+}
+
+// processTimelineEvents collects the output and lifecycle events of the
+// monitored processes from their in-memory buffers
+func (pi *ProjectIntelligence) processTimelineEvents(query TimelineQuery, add func(TimelineEvent)) {
+	for _, process := range pi.processMonitor.GetMonitoredProcesses() {
+		process.mutex.RLock()
+		tag := processTag(process)
+
+		if query.wants(timelineOutput) {
+			for _, line := range process.outputHistory {
+				add(TimelineEvent{
+					Timestamp: line.Timestamp,
+					Source:    timelineOutput,
+					Kind:      line.Stream,
+					Tag:       tag,
+					ProcessID: process.ID,
+					PID:       process.PID,
+					Message:   line.Line,
+					Data:      line,
+				})
+			}
+		}
+
+		if query.wants(timelineLifecycle) {
+			for i, run := range process.Runs {
+				add(TimelineEvent{
+					Timestamp: run.StartTime,
+					Source:    timelineLifecycle,
+					Kind:      "start",
+					Tag:       tag,
+					ProcessID: process.ID,
+					PID:       run.PID,
+					Message:   fmt.Sprintf("started %s (PID %d)", strings.Join(append([]string{process.Command}, process.Args...), " "), run.PID),
+					Data:      run,
+				})
+				if run.EndTime == nil || run.ExitCode == nil {
+					continue
+				}
+
+				message := fmt.Sprintf("exited with code %d", *run.ExitCode)
+				if i == len(process.Runs)-1 && process.Status != "stopped" && process.Status != "error" {
+					message += " (" + process.Status + ")"
+				}
+				add(TimelineEvent{
+					Timestamp: *run.EndTime,
+					Source:    timelineLifecycle,
+					Kind:      "exit",
+					Tag:       tag,
+					ProcessID: process.ID,
+					PID:       run.PID,
+					Message:   message,
+					Data:      run,
+				})
+			}
+
+			for _, restart := range process.Restarts {
+				add(TimelineEvent{
+					Timestamp: restart.Timestamp,
+					Source:    timelineLifecycle,
+					Kind:      "restart",
+					Tag:       tag,
+					ProcessID: process.ID,
+					PID:       restart.NewPID,
+					Message:   fmt.Sprintf("restart attempt %d after exit code %d", restart.Attempt, restart.ExitCode),
+					Data:      restart,
+				})
+			}
+		}
+		process.mutex.RUnlock()
+	}
+}
+
+// Timeline merges process output, errors, lifecycle events, file changes
+// and git events into one chronologically ordered stream
+func (pi *ProjectIntelligence) Timeline(query TimelineQuery) TimelinePage {
+	events := []TimelineEvent{}
+	add := func(event TimelineEvent) {
+		if query.matches(&event) {
+			events = append(events, event)
+		}
+	}
+
+	pi.processTimelineEvents(query, add)
+
+	if query.wants(timelineError) {
+		// The error history outlives the processes that reported it
+		tags := make(map[string]string)
+		for _, process := range pi.processMonitor.GetMonitoredProcesses() {
+			process.mutex.RLock()
+			tags[process.ID] = processTag(process)
+			process.mutex.RUnlock()
+		}
+
+		errorQuery := ErrorQuery{Since: query.Since, Until: query.Until, Grep: query.Grep, Newest: true, Limit: query.Limit}
+		if len(query.Processes) == 1 {
+			errorQuery.ProcessID = query.Processes[0]
+		}
+		page := pi.processMonitor.QueryErrors(errorQuery)
+		// The page is newest first; adding it oldest first keeps errors with
+		// equal timestamps in the order they were reported
+		for i := len(page.Errors) - 1; i >= 0; i-- {
+			streamError := page.Errors[i]
+			tag := tags[streamError.ProcessID]
+			if tag == "" {
+				tag = streamError.ProcessID
+			}
+			add(TimelineEvent{
+				Timestamp: streamError.Timestamp,
+				Source:    timelineError,
+				Kind:      streamError.Severity,
+				Tag:       tag,
+				ProcessID: streamError.ProcessID,
+				PID:       streamError.ProcessPID,
+				Message:   streamError.Message,
+				Data:      streamError,
+			})
+		}
+	}
+
+	// Workspace events belong to no process
+	if len(query.Processes) == 0 {
+		if query.wants(timelineFile) {
+			for _, change := range pi.fileWatcher.getChangesSince(time.Time{}) {
+				path := change.Path
+				if rel, err := filepath.Rel(pi.workspace, path); err == nil {
+					path = rel
+				}
+				if strings.HasPrefix(path, ".") {
+					continue // Inside .git or Argus's own .argus state
+				}
+				add(TimelineEvent{
+					Timestamp: change.Timestamp,
+					Source:    timelineFile,
+					Kind:      change.Type,
+					Tag:       "files",
+					Message:   fmt.Sprintf("%s %s", change.Type, path),
+					Data:      change,
+				})
+			}
+		}
+
+		if query.wants(timelineGit) {
+			for _, event := range pi.gitWatcher.getEvents() {
+				message := event.Message
+				if event.Type == "commit" {
+					message = fmt.Sprintf("commit %s on %s: %s", event.Commit, event.Branch, event.Message)
+				}
+				add(TimelineEvent{
+					Timestamp: event.Timestamp,
+					Source:    timelineGit,
+					Kind:      event.Type,
+					Tag:       "git",
+					Message:   message,
+					Data:      event,
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Timestamp.Before(events[j].Timestamp) })
+
+	page := TimelinePage{Events: events}
+	if query.Limit > 0 && len(events) > query.Limit {
+		page.Events = events[len(events)-query.Limit:]
+		page.HasMore = true
+	}
+	page.Count = len(page.Events)
+	return page
+}
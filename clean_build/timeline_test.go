@@ -0,0 +1,151 @@
+package main
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// newTimelineTestIntelligence returns a project with one process, errors,
+// file changes and git events at the given seconds after base
+func newTimelineTestIntelligence(t *testing.T, base time.Time) *ProjectIntelligence {
+	t.Helper()
+	at := func(seconds int) time.Time { return base.Add(time.Duration(seconds) * time.Second) }
+	exitCode := 1
+	end := at(8)
+
+	process := &MonitoredProcess{
+		ID:      "p-1",
+		Name:    "web",
+		Command: "node",
+		Args:    []string{"server.js"},
+		Status:  "restarting",
+		outputHistory: []OutputLine{
+			{Seq: 1, Stream: "stdout", Timestamp: at(2), Line: "listening"},
+			{Seq: 2, Stream: "stderr", Timestamp: at(5), Line: "TypeError: boom"},
+		},
+		Runs:     []ProcessRun{{PID: 10, StartTime: at(1), EndTime: &end, ExitCode: &exitCode}},
+		Restarts: []RestartEvent{{Attempt: 1, Timestamp: at(9), PreviousPID: 10, ExitCode: 1}},
+	}
+
+	workspace := t.TempDir()
+	pm := &ProcessMonitor{
+		activeProcesses: map[string]*MonitoredProcess{process.ID: process},
+		errors:          NewErrorStore("", 100),
+	}
+	// Reported in this order; the two at 5s share a timestamp
+	pm.errors.Add(StreamError{ProcessID: "p-1", ProcessPID: 10, Severity: "error", Message: "TypeError: boom", Timestamp: at(5)})
+	pm.errors.Add(StreamError{ProcessID: "p-1", ProcessPID: 10, Severity: "warning", Message: "retrying", Timestamp: at(5)})
+	pm.errors.Add(StreamError{ProcessID: "p-gone", Severity: "error", Message: "from a cleaned up process", Timestamp: at(3)})
+
+	return &ProjectIntelligence{
+		workspace:      workspace,
+		processMonitor: pm,
+		fileWatcher: &FileWatcher{workspace: workspace, changes: []FileChange{
+			{Path: workspace + "/server.js", Type: "modified", Timestamp: at(4)},
+			{Path: workspace + "/.git/index", Type: "modified", Timestamp: at(4)},
+		}},
+		gitWatcher: &GitWatcher{events: []GitEvent{
+			{Type: "commit", Timestamp: at(0), Branch: "main", Commit: "abcd1234", Message: "initial"},
+			{Type: "checkout", Timestamp: at(7), Branch: "fix", Message: "switched from main to fix"},
+		}},
+	}
+}
+
+// timelineSummary lists the source and message of each event
+func timelineSummary(page TimelinePage) []string {
+	summary := []string{}
+	for _, event := range page.Events {
+		summary = append(summary, event.Source+": "+event.Message)
+	}
+	return summary
+}
+
+func TestTimelineMergeOrder(t *testing.T) {
+	pi := newTimelineTestIntelligence(t, time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+
+	page := pi.Timeline(TimelineQuery{})
+	want := []string{
+		"git: commit abcd1234 on main: initial",
+		"lifecycle: started node server.js (PID 10)",
+		"output: listening",
+		"error: from a cleaned up process",
+		"file: modified server.js",
+		// Equal timestamps keep output before errors, and errors in the order reported
+		"output: TypeError: boom",
+		"error: TypeError: boom",
+		"error: retrying",
+		"git: switched from main to fix",
+		"lifecycle: exited with code 1 (restarting)",
+		"lifecycle: restart attempt 1 after exit code 1",
+	}
+	if got := timelineSummary(page); !reflect.DeepEqual(got, want) {
+		t.Errorf("timeline =\n%q\nwant\n%q", got, want)
+	}
+	if page.Count != len(want) || page.HasMore {
+		t.Errorf("count %d, has more %t", page.Count, page.HasMore)
+	}
+
+	tags := map[string]string{}
+	for _, event := range page.Events {
+		tags[event.Message] = event.Tag
+	}
+	if tags["retrying"] != "web" || tags["from a cleaned up process"] != "p-gone" || tags["modified server.js"] != "files" {
+		t.Errorf("tags = %v", tags)
+	}
+}
+
+func TestTimelineFilters(t *testing.T) {
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	pi := newTimelineTestIntelligence(t, base)
+
+	tests := []struct {
+		name  string
+		query TimelineQuery
+		want  []string
+	}{
+		{"sources", TimelineQuery{Sources: []string{timelineGit, timelineFile}}, []string{
+			"git: commit abcd1234 on main: initial",
+			"file: modified server.js",
+			"git: switched from main to fix",
+		}},
+		{"process", TimelineQuery{Processes: []string{"p-1"}, Sources: []string{timelineError, timelineLifecycle}}, []string{
+			"lifecycle: started node server.js (PID 10)",
+			"error: TypeError: boom",
+			"error: retrying",
+			"lifecycle: exited with code 1 (restarting)",
+			"lifecycle: restart attempt 1 after exit code 1",
+		}},
+		{"time range", TimelineQuery{Since: base.Add(4 * time.Second), Until: base.Add(5 * time.Second)}, []string{
+			"file: modified server.js",
+			"output: TypeError: boom",
+			"error: TypeError: boom",
+			"error: retrying",
+		}},
+		{"grep", TimelineQuery{Grep: regexp.MustCompile(`boom`)}, []string{
+			"output: TypeError: boom",
+			"error: TypeError: boom",
+		}},
+	}
+
+	for _, tt := range tests {
+		if got := timelineSummary(pi.Timeline(tt.query)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: timeline =\n%q\nwant\n%q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTimelineLimitKeepsNewest(t *testing.T) {
+	pi := newTimelineTestIntelligence(t, time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+
+	page := pi.Timeline(TimelineQuery{Limit: 3})
+	want := []string{
+		"git: switched from main to fix",
+		"lifecycle: exited with code 1 (restarting)",
+		"lifecycle: restart attempt 1 after exit code 1",
+	}
+	if got := timelineSummary(page); !reflect.DeepEqual(got, want) || !page.HasMore || page.Count != 3 {
+		t.Errorf("limited timeline = %q, has more %t, want %q", got, page.HasMore, want)
+	}
+}